@@ -2,6 +2,7 @@
 
 # Get version from VERSION file
 $VERSION = (Get-Content VERSION).Trim()
+$VERSION_FLAG = "github.com/cortex-x/go-thai-id-card-reader/internal/version.Version"
 
 # Set output directory
 $OUTPUT_DIR = "dist"
@@ -14,17 +15,27 @@ if (!(Test-Path $OUTPUT_DIR)) {
 Write-Host "Building Thai ID Card Reader v$VERSION"
 Write-Host "================================================"
 
-# Build for Windows (amd64)
-Write-Host "Building for Windows (amd64)..."
+# Windows builds need no cgo, so each is a single self-contained executable
+# with the web assets and default configuration embedded
 $env:GOOS = "windows"
-$env:GOARCH = "amd64"
-go build -ldflags="-s -w -X main.Version=$VERSION" `
-    -o "$OUTPUT_DIR\thai-id-card-reader-$VERSION.exe" `
-    .\cmd\card-service
+$env:CGO_ENABLED = "0"
+
+foreach ($arch in @("amd64", "arm64")) {
+    Write-Host "Building for Windows ($arch)..."
+    $env:GOARCH = $arch
+    $suffix = if ($arch -eq "amd64") { "" } else { "-$arch" }
+    go build -trimpath -ldflags="-s -w -X $VERSION_FLAG=$VERSION" `
+        -o "$OUTPUT_DIR\thai-id-card-reader-$VERSION$suffix.exe" `
+        .\cmd\card-service
+    go build -trimpath -ldflags="-s -w -X $VERSION_FLAG=$VERSION" `
+        -o "$OUTPUT_DIR\card-cli-$VERSION$suffix.exe" `
+        .\cmd\card-cli
+}
 
 # Reset environment variables
 $env:GOOS = ""
 $env:GOARCH = ""
+$env:CGO_ENABLED = ""
 
 Write-Host ""
 Write-Host "Build complete! Files are in the $OUTPUT_DIR directory:"
@@ -0,0 +1,37 @@
+#!/bin/sh
+# Build script for Linux and macOS. PC/SC is reached through cgo
+# (libpcsclite on Linux, the PCSC framework on macOS), so each binary is
+# built natively on the platform it targets, or cross-compiled with a C
+# cross compiler, e.g. for a Raspberry Pi:
+#
+#   CGO_ENABLED=1 CC=arm-linux-gnueabihf-gcc GOOS=linux GOARCH=arm GOARM=6 ./build.sh
+#   CGO_ENABLED=1 CC=aarch64-linux-gnu-gcc GOOS=linux GOARCH=arm64 ./build.sh
+#
+# Everything else, including the web assets, is embedded in the executable.
+set -e
+
+VERSION=$(tr -d '[:space:]' < VERSION)
+VERSION_FLAG=github.com/cortex-x/go-thai-id-card-reader/internal/version.Version
+OUTPUT_DIR=dist
+OS=$(go env GOOS)
+ARCH=$(go env GOARCH)
+# Raspberry Pi Zero/1 need GOARM=6; name those builds armv6 and so on
+if [ "$ARCH" = "arm" ]; then
+    ARCH="armv$(go env GOARM)"
+fi
+
+mkdir -p "$OUTPUT_DIR"
+
+echo "Building Thai ID Card Reader v$VERSION for $OS ($ARCH)"
+echo "================================================"
+
+go build -trimpath -ldflags="-s -w -X $VERSION_FLAG=$VERSION" \
+    -o "$OUTPUT_DIR/thai-id-card-reader-$VERSION-$OS-$ARCH" \
+    ./cmd/card-service
+go build -trimpath -ldflags="-s -w -X $VERSION_FLAG=$VERSION" \
+    -o "$OUTPUT_DIR/card-cli-$VERSION-$OS-$ARCH" \
+    ./cmd/card-cli
+
+echo ""
+echo "Build complete! Files are in the $OUTPUT_DIR directory:"
+ls -l "$OUTPUT_DIR"/*-"$VERSION"-"$OS"-"$ARCH"
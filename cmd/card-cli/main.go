@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/config"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/diag"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/infra/smartcard"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/keychain"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command>\n\nCommands:\n  selftest                Check the smart card stack and print a JSON report\n  diag                    Write a diagnostics bundle (zip) for support\n  secret set <name>       Store a secret read from stdin in the OS credential store\n  secret delete <name>    Remove a secret from the OS credential store\n", os.Args[0])
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "selftest":
+		os.Exit(selfTest(os.Args[2:]))
+	case "diag":
+		os.Exit(diagnostics(os.Args[2:]))
+	case "secret":
+		os.Exit(secret(os.Args[2:]))
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+// selfTest prints the self-test report and returns the exit code: 0 if every
+// check passed, 1 otherwise.
+func selfTest(args []string) int {
+	flags := flag.NewFlagSet("selftest", flag.ExitOnError)
+	var opts config.LoadOptions
+	flags.StringVar(&opts.File, "config", "", "config file to use (.yaml, .toml or .json)")
+	flags.StringVar(&opts.Profile, "profile", "", "configuration profile to apply")
+	_ = flags.Parse(args)
+
+	cfg, err := config.Load(opts)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	var report domain.SelfTestReport
+	reader, err := smartcard.NewPCSCReader(cfg)
+	if err != nil {
+		failed := domain.NewSelfTestReport()
+		failed.Add("context", time.Now(), err, "")
+		report = *failed
+	} else {
+		report = reader.SelfTest()
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(report)
+
+	if !report.Passed {
+		return 1
+	}
+	return 0
+}
+
+// diagnostics writes the diagnostics bundle support asks for. Run it while
+// the service is stopped if the reader is in use; the service itself serves
+// the same bundle, with its recent log, at GET /admin/diagnostics.
+func diagnostics(args []string) int {
+	flags := flag.NewFlagSet("diag", flag.ExitOnError)
+	var opts config.LoadOptions
+	flags.StringVar(&opts.File, "config", "", "config file to use (.yaml, .toml or .json)")
+	flags.StringVar(&opts.Profile, "profile", "", "configuration profile to apply")
+	output := flags.String("o", "", "file to write, thai-id-diagnostics-<time>.zip by default")
+	_ = flags.Parse(args)
+
+	cfg, err := config.Load(opts)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	bundle := diag.New(cfg)
+	reader, err := smartcard.NewPCSCReader(cfg)
+	if err != nil {
+		bundle.PCSC = domain.PCSCInfo{Error: err.Error()}
+		report := domain.NewSelfTestReport()
+		report.Add("context", time.Now(), err, "")
+		bundle.SelfTest = *report
+	} else {
+		bundle.PCSC = reader.PCSCInfo()
+		bundle.SelfTest = reader.SelfTest()
+	}
+
+	path := *output
+	if path == "" {
+		path = bundle.FileName()
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create %s: %v\n", path, err)
+		return 1
+	}
+	if err := bundle.Write(f); err != nil {
+		f.Close()
+		fmt.Fprintf(os.Stderr, "Failed to write %s: %v\n", path, err)
+		return 1
+	}
+	if err := f.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write %s: %v\n", path, err)
+		return 1
+	}
+
+	fmt.Printf("Wrote %s\n", path)
+	return 0
+}
+
+// secret manages the OS credential store entries that "keychain:<name>"
+// settings refer to. The secret is read from stdin so it stays out of the
+// shell history.
+func secret(args []string) int {
+	if len(args) != 2 || (args[0] != "set" && args[0] != "delete") {
+		usage()
+		return 2
+	}
+	name := args[1]
+
+	if args[0] == "delete" {
+		if err := keychain.Delete(name); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to delete %s: %v\n", name, err)
+			return 1
+		}
+		fmt.Printf("Deleted %s\n", name)
+		return 0
+	}
+
+	fmt.Fprintf(os.Stderr, "Enter the secret for %s: ", name)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		fmt.Fprintf(os.Stderr, "Failed to read the secret: %v\n", err)
+		return 1
+	}
+	value := strings.TrimRight(line, "\r\n")
+	if value == "" {
+		fmt.Fprintln(os.Stderr, "The secret is empty")
+		return 1
+	}
+
+	if err := keychain.Set(name, value); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to store %s: %v\n", name, err)
+		return 1
+	}
+	fmt.Printf("Stored %s; use \"keychain:%s\" in the configuration\n", name, name)
+	return 0
+}
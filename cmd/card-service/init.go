@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/config"
+)
+
+// runInit implements `card-service init`: it writes a commented default
+// configuration file, asking for the common settings with -i.
+func runInit(args []string) int {
+	flags := flag.NewFlagSet("init", flag.ExitOnError)
+	path := flags.String("o", filepath.Join("configs", "config.yaml"), "file to write")
+	interactive := flags.Bool("i", false, "ask for the port, photo and allowed origins")
+	force := flags.Bool("force", false, "overwrite an existing file")
+	_ = flags.Parse(args)
+
+	if _, err := os.Stat(*path); err == nil && !*force {
+		fmt.Fprintf(os.Stderr, "%s already exists; use -force to overwrite it\n", *path)
+		return 1
+	}
+
+	opts := config.DefaultInitOptions()
+	if *interactive {
+		if err := askInitOptions(os.Stdin, os.Stdout, &opts); err != nil {
+			fmt.Fprintf(os.Stderr, "init: %v\n", err)
+			return 1
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := config.WriteDefault(&buf, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "init: %v\n", err)
+		return 1
+	}
+	if err := os.MkdirAll(filepath.Dir(*path), 0o755); err != nil {
+		fmt.Fprintf(os.Stderr, "init: %v\n", err)
+		return 1
+	}
+	if err := os.WriteFile(*path, buf.Bytes(), 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "init: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Wrote %s\n", *path)
+	return 0
+}
+
+// askInitOptions prompts for each init setting, keeping the default shown in
+// brackets when the answer is empty.
+func askInitOptions(in io.Reader, out io.Writer, opts *config.InitOptions) error {
+	scanner := bufio.NewScanner(in)
+	ask := func(question, def string) (string, error) {
+		fmt.Fprintf(out, "%s [%s]: ", question, def)
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return "", err
+			}
+			return "", errors.New("no answer")
+		}
+		if answer := strings.TrimSpace(scanner.Text()); answer != "" {
+			return answer, nil
+		}
+		return def, nil
+	}
+
+	for {
+		answer, err := ask("Port", strconv.Itoa(opts.Port))
+		if err != nil {
+			return err
+		}
+		port, err := strconv.Atoi(answer)
+		if err == nil && port >= 1 && port <= 65535 {
+			opts.Port = port
+			break
+		}
+		fmt.Fprintln(out, "Enter a number between 1 and 65535.")
+	}
+
+	for {
+		def := "y"
+		if !opts.PhotoEnabled {
+			def = "n"
+		}
+		answer, err := ask("Read the card photo? (y/n)", def)
+		if err != nil {
+			return err
+		}
+		if answer = strings.ToLower(answer); answer == "y" || answer == "n" {
+			opts.PhotoEnabled = answer == "y"
+			break
+		}
+		fmt.Fprintln(out, "Answer y or n.")
+	}
+
+	answer, err := ask("Allowed web origins, comma separated", strings.Join(opts.AllowedOrigins, ","))
+	if err != nil {
+		return err
+	}
+	opts.AllowedOrigins = nil
+	for _, origin := range strings.Split(answer, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			opts.AllowedOrigins = append(opts.AllowedOrigins, origin)
+		}
+	}
+
+	return nil
+}
@@ -2,108 +2,185 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/cortex-x/go-thai-id-card-reader/internal/api"
 	"github.com/cortex-x/go-thai-id-card-reader/internal/config"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/crash"
 	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/infra/fleet"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/infra/remote"
 	"github.com/cortex-x/go-thai-id-card-reader/internal/infra/smartcard"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/infra/store"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/infra/usb"
 	"github.com/cortex-x/go-thai-id-card-reader/internal/infra/websocket"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/logging"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/version"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "init" {
+		os.Exit(runInit(os.Args[2:]))
+	}
+
+	var opts config.LoadOptions
+	flag.StringVar(&opts.File, "config", "", "config file to use (.yaml, .toml or .json)")
+	flag.StringVar(&opts.Profile, "profile", "", "configuration profile to apply, e.g. kiosk")
+	flag.Parse()
+
 	// Load configuration
-	cfg, err := config.Load()
+	cfg, err := config.Load(opts)
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	// Set up logging
-	if cfg.Log.Level == "debug" {
-		log.SetFlags(log.LstdFlags | log.Lshortfile)
-	} else {
-		log.SetFlags(log.LstdFlags)
+	// Set up logging; the access log is kept apart so request noise
+	// doesn't bury card errors
+	if cfg.Log.Output != "" {
+		systemLog, err := logging.OpenSystemLog(cfg.Log.Output, cfg.Log.Tag, cfg.Log.SyslogAddress)
+		if err != nil {
+			log.Fatalf("Failed to open %s: %v", cfg.Log.Output, err)
+		}
+		defer systemLog.Close()
+	} else if cfg.Log.File != "" {
+		appLog, err := logging.OpenFile(cfg.Log.File, cfg.Log.Rotate.MaxSizeMB, cfg.Log.Rotate.MaxBackups)
+		if err != nil {
+			log.Fatalf("Failed to open log file: %v", err)
+		}
+		defer appLog.Close()
+		log.SetOutput(appLog)
+	}
+	if cfg.Log.Access.File != "" {
+		accessLog, err := logging.OpenFile(cfg.Log.Access.File, cfg.Log.Rotate.MaxSizeMB, cfg.Log.Rotate.MaxBackups)
+		if err != nil {
+			log.Fatalf("Failed to open access log file: %v", err)
+		}
+		defer accessLog.Close()
+		logging.SetAccessOutput(accessLog)
+	}
+	level, err := logging.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		log.Printf("Warning: %v, using info", err)
+	}
+	logging.SetLevel(level)
+	logging.SetRedactPII(cfg.Log.RedactPII)
+	logging.KeepRecent()
+
+	log.Printf("Thai ID Card Reader %s", version.Version)
+
+	if err := crash.Init(cfg.Crash.DSN, cfg.Crash.Environment, version.Version); err != nil {
+		log.Printf("Warning: crash reporting disabled: %v", err)
+	}
+	defer crash.Recover()
+
+	if cfg.Profile != "" {
+		log.Printf("Using configuration profile %s", cfg.Profile)
+	}
+	if enabled := cfg.EnabledFeatures(); len(enabled) > 0 {
+		log.Printf("Experimental features enabled: %s", strings.Join(enabled, ", "))
+	}
+	if unknown := cfg.UnknownFeatures(); len(unknown) > 0 {
+		log.Printf("Warning: ignoring unknown features: %s", strings.Join(unknown, ", "))
 	}
 
 	// Create WebSocket hub
-	hub := websocket.NewHub()
+	hub := websocket.NewHub(cfg)
+
+	// Track the current card in each reader
+	sessions := domain.NewCardSessions()
+
+	// Cards come from the local readers, or from other agents in remote mode
+	var cardReader domain.CardReaderService
+	if len(cfg.Remote.Agents) > 0 || cfg.Fleet.Accept {
+		reader, err := remote.New(cfg)
+		if err != nil {
+			log.Fatalf("Failed to set up remote agents: %v", err)
+		}
+		log.Printf("Serving cards from %d remote agents", len(cfg.Remote.Agents))
+		if cfg.Fleet.Accept {
+			log.Println("Accepting agents at /fleet/register")
+		}
+		cardReader = reader
+	} else if reader, err := smartcard.NewPCSCReader(cfg); err != nil {
+		log.Printf("Warning: Failed to initialize card reader: %v", err)
+		// Continue running without card reader functionality
+	} else {
+		if sinks := cfg.Sinks(); cfg.Card.IdleWhenNoClients && len(sinks) > 0 {
+			// Reads for the sinks would be missed while nobody is connected
+			log.Printf("Ignoring card.idleWhenNoClients: %s configured", strings.Join(sinks, ", "))
+		} else if cfg.Card.IdleWhenNoClients {
+			// SSE streams are hub clients too; GET /card/wait long-polls
+			// are listening as well
+			reader.SetIdleCheck(func() bool {
+				return hub.ClientCount() == 0 && sessions.Waiters() == 0
+			})
+		}
+		cardReader = reader
+	}
+
+	// Keep successful reads when a store is configured
+	reads, err := store.Open(cfg.Store)
+	if err != nil {
+		log.Fatalf("Failed to open the %s read store: %v", cfg.Store.Type, err)
+	}
 
 	// Create and start server
-	server := api.NewServer(cfg, hub)
-	
+	server := api.NewServer(cfg, hub, sessions, cardReader)
+	if reads != nil {
+		server.SetReadStore(reads)
+	}
+
 	// Start server in a goroutine
 	go func() {
+		defer crash.Recover()
 		if err := server.Start(); err != nil {
 			log.Fatalf("Failed to start server: %v", err)
 		}
 	}()
 
-	// Initialize card reader
-	reader, err := smartcard.NewPCSCReader()
-	if err != nil {
-		log.Printf("Warning: Failed to initialize card reader: %v", err)
-		// Continue running without card reader functionality
-	} else {
+	if cardReader != nil {
 		// Set up card event handlers
-		reader.OnCardInserted(func(card *domain.ThaiIdCard, err error) {
-			if err != nil {
-				log.Printf("Card read error: %v", err)
-				
-				// Determine error code based on error message
-				var errCode int
-				var errMsg string
-				
-				switch err.Error() {
-				case domain.ErrMsgReaderNotFound:
-					errCode = domain.ErrCodeReaderNotFound
-					errMsg = domain.ErrMsgReaderNotFound
-				case domain.ErrMsgCardNotDetected:
-					errCode = domain.ErrCodeCardNotDetected
-					errMsg = domain.ErrMsgCardNotDetected
-				default:
-					if err.Error() == domain.ErrMsgUnsupportedCard {
-						errCode = domain.ErrCodeUnsupportedCard
-						errMsg = domain.ErrMsgUnsupportedCard
-					} else {
-						errCode = domain.ErrCodeReadFailed
-						errMsg = domain.ErrMsgReadFailed
-					}
-				}
-				
-				if err := hub.BroadcastMessage("ERROR", domain.ErrorResponse{
-					Code:    errCode,
-					Message: errMsg,
-				}); err != nil {
-					log.Printf("Failed to broadcast error message: %v", err)
-				}
-				return
-			}
-			
-			log.Printf("Card inserted: %s", card.CitizenID)
-			if err := hub.BroadcastMessage("CARD_INSERTED", card); err != nil {
-				log.Printf("Failed to broadcast card inserted message: %v", err)
-			}
-		})
-		
-		reader.OnCardRemoved(func() {
-			log.Println("Card removed")
-			if err := hub.BroadcastMessage("CARD_REMOVED", nil); err != nil {
-				log.Printf("Failed to broadcast card removed message: %v", err)
-			}
-		})
-		
+		events := server.Events()
+		cardReader.OnCardInserted(events.CardInserted)
+		cardReader.OnCardIdentified(events.CardIdentified)
+		cardReader.OnCardRemoved(events.CardRemoved)
+		cardReader.OnCardBusy(events.CardBusy)
+		cardReader.OnCardChanged(events.CardChanged)
+		cardReader.OnReaderConflict(events.ReaderConflict)
+		cardReader.OnReaderFailover(events.ReaderFailover)
+		cardReader.OnReaderDegraded(events.ReaderDegraded)
+		cardReader.OnReaderRecovered(events.ReaderRecovered)
+		cardReader.OnMonitorStalled(events.MonitorStalled)
+		cardReader.OnMonitorRecovered(events.MonitorRecovered)
+
 		// Start monitoring
-		if err := reader.StartMonitoring(); err != nil {
+		if err := cardReader.StartMonitoring(); err != nil {
 			log.Printf("Failed to start card monitoring: %v", err)
 		} else {
 			log.Println("Card reader monitoring started")
 		}
 	}
 
+	// Point out readers whose driver is missing, even without PC/SC
+	var usbWatcher *usb.Watcher
+	if cfg.USB.Watch {
+		usbWatcher = usb.NewWatcher(cfg.USB, smartcard.ListReaders, server.Events().ReaderDriverMissing)
+		go usbWatcher.Run()
+	}
+
+	// Keep the aggregator told that this agent is here
+	var registrar *fleet.Registrar
+	if cfg.Fleet.Aggregator != "" {
+		registrar = fleet.NewRegistrar(cfg.Fleet)
+		go registrar.Run()
+	}
+
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
@@ -112,8 +189,14 @@ func main() {
 	log.Println("Shutting down server...")
 
 	// Stop card monitoring
-	if reader != nil {
-		reader.StopMonitoring()
+	if cardReader != nil {
+		cardReader.StopMonitoring()
+	}
+	if usbWatcher != nil {
+		usbWatcher.Stop()
+	}
+	if registrar != nil {
+		registrar.Stop()
 	}
 
 	// Graceful shutdown with timeout
@@ -123,6 +206,11 @@ func main() {
 	if err := server.Shutdown(ctx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
+	if reads != nil {
+		if err := reads.Close(); err != nil {
+			log.Printf("Failed to close the read store: %v", err)
+		}
+	}
 
 	log.Println("Server exited")
-}
\ No newline at end of file
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/config"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/logging"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// accessLogEntry is one line of the JSON access log.
+type accessLogEntry struct {
+	Time      string  `json:"time"`
+	RemoteIP  string  `json:"remoteIp"`
+	Method    string  `json:"method"`
+	URI       string  `json:"uri"`
+	Status    int     `json:"status"`
+	LatencyMs float64 `json:"latencyMs"`
+	BytesOut  int64   `json:"bytesOut"`
+	UserAgent string  `json:"userAgent,omitempty"`
+	RequestID string  `json:"requestId,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// redactURI hides the value of a token query parameter, as taken by the
+// fleet dashboard.
+func redactURI(uri string) string {
+	path, query, ok := strings.Cut(uri, "?")
+	if !ok {
+		return uri
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil || !values.Has("token") {
+		return uri
+	}
+	values.Set("token", "[redacted]")
+	return path + "?" + values.Encode()
+}
+
+// accessLogger logs HTTP requests to the access log output in the configured
+// format, independently of the application log.
+func accessLogger(cfg config.AccessLogConfig) echo.MiddlewareFunc {
+	return middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
+		LogRemoteIP:     true,
+		LogMethod:       true,
+		LogURI:          true,
+		LogStatus:       true,
+		LogLatency:      true,
+		LogResponseSize: true,
+		LogUserAgent:    true,
+		LogError:        true,
+		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
+			if cfg.Level == config.AccessLogErrors && v.Status < 400 && v.Error == nil {
+				return nil
+			}
+
+			entry := accessLogEntry{
+				Time:      v.StartTime.Format(time.RFC3339),
+				RemoteIP:  v.RemoteIP,
+				Method:    v.Method,
+				URI:       redactURI(v.URI),
+				Status:    v.Status,
+				LatencyMs: float64(v.Latency.Microseconds()) / 1000,
+				BytesOut:  v.ResponseSize,
+				UserAgent: v.UserAgent,
+				RequestID: c.Response().Header().Get(logging.RequestIDHeader),
+			}
+			if v.Error != nil {
+				entry.Error = v.Error.Error()
+			}
+
+			out := logging.AccessOutput()
+			if cfg.Format == config.AccessLogText {
+				_, err := fmt.Fprintf(out, "%s %s %s %s %d %.1fms %dB %q %s\n",
+					entry.Time, entry.RemoteIP, entry.Method, entry.URI, entry.Status, entry.LatencyMs, entry.BytesOut, entry.UserAgent, entry.RequestID)
+				return err
+			}
+			line, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			_, err = out.Write(append(line, '\n'))
+			return err
+		},
+	})
+}
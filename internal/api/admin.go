@@ -0,0 +1,335 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/config"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/diag"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/infra/websocket"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/logging"
+	"github.com/labstack/echo/v4"
+)
+
+type logLevelRequest struct {
+	Level string `json:"level"`
+	// Token is the admin token, which SET_LOG_LEVEL needs as WebSocket
+	// clients can't send an Authorization header
+	Token string `json:"token,omitempty"`
+}
+
+type logLevelResponse struct {
+	Level string `json:"level"`
+}
+
+func (h *Handler) GetLogLevel(c echo.Context) error {
+	return c.JSON(http.StatusOK, logLevelResponse{Level: logging.CurrentLevel().String()})
+}
+
+// SetLogLevel switches between info, debug and apdu logging at runtime.
+func (h *Handler) SetLogLevel(c echo.Context) error {
+	var req logLevelRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+
+	level, err := logging.ParseLevel(req.Level)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	logging.SetLevel(level)
+	log.Printf("Log level set to %s", level)
+
+	return c.JSON(http.StatusOK, logLevelResponse{Level: level.String()})
+}
+
+// SetLogLevelCommand is the SET_LOG_LEVEL WebSocket command. Like the
+// /admin endpoints it needs the admin token, in the payload, and is refused
+// when none is set.
+func (h *Handler) SetLogLevelCommand(client *websocket.Client, payload json.RawMessage) error {
+	var req logLevelRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return err
+	}
+	if h.config.Server.AdminToken == "" {
+		return errors.New("set server.adminToken to enable SET_LOG_LEVEL")
+	}
+	if !h.validAdminToken(req.Token) {
+		log.Printf("Refused SET_LOG_LEVEL from client %s: invalid admin token", client)
+		return errors.New("invalid admin token")
+	}
+
+	level, err := logging.ParseLevel(req.Level)
+	if err != nil {
+		return err
+	}
+
+	logging.SetLevel(level)
+	log.Printf("Log level set to %s by client %s", level, client)
+
+	return client.SendMessage("LOG_LEVEL", logLevelResponse{Level: level.String()})
+}
+
+// localOnly guards /admin when no admin token is set: only tools on this
+// machine may use it. Requests with an Origin are refused too, since with
+// CORS open to "*" any web page the kiosk browser opens could send them.
+func localOnly(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		host, _, err := net.SplitHostPort(c.Request().RemoteAddr)
+		ip := net.ParseIP(host)
+		if err != nil || ip == nil || !ip.IsLoopback() || c.Request().Header.Get(echo.HeaderOrigin) != "" {
+			return c.JSON(http.StatusForbidden, map[string]string{
+				"error": "set server.adminToken to use /admin from another host or a web page",
+			})
+		}
+		return next(c)
+	}
+}
+
+// GetClients lists the connected WebSocket and SSE clients. With
+// ?disconnected=true the recently disconnected clients follow them.
+func (h *Handler) GetClients(c echo.Context) error {
+	clients := h.hub.Clients()
+	if c.QueryParam("disconnected") == "true" {
+		clients = append(clients, h.hub.DisconnectedClients()...)
+	}
+	return c.JSON(http.StatusOK, clients)
+}
+
+// DisconnectClient force-closes a client by the ID shown in GET
+// /admin/clients. With ?block=true its IP is also refused until unblocked.
+func (h *Handler) DisconnectClient(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid client id",
+		})
+	}
+
+	info, ok := h.hub.Disconnect(id, c.QueryParam("block") == "true")
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "client not found",
+		})
+	}
+
+	return c.JSON(http.StatusOK, info)
+}
+
+type blockRequest struct {
+	IP string `json:"ip"`
+}
+
+func (h *Handler) GetBlocked(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.hub.Blocked())
+}
+
+// Block quarantines an IP, disconnecting its current clients.
+func (h *Handler) Block(c echo.Context) error {
+	var req blockRequest
+	if err := c.Bind(&req); err != nil || net.ParseIP(req.IP) == nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid ip",
+		})
+	}
+
+	h.hub.Block(req.IP)
+	return c.JSON(http.StatusOK, h.hub.Blocked())
+}
+
+func (h *Handler) Unblock(c echo.Context) error {
+	if !h.hub.Unblock(c.Param("ip")) {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "ip is not blocked",
+		})
+	}
+
+	return c.JSON(http.StatusOK, h.hub.Blocked())
+}
+
+type monitorRequest struct {
+	Strategy string `json:"strategy"`
+}
+
+type monitorResponse struct {
+	Strategy string `json:"strategy"`
+}
+
+// GetReaders lists the connected readers with their state and what their
+// drivers report: vendor, model, USB IDs and firmware, as field failures
+// often come down to a particular firmware revision.
+func (h *Handler) GetReaders(c echo.Context) error {
+	if h.reader == nil {
+		return c.JSON(http.StatusServiceUnavailable, domain.ErrorResponse{
+			Code:    domain.ErrCodeReaderNotFound,
+			Message: domain.ErrMsgReaderNotFound,
+		})
+	}
+
+	info := h.reader.PCSCInfo()
+	for i := range info.Readers {
+		info.Readers[i].Alias = h.config.Readers.AliasFor(info.Readers[i].Name)
+	}
+	return c.JSON(http.StatusOK, info)
+}
+
+func (h *Handler) GetMonitor(c echo.Context) error {
+	if h.reader == nil {
+		return c.JSON(http.StatusServiceUnavailable, domain.ErrorResponse{
+			Code:    domain.ErrCodeReaderNotFound,
+			Message: domain.ErrMsgReaderNotFound,
+		})
+	}
+	return c.JSON(http.StatusOK, monitorResponse{Strategy: h.reader.MonitorStrategy()})
+}
+
+// SetMonitor switches the card monitor between polling and waiting for
+// state changes without a restart, for readers that misbehave with one.
+func (h *Handler) SetMonitor(c echo.Context) error {
+	if h.reader == nil {
+		return c.JSON(http.StatusServiceUnavailable, domain.ErrorResponse{
+			Code:    domain.ErrCodeReaderNotFound,
+			Message: domain.ErrMsgReaderNotFound,
+		})
+	}
+
+	var req monitorRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+	if err := h.reader.SetMonitorStrategy(req.Strategy); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, monitorResponse{Strategy: h.reader.MonitorStrategy()})
+}
+
+// SelfTest runs the smart card self-test for remote troubleshooting.
+func (h *Handler) SelfTest(c echo.Context) error {
+	if h.reader == nil {
+		report := domain.NewSelfTestReport()
+		report.Add("context", time.Now(), fmt.Errorf("card reader failed to initialize"), "")
+		return c.JSON(http.StatusOK, report)
+	}
+
+	return c.JSON(http.StatusOK, h.reader.SelfTest())
+}
+
+type deliveryResponse struct {
+	DroppedMessages uint64             `json:"droppedMessages"`
+	QueueOverflows  uint64             `json:"queueOverflows"`
+	Queued          int                `json:"queued"`
+	StaleDropped    uint64             `json:"staleDropped"`
+	Acks            websocket.AckStats `json:"acks"`
+}
+
+// GetDelivery reports messages dropped for slow clients and the state of
+// acknowledged delivery.
+func (h *Handler) GetDelivery(c echo.Context) error {
+	return c.JSON(http.StatusOK, deliveryResponse{
+		DroppedMessages: h.hub.DroppedMessages(),
+		QueueOverflows:  h.hub.QueueOverflows(),
+		Queued:          h.hub.QueuedBroadcasts(),
+		StaleDropped:    h.hub.StaleDropped(),
+		Acks:            h.hub.AckStats(),
+	})
+}
+
+// GetDiagnostics downloads the diagnostics bundle: version details, the
+// redacted configuration, readers with their ATRs, a self-test and the
+// recent logs.
+func (h *Handler) GetDiagnostics(c echo.Context) error {
+	bundle := diag.New(h.config)
+	bundle.Logs["recent.log"] = logging.Recent()
+	if h.reader == nil {
+		bundle.PCSC = domain.PCSCInfo{Error: "card reader failed to initialize"}
+		report := domain.NewSelfTestReport()
+		report.Add("context", time.Now(), fmt.Errorf("card reader failed to initialize"), "")
+		bundle.SelfTest = *report
+	} else {
+		bundle.PCSC = h.reader.PCSCInfo()
+		bundle.SelfTest = h.reader.SelfTest()
+	}
+
+	var buf bytes.Buffer
+	if err := bundle.Write(&buf); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", bundle.FileName()))
+	return c.Blob(http.StatusOK, "application/zip", buf.Bytes())
+}
+
+// GetConfig returns the configuration in effect after the config file and
+// THAIID_ environment overrides, with secrets redacted.
+func (h *Handler) GetConfig(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.config.Effective())
+}
+
+type configUpdateResponse struct {
+	Config          map[string]interface{} `json:"config"`
+	RestartRequired bool                   `json:"restartRequired"`
+}
+
+// UpdateConfig merges the settings in the body, keyed like the config file,
+// into the config file for fleet management tools. The log level and PII
+// redaction apply at once; other settings on restart. As it can change the
+// admin token itself, it is only enabled when server.adminToken is set.
+func (h *Handler) UpdateConfig(c echo.Context) error {
+	if h.config.Server.AdminToken == "" {
+		return c.JSON(http.StatusForbidden, map[string]string{
+			"error": "set server.adminToken to enable configuration updates",
+		})
+	}
+
+	var settings map[string]interface{}
+	dec := json.NewDecoder(c.Request().Body)
+	dec.UseNumber()
+	if err := dec.Decode(&settings); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+
+	updated, restart, err := h.config.Update(settings)
+	if errors.Is(err, config.ErrNoConfigFile) {
+		return c.JSON(http.StatusConflict, map[string]string{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	if level, err := logging.ParseLevel(updated.Log.Level); err == nil {
+		logging.SetLevel(level)
+	}
+	logging.SetRedactPII(updated.Log.RedactPII)
+	log.Printf("Configuration updated by %s (restart required: %t)", c.RealIP(), restart)
+
+	return c.JSON(http.StatusOK, configUpdateResponse{
+		Config:          updated.Effective(),
+		RestartRequired: restart,
+	})
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/infra/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+// maxAnnotationBytes bounds a note or purpose code, in bytes of UTF-8: 500
+// ASCII characters, or about 160 Thai ones.
+const maxAnnotationBytes = 500
+
+type annotateRequest struct {
+	// Reader is a name or alias; it may be left out while only one card is
+	// inserted
+	Reader string `json:"reader"`
+	// RequestID is the requestId of the read being annotated; the
+	// annotation is refused once another card has been read
+	RequestID string `json:"requestId"`
+	Note      string `json:"note"`
+	Purpose   string `json:"purpose"`
+}
+
+// errNoReader is returned when an annotation doesn't say which of several
+// inserted cards it is for.
+var errNoReader = errors.New("reader is required while several cards are inserted")
+
+// annotate attaches the annotation in req to the current card and tells the
+// clients. The event sent is returned, as the reply leaves out the card.
+func (h *Handler) annotate(req annotateRequest, by string) (domain.ReadAnnotatedEvent, error) {
+	var event domain.ReadAnnotatedEvent
+	if req.Note == "" && req.Purpose == "" {
+		return event, fmt.Errorf("note or purpose is required")
+	}
+	if len(req.Note) > maxAnnotationBytes || len(req.Purpose) > maxAnnotationBytes {
+		return event, fmt.Errorf("note and purpose must be at most %d bytes", maxAnnotationBytes)
+	}
+
+	reader := h.config.Readers.Resolve(req.Reader)
+	if reader == "" {
+		cards := h.sessions.All()
+		switch len(cards) {
+		case 0:
+			return event, errors.New(domain.ErrMsgCardNotDetected)
+		case 1:
+			reader = cards[0].Reader
+		default:
+			return event, errNoReader
+		}
+	}
+
+	annotation := domain.Annotation{
+		Note:    req.Note,
+		Purpose: req.Purpose,
+		By:      by,
+		At:      time.Now(),
+	}
+	card, err := h.sessions.Annotate(reader, req.RequestID, annotation)
+	if err != nil {
+		return event, err
+	}
+
+	log.Printf("Read %s in %s annotated by %s", card.RequestID, reader, by)
+	event = domain.ReadAnnotatedEvent{
+		Reader:      reader,
+		ReaderAlias: card.ReaderAlias,
+		RequestID:   card.RequestID,
+		Annotation:  annotation,
+	}
+	if err := h.hub.BroadcastReaderMessage(reader, "READ_ANNOTATED", event); err != nil {
+		log.Printf("Failed to broadcast READ_ANNOTATED message: %v", err)
+	}
+	return event, nil
+}
+
+// Annotate attaches a note or purpose code to the current read, e.g. to tie
+// the scan to an order or visit.
+func (h *Handler) Annotate(c echo.Context) error {
+	var req annotateRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+
+	event, err := h.annotate(req, c.RealIP())
+	switch {
+	case err == nil:
+		return c.JSON(http.StatusOK, event)
+	case err.Error() == domain.ErrMsgCardNotDetected:
+		reader := h.config.Readers.Resolve(req.Reader)
+		return c.JSON(http.StatusNotFound, domain.ErrorResponse{
+			Code:        domain.ErrCodeCardNotDetected,
+			Message:     domain.ErrMsgCardNotDetected,
+			Reader:      reader,
+			ReaderAlias: h.config.Readers.AliasFor(reader),
+		})
+	case errors.Is(err, domain.ErrReadChanged):
+		return c.JSON(http.StatusConflict, map[string]string{
+			"error": err.Error(),
+		})
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+}
+
+// AnnotateCommand is the ANNOTATE WebSocket command.
+func (h *Handler) AnnotateCommand(client *websocket.Client, payload json.RawMessage) error {
+	var req annotateRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return err
+	}
+
+	event, err := h.annotate(req, client.String())
+	if err != nil {
+		return err
+	}
+	return client.SendMessage("ANNOTATED", event)
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"log"
+	"time"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+)
+
+// scheduleClear clears reader's card data after delay, replacing any clear
+// already scheduled for it.
+func (p *EventPublisher) scheduleClear(reader string, delay time.Duration, reason string) {
+	p.clearMu.Lock()
+	defer p.clearMu.Unlock()
+
+	if timer, ok := p.clearTimers[reader]; ok {
+		timer.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		p.clearMu.Lock()
+		// A newer card may have replaced this timer just as it fired
+		current := p.clearTimers[reader] == timer
+		if current {
+			delete(p.clearTimers, reader)
+		}
+		p.clearMu.Unlock()
+
+		if current {
+			p.clearData(reader, reason)
+		}
+	})
+	p.clearTimers[reader] = timer
+}
+
+// cancelClear stops a scheduled clear, e.g. when a new card is inserted.
+func (p *EventPublisher) cancelClear(reader string) {
+	p.clearMu.Lock()
+	defer p.clearMu.Unlock()
+
+	if timer, ok := p.clearTimers[reader]; ok {
+		timer.Stop()
+		delete(p.clearTimers, reader)
+	}
+}
+
+// clearData wipes everything held about the card in reader and tells
+// clients to blank their screens.
+func (p *EventPublisher) clearData(reader, reason string) {
+	log.Printf("Clearing card data for %s (%s)", reader, reason)
+	p.sessions.Remove(reader)
+	p.photos.Revoke(reader)
+	p.hub.Forget(reader)
+	p.broadcast(reader, "CLEAR_DATA", domain.ClearDataEvent{
+		Reader:      reader,
+		ReaderAlias: p.config.Readers.AliasFor(reader),
+		Reason:      reason,
+	})
+}
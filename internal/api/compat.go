@@ -0,0 +1,154 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/config"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/infra/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+// compatFormat converts a card to the payload another agent would return.
+type compatFormat func(card *domain.ThaiIdCard) interface{}
+
+var compatFormats = map[string]compatFormat{
+	config.CompatThaiNationalIDCard: toPersonal,
+}
+
+// personal is the Personal object of the ThaiNationalIDCard library. Dates
+// are as configured in dates:, Sex is the card's code and PhotoRaw the
+// base64 JPEG.
+type personal struct {
+	Citizenid     string `json:"Citizenid"`
+	Birthday      string `json:"Birthday"`
+	Sex           string `json:"Sex"`
+	ThPrefix      string `json:"Th_Prefix"`
+	ThFirstname   string `json:"Th_Firstname"`
+	ThMiddlename  string `json:"Th_Middlename"`
+	ThLastname    string `json:"Th_Lastname"`
+	EnPrefix      string `json:"En_Prefix"`
+	EnFirstname   string `json:"En_Firstname"`
+	EnMiddlename  string `json:"En_Middlename"`
+	EnLastname    string `json:"En_Lastname"`
+	Issue         string `json:"Issue"`
+	Expire        string `json:"Expire"`
+	Address       string `json:"Address"`
+	AddrHouseNo   string `json:"addrHouseNo"`
+	AddrVillageNo string `json:"addrVillageNo"`
+	AddrLane      string `json:"addrLane"`
+	AddrRoad      string `json:"addrRoad"`
+	AddrTambol    string `json:"addrTambol"`
+	AddrAmphur    string `json:"addrAmphur"`
+	AddrProvince  string `json:"addrProvince"`
+	PhotoRaw      string `json:"PhotoRaw"`
+}
+
+func toPersonal(card *domain.ThaiIdCard) interface{} {
+	p := personal{
+		Citizenid:    card.CitizenID,
+		Birthday:     card.DateOfBirth,
+		Sex:          card.GenderCode,
+		ThPrefix:     card.PrefixNameTH,
+		ThFirstname:  card.FirstNameTH,
+		ThMiddlename: card.MiddleNameTH,
+		ThLastname:   card.LastNameTH,
+		EnPrefix:     card.PrefixNameEN,
+		EnFirstname:  card.FirstNameEN,
+		EnMiddlename: card.MiddleNameEN,
+		EnLastname:   card.LastNameEN,
+		Issue:        card.IssueDate,
+		Expire:       card.ExpireDate,
+		PhotoRaw:     card.PhotoBase64,
+	}
+	if a := card.Address; a != nil {
+		p.Address = a.FullAddress
+		p.AddrHouseNo = a.HouseNo
+		p.AddrVillageNo = a.Moo
+		p.AddrLane = a.Soi
+		p.AddrRoad = a.Street
+		p.AddrTambol = a.Subdistrict
+		p.AddrAmphur = a.District
+		p.AddrProvince = a.Province
+	}
+	return p
+}
+
+// mountCompat serves each configured format under /compat/<format>/:
+// GET card reads the card and returns it in that format, and the ws
+// WebSocket pushes it, without an envelope, each time a card is read.
+func (s *Server) mountCompat() {
+	for _, name := range s.config.Compat.Formats {
+		format := compatFormats[name]
+		group := s.echo.Group("/compat/" + name)
+		group.GET("/card", s.handler.compatCard(format), readTimeout(s.config.Server.ReadTimeout))
+		group.GET("/ws", s.handler.compatWebSocket(name, format))
+	}
+}
+
+func (h *Handler) compatCard(format compatFormat) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		card, status, resp := h.readCard(c.Request().Context(), h.config.Readers.Resolve(c.QueryParam("reader")))
+		if card == nil {
+			return c.JSON(status, resp)
+		}
+		return c.JSON(http.StatusOK, format(h.outgoing(card)))
+	}
+}
+
+func (h *Handler) compatWebSocket(name string, format compatFormat) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if h.hub.IsBlocked(c.Request().RemoteAddr) {
+			return c.JSON(http.StatusForbidden, map[string]string{
+				"error": "client is blocked",
+			})
+		}
+
+		conn, err := h.upgrader.Upgrade(c.Response(), c.Request(), nil)
+		if err != nil {
+			log.Printf("WebSocket upgrade error: %v", err)
+			return err
+		}
+
+		client := h.hub.RegisterClient(conn, websocket.ClientOptions{
+			Reader:     h.config.Readers.Resolve(c.QueryParam("reader")),
+			RemoteAddr: c.Request().RemoteAddr,
+			// Shown in GET /admin/clients
+			Protocol: "compat:" + name,
+			Encode:   h.compatEncoder(format),
+		})
+		go client.WritePump()
+		go client.ReadPump()
+
+		return nil
+	}
+}
+
+// compatEncoder sends only complete card reads. With chunked photo delivery
+// the broadcast has no photo, so it is taken from the session; with URL
+// delivery the photo isn't sent at all.
+func (h *Handler) compatEncoder(format compatFormat) websocket.Encoder {
+	return func(messageType string, payload interface{}) ([]byte, bool) {
+		card, ok := payload.(*domain.ThaiIdCard)
+		if messageType != "CARD_INSERTED" || !ok {
+			return nil, false
+		}
+		// The citizen ID may be masked, so the read is matched by its ID
+		if card.PhotoBase64 == "" && card.PhotoChunks > 0 && card.RequestID != "" {
+			if current, ok := h.sessions.Get(card.Reader); ok && current.RequestID == card.RequestID {
+				withPhoto := *card
+				withPhoto.PhotoBase64 = current.PhotoBase64
+				card = &withPhoto
+			}
+		}
+
+		data, err := json.Marshal(format(card))
+		if err != nil {
+			log.Printf("Failed to encode %s: %v", messageType, err)
+			return nil, false
+		}
+		return data, true
+	}
+}
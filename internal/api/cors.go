@@ -0,0 +1,49 @@
+package api
+
+import (
+	"github.com/cortex-x/go-thai-id-card-reader/internal/config"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// corsMiddleware applies the first cors.rules entry matching the request
+// path, and server.allowedOrigins with Echo's defaults everywhere else.
+func corsMiddleware(cfg *config.Config) echo.MiddlewareFunc {
+	fallback := middleware.CORSWithConfig(middleware.CORSConfig{
+		AllowOrigins: cfg.Server.AllowedOrigins,
+	})
+
+	rules := make([]echo.MiddlewareFunc, len(cfg.CORS.Rules))
+	for i, rule := range cfg.CORS.Rules {
+		origins := rule.AllowOrigins
+		if len(origins) == 0 {
+			origins = cfg.Server.AllowedOrigins
+		}
+		rules[i] = middleware.CORSWithConfig(middleware.CORSConfig{
+			AllowOrigins:     origins,
+			AllowMethods:     rule.AllowMethods,
+			AllowHeaders:     rule.AllowHeaders,
+			ExposeHeaders:    rule.ExposeHeaders,
+			AllowCredentials: rule.AllowCredentials,
+			MaxAge:           int(rule.MaxAge.Seconds()),
+		})
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		fallbackNext := fallback(next)
+		rulesNext := make([]echo.HandlerFunc, len(rules))
+		for i, rule := range rules {
+			rulesNext[i] = rule(next)
+		}
+
+		return func(c echo.Context) error {
+			path := c.Request().URL.Path
+			for i, rule := range cfg.CORS.Rules {
+				if rule.Matches(path) {
+					return rulesNext[i](c)
+				}
+			}
+			return fallbackNext(c)
+		}
+	}
+}
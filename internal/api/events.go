@@ -0,0 +1,400 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/config"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/crash"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/infra/printer"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/infra/usb"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/infra/websocket"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/logging"
+	"github.com/cortex-x/go-thai-id-card-reader/pkg/pipeline"
+)
+
+// EventPublisher turns card reader events into WebSocket broadcasts and keeps
+// the per-reader card sessions up to date.
+type EventPublisher struct {
+	config   *config.Config
+	hub      *websocket.Hub
+	sessions *domain.CardSessions
+	photos   *domain.PhotoTokens
+	scans    *domain.RecentScans
+	stats    *domain.Stats
+	batches  *domain.Batches
+	// pipeline processes each card before it is announced
+	pipeline *pipeline.Pipeline
+	// identify screens the early identity of a card; announceIdentity is
+	// false when CARD_IDENTIFIED can't be screened and isn't sent
+	identify         *pipeline.Pipeline
+	announceIdentity bool
+	// printer prints a queue ticket per new card; nil when not configured
+	printer *printer.Printer
+	// reads stores each successful read; nil when not configured
+	reads domain.ReadStore
+	// idempotency derives the idempotency keys of card events
+	idempotency *domain.IdempotencyKeys
+
+	// failures counts consecutive failed reads per reader for crash reports
+	failuresMu sync.Mutex
+	failures   map[string]int
+
+	// clearTimers are the pending auto-clears per reader
+	clearMu     sync.Mutex
+	clearTimers map[string]*time.Timer
+}
+
+func NewEventPublisher(cfg *config.Config, hub *websocket.Hub, sessions *domain.CardSessions, photos *domain.PhotoTokens, stats *domain.Stats, batches *domain.Batches) *EventPublisher {
+	identify, announceIdentity := newIdentityPipeline(cfg)
+	return &EventPublisher{
+		config:   cfg,
+		hub:      hub,
+		sessions: sessions,
+		photos:   photos,
+		scans:    domain.NewRecentScans(cfg.Card.DuplicateWindow),
+		stats:    stats,
+		batches:  batches,
+		pipeline: newPipeline(cfg),
+		printer:  printer.New(cfg.Printer, cfg.Outbox),
+
+		idempotency: domain.NewIdempotencyKeys(cfg.Card.HashSalt, cfg.Server.IdempotencyWindow),
+
+		identify:         identify,
+		announceIdentity: announceIdentity,
+
+		failures:    make(map[string]int),
+		clearTimers: make(map[string]*time.Timer),
+	}
+}
+
+// idempotencyKey returns the idempotency key of an event about a card read,
+// or "" for other events. The card was inserted about ReadTimeMs before it
+// is announced.
+func (p *EventPublisher) idempotencyKey(reader, messageType string, payload interface{}) string {
+	switch event := payload.(type) {
+	case *domain.ThaiIdCard:
+		insertedAt := time.Now().Add(-time.Duration(event.ReadTimeMs) * time.Millisecond)
+		return p.idempotency.Key(messageType, event.HolderID(), reader, insertedAt)
+	case domain.DuplicateScanEvent:
+		holderID := event.CitizenIDHash
+		if holderID == "" {
+			holderID = event.CitizenID
+		}
+		return p.idempotency.Key(messageType, holderID, reader, time.Now())
+	}
+	return ""
+}
+
+// scanKey identifies a card for duplicate suppression.
+func (p *EventPublisher) scanKey(reader string, card *domain.ThaiIdCard) string {
+	if p.config.Card.DuplicateScope == config.DuplicateScopeGlobal {
+		return card.HolderID()
+	}
+	return reader + "|" + card.HolderID()
+}
+
+func (p *EventPublisher) CardInserted(reader string, card *domain.ThaiIdCard, err error) {
+	alias := p.config.Readers.AliasFor(reader)
+
+	if err != nil {
+		log.Printf("Card read error: %v", err)
+		p.sessions.Remove(reader)
+
+		// Determine error code based on error message
+		errResp := domain.NewErrorResponse(err)
+		errResp.Reader = reader
+		errResp.ReaderAlias = alias
+		p.broadcast(reader, "ERROR", errResp)
+
+		// Errors without a reader (no reader, service down) aren't reads
+		if reader != "" {
+			p.stats.RecordFailure(reader, errResp.Code)
+			p.reportFailure(reader, errResp.Code)
+		}
+
+		var unsupported *domain.UnsupportedCardError
+		if errors.As(err, &unsupported) {
+			unsupported.Card.ReaderAlias = alias
+			p.broadcast(reader, "UNSUPPORTED_CARD", unsupported.Card)
+		}
+		return
+	}
+
+	log.Printf("Card inserted in %s: %s", reader, logging.PII(card.HolderID()))
+	card.ReaderAlias = alias
+	card.SessionID = p.batches.ID(reader)
+	if err := p.pipeline.Run(context.Background(), card); err != nil {
+		// A rejected card was read fine, so it doesn't count against the reader
+		log.Printf("Card rejected: %v", err)
+		p.sessions.Remove(reader)
+		errResp := domain.NewErrorResponse(err)
+		errResp.Reader = reader
+		errResp.ReaderAlias = alias
+		p.broadcast(reader, "ERROR", errResp)
+		return
+	}
+	previous, _ := p.sessions.Get(reader)
+	p.sessions.Set(reader, card)
+	saveRead(p.reads, card)
+	if p.config.Privacy.AutoClear && p.config.Privacy.MaxDisplayTime > 0 {
+		p.scheduleClear(reader, p.config.Privacy.MaxDisplayTime, domain.ClearReasonTimeout)
+	} else {
+		p.cancelClear(reader)
+	}
+	p.stats.RecordRead(reader, time.Duration(card.ReadTimeMs)*time.Millisecond)
+	p.failuresMu.Lock()
+	delete(p.failures, reader)
+	p.failuresMu.Unlock()
+
+	// Age-only cards carry nothing to tell holders apart, so none is a
+	// duplicate. A retry is announced even so, since the user asked for it
+	key := p.scanKey(reader, card)
+	if lastScan, ok := p.scans.Duplicate(key); ok && card.HolderID() != "" && !card.Retry {
+		log.Printf("Suppressing duplicate scan in %s", reader)
+		p.broadcast(reader, "DUPLICATE_SCAN", domain.DuplicateScanEvent{
+			Reader:        reader,
+			ReaderAlias:   alias,
+			CitizenID:     card.CitizenID,
+			CitizenIDHash: card.CitizenIDHash,
+			LastScanAt:    lastScan,
+		})
+		return
+	}
+	p.scans.Record(key)
+	// Reading the card in the reader again isn't another visit
+	if !card.Retry || previous == nil || previous.HolderID() != card.HolderID() {
+		p.batches.Record(reader)
+		// The ticket is announced after the card it belongs to
+		defer p.issueTicket(reader, alias, card)
+	}
+
+	if card.PhotoBase64 == "" {
+		p.broadcast(reader, "CARD_INSERTED", card)
+		return
+	}
+
+	switch p.config.Photo.Delivery {
+	case config.PhotoDeliveryChunked:
+		p.sendPhotoChunks(reader, card)
+	case config.PhotoDeliveryURL:
+		p.sendPhotoURL(reader, card)
+	default:
+		p.broadcast(reader, "CARD_INSERTED", card)
+	}
+}
+
+// issueTicket prints a queue ticket for card when a printer is configured.
+func (p *EventPublisher) issueTicket(reader, alias string, card *domain.ThaiIdCard) {
+	if p.printer == nil {
+		return
+	}
+	number, err := p.printer.Issue(card)
+	if err != nil {
+		log.Printf("Queue ticket %s not printed: %v", number, err)
+		return
+	}
+	log.Printf("Queue ticket %s issued in %s", number, reader)
+	p.broadcast(reader, "TICKET_ISSUED", domain.TicketIssuedEvent{
+		Reader:      reader,
+		ReaderAlias: alias,
+		Number:      number,
+	})
+}
+
+func (p *EventPublisher) sendPhotoChunks(reader string, card *domain.ThaiIdCard) {
+	// Send the card without the photo, followed by the photo in chunks
+	chunks := domain.SplitPhoto(card, p.config.Photo.ChunkSize)
+	payload := *card
+	payload.PhotoBase64 = ""
+	payload.PhotoChunks = len(chunks)
+	p.broadcast(reader, "CARD_INSERTED", &payload)
+
+	for _, chunk := range chunks {
+		p.broadcast(reader, "PHOTO_CHUNK", chunk)
+	}
+}
+
+// sendPhotoURL replaces the photo with a single-use link to GET /photo/:token.
+func (p *EventPublisher) sendPhotoURL(reader string, card *domain.ThaiIdCard) {
+	payload := *card
+	payload.PhotoBase64 = ""
+
+	token, err := p.photos.Issue(card)
+	if err != nil {
+		log.Printf("Failed to issue photo token: %v", err)
+	} else {
+		payload.PhotoToken = token
+		payload.PhotoURL = "/photo/" + token
+	}
+
+	p.broadcast(reader, "CARD_INSERTED", &payload)
+}
+
+func (p *EventPublisher) CardIdentified(reader string, card *domain.ThaiIdCard) {
+	log.Printf("Card identified in %s: %s", reader, logging.PII(card.HolderID()))
+	if !p.announceIdentity {
+		return
+	}
+	if _, ok := p.scans.Duplicate(p.scanKey(reader, card)); ok {
+		return
+	}
+	// The rejection is reported once the whole card has been through the
+	// pipeline
+	if err := p.identify.Run(context.Background(), card); err != nil {
+		logging.Debugf("Not announcing the identity in %s: %v", reader, err)
+		return
+	}
+	card.ReaderAlias = p.config.Readers.AliasFor(reader)
+	p.cancelClear(reader)
+	p.broadcast(reader, "CARD_IDENTIFIED", card)
+}
+
+func (p *EventPublisher) CardRemoved(reader string) {
+	log.Printf("Card removed from %s", reader)
+	p.sessions.Remove(reader)
+	p.photos.Revoke(reader)
+	p.broadcast(reader, "CARD_REMOVED", domain.CardRemovedEvent{
+		Reader:      reader,
+		ReaderAlias: p.config.Readers.AliasFor(reader),
+	})
+
+	if p.config.Privacy.AutoClear {
+		p.scheduleClear(reader, p.config.Privacy.ClearDelay, domain.ClearReasonRemoved)
+	}
+}
+
+// CardChanged is followed by CardRemoved and CardInserted for the new card.
+func (p *EventPublisher) CardChanged(reader string) {
+	log.Printf("Card changed in %s", reader)
+	p.broadcast(reader, "CARD_CHANGED", domain.CardChangedEvent{
+		Reader:      reader,
+		ReaderAlias: p.config.Readers.AliasFor(reader),
+	})
+}
+
+func (p *EventPublisher) CardBusy(reader string) {
+	p.broadcast(reader, "CARD_BUSY", domain.CardBusyEvent{
+		Reader:      reader,
+		ReaderAlias: p.config.Readers.AliasFor(reader),
+		TimeoutMs:   p.config.Card.LockTimeout.Milliseconds(),
+	})
+}
+
+func (p *EventPublisher) ReaderConflict(conflict domain.ReaderConflictEvent) {
+	conflict.ReaderAlias = p.config.Readers.AliasFor(conflict.Reader)
+	p.broadcast(conflict.Reader, "READER_CONFLICT", conflict)
+}
+
+func (p *EventPublisher) ReaderFailover(from, to string) {
+	p.broadcast("", "READER_FAILOVER", domain.ReaderFailoverEvent{
+		From:      from,
+		FromAlias: p.config.Readers.AliasFor(from),
+		To:        to,
+		ToAlias:   p.config.Readers.AliasFor(to),
+	})
+}
+
+func (p *EventPublisher) ReaderDegraded(reader string, failures int) {
+	p.broadcast(reader, "READER_DEGRADED", domain.ReaderDegradedEvent{
+		Reader:          reader,
+		ReaderAlias:     p.config.Readers.AliasFor(reader),
+		Failures:        failures,
+		ProbeIntervalMs: p.config.Card.CircuitBreaker.ProbeInterval.Milliseconds(),
+	})
+}
+
+func (p *EventPublisher) ReaderRecovered(reader string) {
+	p.broadcast(reader, "READER_RECOVERED", domain.ReaderRecoveredEvent{
+		Reader:      reader,
+		ReaderAlias: p.config.Readers.AliasFor(reader),
+	})
+}
+
+// MonitorStalled reports a card monitor that stopped making progress.
+func (p *EventPublisher) MonitorStalled(stall domain.MonitorStall, resetContext bool) {
+	p.broadcast(stall.Reader, "MONITOR_STALLED", domain.MonitorStalledEvent{
+		Stage:        stall.Stage,
+		Reader:       stall.Reader,
+		ReaderAlias:  p.config.Readers.AliasFor(stall.Reader),
+		StalledMs:    time.Since(stall.Since).Milliseconds(),
+		ResetContext: resetContext,
+	})
+}
+
+func (p *EventPublisher) MonitorRecovered(stall domain.MonitorStall) {
+	p.broadcast("", "MONITOR_RECOVERED", domain.MonitorRecoveredEvent{
+		StalledMs: time.Since(stall.Since).Milliseconds(),
+	})
+}
+
+// ReaderDriverMissing reports a USB reader PC/SC doesn't list, with how to
+// install its driver on this OS.
+func (p *EventPublisher) ReaderDriverMissing(device usb.Device) {
+	p.broadcast("", "READER_DRIVER_MISSING", domain.ReaderDriverMissingEvent{
+		VendorID:     device.VendorID,
+		ProductID:    device.ProductID,
+		Manufacturer: device.Manufacturer,
+		Product:      device.Product,
+		Remediation:  driverRemediation(),
+	})
+}
+
+func driverRemediation() string {
+	switch runtime.GOOS {
+	case "windows":
+		return "Install the reader's driver from its vendor or Windows Update; Device Manager shows the reader with a problem until it is installed."
+	case "linux":
+		return "Install and start the PC/SC daemon and CCID driver, e.g. sudo apt install pcscd libccid && sudo systemctl enable --now pcscd.socket; readers that aren't CCID compliant need the vendor's driver."
+	}
+	return "Install the reader's driver from its vendor."
+}
+
+// BroadcastStats sends a STATS event every interval, for dashboards.
+func (p *EventPublisher) BroadcastStats(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		p.broadcast("", "STATS", p.stats.Snapshot())
+	}
+}
+
+func (p *EventPublisher) broadcast(reader string, messageType string, payload interface{}) {
+	if card, ok := payload.(*domain.ThaiIdCard); ok && card.RequestID != "" {
+		logging.Debugf("Request %s: broadcasting %s to %d clients", card.RequestID, messageType, p.hub.ClientCount())
+	}
+	if err := p.hub.BroadcastReaderMessage(reader, messageType, payload); err != nil {
+		log.Printf("Failed to broadcast %s message: %v", messageType, err)
+	}
+}
+
+// reportFailure sends a crash report once a reader has failed
+// crash.failureThreshold reads in a row, so a flaky reader or driver shows up
+// without every bad insert being reported.
+func (p *EventPublisher) reportFailure(reader string, code int) {
+	threshold := p.config.Crash.FailureThreshold
+	// Wrong cards and cards held by other applications aren't faults
+	if threshold <= 0 || code != domain.ErrCodeReadFailed {
+		return
+	}
+
+	p.failuresMu.Lock()
+	p.failures[reader]++
+	count := p.failures[reader]
+	p.failuresMu.Unlock()
+
+	if count == threshold {
+		crash.Capture(crash.LevelWarning, fmt.Sprintf("%d consecutive card read failures", count), map[string]string{
+			"reader":     reader,
+			"error_code": strconv.Itoa(code),
+		})
+	}
+}
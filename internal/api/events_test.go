@@ -0,0 +1,101 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/config"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/infra/websocket"
+	"github.com/cortex-x/go-thai-id-card-reader/pkg/pipeline"
+)
+
+// loadConfig loads the defaults with the given config file contents over them.
+func loadConfig(t *testing.T, yaml string) *config.Config {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(file, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load(config.LoadOptions{File: file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// eventTypes returns the types of the events broadcast until an ERROR.
+func eventTypes(t *testing.T, client *websocket.Client) []string {
+	t.Helper()
+	var types []string
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			event, ok := client.Next()
+			if !ok {
+				return
+			}
+			var message struct {
+				Type string `json:"type"`
+			}
+			if err := json.Unmarshal(event.Data, &message); err != nil {
+				t.Error(err)
+				return
+			}
+			types = append(types, message.Type)
+			if message.Type == "ERROR" {
+				return
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no ERROR broadcast, got %v", types)
+	}
+	return types
+}
+
+func init() {
+	pipeline.Register("test-reject", pipeline.StepFunc(func(ctx context.Context, card *pipeline.Card) error {
+		return errors.New("not on the guest list")
+	}))
+}
+
+func TestRejectedCardIdentityNotBroadcast(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		cid  string
+	}{
+		{"validate rejects a wrong check digit", "pipeline:\n  steps: [validate]\n", "1101700203451"},
+		{"custom step rejects the card", "pipeline:\n  steps: [test-reject]\n", "1101700203450"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := loadConfig(t, tt.yaml)
+			hub := websocket.NewHub(cfg)
+			go hub.Run()
+			client := hub.RegisterStream(websocket.ClientOptions{})
+			defer client.Close()
+			events := NewEventPublisher(cfg, hub, domain.NewCardSessions(), domain.NewPhotoTokens(time.Minute), domain.NewStats(), domain.NewBatches())
+
+			const reader = "Test Reader 0"
+			card := &domain.ThaiIdCard{CitizenID: tt.cid, FirstNameEN: "SOMCHAI"}
+			events.CardIdentified(reader, card)
+			events.CardInserted(reader, card, nil)
+
+			for _, messageType := range eventTypes(t, client) {
+				if messageType == "CARD_IDENTIFIED" || messageType == "CARD_INSERTED" {
+					t.Errorf("%s broadcast for a rejected card", messageType)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+	"github.com/labstack/echo/v4"
+)
+
+// fleetCookie holds fleet.token for the fleet dashboard, so it is only in a
+// URL once.
+const fleetCookie = "fleet_token"
+
+// fleetDashboardAuth lets the fleet dashboard in with the fleetCookie, or
+// with ?token=, which browsers can send when the page is opened. A valid
+// ?token= is swapped for the cookie and a redirect to the page without it,
+// so the token doesn't stay in the address bar and history.
+func fleetDashboardAuth(valid func(key string) bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			// Links on the page must not pass its URL on
+			c.Response().Header().Set("Referrer-Policy", "no-referrer")
+
+			if key := c.QueryParam("token"); key != "" {
+				if !valid(key) {
+					return echo.ErrUnauthorized
+				}
+				c.SetCookie(&http.Cookie{
+					Name:     fleetCookie,
+					Value:    key,
+					Path:     "/fleet",
+					Secure:   c.Scheme() == "https",
+					HttpOnly: true,
+					SameSite: http.SameSiteStrictMode,
+				})
+				query := c.QueryParams()
+				query.Del("token")
+				target := url.URL{Path: c.Request().URL.Path, RawQuery: query.Encode()}
+				return c.Redirect(http.StatusSeeOther, target.String())
+			}
+
+			cookie, err := c.Cookie(fleetCookie)
+			if err != nil || !valid(cookie.Value) {
+				return echo.ErrUnauthorized
+			}
+			return next(c)
+		}
+	}
+}
+
+// fleet returns the reader as a fleet when this service is an aggregator.
+func (h *Handler) fleet(c echo.Context) (domain.Fleet, bool) {
+	fleet, ok := h.reader.(domain.Fleet)
+	if !ok {
+		_ = c.JSON(http.StatusServiceUnavailable, map[string]string{
+			"error": "this service doesn't aggregate agents",
+		})
+	}
+	return fleet, ok
+}
+
+// RegisterAgent adds the agent in the body to those served here, or tells
+// the aggregator it is still there.
+func (h *Handler) RegisterAgent(c echo.Context) error {
+	fleet, ok := h.fleet(c)
+	if !ok {
+		return nil
+	}
+	var agent domain.FleetAgent
+	if err := c.Bind(&agent); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+
+	status, err := fleet.Register(agent)
+	switch {
+	case err == nil:
+		return c.JSON(http.StatusOK, status)
+	case errors.Is(err, domain.ErrAgentConfigured):
+		return c.JSON(http.StatusConflict, map[string]string{
+			"error": err.Error(),
+		})
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+}
+
+// GetFleet returns the health of the agents served here, by site.
+func (h *Handler) GetFleet(c echo.Context) error {
+	fleet, ok := h.fleet(c)
+	if !ok {
+		return nil
+	}
+	return c.JSON(http.StatusOK, domain.GroupBySite(fleet.Agents()))
+}
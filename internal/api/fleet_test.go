@@ -0,0 +1,56 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/infra/websocket"
+)
+
+func TestFleetDashboardTokenSwappedForCookie(t *testing.T) {
+	cfg := loadConfig(t, "fleet:\n  accept: true\n  token: \"s3cret-fleet-token\"\n")
+	s := NewServer(cfg, websocket.NewHub(cfg), domain.NewCardSessions(), nil)
+	get := func(path string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		s.echo.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := get("/fleet/dashboard?token=wrong"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("wrong token = %d, want 401", rec.Code)
+	}
+	if rec := get("/fleet/dashboard"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("no token = %d, want 401", rec.Code)
+	}
+
+	rec := get("/fleet/dashboard?token=s3cret-fleet-token")
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/fleet/dashboard" {
+		t.Fatalf("token = %d to %q, want a redirect to the page without it", rec.Code, rec.Header().Get("Location"))
+	}
+	if got := rec.Header().Get("Referrer-Policy"); got != "no-referrer" {
+		t.Errorf("Referrer-Policy = %q", got)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].HttpOnly || cookies[0].SameSite != http.SameSiteStrictMode {
+		t.Fatalf("cookies = %v, want one HTTP-only strict cookie", cookies)
+	}
+
+	rec = get("/fleet/dashboard", cookies[0])
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "<html") {
+		t.Errorf("dashboard with the cookie = %d", rec.Code)
+	}
+	// This service isn't an aggregator, so /fleet itself is unavailable
+	if rec := get("/fleet", cookies[0]); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("/fleet with the cookie = %d, want it let through", rec.Code)
+	}
+	if rec := get("/fleet"); rec.Code == http.StatusServiceUnavailable {
+		t.Error("/fleet without a token was let through")
+	}
+}
@@ -1,39 +1,101 @@
 package api
 
 import (
+	"context"
+	"encoding/base64"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/cortex-x/go-thai-id-card-reader/internal/config"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
 	"github.com/cortex-x/go-thai-id-card-reader/internal/infra/websocket"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/version"
+	"github.com/cortex-x/go-thai-id-card-reader/pkg/pipeline"
 	gorilla "github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
 )
 
 type Handler struct {
+	config   *config.Config
 	hub      *websocket.Hub
+	sessions *domain.CardSessions
+	reader   domain.CardReaderService
+	photos   *domain.PhotoTokens
+	stats    *domain.Stats
 	upgrader gorilla.Upgrader
+	// pipeline processes cards read on demand
+	pipeline *pipeline.Pipeline
+	// batches are the sessions reads are grouped under
+	batches *domain.Batches
+	// reads stores cards read on demand; nil when not configured
+	reads domain.ReadStore
 }
 
-func NewHandler(hub *websocket.Hub) *Handler {
+func NewHandler(cfg *config.Config, hub *websocket.Hub, sessions *domain.CardSessions, reader domain.CardReaderService, photos *domain.PhotoTokens, stats *domain.Stats, batches *domain.Batches) *Handler {
 	return &Handler{
-		hub: hub,
+		config:   cfg,
+		hub:      hub,
+		sessions: sessions,
+		reader:   reader,
+		photos:   photos,
+		stats:    stats,
+		pipeline: newPipeline(cfg),
+		batches:  batches,
 		upgrader: gorilla.Upgrader{
 			CheckOrigin: func(r *http.Request) bool {
-				// Allow connections from any origin
-				return true
+				return cfg.Server.OriginAllowed(r.Header.Get("Origin"))
 			},
+			// The first of the client's Sec-WebSocket-Protocol values that
+			// is supported is chosen
+			Subprotocols: domain.Protocols,
 		},
 	}
 }
 
 func (h *Handler) WebSocketHandler(c echo.Context) error {
+	if h.hub.IsBlocked(c.Request().RemoteAddr) {
+		return c.JSON(http.StatusForbidden, map[string]string{
+			"error": "client is blocked",
+		})
+	}
+
+	// Payload keys can be renamed to the client's convention
+	naming := c.QueryParam("naming")
+	if !domain.ValidNaming(naming) {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "naming must be camel or snake",
+		})
+	}
+
 	conn, err := h.upgrader.Upgrade(c.Response(), c.Request(), nil)
 	if err != nil {
 		log.Printf("WebSocket upgrade error: %v", err)
 		return err
 	}
 
-	client := h.hub.RegisterClient(conn)
+	// Optionally subscribe to a single reader by name or alias
+	opts := websocket.ClientOptions{
+		Reader:     h.config.Readers.Resolve(c.QueryParam("reader")),
+		RemoteAddr: c.Request().RemoteAddr,
+		Protocol:   conn.Subprotocol(),
+	}
+	opts.Preferences.Naming = naming
+
+	// Critical events must be acknowledged by clients that opt in
+	opts.Ack = c.QueryParam("ack") == "true"
+
+	// A reconnecting client passes the last sequence number it saw
+	if since := c.QueryParam("since"); since != "" {
+		if seq, err := strconv.ParseUint(since, 10, 64); err == nil {
+			opts.Replay = true
+			opts.Since = seq
+		}
+	}
+
+	client := h.hub.RegisterClient(conn, opts)
 
 	// Start goroutines for reading and writing
 	go client.WritePump()
@@ -42,9 +104,417 @@ func (h *Handler) WebSocketHandler(c echo.Context) error {
 	return nil
 }
 
+// EventStream streams broadcasts as Server-Sent Events. A reconnecting
+// EventSource sends Last-Event-ID and gets the events it missed first.
+func (h *Handler) EventStream(c echo.Context) error {
+	if h.hub.IsBlocked(c.Request().RemoteAddr) {
+		return c.JSON(http.StatusForbidden, map[string]string{
+			"error": "client is blocked",
+		})
+	}
+
+	// Payload keys can be renamed to the client's convention
+	naming := c.QueryParam("naming")
+	if !domain.ValidNaming(naming) {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "naming must be camel or snake",
+		})
+	}
+
+	opts := websocket.ClientOptions{
+		Reader:     h.config.Readers.Resolve(c.QueryParam("reader")),
+		RemoteAddr: c.Request().RemoteAddr,
+	}
+	opts.Preferences.Naming = naming
+
+	since := c.Request().Header.Get("Last-Event-ID")
+	if since == "" {
+		since = c.QueryParam("since")
+	}
+	if since != "" {
+		if seq, err := strconv.ParseUint(since, 10, 64); err == nil {
+			opts.Replay = true
+			opts.Since = seq
+		}
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("Connection", "keep-alive")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	client := h.hub.RegisterStream(opts)
+	go func() {
+		<-c.Request().Context().Done()
+		client.Close()
+	}()
+
+	for {
+		event, ok := client.Next()
+		if !ok {
+			return nil
+		}
+
+		if event.Seq > 0 {
+			if _, err := fmt.Fprintf(res, "id: %d\n", event.Seq); err != nil {
+				client.WriteFailed(err)
+				return nil
+			}
+		}
+		if _, err := fmt.Fprintf(res, "data: %s\n\n", event.Data); err != nil {
+			client.WriteFailed(err)
+			return nil
+		}
+		res.Flush()
+	}
+}
+
 func (h *Handler) HealthCheck(c echo.Context) error {
+	// A stalled card monitor still serves requests but no longer sees cards
+	if h.reader != nil {
+		if stall := h.reader.MonitorHealth(); stall != nil {
+			return c.JSON(http.StatusServiceUnavailable, map[string]interface{}{
+				"status":  "degraded",
+				"service": "Thai ID Card Reader",
+				"monitor": map[string]interface{}{
+					"stalled":   true,
+					"stage":     stall.Stage,
+					"reader":    stall.Reader,
+					"stalledMs": time.Since(stall.Since).Milliseconds(),
+				},
+			})
+		}
+	}
 	return c.JSON(http.StatusOK, map[string]string{
-		"status": "healthy",
+		"status":  "healthy",
 		"service": "Thai ID Card Reader",
 	})
-}
\ No newline at end of file
+}
+
+// Capabilities tells clients what this build and configuration support.
+func (h *Handler) Capabilities(c echo.Context) error {
+	sinks := []string{"websocket", "sse"}
+	if h.config.Server.SocketIO {
+		sinks = append(sinks, "socketio")
+	}
+	for _, format := range h.config.Compat.Formats {
+		sinks = append(sinks, "compat:"+format)
+	}
+	if h.config.Printer.Address != "" {
+		sinks = append(sinks, "printer")
+	}
+
+	features := h.config.EnabledFeatures()
+	if features == nil {
+		features = []string{}
+	}
+
+	return c.JSON(http.StatusOK, domain.Capabilities{
+		Version: version.Version,
+		Cards:   domain.CardCapabilities{ThaiID: true, Mode: h.config.Card.Mode},
+		Photo: domain.PhotoCapability{
+			Enabled:  h.config.Photo.Enabled && h.config.Card.Mode == config.CardModeFull,
+			Deferred: h.config.Photo.Deferred,
+			Delivery: h.config.Photo.Delivery,
+		},
+		Protocols: domain.Protocols,
+		Sinks:     sinks,
+		Features:  features,
+	})
+}
+
+// Stats returns read totals since the service started.
+func (h *Handler) Stats(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.stats.Snapshot())
+}
+
+// CurrentCard returns the card in the given reader, or every inserted card
+// when no reader is specified.
+func (h *Handler) CurrentCard(c echo.Context) error {
+	reader := h.config.Readers.Resolve(c.QueryParam("reader"))
+	if reader == "" {
+		cards := h.sessions.All()
+		for i, card := range cards {
+			cards[i] = h.outgoing(card)
+		}
+		return c.JSON(http.StatusOK, cards)
+	}
+
+	card, ok := h.sessions.Get(reader)
+	if !ok {
+		return c.JSON(http.StatusNotFound, domain.ErrorResponse{
+			Code:        domain.ErrCodeCardNotDetected,
+			Message:     domain.ErrMsgCardNotDetected,
+			Reader:      reader,
+			ReaderAlias: h.config.Readers.AliasFor(reader),
+		})
+	}
+
+	return c.JSON(http.StatusOK, h.outgoing(card))
+}
+
+const (
+	// defaultWaitTimeout and maxWaitTimeout bound how long GET /card/wait
+	// holds a request
+	defaultWaitTimeout = 30 * time.Second
+	maxWaitTimeout     = 10 * time.Minute
+)
+
+// WaitCard long-polls for a card, for scripts and server-side code that
+// can't use WebSockets or SSE: it returns the card in the requested reader
+// (name or alias), or in any reader, as soon as there is one. With
+// next=true cards already inserted are passed over for the next one read.
+// It gives up with 404 after timeout (default 30s).
+func (h *Handler) WaitCard(c echo.Context) error {
+	timeout := defaultWaitTimeout
+	if value := c.QueryParam("timeout"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 || parsed > maxWaitTimeout {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": fmt.Sprintf("timeout must be a duration up to %v, e.g. 30s", maxWaitTimeout),
+			})
+		}
+		timeout = parsed
+	}
+	next := c.QueryParam("next") == "true"
+	reader := h.config.Readers.Resolve(c.QueryParam("reader"))
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), timeout)
+	defer cancel()
+	card, err := h.sessions.Wait(ctx, reader, next)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, domain.ErrorResponse{
+			Code:        domain.ErrCodeCardNotDetected,
+			Message:     domain.ErrMsgCardNotDetected,
+			Reader:      reader,
+			ReaderAlias: h.config.Readers.AliasFor(reader),
+		})
+	}
+	return c.JSON(http.StatusOK, h.outgoing(card))
+}
+
+// Photo serves the JPEG behind a single-use photo token.
+func (h *Handler) Photo(c echo.Context) error {
+	photo, ok := h.photos.Redeem(c.Param("token"))
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "photo not found or already retrieved",
+		})
+	}
+
+	data, err := base64.StdEncoding.DecodeString(photo)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "invalid photo data",
+		})
+	}
+
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.Blob(http.StatusOK, "image/jpeg", data)
+}
+
+type validateRequest struct {
+	CitizenID string `json:"citizenId"`
+}
+
+// ValidateCitizenID parses a citizen ID typed in or read from elsewhere and
+// reports its structure and whether its check digit is valid.
+func (h *Handler) ValidateCitizenID(c echo.Context) error {
+	var req validateRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+
+	id, err := domain.ParseCitizenID(req.CitizenID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, id)
+}
+
+type readRequest struct {
+	Reader string `json:"reader"`
+}
+
+// ReadCard reads the card in the requested reader (name or alias) on demand.
+// Without a reader it reads the first reader that has a card.
+func (h *Handler) ReadCard(c echo.Context) error {
+	var req readRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+
+	card, status, resp := h.readCard(c.Request().Context(), h.config.Readers.Resolve(req.Reader))
+	if card == nil {
+		return c.JSON(status, resp)
+	}
+
+	return c.JSON(http.StatusOK, h.outgoing(card))
+}
+
+// readCard reads the card in reader on demand and makes it the reader's
+// current card. On failure it returns the HTTP status and error to send.
+func (h *Handler) readCard(ctx context.Context, reader string) (*domain.ThaiIdCard, int, domain.ErrorResponse) {
+	if h.reader == nil {
+		return nil, http.StatusServiceUnavailable, domain.ErrorResponse{
+			Code:    domain.ErrCodeReaderNotFound,
+			Message: domain.ErrMsgReaderNotFound,
+			Reader:  reader,
+		}
+	}
+
+	type result struct {
+		card *domain.ThaiIdCard
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		card, err := h.reader.ReadCard(ctx, reader)
+		done <- result{card, err}
+	}()
+
+	var res result
+	select {
+	case res = <-done:
+	case <-ctx.Done():
+		// The read stops before its next field; wait briefly for what it has
+		select {
+		case res = <-done:
+		case <-time.After(readGrace):
+			res.err = ctx.Err()
+		}
+	}
+
+	card, err := res.card, res.err
+	if err != nil {
+		resp := domain.NewErrorResponse(err)
+		resp.Reader = reader
+		resp.ReaderAlias = h.config.Readers.AliasFor(reader)
+		if resp.Code == domain.ErrCodeReadTimeout && card != nil && card.HolderID() != "" {
+			card.ReaderAlias = resp.ReaderAlias
+			resp.Partial = card
+		}
+
+		return nil, readErrorStatus(resp.Code), resp
+	}
+
+	card.ReaderAlias = h.config.Readers.AliasFor(card.Reader)
+	card.SessionID = h.batches.ID(card.Reader)
+	if err := h.pipeline.Run(ctx, card); err != nil {
+		log.Printf("Card rejected: %v", err)
+		resp := domain.NewErrorResponse(err)
+		resp.Reader = card.Reader
+		resp.ReaderAlias = card.ReaderAlias
+		return nil, readErrorStatus(resp.Code), resp
+	}
+	h.sessions.Set(card.Reader, card)
+	h.batches.Record(card.Reader)
+	saveRead(h.reads, card)
+
+	return card, http.StatusOK, domain.ErrorResponse{}
+}
+
+// readErrorStatus maps a card read error code to an HTTP status.
+func readErrorStatus(code int) int {
+	switch code {
+	case domain.ErrCodeReaderNotFound, domain.ErrCodeCardNotDetected:
+		return http.StatusNotFound
+	case domain.ErrCodeUnsupportedCard, domain.ErrCodeCardRejected, domain.ErrCodeIncompleteRead:
+		return http.StatusUnprocessableEntity
+	case domain.ErrCodeCardInUse, domain.ErrCodeReaderConflict:
+		return http.StatusConflict
+	case domain.ErrCodeReadTimeout:
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+// CardPhoto reads the photo of the card in a reader when photo.deferred left
+// it out of the read. The reader may be omitted when only one card is
+// inserted.
+func (h *Handler) CardPhoto(c echo.Context) error {
+	reader := h.config.Readers.Resolve(c.QueryParam("reader"))
+	if reader == "" {
+		if cards := h.sessions.All(); len(cards) == 1 {
+			reader = cards[0].Reader
+		}
+	}
+
+	card, ok := h.sessions.Get(reader)
+	if !ok {
+		return c.JSON(http.StatusNotFound, domain.ErrorResponse{
+			Code:        domain.ErrCodeCardNotDetected,
+			Message:     domain.ErrMsgCardNotDetected,
+			Reader:      reader,
+			ReaderAlias: h.config.Readers.AliasFor(reader),
+		})
+	}
+
+	photo := card.PhotoBase64
+	if photo == "" {
+		if h.reader == nil {
+			return c.JSON(http.StatusServiceUnavailable, domain.ErrorResponse{
+				Code:    domain.ErrCodeReaderNotFound,
+				Message: domain.ErrMsgReaderNotFound,
+				Reader:  reader,
+			})
+		}
+
+		type result struct {
+			citizenID, photo string
+			err              error
+		}
+		ctx := c.Request().Context()
+		done := make(chan result, 1)
+		go func() {
+			citizenID, photo, err := h.reader.ReadPhoto(ctx, reader)
+			done <- result{citizenID, photo, err}
+		}()
+
+		var res result
+		select {
+		case res = <-done:
+		case <-ctx.Done():
+			res.err = ctx.Err()
+		}
+
+		citizenID, read, err := res.citizenID, res.photo, res.err
+		if err != nil {
+			resp := domain.NewErrorResponse(err)
+			resp.Reader = reader
+			resp.ReaderAlias = h.config.Readers.AliasFor(reader)
+			return c.JSON(readErrorStatus(resp.Code), resp)
+		}
+		if citizenID != card.CitizenID {
+			return c.JSON(http.StatusConflict, map[string]string{
+				"error": "the card in the reader has changed",
+			})
+		}
+		photo = read
+
+		// Keep the photo with the session so it's read only once
+		updated := *card
+		updated.PhotoBase64 = photo
+		updated.PhotoDeferred = false
+		h.sessions.Replace(reader, &updated)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(photo)
+	if err != nil || len(data) == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "the card has no photo",
+		})
+	}
+
+	c.Response().Header().Set("Cache-Control", "no-store")
+	return c.Blob(http.StatusOK, "image/jpeg", data)
+}
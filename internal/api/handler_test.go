@@ -0,0 +1,145 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/infra/websocket"
+)
+
+func TestRESTCardsMasked(t *testing.T) {
+	const (
+		reader = "TestReader0"
+		cid    = "1101700203450"
+	)
+	cfg := loadConfig(t, "privacy:\n  maskCitizenId: true\n")
+	sessions := domain.NewCardSessions()
+	id, _ := domain.ParseCitizenID(cid)
+	sessions.Set(reader, &domain.ThaiIdCard{Reader: reader, CitizenID: cid, CitizenIDInfo: id})
+	s := NewServer(cfg, websocket.NewHub(cfg), sessions, nil)
+
+	tests := []struct {
+		name string
+		path string
+		all  bool
+	}{
+		{"current card in a reader", "/card/current?reader=" + reader, false},
+		{"current cards", "/card/current", true},
+		{"wait", "/card/wait?timeout=1s", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			s.echo.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("GET %s = %d: %s", tt.path, rec.Code, rec.Body)
+			}
+
+			var cards []domain.ThaiIdCard
+			if tt.all {
+				if err := json.Unmarshal(rec.Body.Bytes(), &cards); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				var card domain.ThaiIdCard
+				if err := json.Unmarshal(rec.Body.Bytes(), &card); err != nil {
+					t.Fatal(err)
+				}
+				cards = append(cards, card)
+			}
+			for _, card := range cards {
+				if card.CitizenID != domain.MaskCitizenID(cid) || card.CitizenIDInfo != nil {
+					t.Errorf("GET %s returned citizen ID %q with info %v, want it masked", tt.path, card.CitizenID, card.CitizenIDInfo)
+				}
+			}
+		})
+	}
+
+	if card, _ := sessions.Get(reader); card.CitizenID != cid {
+		t.Errorf("session citizen ID = %q, want it kept as read", card.CitizenID)
+	}
+}
+
+func TestRESTCardsPhotoURL(t *testing.T) {
+	const reader = "TestReader0"
+	cfg := loadConfig(t, "photo:\n  delivery: url\n")
+	sessions := domain.NewCardSessions()
+	photo := base64.StdEncoding.EncodeToString([]byte{0xFF, 0xD8, 0xFF, 0xD9})
+	sessions.Set(reader, &domain.ThaiIdCard{Reader: reader, CitizenID: "1101700203450", PhotoBase64: photo})
+	s := NewServer(cfg, websocket.NewHub(cfg), sessions, nil)
+
+	for _, path := range []string{"/card/current?reader=" + reader, "/card/wait?timeout=1s"} {
+		rec := httptest.NewRecorder()
+		s.echo.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var card domain.ThaiIdCard
+		if err := json.Unmarshal(rec.Body.Bytes(), &card); err != nil {
+			t.Fatal(err)
+		}
+		if card.PhotoBase64 != "" || card.PhotoURL == "" {
+			t.Fatalf("GET %s returned photoBase64 %q and photoUrl %q, want only a URL", path, card.PhotoBase64, card.PhotoURL)
+		}
+
+		rec = httptest.NewRecorder()
+		s.echo.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, card.PhotoURL, nil))
+		if rec.Code != http.StatusOK || base64.StdEncoding.EncodeToString(rec.Body.Bytes()) != photo {
+			t.Errorf("GET %s = %d, want the photo", card.PhotoURL, rec.Code)
+		}
+	}
+}
+
+func TestCompatEncoderPhoto(t *testing.T) {
+	const reader = "TestReader0"
+	photo := base64.StdEncoding.EncodeToString([]byte{0xFF, 0xD8, 0xFF, 0xD9})
+	read := &domain.ThaiIdCard{Reader: reader, CitizenID: "1101700203450", PhotoBase64: photo, RequestID: "read-1"}
+
+	tests := []struct {
+		name      string
+		yaml      string
+		broadcast domain.ThaiIdCard
+		want      string
+	}{
+		{
+			name:      "chunked, masked citizen ID",
+			yaml:      "photo:\n  delivery: chunked\nprivacy:\n  maskCitizenId: true\n",
+			broadcast: domain.ThaiIdCard{Reader: reader, CitizenID: domain.MaskCitizenID(read.CitizenID), PhotoChunks: 1, RequestID: "read-1"},
+			want:      photo,
+		},
+		{
+			name:      "chunked, another read",
+			yaml:      "photo:\n  delivery: chunked\n",
+			broadcast: domain.ThaiIdCard{Reader: reader, CitizenID: read.CitizenID, PhotoChunks: 1, RequestID: "read-0"},
+			want:      "",
+		},
+		{
+			name:      "url",
+			yaml:      "photo:\n  delivery: url\n",
+			broadcast: domain.ThaiIdCard{Reader: reader, CitizenID: read.CitizenID, PhotoURL: "/photo/x", RequestID: "read-1"},
+			want:      "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := loadConfig(t, tt.yaml)
+			sessions := domain.NewCardSessions()
+			sessions.Set(reader, read)
+			h := NewHandler(cfg, websocket.NewHub(cfg), sessions, nil, domain.NewPhotoTokens(time.Minute), domain.NewStats(), domain.NewBatches())
+
+			data, ok := h.compatEncoder(toPersonal)("CARD_INSERTED", &tt.broadcast)
+			if !ok {
+				t.Fatal("CARD_INSERTED not encoded")
+			}
+			var p personal
+			if err := json.Unmarshal(data, &p); err != nil {
+				t.Fatal(err)
+			}
+			if p.PhotoRaw != tt.want {
+				t.Errorf("PhotoRaw = %q, want %q", p.PhotoRaw, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/infra/outbox"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/version"
+)
+
+// openHeartbeatOutbox opens the queue heartbeats go through while the
+// management server is unreachable; nil when outbox.dir isn't set.
+func (s *Server) openHeartbeatOutbox() *outbox.Queue {
+	client := &http.Client{Timeout: s.config.Heartbeat.Timeout}
+	queue, err := outbox.Open(s.config.Outbox, "heartbeat", func(body []byte) error {
+		return s.postHeartbeat(client, body)
+	})
+	if err != nil {
+		log.Printf("Sending heartbeats without an outbox: %v", err)
+	}
+	return queue
+}
+
+// sendHeartbeats POSTs a heartbeat to heartbeat.url every interval, for as
+// long as the service runs. With an outbox, heartbeats missed while offline
+// are delivered late rather than lost.
+func (s *Server) sendHeartbeats(queue *outbox.Queue) {
+	cfg := s.config.Heartbeat
+	agentID := cfg.ResolveAgentID()
+	client := &http.Client{Timeout: cfg.Timeout}
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	// Log changes rather than every interval, e.g. while offline
+	lastErr := ""
+	for {
+		body, err := json.Marshal(s.heartbeat(agentID))
+		if err == nil {
+			if queue != nil {
+				// The outbox logs delivery failures itself
+				err = queue.Enqueue(body, false)
+			} else {
+				err = s.postHeartbeat(client, body)
+			}
+		}
+		if err != nil && err.Error() != lastErr {
+			log.Printf("Failed to send heartbeat: %v", err)
+		} else if err == nil && lastErr != "" {
+			log.Println("Heartbeats are getting through again")
+		}
+		lastErr = ""
+		if err != nil {
+			lastErr = err.Error()
+		}
+		<-ticker.C
+	}
+}
+
+func (s *Server) postHeartbeat(client *http.Client, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.Heartbeat.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.Heartbeat.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token := s.config.Heartbeat.Token; token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity:
+		// The server won't take this heartbeat however often it's sent;
+		// other errors, e.g. a wrong token, are fixed on the server's side
+		return outbox.Rejected(fmt.Errorf("management server returned %d", resp.StatusCode))
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("management server returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// heartbeat reports the agent's health, without the ATRs of cards in its
+// readers.
+func (s *Server) heartbeat(agentID string) domain.Heartbeat {
+	beat := domain.Heartbeat{
+		AgentID: agentID,
+		Version: version.Version,
+		OS:      runtime.GOOS,
+		SentAt:  time.Now(),
+		Readers: []domain.ReaderStatus{},
+		Clients: s.hub.ClientCount(),
+		Stats:   s.handler.stats.Snapshot(),
+	}
+	if reader := s.handler.reader; reader != nil {
+		info := reader.PCSCInfo()
+		for _, status := range info.Readers {
+			status.Alias = s.config.Readers.AliasFor(status.Name)
+			status.ATR = ""
+			beat.Readers = append(beat.Readers, status)
+		}
+		beat.ReaderError = info.Error
+		beat.MonitorStall = reader.MonitorHealth()
+	} else {
+		beat.ReaderError = domain.ErrMsgReaderNotFound
+	}
+	return beat
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/config"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+	"github.com/labstack/echo/v4"
+)
+
+// Page sizes of GET /history.
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 500
+)
+
+// GetHistory searches the stored reads, e.g. to check whether someone
+// checked in today, a page at a time. It needs the admin token, and is
+// refused when none is set. Holder data is masked unless the request has
+// mask=false.
+func (h *Handler) GetHistory(c echo.Context) error {
+	if h.reads == nil {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{
+			"error": "reads aren't stored; set store.type",
+		})
+	}
+	if h.config.Server.AdminToken == "" {
+		return c.JSON(http.StatusForbidden, map[string]string{
+			"error": "history needs server.adminToken to be set",
+		})
+	}
+	if !h.adminAuthorized(c) {
+		return c.JSON(http.StatusUnauthorized, map[string]string{
+			"error": "history needs the admin token",
+		})
+	}
+
+	query, err := h.historyQuery(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	mask := c.QueryParam("mask") != "false" || h.config.Privacy.MaskCitizenID
+
+	// One more than the page tells whether there is a next one
+	limit := query.Limit
+	query.Limit++
+	reads, err := h.reads.Search(c.Request().Context(), query)
+	if err != nil {
+		log.Printf("Failed to search stored reads: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "failed to search stored reads",
+		})
+	}
+
+	history := domain.ReadHistory{Reads: []domain.StoredRead{}, Limit: limit, Offset: query.Offset, Masked: mask}
+	if len(reads) > limit {
+		reads = reads[:limit]
+		history.NextOffset = query.Offset + limit
+	}
+	for _, read := range reads {
+		if mask {
+			read = read.Mask()
+		}
+		history.Reads = append(history.Reads, read)
+	}
+	return c.JSON(http.StatusOK, history)
+}
+
+// historyQuery reads the search from the query string: citizenId, reader
+// (name or alias), from and to as RFC 3339 times or dates, limit and
+// offset.
+func (h *Handler) historyQuery(c echo.Context) (domain.ReadQuery, error) {
+	query := domain.ReadQuery{
+		CitizenID: c.QueryParam("citizenId"),
+		Reader:    h.config.Readers.Resolve(c.QueryParam("reader")),
+		Limit:     defaultHistoryLimit,
+	}
+	// Hash-only mode stores digests, so search for the ID's
+	if query.CitizenID != "" && h.config.Card.Mode == config.CardModeHashOnly {
+		if _, err := domain.ParseCitizenID(query.CitizenID); err == nil {
+			query.CitizenID = domain.HashCitizenID(h.config.Card.HashSalt, query.CitizenID)
+		}
+	}
+
+	var err error
+	if query.From, err = parseHistoryTime(c.QueryParam("from"), false); err != nil {
+		return query, fmt.Errorf("from: %w", err)
+	}
+	if query.To, err = parseHistoryTime(c.QueryParam("to"), true); err != nil {
+		return query, fmt.Errorf("to: %w", err)
+	}
+
+	if limit := c.QueryParam("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxHistoryLimit {
+			return query, fmt.Errorf("limit must be between 1 and %d", maxHistoryLimit)
+		}
+		query.Limit = n
+	}
+	if offset := c.QueryParam("offset"); offset != "" {
+		n, err := strconv.Atoi(offset)
+		if err != nil || n < 0 {
+			return query, fmt.Errorf("offset must be a number of reads")
+		}
+		query.Offset = n
+	}
+	return query, nil
+}
+
+// parseHistoryTime parses an RFC 3339 time or a date in local time. A date
+// as the end of a range includes that whole day.
+func parseHistoryTime(value string, end bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	day, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("must be a date (2006-01-02) or an RFC 3339 time, got %q", value)
+	}
+	if end {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day, nil
+}
+
+// adminAuthorized reports whether an admin token is set and the request
+// carries it.
+func (h *Handler) adminAuthorized(c echo.Context) bool {
+	key, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+	return ok && h.validAdminToken(key)
+}
+
+// validAdminToken reports whether an admin token is set and key is it.
+func (h *Handler) validAdminToken(key string) bool {
+	token := h.config.Server.AdminToken
+	return token != "" && subtle.ConstantTimeCompare([]byte(key), []byte(token)) == 1
+}
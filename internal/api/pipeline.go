@@ -0,0 +1,144 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/config"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/infra/ldap"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/logging"
+	"github.com/cortex-x/go-thai-id-card-reader/pkg/geocode"
+	"github.com/cortex-x/go-thai-id-card-reader/pkg/pipeline"
+)
+
+// newPipeline builds the post-read steps in the order of pipeline.steps.
+// Validate has checked the names, so an unknown one can't occur.
+func newPipeline(cfg *config.Config) *pipeline.Pipeline {
+	p := &pipeline.Pipeline{}
+	for _, name := range cfg.Pipeline.Steps {
+		switch name {
+		case pipeline.StepValidate:
+			p.Add(name, pipeline.StepFunc(validateCard))
+		case pipeline.StepEnrich:
+			if directory := ldap.New(cfg.LDAP); directory != nil {
+				p.Add(name, enricher{directory})
+			}
+		case pipeline.StepGeocode:
+			p.Add(name, newGeocoder(cfg.Geocode))
+		default:
+			if step, ok := pipeline.Lookup(name); ok {
+				p.Add(name, step)
+			}
+		}
+	}
+	return p
+}
+
+// newIdentityPipeline builds the steps of pipeline.steps that the early
+// CARD_IDENTIFIED goes through, so it never names a holder the whole card
+// would be rejected for. Only validate needs just the citizen ID; enrich and
+// geocode only add data. announce is false when a registered step is
+// configured, as it may reject or redact a card only once it has seen all
+// of it; the holder is then first announced by CARD_INSERTED.
+func newIdentityPipeline(cfg *config.Config) (p *pipeline.Pipeline, announce bool) {
+	p = &pipeline.Pipeline{}
+	for _, name := range cfg.Pipeline.Steps {
+		switch name {
+		case pipeline.StepValidate:
+			p.Add(name, pipeline.StepFunc(validateCard))
+		case pipeline.StepEnrich, pipeline.StepGeocode:
+		default:
+			return nil, false
+		}
+	}
+	return p, true
+}
+
+// validateCard rejects a card whose citizen ID doesn't parse or has a wrong
+// check digit, which points to a damaged chip or a forged card.
+func validateCard(ctx context.Context, card *domain.ThaiIdCard) error {
+	id, err := domain.ParseCitizenID(card.CitizenID)
+	if err != nil {
+		return err
+	}
+	if !id.Valid {
+		return fmt.Errorf("citizen ID check digit is wrong")
+	}
+	return nil
+}
+
+// enricher adds the card holder's directory attributes to cards. A failed
+// lookup is logged and leaves the card as read, so an unreachable directory
+// never stops cards being announced.
+type enricher struct {
+	directory *ldap.Directory
+}
+
+func (e enricher) Process(ctx context.Context, card *domain.ThaiIdCard) error {
+	if card.CitizenID == "" {
+		return nil
+	}
+
+	attrs, err := e.directory.Lookup(ctx, card.CitizenID)
+	switch {
+	case errors.Is(err, ldap.ErrNotFound):
+		logging.Debugf("No directory entry for %s", logging.PII(card.CitizenID))
+	case err != nil:
+		log.Printf("Directory lookup failed: %v", err)
+	default:
+		card.Directory = attrs
+	}
+	return nil
+}
+
+// geocoder adds the location of the card holder's address to cards. When
+// the provider fails or there is none, the province's approximate centre is
+// used, so an unreachable provider never stops cards being announced.
+type geocoder struct {
+	provider geocode.Provider
+	timeout  time.Duration
+}
+
+func newGeocoder(cfg config.GeocodeConfig) geocoder {
+	g := geocoder{timeout: cfg.Timeout}
+	switch cfg.Provider {
+	case "":
+	case geocode.ProviderNominatim:
+		g.provider = geocode.NewNominatim(cfg.URL, &http.Client{Timeout: cfg.Timeout})
+	default:
+		// Validate has checked the provider is registered
+		g.provider, _ = geocode.Lookup(cfg.Provider)
+	}
+	return g
+}
+
+func (g geocoder) Process(ctx context.Context, card *domain.ThaiIdCard) error {
+	if card.Address == nil {
+		return nil
+	}
+
+	if g.provider != nil {
+		ctx, cancel := context.WithTimeout(ctx, g.timeout)
+		location, err := g.provider.Geocode(ctx, card.Address)
+		cancel()
+		switch {
+		case errors.Is(err, geocode.ErrNotFound):
+			logging.Debugf("Geocoder couldn't place the address of %s", logging.PII(card.CitizenID))
+		case err != nil:
+			log.Printf("Geocoding failed: %v", err)
+		case location != nil:
+			card.Address.Location = location
+			return nil
+		}
+	}
+
+	if location, ok := geocode.ProvinceCentre(card.Address.Province); ok {
+		card.Address.Location = location
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"log"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/config"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+)
+
+// renderForClient adapts a broadcast payload to one client's preferences.
+// It returns nil when the payload needs no changes, and false when the
+// message should not be sent to that client.
+func (s *Server) renderForClient(prefs domain.ClientPreferences, messageType string, payload interface{}) (interface{}, bool) {
+	// Clients can ask for masking, but not opt out of a site-wide policy
+	mask := prefs.Mask || s.config.Privacy.MaskCitizenID
+	if !mask && prefs == (domain.ClientPreferences{}) {
+		return nil, true
+	}
+
+	switch p := payload.(type) {
+	case *domain.ThaiIdCard:
+		card := *p
+		if mask {
+			card = *maskedCard(p)
+		}
+		if prefs.Calendar != "" {
+			dates := s.config.Dates
+			card.DateOfBirth = domain.ConvertDate(card.DateOfBirth, dates.DateOfBirth.Calendar, prefs.Calendar)
+			card.IssueDate = domain.ConvertDate(card.IssueDate, dates.IssueDate.Calendar, prefs.Calendar)
+			card.ExpireDate = domain.ConvertDate(card.ExpireDate, dates.ExpireDate.Calendar, prefs.Calendar)
+		}
+		if !prefs.IncludePhoto() {
+			card.PhotoBase64 = ""
+			card.PhotoChunks = 0
+			card.PhotoURL = ""
+			card.PhotoToken = ""
+		}
+		return &card, true
+
+	case domain.PhotoChunk:
+		if !prefs.IncludePhoto() {
+			return nil, false
+		}
+		if mask {
+			p.CitizenID = domain.MaskCitizenID(p.CitizenID)
+		}
+		return p, true
+
+	case domain.DuplicateScanEvent:
+		if mask {
+			p.CitizenID = domain.MaskCitizenID(p.CitizenID)
+		}
+		return p, true
+
+	case domain.ErrorResponse:
+		return p.Localize(prefs.Locale), true
+	}
+
+	return nil, true
+}
+
+// maskedCard returns a copy of card with its citizen ID masked.
+func maskedCard(card *domain.ThaiIdCard) *domain.ThaiIdCard {
+	masked := *card
+	masked.CitizenID = domain.MaskCitizenID(card.CitizenID)
+	// The structure reveals most of the digits
+	masked.CitizenIDInfo = nil
+	return &masked
+}
+
+// outgoing returns card as the REST and compat endpoints send it, with
+// privacy.maskCitizenId applied and, with photo.delivery: url, the photo
+// replaced by a single-use URL of its own. The session keeps the card as
+// read.
+func (h *Handler) outgoing(card *domain.ThaiIdCard) *domain.ThaiIdCard {
+	if h.config.Photo.Delivery == config.PhotoDeliveryURL && card.PhotoBase64 != "" {
+		withURL := *card
+		withURL.PhotoBase64 = ""
+		if token, err := h.photos.Issue(card); err != nil {
+			log.Printf("Failed to issue photo token: %v", err)
+		} else {
+			withURL.PhotoToken = token
+			withURL.PhotoURL = "/photo/" + token
+		}
+		card = &withURL
+	}
+	if !h.config.Privacy.MaskCitizenID {
+		return card
+	}
+	return maskedCard(card)
+}
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"github.com/cortex-x/go-thai-id-card-reader/internal/logging"
+	"github.com/labstack/echo/v4"
+)
+
+// requestID takes the X-Request-ID of each request, or generates one, and
+// sends it back. Handlers pass it on to card reads through the request
+// context, so the access log, card payload and APDU log lines share it.
+func requestID() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			id := req.Header.Get(logging.RequestIDHeader)
+			if !logging.ValidRequestID(id) {
+				id = logging.NewRequestID()
+			}
+
+			c.Response().Header().Set(logging.RequestIDHeader, id)
+			c.SetRequest(req.WithContext(logging.WithRequestID(req.Context(), id)))
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/infra/websocket"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/logging"
+	"github.com/labstack/echo/v4"
+)
+
+// RetryRead resets the card in the requested reader (name or alias) and
+// reads it again, e.g. for a "try again" button after a partial or failed
+// read. The read is announced like an insertion, so the reply is 202 without
+// a body; 404 means there was no card to read.
+func (h *Handler) RetryRead(c echo.Context) error {
+	var req readRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+	if h.reader == nil {
+		return c.JSON(http.StatusServiceUnavailable, domain.ErrorResponse{
+			Code:    domain.ErrCodeReaderNotFound,
+			Message: domain.ErrMsgReaderNotFound,
+		})
+	}
+
+	reader := h.config.Readers.Resolve(req.Reader)
+	if err := h.reader.RetryRead(c.Request().Context(), reader); err != nil {
+		resp := domain.NewErrorResponse(err)
+		resp.Reader = reader
+		resp.ReaderAlias = h.config.Readers.AliasFor(reader)
+		return c.JSON(readErrorStatus(resp.Code), resp)
+	}
+	return c.NoContent(http.StatusAccepted)
+}
+
+// RetryReadCommand is the RETRY_READ WebSocket command, with an optional
+// {"reader": ...} payload. The CARD_INSERTED or ERROR broadcast is its reply.
+func (h *Handler) RetryReadCommand(client *websocket.Client, payload json.RawMessage) error {
+	var req readRequest
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return err
+		}
+	}
+	if h.reader == nil {
+		return errors.New(domain.ErrMsgReaderNotFound)
+	}
+
+	ctx := logging.WithRequestID(context.Background(), logging.NewRequestID())
+	if timeout := h.config.Server.ReadTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return h.reader.RetryRead(ctx, h.config.Readers.Resolve(req.Reader))
+}
@@ -2,55 +2,219 @@ package api
 
 import (
 	"context"
+	"crypto/subtle"
 	"fmt"
 	"log"
+	"net/http"
 
 	"github.com/cortex-x/go-thai-id-card-reader/internal/config"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/crash"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/infra/outbox"
 	"github.com/cortex-x/go-thai-id-card-reader/internal/infra/websocket"
+	"github.com/cortex-x/go-thai-id-card-reader/web"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
 
 type Server struct {
 	echo    *echo.Echo
+	server  *http.Server
 	config  *config.Config
 	hub     *websocket.Hub
 	handler *Handler
+	events  *EventPublisher
+	// heartbeats queues heartbeats while the management server is
+	// unreachable; nil without heartbeat.url or outbox.dir
+	heartbeats *outbox.Queue
 }
 
-func NewServer(cfg *config.Config, hub *websocket.Hub) *Server {
+func NewServer(cfg *config.Config, hub *websocket.Hub, sessions *domain.CardSessions, reader domain.CardReaderService) *Server {
 	e := echo.New()
 	e.HideBanner = true
-	
+
 	// Middleware
-	e.Use(middleware.Logger())
-	e.Use(middleware.Recover())
-	e.Use(middleware.CORS())
+	e.Use(requestID())
+	if cfg.Server.AccessLog {
+		e.Use(accessLogger(cfg.Log.Access))
+	}
+	e.Use(middleware.RecoverWithConfig(middleware.RecoverConfig{
+		LogErrorFunc: func(c echo.Context, err error, stack []byte) error {
+			crash.CapturePanic(err)
+			return err
+		},
+	}))
+	e.Use(corsMiddleware(cfg))
 
-	handler := NewHandler(hub)
+	photos := domain.NewPhotoTokens(cfg.Photo.TokenTTL)
+	stats := domain.NewStats()
+	batches := domain.NewBatches()
+	handler := NewHandler(cfg, hub, sessions, reader, photos, stats, batches)
 
 	// Routes
 	e.GET("/health", handler.HealthCheck)
+	e.GET("/stats", handler.Stats)
+	e.GET("/capabilities", handler.Capabilities)
 	e.GET("/ws", handler.WebSocketHandler)
+	e.GET("/events", handler.EventStream)
+	e.GET("/card/current", handler.CurrentCard)
+	e.GET("/card/wait", handler.WaitCard)
+	e.GET("/card/photo", handler.CardPhoto, readTimeout(cfg.Server.ReadTimeout))
+	e.POST("/read", handler.ReadCard, readTimeout(cfg.Server.ReadTimeout))
+	e.POST("/card/retry", handler.RetryRead, readTimeout(cfg.Server.ReadTimeout))
+	e.POST("/validate", handler.ValidateCitizenID)
+	e.POST("/card/annotate", handler.Annotate)
+	e.GET("/session", handler.GetSessions)
+	e.POST("/session/start", handler.StartSession)
+	e.POST("/session/end", handler.EndSession)
+	e.GET("/photo/:token", handler.Photo)
+	e.GET("/history", handler.GetHistory)
+
+	if cfg.Server.SocketIO {
+		e.GET("/socket.io/", handler.SocketIO)
+	}
 
-	return &Server{
+	if cfg.Server.DemoPage {
+		e.StaticFS("/demo", web.Static())
+		e.GET("/", func(c echo.Context) error {
+			return c.Redirect(http.StatusFound, "/demo/")
+		})
+	}
+
+	if cfg.Fleet.Accept {
+		// Validation makes sure there is a token
+		fleetKey := func(key string, c echo.Context) (bool, error) {
+			return subtle.ConstantTimeCompare([]byte(key), []byte(cfg.Fleet.Token)) == 1, nil
+		}
+		fleet := e.Group("/fleet")
+		// The dashboard fetches it with the cookie it was given
+		fleet.GET("", handler.GetFleet, middleware.KeyAuthWithConfig(middleware.KeyAuthConfig{
+			KeyLookup: "header:" + echo.HeaderAuthorization + ",cookie:" + fleetCookie,
+			Validator: fleetKey,
+		}))
+		// The page the operations team watches the agents on. Browsers
+		// can't send a header when opening it, so it takes ?token= once
+		fleet.FileFS("/dashboard", "fleet.html", web.Static(), fleetDashboardAuth(func(key string) bool {
+			ok, _ := fleetKey(key, nil)
+			return ok
+		}))
+		fleet.POST("/register", handler.RegisterAgent, middleware.KeyAuth(fleetKey))
+	}
+
+	admin := e.Group("/admin")
+	if cfg.Server.AdminToken != "" {
+		admin.Use(middleware.KeyAuth(func(key string, c echo.Context) (bool, error) {
+			return subtle.ConstantTimeCompare([]byte(key), []byte(cfg.Server.AdminToken)) == 1, nil
+		}))
+	} else {
+		admin.Use(localOnly)
+	}
+	admin.GET("/log-level", handler.GetLogLevel)
+	admin.PUT("/log-level", handler.SetLogLevel)
+	admin.GET("/delivery", handler.GetDelivery)
+	admin.GET("/config", handler.GetConfig)
+	admin.PUT("/config", handler.UpdateConfig)
+	admin.GET("/diagnostics", handler.GetDiagnostics)
+	admin.POST("/selftest", handler.SelfTest)
+	admin.GET("/readers", handler.GetReaders)
+	admin.GET("/monitor", handler.GetMonitor)
+	admin.PUT("/monitor", handler.SetMonitor)
+	admin.GET("/clients", handler.GetClients)
+	admin.DELETE("/clients/:id", handler.DisconnectClient)
+	admin.GET("/blocked", handler.GetBlocked)
+	admin.POST("/blocked", handler.Block)
+	admin.DELETE("/blocked/:ip", handler.Unblock)
+
+	// Broadcasts are adapted to the preferences each client sent in HELLO
+	s := &Server{
 		echo:    e,
 		config:  cfg,
 		hub:     hub,
 		handler: handler,
+		events:  NewEventPublisher(cfg, hub, sessions, photos, stats, batches),
 	}
+	hub.SetRenderer(s.renderForClient)
+	hub.SetSessionLookup(batches.ID)
+	hub.SetIdempotencyKeys(s.events.idempotencyKey)
+	s.mountCompat()
+
+	// WebSocket commands
+	hub.HandleCommand("SET_LOG_LEVEL", handler.SetLogLevelCommand)
+	hub.HandleCommand("ANNOTATE", handler.AnnotateCommand)
+	hub.HandleCommand("START_SESSION", handler.StartSessionCommand)
+	hub.HandleCommand("END_SESSION", handler.EndSessionCommand)
+	hub.HandleCommand("RETRY_READ", handler.RetryReadCommand)
+
+	return s
+}
+
+// SetReadStore makes the server store every successful read in reads. It
+// must be called before Start.
+func (s *Server) SetReadStore(reads domain.ReadStore) {
+	s.handler.reads = reads
+	s.events.reads = reads
+}
+
+// Events returns the publisher that card reader events should be sent to.
+func (s *Server) Events() *EventPublisher {
+	return s.events
 }
 
 func (s *Server) Start() error {
 	// Start WebSocket hub
-	go s.hub.Run()
+	go func() {
+		defer crash.Recover()
+		s.hub.Run()
+	}()
+
+	if s.config.Stats.Interval > 0 {
+		go func() {
+			defer crash.Recover()
+			s.events.BroadcastStats(s.config.Stats.Interval)
+		}()
+	}
+
+	if s.config.Heartbeat.URL != "" {
+		s.heartbeats = s.openHeartbeatOutbox()
+		go func() {
+			defer crash.Recover()
+			s.sendHeartbeats(s.heartbeats)
+		}()
+	}
 
-	addr := fmt.Sprintf(":%d", s.config.Server.Port)
-	log.Printf("Starting WebSocket server on %s", addr)
-	
-	return s.echo.Start(addr)
+	// HTTP/2 is negotiated over TLS; h2c is HTTP/2 with prior knowledge on
+	// the plain port. WebSockets stay on HTTP/1.1 either way
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(s.config.Server.H2C)
+
+	s.server = &http.Server{
+		Addr:      fmt.Sprintf(":%d", s.config.Server.Port),
+		Handler:   s.echo,
+		Protocols: &protocols,
+	}
+
+	if tls := s.config.Server.TLS; tls.Enabled() {
+		log.Printf("Starting WebSocket server on %s (HTTPS)", s.server.Addr)
+		return s.server.ListenAndServeTLS(tls.CertFile, tls.KeyFile)
+	}
+	log.Printf("Starting WebSocket server on %s", s.server.Addr)
+	return s.server.ListenAndServe()
 }
 
 func (s *Server) Shutdown(ctx context.Context) error {
-	return s.echo.Shutdown(ctx)
-}
\ No newline at end of file
+	// Keep what the sinks haven't delivered for the next run
+	defer func() {
+		if s.heartbeats != nil {
+			s.heartbeats.Close()
+		}
+		if s.events.printer != nil {
+			s.events.printer.Close()
+		}
+	}()
+	if s.server == nil {
+		return nil
+	}
+	return s.server.Shutdown(ctx)
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/infra/websocket"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/logging"
+	"github.com/labstack/echo/v4"
+)
+
+type sessionRequest struct {
+	// Reader is a name or alias; without one the session covers every
+	// reader that has no session of its own
+	Reader string `json:"reader"`
+	// Label names the session for people, e.g. a family name or visit
+	Label string `json:"label"`
+}
+
+// startSession opens a session that groups the reads that follow, and tells
+// the clients.
+func (h *Handler) startSession(req sessionRequest) (domain.Session, error) {
+	if len(req.Label) > maxAnnotationBytes {
+		return domain.Session{}, fmt.Errorf("label must be at most %d bytes", maxAnnotationBytes)
+	}
+
+	reader := h.config.Readers.Resolve(req.Reader)
+	session, err := h.batches.Start(domain.Session{
+		ID:          logging.NewRequestID(),
+		Reader:      reader,
+		ReaderAlias: h.config.Readers.AliasFor(reader),
+		Label:       req.Label,
+		StartedAt:   time.Now(),
+	})
+	if err != nil {
+		return session, err
+	}
+
+	log.Printf("Session %s started for %s", session.ID, readerOrAll(reader))
+	h.broadcastSession(reader, "SESSION_STARTED", session)
+	return session, nil
+}
+
+// endSession closes the session of the requested reader and tells the
+// clients.
+func (h *Handler) endSession(req sessionRequest) (domain.Session, error) {
+	reader := h.config.Readers.Resolve(req.Reader)
+	session, err := h.batches.End(reader)
+	if err != nil {
+		return session, err
+	}
+
+	log.Printf("Session %s ended for %s after %d reads", session.ID, readerOrAll(reader), session.Reads)
+	h.broadcastSession(reader, "SESSION_ENDED", session)
+	return session, nil
+}
+
+func (h *Handler) broadcastSession(reader, messageType string, session domain.Session) {
+	if err := h.hub.BroadcastReaderMessage(reader, messageType, session); err != nil {
+		log.Printf("Failed to broadcast %s message: %v", messageType, err)
+	}
+}
+
+func readerOrAll(reader string) string {
+	if reader == "" {
+		return "all readers"
+	}
+	return reader
+}
+
+// GetSessions lists the open sessions.
+func (h *Handler) GetSessions(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.batches.Open())
+}
+
+// StartSession groups the reads that follow under a new session ID.
+func (h *Handler) StartSession(c echo.Context) error {
+	var req sessionRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+
+	session, err := h.startSession(req)
+	switch {
+	case err == nil:
+		return c.JSON(http.StatusCreated, session)
+	case errors.Is(err, domain.ErrSessionOpen):
+		return c.JSON(http.StatusConflict, map[string]string{
+			"error": err.Error(),
+		})
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+}
+
+// EndSession closes a session, returning it with its read count.
+func (h *Handler) EndSession(c echo.Context) error {
+	var req sessionRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+
+	session, err := h.endSession(req)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": err.Error(),
+		})
+	}
+	return c.JSON(http.StatusOK, session)
+}
+
+// StartSessionCommand is the START_SESSION WebSocket command. The
+// SESSION_STARTED broadcast is its reply.
+func (h *Handler) StartSessionCommand(client *websocket.Client, payload json.RawMessage) error {
+	req, err := decodeSessionRequest(payload)
+	if err != nil {
+		return err
+	}
+	_, err = h.startSession(req)
+	return err
+}
+
+// EndSessionCommand is the END_SESSION WebSocket command. The SESSION_ENDED
+// broadcast is its reply.
+func (h *Handler) EndSessionCommand(client *websocket.Client, payload json.RawMessage) error {
+	req, err := decodeSessionRequest(payload)
+	if err != nil {
+		return err
+	}
+	_, err = h.endSession(req)
+	return err
+}
+
+// decodeSessionRequest decodes a session command, whose payload may be left
+// out for a session of all readers.
+func decodeSessionRequest(payload json.RawMessage) (sessionRequest, error) {
+	var req sessionRequest
+	if len(payload) == 0 {
+		return req, nil
+	}
+	err := json.Unmarshal(payload, &req)
+	return req, err
+}
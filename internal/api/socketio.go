@@ -0,0 +1,193 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/infra/websocket"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/logging"
+	gorilla "github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+// Socket.IO is served over its websocket transport only, which is enough
+// for clients created with transports: ["websocket"]. Engine.IO 3 (Socket.IO
+// 2 clients) and 4 (Socket.IO 3 and 4) differ in who pings and in whether
+// the client has to connect to the namespace.
+const (
+	socketIOPingInterval = 25 * time.Second
+	socketIOPingTimeout  = 20 * time.Second
+)
+
+// Engine.IO packet types, and the Socket.IO ones carried in messages
+const (
+	eioOpen    = "0"
+	eioClose   = "1"
+	eioPing    = "2"
+	eioPong    = "3"
+	eioMessage = "4"
+
+	sioConnect    = "0"
+	sioDisconnect = "1"
+	sioEvent      = "2"
+	sioError      = "4"
+)
+
+type engineIOOpen struct {
+	SID          string   `json:"sid"`
+	Upgrades     []string `json:"upgrades"`
+	PingInterval int64    `json:"pingInterval"`
+	PingTimeout  int64    `json:"pingTimeout"`
+	MaxPayload   int      `json:"maxPayload,omitempty"`
+}
+
+// socketIOEvent names a broadcast as a Socket.IO event: CARD_INSERTED is
+// card-inserted. ERROR is card-error, as Socket.IO 2 clients reserve error.
+func socketIOEvent(messageType string) string {
+	if messageType == "ERROR" {
+		return "card-error"
+	}
+	return strings.ToLower(strings.ReplaceAll(messageType, "_", "-"))
+}
+
+// SocketIO serves the broadcasts to Socket.IO clients as events whose data
+// is the payload.
+func (h *Handler) SocketIO(c echo.Context) error {
+	eio := c.QueryParam("EIO")
+	if eio != "3" && eio != "4" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "unsupported Engine.IO version",
+		})
+	}
+	if c.QueryParam("transport") != "websocket" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": `only the websocket transport is supported; create the client with transports: ["websocket"]`,
+		})
+	}
+	if h.hub.IsBlocked(c.Request().RemoteAddr) {
+		return c.JSON(http.StatusForbidden, map[string]string{
+			"error": "client is blocked",
+		})
+	}
+
+	conn, err := h.upgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade error: %v", err)
+		return err
+	}
+
+	raw := make([]byte, 15)
+	if _, err := rand.Read(raw); err != nil {
+		_ = conn.Close()
+		return err
+	}
+	sid := hex.EncodeToString(raw)
+
+	// Events are held back until the client has joined the namespace
+	var connected atomic.Bool
+	client := h.hub.RegisterClient(conn, websocket.ClientOptions{
+		Reader:     h.config.Readers.Resolve(c.QueryParam("reader")),
+		RemoteAddr: c.Request().RemoteAddr,
+		Protocol:   "socket.io/EIO" + eio,
+		Encode: func(messageType string, payload interface{}) ([]byte, bool) {
+			if !connected.Load() {
+				return nil, false
+			}
+			data, err := json.Marshal([]interface{}{socketIOEvent(messageType), payload})
+			if err != nil {
+				log.Printf("Failed to encode %s: %v", messageType, err)
+				return nil, false
+			}
+			return append([]byte(eioMessage+sioEvent), data...), true
+		},
+	})
+	go client.WritePump()
+
+	open, _ := json.Marshal(engineIOOpen{
+		SID:          sid,
+		Upgrades:     []string{},
+		PingInterval: socketIOPingInterval.Milliseconds(),
+		PingTimeout:  socketIOPingTimeout.Milliseconds(),
+		MaxPayload:   1000000,
+	})
+	_ = client.SendRaw(append([]byte(eioOpen), open...))
+	if eio == "3" {
+		// Socket.IO 2 joins the default namespace without asking
+		connected.Store(true)
+		_ = client.SendRaw([]byte(eioMessage + sioConnect))
+	}
+
+	go h.socketIOReadLoop(conn, client, eio, sid, &connected)
+	return nil
+}
+
+// socketIOReadLoop answers pings and namespace connects until the client
+// goes away or stops answering.
+func (h *Handler) socketIOReadLoop(conn *gorilla.Conn, client *websocket.Client, eio, sid string, connected *atomic.Bool) {
+	done := make(chan struct{})
+	defer func() {
+		close(done)
+		client.Close()
+		_ = conn.Close()
+	}()
+
+	// Engine.IO 4 servers ping; Engine.IO 3 clients do
+	if eio == "4" {
+		go func() {
+			ticker := time.NewTicker(socketIOPingInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					_ = client.SendRaw([]byte(eioPing))
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	conn.SetReadLimit(4096)
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(socketIOPingInterval + socketIOPingTimeout))
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if messageType != gorilla.TextMessage || len(data) == 0 {
+			continue
+		}
+
+		packet := string(data)
+		switch {
+		case strings.HasPrefix(packet, eioPing):
+			// "2probe" is answered with "3probe"
+			_ = client.SendRaw([]byte(eioPong + packet[1:]))
+		case strings.HasPrefix(packet, eioPong):
+		case packet == eioClose:
+			return
+		case strings.HasPrefix(packet, eioMessage+sioConnect):
+			// Only the default namespace exists: "40" or "40{auth}"
+			if strings.HasPrefix(packet, eioMessage+sioConnect+"/") {
+				namespace, _, _ := strings.Cut(packet[2:], ",")
+				_ = client.SendRaw([]byte(fmt.Sprintf(`%s%s%s,{"message":"Invalid namespace"}`, eioMessage, sioError, namespace)))
+				continue
+			}
+			if eio == "4" && !connected.Load() {
+				_ = client.SendRaw([]byte(fmt.Sprintf(`%s%s{"sid":%q}`, eioMessage, sioConnect, sid)))
+				connected.Store(true)
+			}
+		case strings.HasPrefix(packet, eioMessage+sioDisconnect):
+			return
+		default:
+			logging.Debugf("Ignoring Socket.IO packet from %s: %.40s", client, packet)
+		}
+	}
+}
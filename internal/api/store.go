@@ -0,0 +1,28 @@
+package api
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+)
+
+// saveTimeout bounds storing a read.
+const saveTimeout = 10 * time.Second
+
+// saveRead stores card in reads, if set, without holding up its
+// announcement. A failure is logged; the card is announced regardless.
+func saveRead(reads domain.ReadStore, card *domain.ThaiIdCard) {
+	if reads == nil {
+		return
+	}
+	read := domain.NewStoredRead(card, time.Now())
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), saveTimeout)
+		defer cancel()
+		if err := reads.Save(ctx, read); err != nil {
+			log.Printf("Failed to store read from %s: %v", read.Reader, err)
+		}
+	}()
+}
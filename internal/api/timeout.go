@@ -0,0 +1,30 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// readGrace is how long a timed out read gets to return the fields it read
+// before its deadline, for the partial data of the 504 response.
+const readGrace = 250 * time.Millisecond
+
+// readTimeout puts a deadline on the request context of on-demand read
+// endpoints. The reads stop at the deadline, and the handlers stop waiting
+// for them, answering 504 with error 1009, so a wedged reader doesn't hold
+// HTTP clients indefinitely. A zero timeout leaves requests unbounded.
+func readTimeout(timeout time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if timeout <= 0 {
+			return next
+		}
+		return func(c echo.Context) error {
+			ctx, cancel := context.WithTimeout(c.Request().Context(), timeout)
+			defer cancel()
+			c.SetRequest(c.Request().WithContext(ctx))
+			return next(c)
+		}
+	}
+}
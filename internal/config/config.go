@@ -1,47 +1,876 @@
 package config
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Server ServerConfig `mapstructure:"server"`
-	Log    LogConfig    `mapstructure:"log"`
+	Server    ServerConfig    `mapstructure:"server"`
+	Log       LogConfig       `mapstructure:"log"`
+	Card      CardConfig      `mapstructure:"card"`
+	Readers   ReadersConfig   `mapstructure:"readers"`
+	Photo     PhotoConfig     `mapstructure:"photo"`
+	Privacy   PrivacyConfig   `mapstructure:"privacy"`
+	Dates     DatesConfig     `mapstructure:"dates"`
+	Gender    GenderConfig    `mapstructure:"gender"`
+	Stats     StatsConfig     `mapstructure:"stats"`
+	Crash     CrashConfig     `mapstructure:"crash"`
+	Compat    CompatConfig    `mapstructure:"compat"`
+	CORS      CORSConfig      `mapstructure:"cors"`
+	USB       USBConfig       `mapstructure:"usb"`
+	LDAP      LDAPConfig      `mapstructure:"ldap"`
+	Printer   PrinterConfig   `mapstructure:"printer"`
+	Pipeline  PipelineConfig  `mapstructure:"pipeline"`
+	Remote    RemoteConfig    `mapstructure:"remote"`
+	Fleet     FleetConfig     `mapstructure:"fleet"`
+	Heartbeat HeartbeatConfig `mapstructure:"heartbeat"`
+	Geocode   GeocodeConfig   `mapstructure:"geocode"`
+	Store     StoreConfig     `mapstructure:"store"`
+	Outbox    OutboxConfig    `mapstructure:"outbox"`
+	// Features are experimental behaviours turned on by name; see
+	// knownFeatures
+	Features map[string]bool `mapstructure:"features"`
+
+	// Profile is the profile merged over the base configuration, if any
+	Profile string `mapstructure:"profile"`
+
+	// file is the config file read, empty when running on defaults, and
+	// profileOverride the profile given in LoadOptions; Update uses them to
+	// reload the same way
+	file            string
+	profileOverride string
+}
+
+// CrashConfig enables reporting panics and repeated read failures to a
+// Sentry-compatible server.
+type CrashConfig struct {
+	// DSN is the project DSN; empty disables reporting
+	DSN         string `mapstructure:"dsn" secret:"true"`
+	Environment string `mapstructure:"environment"`
+	// FailureThreshold reports a reader after this many consecutive failed
+	// reads (0 disables)
+	FailureThreshold int `mapstructure:"failureThreshold"`
+}
+
+// LDAPConfig looks up the card holder in an LDAP directory or Active
+// Directory after a read and adds attributes of their entry to the card,
+// e.g. for staff check-in.
+type LDAPConfig struct {
+	// URL is ldap://host[:port] or ldaps://host[:port]; empty disables
+	// lookups
+	URL string `mapstructure:"url"`
+	// StartTLS upgrades an ldap:// connection to TLS before binding
+	StartTLS bool   `mapstructure:"startTLS"`
+	BindDN   string `mapstructure:"bindDN"`
+	// BindPassword may be "keychain:<name>" to read it from the OS
+	// credential store
+	BindPassword string `mapstructure:"bindPassword" secret:"true"`
+	BaseDN       string `mapstructure:"baseDN"`
+	// CitizenIDAttribute is the attribute holding the citizen ID
+	CitizenIDAttribute string `mapstructure:"citizenIdAttribute"`
+	// Attributes are copied from the entry into the card's directory field
+	Attributes []string `mapstructure:"attributes"`
+	// Timeout bounds a lookup, which holds up the card's announcement
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// PipelineConfig orders the processing each card goes through after a
+// successful read, before it is stored and announced.
+type PipelineConfig struct {
+	// Steps are built-in (validate, enrich, geocode) or registered step
+	// names, run in this order
+	Steps []string `mapstructure:"steps"`
+}
+
+// RemoteConfig serves the cards of other agents instead of the local
+// readers, so a central server can offer one API over many counter agents.
+type RemoteConfig struct {
+	// Agents are the agents to serve; empty uses the local readers
+	Agents []RemoteAgent `mapstructure:"agents"`
+}
+
+// RemoteAgent is an agent whose readers are served as <name>/<reader>.
+type RemoteAgent struct {
+	// Name prefixes the agent's reader names, e.g. counter-1
+	Name string `mapstructure:"name"`
+	// URL is the agent's base URL, e.g. http://10.0.0.11:8080
+	URL string `mapstructure:"url"`
+	// Site groups agents on the fleet dashboard, e.g. a branch
+	Site string `mapstructure:"site"`
+}
+
+// FleetConfig links agents to an aggregator. An aggregator accepts agents
+// that register themselves and serves their cards as it serves
+// remote.agents; an agent with Aggregator set registers itself there.
+type FleetConfig struct {
+	// Accept makes this service an aggregator
+	Accept bool `mapstructure:"accept"`
+	// Token is the bearer token agents register with, also needed for the
+	// fleet listing and dashboard; required with Accept
+	Token string `mapstructure:"token" secret:"true"`
+	// TTL drops a registered agent that hasn't registered again for this
+	// long
+	TTL time.Duration `mapstructure:"ttl"`
+	// Aggregator is the base URL of the aggregator to register with; empty
+	// doesn't register
+	Aggregator string `mapstructure:"aggregator"`
+	// Name identifies this agent to the aggregator; default the host name
+	Name string `mapstructure:"name"`
+	Site string `mapstructure:"site"`
+	// URL is where the aggregator reaches this agent
+	URL      string        `mapstructure:"url"`
+	Interval time.Duration `mapstructure:"interval"`
+}
+
+// OutboxConfig keeps what the printer and heartbeat sinks couldn't deliver
+// in an on-disk queue, delivered in order once they're reachable again.
+type OutboxConfig struct {
+	// Dir holds a queue per sink; empty keeps nothing on disk
+	Dir string `mapstructure:"dir"`
+	// Key encrypts queued entries holding personal data, e.g. the name on
+	// a queue ticket; without one they aren't queued. It may be
+	// "keychain:<name>"
+	Key string `mapstructure:"key" secret:"true"`
+	// MaxBytes caps each sink's queue; the oldest entries are dropped
+	// beyond it
+	MaxBytes int64 `mapstructure:"maxBytes"`
+	// MaxAge drops entries older than this instead of delivering them
+	// late, per sink
+	MaxAge        OutboxMaxAge  `mapstructure:"maxAge"`
+	RetryInterval time.Duration `mapstructure:"retryInterval"`
+	// MaxAttempts moves an entry aside once this many attempts to deliver
+	// it have failed while the entry behind it is delivered, so it doesn't
+	// hold up the queue; 0 keeps trying until MaxAge
+	MaxAttempts int `mapstructure:"maxAttempts"`
+}
+
+// OutboxMaxAge is how long each sink's entries are worth delivering; 0 keeps
+// them until delivered.
+type OutboxMaxAge struct {
+	Printer   time.Duration `mapstructure:"printer"`
+	Heartbeat time.Duration `mapstructure:"heartbeat"`
+}
+
+// For returns the maximum age of the entries of the sink called name.
+func (m OutboxMaxAge) For(name string) time.Duration {
+	switch name {
+	case "printer":
+		return m.Printer
+	case "heartbeat":
+		return m.Heartbeat
+	}
+	return 0
+}
+
+// HeartbeatConfig reports the agent's health to a management server on an
+// interval, so dead kiosks are noticed. Heartbeats never hold card data.
+type HeartbeatConfig struct {
+	// URL is POSTed a heartbeat every Interval; empty disables heartbeats
+	URL string `mapstructure:"url"`
+	// AgentID identifies this agent; default the host name
+	AgentID string `mapstructure:"agentId"`
+	// Token is sent as a bearer token when set
+	Token    string        `mapstructure:"token" secret:"true"`
+	Interval time.Duration `mapstructure:"interval"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+}
+
+// ResolveAgentID returns AgentID, or the host name when it isn't set.
+func (c HeartbeatConfig) ResolveAgentID() string {
+	if c.AgentID != "" {
+		return c.AgentID
+	}
+	hostname, _ := os.Hostname()
+	return hostname
+}
+
+// GeocodeConfig places the card holder's address on the map in the geocode
+// pipeline step, for logistics and home-visit scheduling.
+type GeocodeConfig struct {
+	// Provider is nominatim or a provider a custom build registers; empty
+	// only gives the approximate centre of the province
+	Provider string `mapstructure:"provider"`
+	// URL is the Nominatim server
+	URL string `mapstructure:"url"`
+	// Timeout bounds a lookup, which holds up the card's announcement
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// StoreConfig persists successful reads, so they can be searched later or
+// kept in a deployment's own database.
+type StoreConfig struct {
+	// Type is StoreNone, StoreMemory, StoreSQLite or StorePostgres
+	Type string `mapstructure:"type"`
+	// DSN is the SQLite file or the PostgreSQL connection URL. It may be
+	// "keychain:<name>" to read it from the OS credential store
+	DSN string `mapstructure:"dsn" secret:"true"`
+	// Driver is the database/sql driver name; default sqlite for SQLite
+	// and pgx for PostgreSQL
+	Driver string `mapstructure:"driver"`
+	// MaxReads is how many reads the memory store keeps
+	MaxReads int `mapstructure:"maxReads"`
+}
+
+// Store types.
+const (
+	StoreNone     = "none"
+	StoreMemory   = "memory"
+	StoreSQLite   = "sqlite"
+	StorePostgres = "postgres"
+)
+
+// PrinterConfig prints an ESC/POS queue ticket on a receipt printer after
+// each successful read, for self check-in kiosks.
+type PrinterConfig struct {
+	// Address is tcp://host:port for a network printer, or the device or
+	// share a USB printer is written to, e.g. /dev/usb/lp0 or
+	// \\localhost\receipt; empty disables tickets
+	Address string `mapstructure:"address"`
+	// Header is printed above the queue number
+	Header string `mapstructure:"header"`
+	// Prefix is put before the number, e.g. A for A001
+	Prefix string `mapstructure:"prefix"`
+	// ResetDaily starts numbering at 1 again each day
+	ResetDaily bool `mapstructure:"resetDaily"`
+	// Name prints the holder's first name and last initial: PrinterNameEN,
+	// PrinterNameTH (needs CodePage) or PrinterNameNone
+	Name string `mapstructure:"name"`
+	// CodePage is the printer's code page number for Thai (TIS-620)
+	CodePage int           `mapstructure:"codePage"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+}
+
+// Names printed on queue tickets.
+const (
+	PrinterNameEN   = "en"
+	PrinterNameTH   = "th"
+	PrinterNameNone = "none"
+)
+
+// USBConfig watches the USB bus for smart card readers that PC/SC doesn't
+// list, to point out missing drivers.
+type USBConfig struct {
+	Watch    bool          `mapstructure:"watch"`
+	Interval time.Duration `mapstructure:"interval"`
+	// Devices are readers that aren't USB CCID class devices, as VID:PID
+	// in hex, e.g. 072F:90CC
+	Devices []string `mapstructure:"devices"`
+}
+
+// CORSConfig sets CORS per route, e.g. to keep /health open to any origin
+// while the rest of the API is locked down.
+type CORSConfig struct {
+	// Rules are tried in order. Routes no rule matches allow
+	// server.allowedOrigins with the default methods and headers
+	Rules []CORSRule `mapstructure:"rules"`
+}
+
+type CORSRule struct {
+	// Paths are request paths, exact ("/health") or ending in /* for the
+	// paths below ("/admin/*")
+	Paths []string `mapstructure:"paths"`
+	// AllowOrigins defaults to server.allowedOrigins
+	AllowOrigins []string `mapstructure:"allowOrigins"`
+	// AllowMethods defaults to the common REST methods and AllowHeaders
+	// to the headers a preflight asks for
+	AllowMethods     []string `mapstructure:"allowMethods"`
+	AllowHeaders     []string `mapstructure:"allowHeaders"`
+	ExposeHeaders    []string `mapstructure:"exposeHeaders"`
+	AllowCredentials bool     `mapstructure:"allowCredentials"`
+	// MaxAge lets browsers cache a preflight result (0 = not sent)
+	MaxAge time.Duration `mapstructure:"maxAge"`
+}
+
+// Matches reports whether the rule applies to a request path.
+func (r CORSRule) Matches(path string) bool {
+	for _, p := range r.Paths {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		} else if path == p {
+			return true
+		}
+	}
+	return false
+}
+
+// CompatConfig serves the paths and payload shapes of other card agents, so
+// web apps written against them work unchanged.
+type CompatConfig struct {
+	// Formats are served under /compat/<format>/
+	Formats []string `mapstructure:"formats"`
+}
+
+// CompatThaiNationalIDCard is the Personal object of the ThaiNationalIDCard
+// library, which many local agents return as is.
+const CompatThaiNationalIDCard = "thainationalidcard"
+
+type StatsConfig struct {
+	// Interval broadcasts STATS this often (0 disables)
+	Interval time.Duration `mapstructure:"interval"`
 }
 
 type ServerConfig struct {
 	Port int `mapstructure:"port"`
+	// MaxClientBufferBytes caps the bytes queued for one WebSocket client;
+	// messages beyond it are dropped for that client
+	MaxClientBufferBytes int64 `mapstructure:"maxClientBufferBytes"`
+	// EventBuffer is how many recent events are kept for clients that
+	// reconnect with ?since=<seq>
+	EventBuffer int `mapstructure:"eventBuffer"`
+	// BroadcastQueue is how many broadcasts may wait for delivery; beyond
+	// it broadcasts fail instead of blocking the card reader
+	BroadcastQueue int `mapstructure:"broadcastQueue"`
+	// EventTTL drops events of a type once they're older than their TTL
+	// instead of delivering them late, e.g. from a replay or a backlog
+	// built up during a network blip
+	EventTTL []EventTTL `mapstructure:"eventTTL"`
+	// AckEvents must be acknowledged by clients connected with ?ack=true;
+	// they are resent every AckTimeout, up to AckRetries times
+	AckEvents  []string      `mapstructure:"ackEvents"`
+	AckTimeout time.Duration `mapstructure:"ackTimeout"`
+	AckRetries int           `mapstructure:"ackRetries"`
+	// RequireHello makes WebSocket clients identify themselves with HELLO
+	// within HelloTimeout before they receive events
+	RequireHello bool          `mapstructure:"requireHello"`
+	HelloTimeout time.Duration `mapstructure:"helloTimeout"`
+	// JSONNaming renames event payload keys for clients that don't ask
+	// for a naming themselves: domain.NamingCamel, domain.NamingSnake or
+	// "" for keys as declared
+	JSONNaming string `mapstructure:"jsonNaming"`
+	// ReadTimeout bounds on-demand reads (POST /read, GET /card/photo);
+	// 0 waits as long as the read takes
+	ReadTimeout time.Duration `mapstructure:"readTimeout"`
+	// IdempotencyWindow is the bucket card insertion times are rounded to
+	// in the idempotency keys of card events, so reading the same card in
+	// the same reader again within it gives the same key
+	IdempotencyWindow time.Duration `mapstructure:"idempotencyWindow"`
+	// EnvelopeMetadata adds fields from domain.EnvelopeMetadata to every
+	// message envelope; empty keeps the envelope of the negotiated protocol
+	EnvelopeMetadata []string `mapstructure:"envelopeMetadata"`
+	// AllowedOrigins are the web origins allowed to call the REST API and
+	// open a WebSocket, e.g. https://kiosk.example.com; "*" allows any
+	AllowedOrigins []string `mapstructure:"allowedOrigins"`
+	// AdminToken, when set, must be sent as a bearer token to use /admin.
+	// "keychain:<name>" reads it from the OS credential store
+	AdminToken string `mapstructure:"adminToken" secret:"true"`
+	// DemoPage serves the built-in test page at /demo/
+	DemoPage bool `mapstructure:"demoPage"`
+	// AccessLog logs every HTTP request
+	AccessLog bool `mapstructure:"accessLog"`
+	// SocketIO serves the events to Socket.IO clients at /socket.io/
+	SocketIO bool `mapstructure:"socketIO"`
+	// TLS serves HTTPS, with HTTP/2, when a certificate is set
+	TLS TLSConfig `mapstructure:"tls"`
+	// H2C serves HTTP/2 without TLS alongside HTTP/1.1
+	H2C bool `mapstructure:"h2c"`
+}
+
+type TLSConfig struct {
+	// CertFile and KeyFile are PEM files; empty serves plain HTTP
+	CertFile string `mapstructure:"certFile"`
+	KeyFile  string `mapstructure:"keyFile"`
+}
+
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != ""
+}
+
+// OriginAllowed reports whether a browser request from origin may connect.
+// Requests without an Origin header don't come from a web page and are
+// always allowed.
+func (s ServerConfig) OriginAllowed(origin string) bool {
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range s.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
 }
 
 type LogConfig struct {
 	Level string `mapstructure:"level"`
+	// RedactPII replaces citizen IDs with a per-run hash and leaves card
+	// data out of APDU logs
+	RedactPII bool `mapstructure:"redactPII"`
+	// Output sends the application log to syslog or eventlog (Windows)
+	// instead of stderr or File
+	Output string `mapstructure:"output"`
+	// Tag names the service in syslog and is the Event Log source
+	Tag string `mapstructure:"tag"`
+	// SyslogAddress is a remote syslog server as network://host:port;
+	// empty uses the local syslog
+	SyslogAddress string `mapstructure:"syslogAddress"`
+	// File receives the application log; empty logs to stderr
+	File   string          `mapstructure:"file"`
+	Rotate RotateConfig    `mapstructure:"rotate"`
+	Access AccessLogConfig `mapstructure:"access"`
 }
 
-func Load() (*Config, error) {
-	viper.SetConfigName("config")
-	viper.SetConfigType("yaml")
-	viper.AddConfigPath("./configs")
-	viper.AddConfigPath("../configs")
-	viper.AddConfigPath("../../configs")
+// RotateConfig limits the size of log files; 0 MB disables rotation.
+type RotateConfig struct {
+	MaxSizeMB  int `mapstructure:"maxSizeMB"`
+	MaxBackups int `mapstructure:"maxBackups"`
+}
 
-	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
-	viper.AutomaticEnv()
+// AccessLogConfig sets up the HTTP access log, which is kept apart from the
+// application log. It is written only while server.accessLog is on.
+type AccessLogConfig struct {
+	// File receives the access log; empty logs to stdout
+	File string `mapstructure:"file"`
+	// Format is json or text
+	Format string `mapstructure:"format"`
+	// Level is all, or errors for failed requests only
+	Level string `mapstructure:"level"`
+}
 
-	viper.SetDefault("server.port", 8080)
-	viper.SetDefault("log.level", "info")
+const (
+	AccessLogJSON   = "json"
+	AccessLogText   = "text"
+	AccessLogAll    = "all"
+	AccessLogErrors = "errors"
+)
+
+type CardConfig struct {
+	// Mode is CardModeFull, CardModeCIDOnly, which reads only the citizen
+	// ID, and the names with IncludeName, CardModeHashOnly, which announces
+	// only the citizen ID's digest salted with HashSalt, or CardModeAgeOnly,
+	// which announces only whether the holder is of each of AgeThresholds
+	Mode        string `mapstructure:"mode"`
+	IncludeName bool   `mapstructure:"includeName"`
+	HashSalt    string `mapstructure:"hashSalt" secret:"true"`
+	// AgeThresholds are the ages CardModeAgeOnly checks the holder against
+	AgeThresholds []int `mapstructure:"ageThresholds"`
+	// Disposition is applied when disconnecting after a read:
+	// leave, reset, unpower or keep (stay connected until removal)
+	Disposition string `mapstructure:"disposition"`
+	// Feedback flashes the LED and beeps on supported (ACS) readers
+	Feedback bool `mapstructure:"feedback"`
+	// LockTimeout is how long to keep retrying when another application
+	// holds the card before reporting it as in use
+	LockTimeout time.Duration `mapstructure:"lockTimeout"`
+	// StartService tries to start a stopped Windows Smart Card service
+	// (requires running elevated)
+	StartService bool `mapstructure:"startService"`
+	// IdleWhenNoClients pauses polling while no WebSocket or SSE clients are
+	// connected and no GET /card/wait is waiting; it has no effect while
+	// Config.Sinks has any
+	IdleWhenNoClients bool `mapstructure:"idleWhenNoClients"`
+	// Transliterate fills blank or garbled English names with an RTGS
+	// romanization of the Thai name
+	Transliterate bool `mapstructure:"transliterate"`
+	// IncludeRaw adds the names, dates and address as read, before
+	// parsing, to cards
+	IncludeRaw bool `mapstructure:"includeRaw"`
+	// StrictRead fails a read with the error of each field that failed,
+	// instead of announcing a partial card
+	StrictRead bool `mapstructure:"strictRead"`
+	// WaitForChanges blocks until a card or reader changes instead of
+	// polling every 500ms, to save power
+	WaitForChanges bool `mapstructure:"waitForChanges"`
+	// DuplicateWindow suppresses announcing the same citizen ID again within
+	// this long (0 disables), per reader or globally per DuplicateScope
+	DuplicateWindow time.Duration `mapstructure:"duplicateWindow"`
+	DuplicateScope  string        `mapstructure:"duplicateScope"`
+	// CircuitBreaker stops reading from a reader that keeps failing
+	CircuitBreaker CircuitBreakerConfig `mapstructure:"circuitBreaker"`
+	// Watchdog reports a card monitor that stops making progress
+	Watchdog WatchdogConfig `mapstructure:"watchdog"`
+}
+
+type WatchdogConfig struct {
+	// StallTimeout is how long a monitor iteration may take before the
+	// monitor counts as stalled (0 disables). Waits for a state change get
+	// another 30s on top
+	StallTimeout time.Duration `mapstructure:"stallTimeout"`
+	// ResetContext re-establishes the PC/SC context on a stall
+	ResetContext bool `mapstructure:"resetContext"`
+}
+
+type CircuitBreakerConfig struct {
+	// Failures is how many reads in a row must fail to stop reading from the
+	// reader (0 disables)
+	Failures int `mapstructure:"failures"`
+	// ProbeInterval is how often a degraded reader is tried again
+	ProbeInterval time.Duration `mapstructure:"probeInterval"`
+}
 
-	if err := viper.ReadInConfig(); err != nil {
+const (
+	DuplicateScopeReader = "reader"
+	DuplicateScopeGlobal = "global"
+)
+
+// Card read modes.
+const (
+	CardModeFull     = "full"
+	CardModeCIDOnly  = "cid-only"
+	CardModeHashOnly = "hash-only"
+	CardModeAgeOnly  = "age-only"
+)
+
+// CIDOnly reports whether only the citizen ID is read, in the express
+// cid-only or the hash-only mode.
+func (c CardConfig) CIDOnly() bool {
+	return c.Mode == CardModeCIDOnly || c.Mode == CardModeHashOnly
+}
+
+// Sinks returns the configured outputs that need the readers watched whether
+// or not clients are connected: the read store and printer take every read,
+// and heartbeats report the readers' state.
+func (c *Config) Sinks() []string {
+	var sinks []string
+	if c.Store.Type != "" && c.Store.Type != StoreNone {
+		sinks = append(sinks, "store")
+	}
+	if c.Printer.Address != "" {
+		sinks = append(sinks, "printer")
+	}
+	if c.Heartbeat.URL != "" {
+		sinks = append(sinks, "heartbeat")
+	}
+	return sinks
+}
+
+const (
+	PhotoDeliveryInline  = "inline"
+	PhotoDeliveryChunked = "chunked"
+	PhotoDeliveryURL     = "url"
+)
+
+type PhotoConfig struct {
+	// Enabled reads the photo; turning it off skips the slowest part of
+	// the read and keeps the photo out of every event and response
+	Enabled bool `mapstructure:"enabled"`
+	// Deferred leaves the photo out of the read on insertion; it is read
+	// when requested from GET /card/photo
+	Deferred bool `mapstructure:"deferred"`
+	// Delivery is inline (photoBase64 in CARD_INSERTED), chunked
+	// (separate PHOTO_CHUNK messages) or url (single-use REST link)
+	Delivery string `mapstructure:"delivery"`
+	// ChunkSize is the number of base64 characters per PHOTO_CHUNK
+	ChunkSize int `mapstructure:"chunkSize"`
+	// TokenTTL is how long a photo URL stays valid in url mode
+	TokenTTL time.Duration `mapstructure:"tokenTTL"`
+}
+
+// DatesConfig sets how each card date is output.
+type DatesConfig struct {
+	DateOfBirth DateFormat `mapstructure:"dateOfBirth"`
+	IssueDate   DateFormat `mapstructure:"issueDate"`
+	ExpireDate  DateFormat `mapstructure:"expireDate"`
+}
+
+type DateFormat struct {
+	// Calendar is the era of the ISO date: gregorian or buddhist
+	Calendar string `mapstructure:"calendar"`
+	// Display adds a Thai Buddhist Era display string, e.g. "1 มกราคม 2533"
+	Display bool `mapstructure:"display"`
+}
+
+type GenderConfig struct {
+	// Labels maps the card's gender code to the value output as gender
+	Labels map[string]string `mapstructure:"labels"`
+	// Unspecified is output for blank or unknown codes
+	Unspecified string `mapstructure:"unspecified"`
+}
+
+// Label returns the configured label for a gender code.
+func (c GenderConfig) Label(code string) string {
+	if label, ok := c.Labels[code]; ok {
+		return label
+	}
+	return c.Unspecified
+}
+
+type PrivacyConfig struct {
+	// MaskCitizenID masks the citizen ID in every card sent out, broadcast
+	// or returned over REST; clients can't opt out of it
+	MaskCitizenID bool `mapstructure:"maskCitizenId"`
+	// AutoClear broadcasts CLEAR_DATA and forgets a card ClearDelay after
+	// it is removed, or MaxDisplayTime after it was read (0 = no limit)
+	AutoClear      bool          `mapstructure:"autoClear"`
+	ClearDelay     time.Duration `mapstructure:"clearDelay"`
+	MaxDisplayTime time.Duration `mapstructure:"maxDisplayTime"`
+}
+
+type ReadersConfig struct {
+	Aliases []ReaderAlias `mapstructure:"aliases"`
+	// Preferred restricts monitoring to one reader (name or alias), failing
+	// over to another reader while it's unavailable
+	Preferred string `mapstructure:"preferred"`
+	// Serial are CCID readers attached by serial or Bluetooth SPP, which
+	// PC/SC doesn't see
+	Serial []SerialReader `mapstructure:"serial"`
+}
+
+// EventTTL is how long events of one type stay worth delivering.
+type EventTTL struct {
+	Type string        `mapstructure:"type"`
+	TTL  time.Duration `mapstructure:"ttl"`
+}
+
+// SerialReader is a reader on a serial port, e.g. the Bluetooth reader of a
+// mobile enrollment kit bound to /dev/rfcomm0 or COM5.
+type SerialReader struct {
+	// Name is the reader name used in events and ?reader= filters
+	Name   string `mapstructure:"name"`
+	Device string `mapstructure:"device"`
+	// BaudRate defaults to 9600; Bluetooth SPP links ignore it
+	BaudRate int `mapstructure:"baudRate"`
+}
+
+// SerialBaudRates are the baud rates a serial reader may use.
+var SerialBaudRates = []int{9600, 19200, 38400, 57600, 115200}
+
+// ReaderAlias gives a PC/SC reader a friendly name, e.g. "counter-1".
+type ReaderAlias struct {
+	Name  string `mapstructure:"name"`
+	Alias string `mapstructure:"alias"`
+}
+
+// AliasFor returns the alias configured for a reader, or "" if there is none.
+func (c ReadersConfig) AliasFor(reader string) string {
+	for _, a := range c.Aliases {
+		if a.Name == reader {
+			return a.Alias
+		}
+	}
+	return ""
+}
+
+// Resolve maps an alias to its reader name. Anything else is returned as is.
+func (c ReadersConfig) Resolve(nameOrAlias string) string {
+	for _, a := range c.Aliases {
+		if a.Alias == nameOrAlias {
+			return a.Name
+		}
+	}
+	return nameOrAlias
+}
+
+// EnvPrefix namespaces environment overrides so they don't collide with
+// other software's variables, e.g. THAIID_SERVER_PORT for server.port.
+const EnvPrefix = "THAIID"
+
+// LoadOptions selects the configuration to load.
+type LoadOptions struct {
+	// File is the config file to read (YAML, TOML or JSON by extension).
+	// When empty, THAIID_CONFIG is used, and failing that config.yaml,
+	// config.toml or config.json is searched for in the configs directory
+	// next to the executable and relative to the working directory
+	File string
+	// Profile is merged over the base configuration; when empty,
+	// THAIID_PROFILE or profile: in the file is used
+	Profile string
+}
+
+// Load reads the config file and THAIID_ environment overrides.
+func Load(opts LoadOptions) (*Config, error) {
+	v := newViper()
+
+	file := opts.File
+	if file == "" {
+		file = os.Getenv(EnvPrefix + "_CONFIG")
+	}
+	if file != "" {
+		v.SetConfigFile(file)
+	} else {
+		v.SetConfigName("config")
+		// Services start in a different working directory, e.g. C:\Windows\System32
+		if exe, err := os.Executable(); err == nil {
+			v.AddConfigPath(filepath.Join(filepath.Dir(exe), "configs"))
+		}
+		v.AddConfigPath("./configs")
+		v.AddConfigPath("../configs")
+		v.AddConfigPath("../../configs")
+	}
+
+	if err := v.ReadInConfig(); err != nil {
+		// Running on defaults is fine unless a file was asked for
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
 			return nil, err
 		}
 	}
 
+	return build(v, v.ConfigFileUsed(), opts.Profile)
+}
+
+// newViper returns a viper with the defaults and THAIID_ environment
+// overrides set up, ready for a config file to be read.
+func newViper() *viper.Viper {
+	v := viper.New()
+
+	// THAIID_SERVER_PORT overrides server.port, and so on
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+
+	v.SetDefault("server.port", 8080)
+	v.SetDefault("server.maxClientBufferBytes", 2*1024*1024)
+	v.SetDefault("server.eventBuffer", 100)
+	v.SetDefault("server.broadcastQueue", 1024)
+	v.SetDefault("server.ackEvents", []string{"CARD_INSERTED"})
+	v.SetDefault("server.ackTimeout", "5s")
+	v.SetDefault("server.ackRetries", 3)
+	v.SetDefault("server.requireHello", false)
+	v.SetDefault("server.helloTimeout", "10s")
+	v.SetDefault("server.jsonNaming", "")
+	v.SetDefault("server.readTimeout", "30s")
+	v.SetDefault("server.idempotencyWindow", "1m")
+	v.SetDefault("server.envelopeMetadata", []string{})
+	v.SetDefault("server.allowedOrigins", []string{"*"})
+	v.SetDefault("server.adminToken", "")
+	v.SetDefault("server.demoPage", true)
+	v.SetDefault("server.accessLog", true)
+	v.SetDefault("server.socketIO", false)
+	v.SetDefault("server.tls.certFile", "")
+	v.SetDefault("server.tls.keyFile", "")
+	v.SetDefault("server.h2c", false)
+	v.SetDefault("log.level", "info")
+	v.SetDefault("log.redactPII", true)
+	v.SetDefault("log.output", "")
+	v.SetDefault("log.tag", "thai-id-card-reader")
+	v.SetDefault("log.syslogAddress", "")
+	v.SetDefault("log.file", "")
+	v.SetDefault("log.rotate.maxSizeMB", 10)
+	v.SetDefault("log.rotate.maxBackups", 5)
+	v.SetDefault("log.access.file", "")
+	v.SetDefault("log.access.format", AccessLogJSON)
+	v.SetDefault("log.access.level", AccessLogAll)
+	v.SetDefault("card.mode", CardModeFull)
+	v.SetDefault("card.includeName", false)
+	v.SetDefault("card.hashSalt", "")
+	v.SetDefault("card.ageThresholds", []int{20})
+	v.SetDefault("card.disposition", "leave")
+	v.SetDefault("card.feedback", false)
+	v.SetDefault("card.lockTimeout", "5s")
+	v.SetDefault("card.circuitBreaker.failures", 5)
+	v.SetDefault("card.circuitBreaker.probeInterval", "30s")
+	v.SetDefault("card.watchdog.stallTimeout", "60s")
+	v.SetDefault("card.watchdog.resetContext", false)
+	v.SetDefault("card.startService", false)
+	v.SetDefault("card.idleWhenNoClients", false)
+	v.SetDefault("card.transliterate", false)
+	v.SetDefault("card.includeRaw", false)
+	v.SetDefault("card.strictRead", false)
+	v.SetDefault("card.waitForChanges", false)
+	v.SetDefault("card.duplicateWindow", "0s")
+	v.SetDefault("card.duplicateScope", DuplicateScopeReader)
+	v.SetDefault("readers.preferred", "")
+	v.SetDefault("photo.enabled", true)
+	v.SetDefault("photo.deferred", false)
+	v.SetDefault("photo.delivery", PhotoDeliveryInline)
+	v.SetDefault("photo.chunkSize", 4096)
+	v.SetDefault("photo.tokenTTL", "60s")
+	v.SetDefault("privacy.maskCitizenId", false)
+	v.SetDefault("privacy.autoClear", false)
+	v.SetDefault("privacy.clearDelay", "0s")
+	v.SetDefault("privacy.maxDisplayTime", "0s")
+	v.SetDefault("gender.labels", map[string]string{"1": "male", "2": "female"})
+	v.SetDefault("gender.unspecified", "unspecified")
+	for _, field := range []string{"dateOfBirth", "issueDate", "expireDate"} {
+		v.SetDefault("dates."+field+".calendar", "gregorian")
+		v.SetDefault("dates."+field+".display", false)
+	}
+	v.SetDefault("stats.interval", "0s")
+	v.SetDefault("crash.dsn", "")
+	v.SetDefault("crash.environment", "production")
+	v.SetDefault("crash.failureThreshold", 3)
+	v.SetDefault("compat.formats", []string{})
+	v.SetDefault("cors.rules", []map[string]interface{}{})
+	v.SetDefault("usb.watch", false)
+	v.SetDefault("usb.interval", "5s")
+	v.SetDefault("usb.devices", []string{})
+	v.SetDefault("ldap.url", "")
+	v.SetDefault("ldap.startTLS", false)
+	v.SetDefault("ldap.bindDN", "")
+	v.SetDefault("ldap.bindPassword", "")
+	v.SetDefault("ldap.baseDN", "")
+	v.SetDefault("ldap.citizenIdAttribute", "")
+	v.SetDefault("ldap.attributes", []string{"employeeID", "department"})
+	v.SetDefault("ldap.timeout", "2s")
+	v.SetDefault("printer.address", "")
+	v.SetDefault("printer.header", "Queue number")
+	v.SetDefault("printer.prefix", "")
+	v.SetDefault("printer.resetDaily", true)
+	v.SetDefault("printer.name", PrinterNameEN)
+	v.SetDefault("printer.codePage", 0)
+	v.SetDefault("printer.timeout", "5s")
+	v.SetDefault("pipeline.steps", []string{"enrich"})
+	v.SetDefault("remote.agents", []map[string]interface{}{})
+	v.SetDefault("fleet.accept", false)
+	v.SetDefault("fleet.token", "")
+	v.SetDefault("fleet.ttl", "3m")
+	v.SetDefault("fleet.aggregator", "")
+	v.SetDefault("fleet.name", "")
+	v.SetDefault("fleet.site", "")
+	v.SetDefault("fleet.url", "")
+	v.SetDefault("fleet.interval", "1m")
+	v.SetDefault("heartbeat.url", "")
+	v.SetDefault("geocode.provider", "")
+	v.SetDefault("geocode.url", "https://nominatim.openstreetmap.org")
+	v.SetDefault("geocode.timeout", "3s")
+	v.SetDefault("store.type", StoreNone)
+	v.SetDefault("store.dsn", "")
+	v.SetDefault("store.driver", "")
+	v.SetDefault("store.maxReads", 10000)
+	v.SetDefault("outbox.dir", "")
+	v.SetDefault("outbox.key", "")
+	v.SetDefault("outbox.maxBytes", 10485760)
+	v.SetDefault("outbox.maxAge.printer", "5m")
+	v.SetDefault("outbox.maxAge.heartbeat", "24h")
+	v.SetDefault("outbox.retryInterval", "30s")
+	v.SetDefault("outbox.maxAttempts", 10)
+	v.SetDefault("heartbeat.agentId", "")
+	v.SetDefault("heartbeat.token", "")
+	v.SetDefault("heartbeat.interval", "5m")
+	v.SetDefault("heartbeat.timeout", "10s")
+	for _, name := range knownFeatures {
+		v.SetDefault("features."+name, false)
+	}
+
+	return v
+}
+
+// build applies the profile, resolves secrets and validates the settings
+// read into v from file.
+func build(v *viper.Viper, file, profile string) (*Config, error) {
+	override := profile
+	if profile == "" {
+		profile = v.GetString("profile")
+	}
+	if profile != "" {
+		if err := applyProfile(v, file, profile); err != nil {
+			return nil, err
+		}
+	}
+
 	var config Config
-	if err := viper.Unmarshal(&config); err != nil {
+	if err := v.Unmarshal(&config); err != nil {
+		return nil, err
+	}
+	config.Profile = profile
+	config.file = file
+	config.profileOverride = override
+
+	if err := resolveSecrets(reflect.ValueOf(&config).Elem(), ""); err != nil {
 		return nil, err
 	}
 
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
 	return &config, nil
-}
\ No newline at end of file
+}
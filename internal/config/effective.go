@@ -0,0 +1,55 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// redacted replaces the value of settings tagged `secret:"true"`.
+const redacted = "[redacted]"
+
+// Effective returns the configuration in use as a tree keyed like the config
+// file, with durations as strings and secrets redacted.
+func (c *Config) Effective() map[string]interface{} {
+	return effectiveStruct(reflect.ValueOf(*c))
+}
+
+func effectiveStruct(v reflect.Value) map[string]interface{} {
+	out := make(map[string]interface{})
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key, _, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+		if field.Tag.Get("secret") == "true" {
+			if !v.Field(i).IsZero() {
+				out[key] = redacted
+			} else {
+				out[key] = ""
+			}
+			continue
+		}
+		out[key] = effectiveValue(v.Field(i))
+	}
+	return out
+}
+
+func effectiveValue(v reflect.Value) interface{} {
+	if d, ok := v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		return effectiveStruct(v)
+	case reflect.Slice:
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = effectiveValue(v.Index(i))
+		}
+		return items
+	}
+	return v.Interface()
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"sort"
+	"strings"
+)
+
+// Feature flags gate experimental behaviour so it can ship turned off and
+// be enabled site by site under features: in the config file or a profile.
+const (
+	// FeatureEventMonitoring waits for PC/SC card and reader changes
+	// instead of polling, as card.waitForChanges does
+	FeatureEventMonitoring = "eventMonitoring"
+)
+
+// knownFeatures are the flags this build understands.
+var knownFeatures = []string{
+	FeatureEventMonitoring,
+}
+
+// Feature reports whether the named feature flag is on. Viper lower-cases
+// map keys, so names are matched without regard to case.
+func (c *Config) Feature(name string) bool {
+	for key, on := range c.Features {
+		if strings.EqualFold(key, name) {
+			return on
+		}
+	}
+	return false
+}
+
+// EnabledFeatures lists the known flags that are on.
+func (c *Config) EnabledFeatures() []string {
+	var enabled []string
+	for _, name := range knownFeatures {
+		if c.Feature(name) {
+			enabled = append(enabled, name)
+		}
+	}
+	return enabled
+}
+
+// UnknownFeatures lists the flags set that this build doesn't know, e.g.
+// from a configuration shared with newer versions. They are ignored.
+func (c *Config) UnknownFeatures() []string {
+	var unknown []string
+	for key := range c.Features {
+		found := false
+		for _, name := range knownFeatures {
+			found = found || strings.EqualFold(key, name)
+		}
+		if !found {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
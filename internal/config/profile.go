@@ -0,0 +1,97 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// builtinProfiles can be selected without being defined in the config file,
+// and extended by profiles that are.
+var builtinProfiles = map[string]map[string]interface{}{
+	// lowpower suits battery or solar powered units, e.g. a Raspberry Pi:
+	// no polling, cards powered down after reads, photos read on request and
+	// no per-request logging
+	"lowpower": {
+		"card": map[string]interface{}{
+			"waitForChanges": true,
+			"disposition":    "unpower",
+		},
+		"photo": map[string]interface{}{
+			"deferred": true,
+		},
+		"server": map[string]interface{}{
+			"accessLog": false,
+		},
+	},
+}
+
+// applyProfile merges a named profile over the base configuration. A
+// profile is a section under `profiles:` in the config file, a file next to
+// it named after the profile (config.<name>.yaml for config.yaml), or both;
+// the file wins. A section can
+// name another profile in `extends` to build on it.
+func applyProfile(v *viper.Viper, file, name string) error {
+	found := false
+
+	chain, err := profileChain(v, name)
+	if err != nil {
+		return err
+	}
+	for _, profile := range chain {
+		settings := builtinProfiles[profile]
+		if v.IsSet("profiles." + profile) {
+			settings = v.GetStringMap("profiles." + profile)
+			delete(settings, "extends")
+		}
+		if err := v.MergeConfigMap(settings); err != nil {
+			return fmt.Errorf("profile %q: %w", profile, err)
+		}
+		found = true
+	}
+
+	if file != "" {
+		ext := filepath.Ext(file)
+		path := strings.TrimSuffix(file, ext) + "." + name + ext
+		if f, err := os.Open(path); err == nil {
+			err = v.MergeConfig(f)
+			f.Close()
+			if err != nil {
+				return fmt.Errorf("profile %q: %s: %w", name, path, err)
+			}
+			found = true
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("profile %q: %w", name, err)
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("profile %q not found: add it under profiles: in the config file or create a config.%s file next to it", name, name)
+	}
+	return nil
+}
+
+// profileChain returns the profile sections to merge, the one furthest up
+// the extends chain first. It is empty when there is no section for name.
+func profileChain(v *viper.Viper, name string) ([]string, error) {
+	var chain []string
+	seen := make(map[string]bool)
+	for profile := name; profile != ""; profile = v.GetString("profiles." + profile + ".extends") {
+		if seen[profile] {
+			return nil, fmt.Errorf("profile %q: extends loops back to %q", name, profile)
+		}
+		seen[profile] = true
+		if !v.IsSet("profiles."+profile) && builtinProfiles[profile] == nil {
+			if profile == name {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("profile %q extends unknown profile %q", name, profile)
+		}
+		chain = append([]string{profile}, chain...)
+	}
+	return chain, nil
+}
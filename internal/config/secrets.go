@@ -0,0 +1,48 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/keychain"
+)
+
+// keychainPrefix marks a secret setting whose value is the name of an entry
+// in the OS credential store, e.g. adminToken: "keychain:adminToken".
+const keychainPrefix = "keychain:"
+
+// resolveSecrets replaces keychain references in settings tagged
+// `secret:"true"` with the secrets they name.
+func resolveSecrets(v reflect.Value, path string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key, _, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+		if path != "" {
+			key = path + "." + key
+		}
+
+		value := v.Field(i)
+		switch {
+		case value.Kind() == reflect.Struct:
+			if err := resolveSecrets(value, key); err != nil {
+				return err
+			}
+		case value.Kind() == reflect.String && field.Tag.Get("secret") == "true":
+			name, ok := strings.CutPrefix(value.String(), keychainPrefix)
+			if !ok {
+				continue
+			}
+			secret, err := keychain.Get(name)
+			if err != nil {
+				return fmt.Errorf("%s: reading %q from the OS credential store: %w", key, name, err)
+			}
+			value.SetString(secret)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,413 @@
+package config
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// InitOptions are the settings asked for by `card-service init`; everything
+// else is written with its default value.
+type InitOptions struct {
+	Port           int
+	PhotoEnabled   bool
+	AllowedOrigins []string
+}
+
+// DefaultInitOptions returns the values used in configs/config.yaml.
+func DefaultInitOptions() InitOptions {
+	return InitOptions{
+		Port:           8080,
+		PhotoEnabled:   true,
+		AllowedOrigins: []string{"*"},
+	}
+}
+
+// configTemplate is configs/config.yaml with the init settings filled in;
+// keep the two in sync when adding keys.
+var configTemplate = template.Must(template.New("config.yaml").Funcs(template.FuncMap{
+	"list": func(values []string) string {
+		quoted := make([]string, len(values))
+		for i, v := range values {
+			quoted[i] = strconv.Quote(v)
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	},
+}).Parse(`server:
+  # HTTP and WebSocket port
+  port: {{ .Port }}
+  # web origins allowed to use the API and WebSocket, e.g.
+  # ["https://kiosk.example.com"]; "*" allows any
+  allowedOrigins: {{ list .AllowedOrigins }}
+  # bearer token required for /admin, /history and SET_LOG_LEVEL (empty =
+  # /admin for local tools only). Use "keychain:<name>" to read it from the
+  # OS credential store instead
+  adminToken: ""
+  # serve the built-in test page at http://localhost:<port>/demo/
+  demoPage: true
+  # log every HTTP request
+  accessLog: true
+  # also serve events to Socket.IO clients at /socket.io/ (websocket
+  # transport only)
+  socketIO: false
+  # serve HTTPS (with HTTP/2) using these PEM files; empty = plain HTTP
+  tls:
+    certFile: ""
+    keyFile: ""
+  # serve HTTP/2 without TLS (h2c) alongside HTTP/1.1
+  h2c: false
+  # per-client cap on queued outgoing bytes; excess messages are dropped
+  maxClientBufferBytes: 2097152
+  # recent events kept for clients reconnecting with ?since=<seq>
+  eventBuffer: 100
+  # broadcasts waiting for delivery; when full, events are dropped rather
+  # than holding up card reads
+  broadcastQueue: 1024
+  # drop events older than their ttl rather than deliver them late, e.g. in
+  # a replay after a network blip; list the card state events together so a
+  # late CARD_INSERTED isn't replayed without its CARD_REMOVED
+  eventTTL: []
+  #  - type: "CARD_INSERTED"
+  #    ttl: "10s"
+  #  - type: "CARD_REMOVED"
+  #    ttl: "10s"
+  # events clients connected with ?ack=true must ACK; resent every
+  # ackTimeout up to ackRetries times
+  ackEvents: ["CARD_INSERTED"]
+  ackTimeout: "5s"
+  ackRetries: 3
+  # require clients to identify themselves with HELLO before they get events
+  requireHello: false
+  helloTimeout: "10s"
+  # event payload keys for clients that don't choose with HELLO or ?naming=:
+  # camel (prefixNameEn), snake (prefix_name_en) or "" as declared
+  jsonNaming: ""
+  # give up on-demand reads (POST /read, GET /card/photo) with 504 after
+  # this long; 0 = no limit
+  readTimeout: "30s"
+  # events about a card read carry an idempotencyKey, the same for reads of
+  # the same card in the same reader within this window, hashed with
+  # card.hashSalt (a random key per run when empty)
+  idempotencyWindow: "1m"
+  # add to every message, whatever the protocol version: timestamp,
+  # agentId (heartbeat.agentId), sequence (numbers each message on a
+  # connection) and readerName (the reader's alias). Off for legacy clients
+  envelopeMetadata: []
+
+log:
+  # info | debug | apdu
+  level: "info"
+  # hash citizen IDs and leave card data out of APDU logs
+  redactPII: true
+  # send the application log to syslog or eventlog (Windows Event Log)
+  # instead of stderr or file; tag names the service / Event Log source.
+  # syslogAddress: remote server, e.g. "udp://10.0.0.2:514" (empty = local)
+  output: ""
+  tag: "thai-id-card-reader"
+  syslogAddress: ""
+  # application log file (empty = stderr)
+  file: ""
+  # rotate log files at maxSizeMB (0 = never), keeping maxBackups old files
+  rotate:
+    maxSizeMB: 10
+    maxBackups: 5
+  # HTTP access log, separate from the application log (server.accessLog
+  # turns it off). file: empty = stdout; format: json | text;
+  # level: all | errors (failed requests only)
+  access:
+    file: ""
+    format: "json"
+    level: "all"
+
+card:
+  # full reads everything; cid-only reads just the citizen ID (plus the
+  # names with includeName) in about 150ms, for queue tickets or attendance;
+  # hash-only announces only a salted SHA-256 of the citizen ID, for
+  # deployments that must not process national IDs; age-only announces only
+  # whether the holder is at least each of ageThresholds years old
+  mode: "full"
+  includeName: false
+  # salt of hash-only digests; supports "keychain:<name>"
+  hashSalt: ""
+  ageThresholds: [20]
+  # leave | reset | unpower | keep
+  disposition: "leave"
+  # flash LED / beep on supported ACS readers
+  feedback: false
+  # wait this long for another application to release the card
+  lockTimeout: "5s"
+  # try to start a stopped Windows Smart Card service (needs elevation)
+  startService: false
+  # don't poll or read cards while no WebSocket or SSE clients are connected
+  # and no GET /card/wait is waiting; ignored with a read store, printer or heartbeat, which need every read
+  idleWhenNoClients: false
+  # romanize the Thai name (RTGS) when the English name is blank or garbled
+  transliterate: false
+  # add the names, dates and address as read, before parsing, as "raw"
+  includeRaw: false
+  # fail a read when any field fails to read (error 1011, listing each field
+  # and why) instead of sending a partial card, e.g. for e-KYC
+  strictRead: false
+  # block until a card or reader changes instead of polling every 500ms
+  waitForChanges: false
+  # don't announce the same citizen ID again within this window (0s = off);
+  # DUPLICATE_SCAN is sent instead. Scope: reader | global
+  duplicateWindow: "0s"
+  duplicateScope: "reader"
+  # after this many failed reads in a row stop reading from the reader and
+  # send READER_DEGRADED, trying again every probeInterval (0 = off)
+  circuitBreaker:
+    failures: 5
+    probeInterval: "30s"
+  # send MONITOR_STALLED and report degraded health when the card monitor
+  # hasn't finished a pass in stallTimeout (0 = off), e.g. a driver hanging;
+  # resetContext re-establishes the PC/SC context to try to recover
+  watchdog:
+    stallTimeout: "60s"
+    resetContext: false
+
+readers:
+  # Only read from this reader (name or alias) and fail over while it's gone
+  preferred: ""
+  # Friendly names shown in events and accepted by ?reader= filters
+  aliases: []
+  #  - name: "ACS ACR39U ICC Reader 0"
+  #    alias: "counter-1"
+  # CCID readers on a serial port or Bluetooth SPP link, e.g. the reader of a
+  # mobile enrollment kit; they must exchange APDUs, not TPDUs
+  serial: []
+  #  - name: "enrollment-kit"
+  #    device: "/dev/rfcomm0"   # or "COM5" on Windows
+  #    baudRate: 9600
+
+photo:
+  # read the card photo; false skips it and makes reads faster
+  enabled: {{ .PhotoEnabled }}
+  # leave the photo out of reads; fetch it from GET /card/photo when needed
+  deferred: false
+  # inline | chunked (send the photo as separate PHOTO_CHUNK messages)
+  # | url (send a single-use photoUrl instead of the photo)
+  delivery: "inline"
+  chunkSize: 4096
+  # How long a photoUrl stays valid in url mode
+  tokenTTL: "60s"
+
+privacy:
+  # mask the citizen ID in every card sent out, broadcast or returned by the
+  # REST and compat endpoints; clients cannot turn this off
+  maskCitizenId: false
+  # kiosks: broadcast CLEAR_DATA and forget the card clearDelay after it is
+  # removed, or maxDisplayTime after it was read (0s = until removed)
+  autoClear: false
+  clearDelay: "0s"
+  maxDisplayTime: "0s"
+
+dates:
+  # calendar: era of the ISO date (gregorian | buddhist)
+  # display: also add a Thai display string with the BE year, e.g. "1 มกราคม 2533"
+  dateOfBirth:
+    calendar: "gregorian"
+    display: false
+  issueDate:
+    calendar: "gregorian"
+    display: false
+  expireDate:
+    calendar: "gregorian"
+    display: false
+
+gender:
+  # output value per card gender code, e.g. "1": "ชาย", "2": "หญิง"
+  labels:
+    "1": "male"
+    "2": "female"
+  # output for blank or other codes (0, 3, ...)
+  unspecified: "unspecified"
+
+stats:
+  # broadcast STATS this often for dashboards (0s = off)
+  interval: "0s"
+
+crash:
+  # Sentry-compatible DSN (https://<key>@<host>/<project>) to report panics
+  # and repeated read failures to; empty = off. Reports include the app
+  # version, OS and reader name, never card data. Supports "keychain:<name>"
+  dsn: ""
+  environment: "production"
+  # report a reader after this many failed reads in a row (0 = never)
+  failureThreshold: 3
+
+compat:
+  # serve the paths and payloads of other card agents under
+  # /compat/<format>/ for apps written against them: thainationalidcard
+  formats: []
+
+cors:
+  # CORS per route, first match wins; other routes allow
+  # server.allowedOrigins. allowOrigins defaults to server.allowedOrigins
+  rules: []
+  # rules:
+  #   - paths: ["/health"]
+  #     allowOrigins: ["*"]
+  #   - paths: ["/admin/*"]
+  #     allowOrigins: ["https://fleet.example.com"]
+  #     allowMethods: ["GET", "PUT"]
+  #     allowHeaders: ["Authorization", "Content-Type"]
+  #     allowCredentials: true
+  #     maxAge: "10m"
+
+usb:
+  # look for USB smart card readers PC/SC doesn't list, usually because their
+  # driver is missing, and send READER_DRIVER_MISSING (Linux and Windows)
+  watch: false
+  interval: "5s"
+  # readers that aren't USB CCID class devices, as "VID:PID" in hex
+  devices: []
+
+ldap:
+  # look the card holder up in LDAP or Active Directory after a read and add
+  # their entry's attributes to the card as "directory", e.g. for staff
+  # check-in. url: ldap://host or ldaps://host; empty = off
+  url: ""
+  # upgrade an ldap:// connection to TLS before binding
+  startTLS: false
+  bindDN: ""
+  # supports "keychain:<name>"
+  bindPassword: ""
+  baseDN: ""
+  # attribute holding the citizen ID
+  citizenIdAttribute: ""
+  attributes: ["employeeID", "department"]
+  # a lookup delays the card's announcement by at most this long
+  timeout: "2s"
+
+printer:
+  # print a queue ticket (number and masked name) on an ESC/POS receipt
+  # printer after each new card, for self check-in. address: tcp://host:9100
+  # for a network printer, or the USB printer's device or share, e.g.
+  # /dev/usb/lp0 or \\localhost\receipt; empty = off
+  address: ""
+  header: "Queue number"
+  # put before the number, e.g. "A" for A001
+  prefix: ""
+  # start numbering at 1 again each day
+  resetDaily: true
+  # first name and last initial: en, th or none
+  name: "en"
+  # printer's code page for Thai (TIS-620), needed for name: th
+  codePage: 0
+  timeout: "5s"
+
+pipeline:
+  # processing each card goes through after a read, before it is announced,
+  # in this order: validate (reject a wrong citizen ID check digit), enrich
+  # (ldap lookup), geocode (see geocode) and steps registered by a custom
+  # build
+  steps: ["enrich"]
+
+remote:
+  # serve the cards of other agents instead of this machine's readers, so a
+  # central server offers one API over many counters. Their readers are
+  # named <name>/<reader>; the agents should use photo.delivery: inline and
+  # leave privacy.maskCitizenId off
+  agents: []
+  #  - name: "counter-1"
+  #    url: "http://10.0.0.11:8080"
+  #    site: "branch-1"     # groups agents on the fleet dashboard
+
+fleet:
+  # aggregator: accept agents that register themselves with POST
+  # /fleet/register and serve their cards like remote.agents; GET /fleet and
+  # /fleet/dashboard show each site's agents
+  accept: false
+  # bearer token agents register with, also needed for GET /fleet and
+  # /fleet/dashboard?token=; required with accept. Supports "keychain:<name>"
+  token: ""
+  # drop a registered agent that hasn't registered again for this long
+  ttl: "3m"
+  # agent: register with this aggregator every interval, as name at site,
+  # reachable at url. name defaults to the host name
+  aggregator: ""
+  name: ""
+  site: ""
+  url: ""
+  interval: "1m"
+
+heartbeat:
+  # POST the agent's ID, version, reader status and read counters (never
+  # card data) to this URL every interval, so dead kiosks are noticed;
+  # empty = off
+  url: ""
+  # defaults to the host name
+  agentId: ""
+  # sent as a bearer token when set. Supports "keychain:<name>"
+  token: ""
+  interval: "5m"
+  timeout: "10s"
+
+geocode:
+  # where the geocode pipeline step looks the card holder's address up, for
+  # logistics and home visits: nominatim (sends the address to url) or a
+  # provider registered by a custom build. Addresses it can't place, and
+  # all addresses when empty, get their province's approximate centre
+  provider: ""
+  url: "https://nominatim.openstreetmap.org"
+  # a lookup delays the card's announcement by at most this long
+  timeout: "3s"
+
+store:
+  # keep successful reads (without the photo) so they can be searched:
+  # none, memory (the last maxReads, lost on restart), sqlite or postgres
+  type: "none"
+  # SQLite file or PostgreSQL URL. Supports "keychain:<name>"
+  dsn: ""
+  # database/sql driver a custom build links; default sqlite or pgx
+  driver: ""
+  maxReads: 10000
+
+outbox:
+  # keep what the printer and heartbeat couldn't deliver in a queue per sink
+  # under this directory, and deliver it in order once they're back; empty =
+  # off, undelivered tickets and heartbeats are lost
+  dir: ""
+  # encrypts queued entries with personal data (names on tickets); without
+  # it they aren't queued. Any passphrase; supports "keychain:<name>"
+  key: ""
+  # per sink; the oldest entries are dropped beyond it
+  maxBytes: 10485760
+  # drop entries older than this instead of delivering them late (0 = keep);
+  # a ticket printed long after the holder left the counter is of no use
+  maxAge:
+    printer: "5m"
+    heartbeat: "24h"
+  retryInterval: "30s"
+  # move an entry aside to a rejected directory once it has failed this many
+  # times while the entry behind it gets through, or at once when the sink
+  # rejects it, so it doesn't hold up the queue (0 = retry until maxAge)
+  maxAttempts: 10
+
+# experimental behaviour, off until turned on here or in a profile
+features:
+  # wait for card and reader changes instead of polling, as
+  # card.waitForChanges does
+  eventMonitoring: false
+
+# Profiles override the settings above for one deployment type. Select one
+# with --profile <name> or THAIID_PROFILE; config.<name>.yaml next to this
+# file is merged as well. extends builds on another profile. The built-in
+# lowpower profile sets waitForChanges, deferred photos, unpower and no
+# access log, for battery powered units.
+# profiles:
+#   kiosk:
+#     card:
+#       disposition: "unpower"
+#   hospital:
+#     extends: kiosk
+#     server:
+#       ackEvents: ["CARD_INSERTED"]
+`))
+
+// WriteDefault writes a fully commented configuration file.
+func WriteDefault(w io.Writer, opts InitOptions) error {
+	return configTemplate.Execute(w, opts)
+}
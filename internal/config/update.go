@@ -0,0 +1,298 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrNoConfigFile is returned by Update when the service runs on defaults.
+var ErrNoConfigFile = errors.New("no config file is in use; create one with card-service init")
+
+// liveKeys take effect without a restart; the caller applies them.
+var liveKeys = map[string]bool{
+	"log.level":     true,
+	"log.redactPII": true,
+}
+
+var updateMu sync.Mutex
+
+// Update merges settings, a tree keyed like the config file, into the config
+// file c was loaded from. The result is loaded as on startup, so the file is
+// only written when it is valid, and is written to a temporary file renamed
+// over the original so it is never left half written. Comments in YAML files
+// are kept.
+//
+// It returns the new configuration and whether settings other than the log
+// level and PII redaction changed, which take effect on restart.
+func (c *Config) Update(settings map[string]interface{}) (*Config, bool, error) {
+	if c.file == "" {
+		return nil, false, ErrNoConfigFile
+	}
+
+	settings = normalize(settings).(map[string]interface{})
+	known := make(map[string]string)
+	flatten(c.Effective(), "", known)
+	keys, err := checkKeys(known, settings, "")
+	if err != nil {
+		return nil, false, err
+	}
+
+	updateMu.Lock()
+	defer updateMu.Unlock()
+
+	data, err := os.ReadFile(c.file)
+	if err != nil {
+		return nil, false, err
+	}
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(c.file)), ".")
+	data, err = merge(format, data, settings)
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %w", c.file, err)
+	}
+
+	v := newViper()
+	v.SetConfigType(format)
+	if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+		return nil, false, err
+	}
+	updated, err := build(v, c.file, c.profileOverride)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := writeAtomic(c.file, data); err != nil {
+		return nil, false, err
+	}
+
+	restart := false
+	for _, key := range keys {
+		restart = restart || !liveKeys[key]
+	}
+	return updated, restart, nil
+}
+
+// checkKeys rejects settings that aren't config keys and drops secrets sent
+// back as "[redacted]", as a client that edits the output of GET
+// /admin/config would. It returns the keys of the remaining settings.
+func checkKeys(known map[string]string, settings map[string]interface{}, prefix string) ([]string, error) {
+	var keys []string
+	for key, value := range settings {
+		path := prefix + key
+		if nested, ok := value.(map[string]interface{}); ok && knownKey(known, path) == "" {
+			more, err := checkKeys(known, nested, path+".")
+			if err != nil {
+				return nil, err
+			}
+			if len(nested) == 0 {
+				delete(settings, key)
+			}
+			keys = append(keys, more...)
+			continue
+		}
+
+		name := knownKey(known, path)
+		if name == "" && !strings.HasPrefix(strings.ToLower(path), "profiles.") && !strings.EqualFold(path, "profile") {
+			return nil, fmt.Errorf("unknown setting %s", path)
+		}
+		if value == redacted {
+			delete(settings, key)
+			continue
+		}
+		if name == "" {
+			name = path
+		}
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// knownKey returns the config key path names or is inside, e.g.
+// gender.labels for gender.labels.1, or "" if there is none.
+func knownKey(known map[string]string, path string) string {
+	lower := strings.ToLower(path)
+	for key, name := range known {
+		if lower == key || strings.HasPrefix(lower, key+".") {
+			return name
+		}
+	}
+	return ""
+}
+
+// flatten maps the lower-cased dotted path of each leaf setting to its
+// name.
+func flatten(tree map[string]interface{}, prefix string, out map[string]string) {
+	for key, value := range tree {
+		path := prefix + key
+		if nested, ok := value.(map[string]interface{}); ok {
+			flatten(nested, path+".", out)
+			continue
+		}
+		out[strings.ToLower(path)] = path
+	}
+}
+
+// normalize turns the json.Numbers of a request body into ints or floats so
+// every format encodes them as numbers.
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalize(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalize(item)
+		}
+	}
+	return value
+}
+
+// merge applies settings to the content of a config file in format.
+func merge(format string, data []byte, settings map[string]interface{}) ([]byte, error) {
+	switch format {
+	case "yaml", "yml":
+		var doc yaml.Node
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		if len(doc.Content) == 0 {
+			doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+		}
+		if err := mergeNode(doc.Content[0], settings); err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(&doc); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), enc.Close()
+	case "toml":
+		tree := make(map[string]interface{})
+		if err := toml.Unmarshal(data, &tree); err != nil {
+			return nil, err
+		}
+		mergeMap(tree, settings)
+		return toml.Marshal(tree)
+	case "json":
+		tree := make(map[string]interface{})
+		if err := json.Unmarshal(data, &tree); err != nil {
+			return nil, err
+		}
+		mergeMap(tree, settings)
+		out, err := json.MarshalIndent(tree, "", "  ")
+		return append(out, '\n'), err
+	}
+	return nil, fmt.Errorf("unsupported config format %q", format)
+}
+
+// mergeNode sets each setting in a YAML mapping, keeping the comments,
+// quoting and flow style of the values it replaces.
+func mergeNode(mapping *yaml.Node, settings map[string]interface{}) error {
+	if mapping.Kind != yaml.MappingNode {
+		return fmt.Errorf("expected a mapping at line %d", mapping.Line)
+	}
+
+	for key, value := range settings {
+		var existing *yaml.Node
+		for i := 0; i+1 < len(mapping.Content); i += 2 {
+			if strings.EqualFold(mapping.Content[i].Value, key) {
+				existing = mapping.Content[i+1]
+				break
+			}
+		}
+
+		nested, isMap := value.(map[string]interface{})
+		if existing != nil && isMap && existing.Kind == yaml.MappingNode {
+			if err := mergeNode(existing, nested); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var node yaml.Node
+		if err := node.Encode(value); err != nil {
+			return err
+		}
+		if existing == nil {
+			mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, &node)
+			continue
+		}
+		switch {
+		case node.Kind == yaml.ScalarNode && existing.Kind == yaml.ScalarNode && node.Tag == existing.Tag:
+			node.Style = existing.Style
+		case node.Kind == existing.Kind:
+			node.Style |= existing.Style & yaml.FlowStyle
+		}
+		node.HeadComment, node.LineComment, node.FootComment = existing.HeadComment, existing.LineComment, existing.FootComment
+		*existing = node
+	}
+	return nil
+}
+
+func mergeMap(tree, settings map[string]interface{}) {
+	for key, value := range settings {
+		name := key
+		for existing := range tree {
+			if strings.EqualFold(existing, key) {
+				name = existing
+				break
+			}
+		}
+
+		nested, isMap := value.(map[string]interface{})
+		if current, ok := tree[name].(map[string]interface{}); ok && isMap {
+			mergeMap(current, nested)
+			continue
+		}
+		tree[name] = value
+	}
+}
+
+// writeAtomic replaces the file at path with data, keeping its permissions.
+func writeAtomic(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,448 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/logging"
+	"github.com/cortex-x/go-thai-id-card-reader/pkg/geocode"
+	"github.com/cortex-x/go-thai-id-card-reader/pkg/pipeline"
+)
+
+// Validate checks the loaded configuration and reports every invalid field
+// by its config key, so mistakes fail at startup rather than surfacing as
+// runtime errors later.
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(key string, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		fail("server.port", "must be between 1 and 65535, got %d", c.Server.Port)
+	}
+	if c.Server.MaxClientBufferBytes < 0 {
+		fail("server.maxClientBufferBytes", "must not be negative")
+	}
+	if c.Server.EventBuffer < 0 {
+		fail("server.eventBuffer", "must not be negative")
+	}
+	if c.Server.BroadcastQueue < 1 {
+		fail("server.broadcastQueue", "must be at least 1, got %d", c.Server.BroadcastQueue)
+	}
+	ttlTypes := make(map[string]bool)
+	for i, ttl := range c.Server.EventTTL {
+		key := fmt.Sprintf("server.eventTTL[%d]", i)
+		switch {
+		case ttl.Type == "":
+			fail(key+".type", "must not be empty")
+		case ttlTypes[ttl.Type]:
+			fail(key+".type", "%s is listed more than once", ttl.Type)
+		}
+		if ttl.TTL <= 0 {
+			fail(key+".ttl", "must be positive")
+		}
+		ttlTypes[ttl.Type] = true
+	}
+	if len(c.Server.AckEvents) > 0 && c.Server.AckTimeout <= 0 {
+		fail("server.ackTimeout", "must be positive when server.ackEvents is set")
+	}
+	if c.Server.AckRetries < 0 {
+		fail("server.ackRetries", "must not be negative")
+	}
+	if c.Server.ReadTimeout < 0 {
+		fail("server.readTimeout", "must not be negative")
+	}
+	if c.Server.IdempotencyWindow <= 0 {
+		fail("server.idempotencyWindow", "must be positive")
+	}
+	for _, field := range c.Server.EnvelopeMetadata {
+		if !slices.Contains(domain.EnvelopeMetadata, field) {
+			fail("server.envelopeMetadata", "unknown field %q, must be one of %s", field, strings.Join(domain.EnvelopeMetadata, ", "))
+		}
+	}
+	if c.Server.RequireHello && c.Server.HelloTimeout <= 0 {
+		fail("server.helloTimeout", "must be positive when server.requireHello is set")
+	}
+	if !domain.ValidNaming(c.Server.JSONNaming) {
+		fail("server.jsonNaming", "must be %s, %s or empty, got %q", domain.NamingCamel, domain.NamingSnake, c.Server.JSONNaming)
+	}
+
+	if (c.Server.TLS.CertFile == "") != (c.Server.TLS.KeyFile == "") {
+		fail("server.tls", "certFile and keyFile must be set together")
+	}
+
+	for i, origin := range c.Server.AllowedOrigins {
+		if !validOrigin(origin) {
+			fail(fmt.Sprintf("server.allowedOrigins[%d]", i), "must be \"*\" or an origin like https://example.com, got %q", origin)
+		}
+	}
+	for i, rule := range c.CORS.Rules {
+		key := fmt.Sprintf("cors.rules[%d]", i)
+		if len(rule.Paths) == 0 {
+			fail(key+".paths", "must list at least one path")
+		}
+		for j, path := range rule.Paths {
+			if !strings.HasPrefix(path, "/") && path != "*" {
+				fail(fmt.Sprintf("%s.paths[%d]", key, j), "must start with /, got %q", path)
+			}
+		}
+		for j, origin := range rule.AllowOrigins {
+			if !validOrigin(origin) {
+				fail(fmt.Sprintf("%s.allowOrigins[%d]", key, j), "must be \"*\" or an origin like https://example.com, got %q", origin)
+			}
+		}
+		origins := rule.AllowOrigins
+		if len(origins) == 0 {
+			origins = c.Server.AllowedOrigins
+		}
+		if rule.AllowCredentials && slices.Contains(origins, "*") {
+			fail(key+".allowCredentials", "needs explicit allowOrigins, not \"*\"")
+		}
+		if rule.MaxAge < 0 {
+			fail(key+".maxAge", "must not be negative")
+		}
+	}
+
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		fail("log.level", "%v", err)
+	}
+	switch c.Log.Output {
+	case "", logging.OutputSyslog, logging.OutputEventLog:
+	default:
+		fail("log.output", "must be empty, %s or %s, got %q", logging.OutputSyslog, logging.OutputEventLog, c.Log.Output)
+	}
+	if c.Log.Output != "" && c.Log.Tag == "" {
+		fail("log.tag", "must not be empty when log.output is set")
+	}
+	if c.Log.Output != "" && c.Log.File != "" {
+		fail("log.file", "can't be used with log.output %s", c.Log.Output)
+	}
+	if c.Log.Rotate.MaxSizeMB < 0 {
+		fail("log.rotate.maxSizeMB", "must not be negative")
+	}
+	if c.Log.Rotate.MaxBackups < 0 {
+		fail("log.rotate.maxBackups", "must not be negative")
+	}
+	if c.Log.Access.Format != AccessLogJSON && c.Log.Access.Format != AccessLogText {
+		fail("log.access.format", "must be %s or %s, got %q", AccessLogJSON, AccessLogText, c.Log.Access.Format)
+	}
+	if c.Log.Access.Level != AccessLogAll && c.Log.Access.Level != AccessLogErrors {
+		fail("log.access.level", "must be %s or %s, got %q", AccessLogAll, AccessLogErrors, c.Log.Access.Level)
+	}
+
+	if !slices.Contains([]string{"", "leave", "reset", "unpower", "keep"}, c.Card.Disposition) {
+		fail("card.disposition", "must be leave, reset, unpower or keep, got %q", c.Card.Disposition)
+	}
+	if c.Card.LockTimeout < 0 {
+		fail("card.lockTimeout", "must not be negative")
+	}
+	if c.Card.CircuitBreaker.Failures < 0 {
+		fail("card.circuitBreaker.failures", "must not be negative")
+	}
+	if c.Card.CircuitBreaker.Failures > 0 && c.Card.CircuitBreaker.ProbeInterval <= 0 {
+		fail("card.circuitBreaker.probeInterval", "must be positive when card.circuitBreaker.failures is set")
+	}
+	if c.Card.Watchdog.StallTimeout < 0 {
+		fail("card.watchdog.stallTimeout", "must not be negative")
+	}
+	switch c.Card.Mode {
+	case CardModeFull, CardModeCIDOnly:
+	case CardModeHashOnly:
+		if c.Card.HashSalt == "" {
+			fail("card.hashSalt", "must be set in %s mode", CardModeHashOnly)
+		}
+	case CardModeAgeOnly:
+		if len(c.Card.AgeThresholds) == 0 {
+			fail("card.ageThresholds", "must list at least one age in %s mode", CardModeAgeOnly)
+		}
+		for _, age := range c.Card.AgeThresholds {
+			if age < 1 || age > 150 {
+				fail("card.ageThresholds", "must be between 1 and 150, got %d", age)
+			}
+		}
+	default:
+		fail("card.mode", "must be %s, %s, %s or %s, got %q", CardModeFull, CardModeCIDOnly, CardModeHashOnly, CardModeAgeOnly, c.Card.Mode)
+	}
+	if (c.Card.Mode == CardModeHashOnly || c.Card.Mode == CardModeAgeOnly) && slices.Contains(c.Pipeline.Steps, pipeline.StepValidate) {
+		fail("pipeline.steps", "the %s step needs the citizen ID, which %s mode doesn't keep", pipeline.StepValidate, c.Card.Mode)
+	}
+	if c.Card.DuplicateWindow < 0 {
+		fail("card.duplicateWindow", "must not be negative")
+	}
+	if c.Card.DuplicateScope != DuplicateScopeReader && c.Card.DuplicateScope != DuplicateScopeGlobal {
+		fail("card.duplicateScope", "must be %s or %s, got %q", DuplicateScopeReader, DuplicateScopeGlobal, c.Card.DuplicateScope)
+	}
+
+	names := make(map[string]bool)
+	aliases := make(map[string]bool)
+	for i, alias := range c.Readers.Aliases {
+		key := fmt.Sprintf("readers.aliases[%d]", i)
+		switch {
+		case alias.Name == "":
+			fail(key+".name", "must not be empty")
+		case names[alias.Name]:
+			fail(key+".name", "reader %q already has an alias", alias.Name)
+		}
+		switch {
+		case alias.Alias == "":
+			fail(key+".alias", "must not be empty")
+		case aliases[alias.Alias]:
+			fail(key+".alias", "alias %q is used more than once", alias.Alias)
+		}
+		names[alias.Name] = true
+		aliases[alias.Alias] = true
+	}
+
+	serialNames := make(map[string]bool)
+	for i, serial := range c.Readers.Serial {
+		key := fmt.Sprintf("readers.serial[%d]", i)
+		switch {
+		case serial.Name == "":
+			fail(key+".name", "must not be empty")
+		case serialNames[serial.Name]:
+			fail(key+".name", "reader %q is listed more than once", serial.Name)
+		}
+		if serial.Device == "" {
+			fail(key+".device", "must not be empty")
+		}
+		if serial.BaudRate != 0 && !slices.Contains(SerialBaudRates, serial.BaudRate) {
+			fail(key+".baudRate", "must be one of %v, got %d", SerialBaudRates, serial.BaudRate)
+		}
+		serialNames[serial.Name] = true
+	}
+
+	switch c.Photo.Delivery {
+	case PhotoDeliveryInline:
+	case PhotoDeliveryChunked:
+		if c.Photo.ChunkSize < 4 {
+			fail("photo.chunkSize", "must be at least 4 when photo.delivery is chunked, got %d", c.Photo.ChunkSize)
+		}
+	case PhotoDeliveryURL:
+		if c.Photo.TokenTTL <= 0 {
+			fail("photo.tokenTTL", "must be positive when photo.delivery is url")
+		}
+	default:
+		fail("photo.delivery", "must be %s, %s or %s, got %q", PhotoDeliveryInline, PhotoDeliveryChunked, PhotoDeliveryURL, c.Photo.Delivery)
+	}
+
+	for key, format := range map[string]DateFormat{
+		"dates.dateOfBirth.calendar": c.Dates.DateOfBirth,
+		"dates.issueDate.calendar":   c.Dates.IssueDate,
+		"dates.expireDate.calendar":  c.Dates.ExpireDate,
+	} {
+		if format.Calendar != "gregorian" && format.Calendar != "buddhist" {
+			fail(key, "must be gregorian or buddhist, got %q", format.Calendar)
+		}
+	}
+
+	if c.Privacy.ClearDelay < 0 {
+		fail("privacy.clearDelay", "must not be negative")
+	}
+	if c.Privacy.MaxDisplayTime < 0 {
+		fail("privacy.maxDisplayTime", "must not be negative")
+	}
+
+	if c.Stats.Interval < 0 {
+		fail("stats.interval", "must not be negative")
+	}
+
+	if c.Crash.DSN != "" {
+		if u, err := url.Parse(c.Crash.DSN); err != nil || u.User == nil || u.Host == "" || strings.Trim(u.Path, "/") == "" {
+			fail("crash.dsn", "must look like https://<key>@<host>/<project>")
+		}
+	}
+	if c.Crash.FailureThreshold < 0 {
+		fail("crash.failureThreshold", "must not be negative")
+	}
+
+	if c.USB.Watch && c.USB.Interval <= 0 {
+		fail("usb.interval", "must be positive when usb.watch is set")
+	}
+	for i, id := range c.USB.Devices {
+		if !usbIDPattern.MatchString(id) {
+			fail(fmt.Sprintf("usb.devices[%d]", i), "must be VID:PID in hex, e.g. 072F:90CC, got %q", id)
+		}
+	}
+
+	if c.LDAP.URL != "" {
+		if u, err := url.Parse(c.LDAP.URL); err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+			fail("ldap.url", "must look like ldap://<host> or ldaps://<host>, got %q", c.LDAP.URL)
+		} else if c.LDAP.StartTLS && u.Scheme == "ldaps" {
+			fail("ldap.startTLS", "can't be used with ldaps://, which is TLS already")
+		}
+		if c.LDAP.BindDN != "" && c.LDAP.BindPassword == "" {
+			// An empty password would be an unauthenticated bind, which
+			// servers accept without checking anything
+			fail("ldap.bindPassword", "must be set when ldap.bindDN is set")
+		}
+		if c.LDAP.BaseDN == "" {
+			fail("ldap.baseDN", "must be set when ldap.url is set")
+		}
+		if c.LDAP.CitizenIDAttribute == "" {
+			fail("ldap.citizenIdAttribute", "must be set when ldap.url is set")
+		}
+		if len(c.LDAP.Attributes) == 0 {
+			fail("ldap.attributes", "must list at least one attribute when ldap.url is set")
+		}
+		if c.LDAP.Timeout <= 0 {
+			fail("ldap.timeout", "must be positive when ldap.url is set")
+		}
+	}
+
+	if c.Printer.Address != "" {
+		if strings.HasPrefix(c.Printer.Address, "tcp://") {
+			if _, _, err := net.SplitHostPort(strings.TrimPrefix(c.Printer.Address, "tcp://")); err != nil {
+				fail("printer.address", "must look like tcp://<host>:<port>, got %q", c.Printer.Address)
+			}
+		}
+		if c.Printer.Timeout <= 0 {
+			fail("printer.timeout", "must be positive when printer.address is set")
+		}
+	}
+	switch c.Printer.Name {
+	case PrinterNameEN, PrinterNameNone:
+	case PrinterNameTH:
+		if c.Printer.CodePage < 1 || c.Printer.CodePage > 255 {
+			fail("printer.codePage", "must be the printer's Thai code page (1-255) when printer.name is th, got %d", c.Printer.CodePage)
+		}
+	default:
+		fail("printer.name", "must be %s, %s or %s, got %q", PrinterNameEN, PrinterNameTH, PrinterNameNone, c.Printer.Name)
+	}
+
+	stepNames := pipeline.Names()
+	for i, step := range c.Pipeline.Steps {
+		if !slices.Contains(stepNames, step) {
+			fail("pipeline.steps", "unknown step %q (expected one of %s)", step, strings.Join(stepNames, ", "))
+		} else if slices.Contains(c.Pipeline.Steps[:i], step) {
+			fail("pipeline.steps", "step %q is listed twice", step)
+		}
+	}
+
+	agentNames := make(map[string]bool)
+	for i, agent := range c.Remote.Agents {
+		key := fmt.Sprintf("remote.agents[%d]", i)
+		switch {
+		case agent.Name == "":
+			fail(key+".name", "must not be empty")
+		case strings.Contains(agent.Name, "/"):
+			fail(key+".name", "must not contain /, got %q", agent.Name)
+		case agentNames[agent.Name]:
+			fail(key+".name", "agent %q is listed more than once", agent.Name)
+		}
+		if !validHTTPURL(agent.URL) {
+			fail(key+".url", "must look like http://<host>:<port> or https://<host>:<port>, got %q", agent.URL)
+		}
+		agentNames[agent.Name] = true
+	}
+
+	if c.Outbox.Dir != "" {
+		if c.Outbox.MaxBytes <= 0 {
+			fail("outbox.maxBytes", "must be positive when outbox.dir is set")
+		}
+		if c.Outbox.MaxAge.Printer < 0 {
+			fail("outbox.maxAge.printer", "must not be negative")
+		}
+		if c.Outbox.MaxAge.Heartbeat < 0 {
+			fail("outbox.maxAge.heartbeat", "must not be negative")
+		}
+		if c.Outbox.MaxAttempts < 0 {
+			fail("outbox.maxAttempts", "must not be negative")
+		}
+		if c.Outbox.RetryInterval <= 0 {
+			fail("outbox.retryInterval", "must be positive when outbox.dir is set")
+		}
+	}
+
+	if c.Fleet.Accept && c.Fleet.TTL <= 0 {
+		fail("fleet.ttl", "must be positive when fleet.accept is on")
+	}
+	if c.Fleet.Accept && c.Fleet.Token == "" {
+		// Anyone could otherwise register an agent whose card reads the
+		// aggregator rebroadcasts
+		fail("fleet.token", "must be set when fleet.accept is on")
+	}
+	if c.Fleet.Aggregator != "" {
+		if !validHTTPURL(c.Fleet.Aggregator) {
+			fail("fleet.aggregator", "must look like http://<host>:<port> or https://<host>:<port>, got %q", c.Fleet.Aggregator)
+		}
+		if !validHTTPURL(c.Fleet.URL) {
+			fail("fleet.url", "must be this agent's http:// or https:// URL as the aggregator reaches it, got %q", c.Fleet.URL)
+		}
+		if strings.Contains(c.Fleet.Name, "/") {
+			fail("fleet.name", "must not contain /, got %q", c.Fleet.Name)
+		}
+		if c.Fleet.Interval <= 0 {
+			fail("fleet.interval", "must be positive when fleet.aggregator is set")
+		}
+	}
+
+	if c.Heartbeat.URL != "" {
+		if !validHTTPURL(c.Heartbeat.URL) {
+			fail("heartbeat.url", "must be an http:// or https:// URL, got %q", c.Heartbeat.URL)
+		}
+		if c.Heartbeat.Interval <= 0 {
+			fail("heartbeat.interval", "must be positive when heartbeat.url is set")
+		}
+		if c.Heartbeat.Timeout <= 0 {
+			fail("heartbeat.timeout", "must be positive when heartbeat.url is set")
+		}
+	}
+
+	if c.Geocode.Provider != "" {
+		if providers := geocode.Names(); !slices.Contains(providers, c.Geocode.Provider) {
+			fail("geocode.provider", "unknown provider %q (expected one of %s)", c.Geocode.Provider, strings.Join(providers, ", "))
+		}
+		if c.Geocode.Provider == geocode.ProviderNominatim && !validHTTPURL(c.Geocode.URL) {
+			fail("geocode.url", "must be an http:// or https:// URL, got %q", c.Geocode.URL)
+		}
+		if c.Geocode.Timeout <= 0 {
+			fail("geocode.timeout", "must be positive when geocode.provider is set")
+		}
+	}
+
+	switch c.Store.Type {
+	case StoreNone:
+	case StoreMemory:
+		if c.Store.MaxReads <= 0 {
+			fail("store.maxReads", "must be positive when store.type is %s", StoreMemory)
+		}
+	case StoreSQLite, StorePostgres:
+		if c.Store.DSN == "" {
+			fail("store.dsn", "must be set when store.type is %s", c.Store.Type)
+		}
+	default:
+		fail("store.type", "must be %s, %s, %s or %s, got %q", StoreNone, StoreMemory, StoreSQLite, StorePostgres, c.Store.Type)
+	}
+
+	for _, format := range c.Compat.Formats {
+		if format != CompatThaiNationalIDCard {
+			fail("compat.formats", "unknown format %q (expected %s)", format, CompatThaiNationalIDCard)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+var usbIDPattern = regexp.MustCompile(`^[0-9A-Fa-f]{4}:[0-9A-Fa-f]{4}$`)
+
+// validHTTPURL accepts an http:// or https:// URL with a host.
+func validHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// validOrigin accepts "*" or a web origin such as https://example.com.
+func validOrigin(origin string) bool {
+	if origin == "*" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && (u.Path == "" || u.Path == "/") && u.RawQuery == ""
+}
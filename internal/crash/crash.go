@@ -0,0 +1,252 @@
+// Package crash reports panics and repeated failures to a Sentry-compatible
+// server (Sentry, GlitchTip). Reports carry the app version, OS and reader
+// name, never card data.
+package crash
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	LevelError   = "error"
+	LevelWarning = "warning"
+	LevelFatal   = "fatal"
+)
+
+// reporter sends events in the background so reporting never blocks a read.
+type reporter struct {
+	endpoint    string
+	auth        string
+	release     string
+	environment string
+	client      *http.Client
+	queue       chan event
+	pending     sync.WaitGroup
+}
+
+var current *reporter
+
+// Init enables reporting to the project in dsn, e.g.
+// https://<key>@sentry.example.com/<project>. It does nothing for an empty
+// dsn.
+func Init(dsn, environment, release string) error {
+	if dsn == "" {
+		return nil
+	}
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil || u.Host == "" {
+		return fmt.Errorf("invalid crash reporting DSN")
+	}
+	project := strings.Trim(u.Path, "/")
+	if project == "" {
+		return fmt.Errorf("invalid crash reporting DSN: no project ID")
+	}
+
+	r := &reporter{
+		endpoint:    fmt.Sprintf("%s://%s/api/%s/store/", u.Scheme, u.Host, project),
+		auth:        fmt.Sprintf("Sentry sentry_version=7, sentry_client=thai-id-card-reader/%s, sentry_key=%s", release, u.User.Username()),
+		release:     release,
+		environment: environment,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		queue:       make(chan event, 16),
+	}
+	go r.run()
+	current = r
+	return nil
+}
+
+// event is the subset of the Sentry event payload that is sent.
+type event struct {
+	EventID     string                 `json:"event_id"`
+	Timestamp   string                 `json:"timestamp"`
+	Level       string                 `json:"level"`
+	Platform    string                 `json:"platform"`
+	Release     string                 `json:"release,omitempty"`
+	Environment string                 `json:"environment,omitempty"`
+	ServerName  string                 `json:"server_name,omitempty"`
+	Message     string                 `json:"message,omitempty"`
+	Exception   []exception            `json:"exception,omitempty"`
+	Tags        map[string]string      `json:"tags,omitempty"`
+	Contexts    map[string]interface{} `json:"contexts"`
+}
+
+type exception struct {
+	Type       string      `json:"type"`
+	Value      string      `json:"value"`
+	Stacktrace *stacktrace `json:"stacktrace,omitempty"`
+}
+
+type stacktrace struct {
+	Frames []frame `json:"frames"`
+}
+
+type frame struct {
+	Function string `json:"function"`
+	Filename string `json:"filename"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+// citizenIDPattern matches anything that could be a citizen ID, which is
+// removed from messages in case one ends up in an error string.
+var citizenIDPattern = regexp.MustCompile(`\d{13}|\d-\d{4}-\d{5}-\d{2}-\d`)
+
+func scrub(s string) string {
+	return citizenIDPattern.ReplaceAllString(s, "[redacted]")
+}
+
+func newEvent(level string, tags map[string]string) event {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	hostname, _ := os.Hostname()
+
+	e := event{
+		EventID:     hex.EncodeToString(id),
+		Timestamp:   time.Now().UTC().Format(time.RFC3339),
+		Level:       level,
+		Platform:    "go",
+		Release:     current.release,
+		Environment: current.environment,
+		ServerName:  hostname,
+		Tags:        map[string]string{"os": runtime.GOOS, "arch": runtime.GOARCH},
+		Contexts: map[string]interface{}{
+			"os":      map[string]string{"name": runtime.GOOS},
+			"runtime": map[string]string{"name": "go", "version": runtime.Version()},
+		},
+	}
+	for k, v := range tags {
+		e.Tags[k] = scrub(v)
+	}
+	return e
+}
+
+// Capture reports a message, e.g. a failure that keeps repeating. tags add
+// context such as the reader name.
+func Capture(level, message string, tags map[string]string) {
+	if current == nil {
+		return
+	}
+	e := newEvent(level, tags)
+	e.Message = scrub(message)
+	current.send(e)
+}
+
+// CapturePanic reports a recovered panic value with the current stack.
+func CapturePanic(value interface{}) {
+	if current == nil {
+		return
+	}
+	e := newEvent(LevelFatal, nil)
+	e.Exception = []exception{{
+		Type:       "panic",
+		Value:      scrub(fmt.Sprint(value)),
+		Stacktrace: callers(),
+	}}
+	current.send(e)
+}
+
+// Recover reports a panic and re-panics. Use it as the first deferred call
+// of long-running goroutines: defer crash.Recover().
+func Recover() {
+	if v := recover(); v != nil {
+		CapturePanic(v)
+		Flush(5 * time.Second)
+		panic(v)
+	}
+}
+
+// Flush waits up to timeout for queued reports to be sent.
+func Flush(timeout time.Duration) {
+	if current == nil {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		current.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
+
+// callers returns the stack, oldest call first as Sentry expects, without
+// this package's frames.
+func callers() *stacktrace {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var st stacktrace
+	for {
+		f, more := frames.Next()
+		if !strings.Contains(f.Function, "/internal/crash.") {
+			st.Frames = append([]frame{{
+				Function: f.Function,
+				Filename: f.File,
+				Lineno:   f.Line,
+				InApp:    strings.Contains(f.Function, "go-thai-id-card-reader"),
+			}}, st.Frames...)
+		}
+		if !more {
+			break
+		}
+	}
+	return &st
+}
+
+func (r *reporter) send(e event) {
+	r.pending.Add(1)
+	select {
+	case r.queue <- e:
+	default:
+		r.pending.Done()
+		log.Println("Crash report dropped: queue full")
+	}
+}
+
+func (r *reporter) run() {
+	for e := range r.queue {
+		if err := r.post(e); err != nil {
+			log.Printf("Failed to send crash report: %v", err)
+		}
+		r.pending.Done()
+	}
+}
+
+func (r *reporter) post(e event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, r.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", r.auth)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("server returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+// Package diag builds the diagnostics bundle support asks users for: a zip
+// with the version details, the configuration with secrets redacted, the
+// PC/SC stack and readers, a self-test and the recent logs.
+package diag
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/config"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/version"
+)
+
+// maxLogBytes is how much of the end of each log file is included.
+const maxLogBytes = 1 << 20
+
+type Bundle struct {
+	CreatedAt time.Time
+	Version   version.Info
+	Config    map[string]interface{}
+	PCSC      domain.PCSCInfo
+	SelfTest  domain.SelfTestReport
+	// Logs maps names in the bundle's logs/ folder to their content
+	Logs map[string][]byte
+}
+
+// FileName is the suggested name of the bundle, e.g. for downloads.
+func (b *Bundle) FileName() string {
+	return fmt.Sprintf("thai-id-diagnostics-%s.zip", b.CreatedAt.Format("20060102-150405"))
+}
+
+// New starts a bundle with the version, the effective configuration and the
+// tails of the log files cfg writes.
+func New(cfg *config.Config) *Bundle {
+	b := &Bundle{
+		CreatedAt: time.Now(),
+		Version:   version.Get(),
+		Config:    cfg.Effective(),
+		Logs:      map[string][]byte{},
+	}
+	for _, path := range []string{cfg.Log.File, cfg.Log.File + ".1", cfg.Log.Access.File} {
+		if path == "" || path == ".1" {
+			continue
+		}
+		if data, err := tail(path, maxLogBytes); err == nil {
+			b.Logs[filepath.Base(path)] = data
+		}
+	}
+	return b
+}
+
+// Write writes the bundle as a zip to w.
+func (b *Bundle) Write(w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	files := []struct {
+		name  string
+		value interface{}
+	}{
+		{"version.json", b.Version},
+		{"config.json", b.Config},
+		{"pcsc.json", b.PCSC},
+		{"selftest.json", b.SelfTest},
+	}
+	for _, f := range files {
+		data, err := json.MarshalIndent(f.value, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := writeFile(zw, f.name, b.CreatedAt, data); err != nil {
+			return err
+		}
+	}
+	for name, data := range b.Logs {
+		if err := writeFile(zw, "logs/"+name, b.CreatedAt, data); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func writeFile(zw *zip.Writer, name string, modified time.Time, data []byte) error {
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+// tail reads up to max bytes from the end of the file at path.
+func tail(path string, max int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > max {
+		if _, err := f.Seek(-max, io.SeekEnd); err != nil {
+			return nil, err
+		}
+	}
+	return io.ReadAll(f)
+}
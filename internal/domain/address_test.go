@@ -0,0 +1,85 @@
+package domain
+
+import "testing"
+
+func TestParseThaiAddress(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want *Address
+	}{
+		{name: "empty", in: "", want: nil},
+		{
+			name: "card layout with prefixes",
+			in:   "123/4#หมู่ที่ 5#####ตำบลบางพูด#อำเภอปากเกร็ด#จังหวัดนนทบุรี",
+			want: &Address{
+				HouseNo: "123/4", Moo: "5", Subdistrict: "บางพูด", District: "ปากเกร็ด", Province: "นนทบุรี",
+				FullAddress:     "123/4 หมู่ที่ 5 ตำบลบางพูด อำเภอปากเกร็ด จังหวัดนนทบุรี",
+				ParseConfidence: 1,
+			},
+		},
+		{
+			name: "Bangkok soi named after its street",
+			in:   "99/12#ซอยสุขุมวิท 71#ถนนสุขุมวิท#แขวงพระโขนงเหนือ#เขตวัฒนา#กรุงเทพมหานคร",
+			want: &Address{
+				HouseNo: "99/12", Soi: "สุขุมวิท 71", Street: "สุขุมวิท",
+				Subdistrict: "พระโขนงเหนือ", District: "วัฒนา", Province: "กรุงเทพมหานคร",
+				FullAddress:     "99/12 ซอยสุขุมวิท 71 ถนนสุขุมวิท แขวงพระโขนงเหนือ เขตวัฒนา กรุงเทพมหานคร",
+				ParseConfidence: 1,
+			},
+		},
+		{
+			name: "building, floor and room in the house number",
+			in:   "88/8 อาคารเอ ชั้น 5 ห้อง 501#ถนนพหลโยธิน#แขวงจตุจักร#เขตจตุจักร#กรุงเทพมหานคร",
+			want: &Address{
+				HouseNo: "88/8", Building: "เอ", Floor: "5", Room: "501", Street: "พหลโยธิน",
+				Subdistrict: "จตุจักร", District: "จตุจักร", Province: "กรุงเทพมหานคร",
+				FullAddress:     "88/8 อาคารเอ ชั้น 5 ห้อง 501 ถนนพหลโยธิน แขวงจตุจักร เขตจตุจักร กรุงเทพมหานคร",
+				ParseConfidence: 1,
+			},
+		},
+		{
+			// Parts placed by position count half
+			name: "no prefixes",
+			in:   "45#7#บ้านใหม่#หนองหาร#อุดรธานี",
+			want: &Address{
+				HouseNo: "45", Moo: "7", Subdistrict: "บ้านใหม่", District: "หนองหาร", Province: "อุดรธานี",
+				FullAddress:     "45 7 บ้านใหม่ หนองหาร อุดรธานี",
+				ParseConfidence: 0.6,
+			},
+		},
+		{
+			// A part that fits nowhere is only kept in FullAddress
+			name: "abbreviated prefixes and an extra part",
+			in:   "12#ถ.เพชรเกษม#ตลาดเก่า#ต.หน้าเมือง#อ.เมืองราชบุรี#จ.ราชบุรี",
+			want: &Address{
+				HouseNo: "12", Street: "เพชรเกษม", Subdistrict: "หน้าเมือง", District: "เมืองราชบุรี", Province: "ราชบุรี",
+				FullAddress:     "12 ถ.เพชรเกษม ตลาดเก่า ต.หน้าเมือง อ.เมืองราชบุรี จ.ราชบุรี",
+				ParseConfidence: 0.9,
+			},
+		},
+		{
+			name: "หมู่บ้าน is a village name, not a Moo",
+			in:   "7/1#หมู่บ้านสวนทอง#ตำบลคลองหนึ่ง#อำเภอคลองหลวง#จังหวัดปทุมธานี",
+			want: &Address{
+				HouseNo: "7/1", Street: "หมู่บ้านสวนทอง", Subdistrict: "คลองหนึ่ง", District: "คลองหลวง", Province: "ปทุมธานี",
+				FullAddress:     "7/1 หมู่บ้านสวนทอง ตำบลคลองหนึ่ง อำเภอคลองหลวง จังหวัดปทุมธานี",
+				ParseConfidence: 1,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseThaiAddress(tt.in)
+			if got == nil || tt.want == nil {
+				if got != tt.want {
+					t.Fatalf("ParseThaiAddress(%q) = %+v, want %+v", tt.in, got, tt.want)
+				}
+				return
+			}
+			if *got != *tt.want {
+				t.Errorf("ParseThaiAddress(%q)\n got %+v\nwant %+v", tt.in, *got, *tt.want)
+			}
+		})
+	}
+}
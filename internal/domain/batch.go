@@ -0,0 +1,107 @@
+package domain
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrSessionOpen is returned when a session is started for a reader that
+// already has one.
+var ErrSessionOpen = errors.New("a session is already open for the reader; end it first")
+
+// ErrNoSession is returned when ending a session that isn't open.
+var ErrNoSession = errors.New("no session is open for the reader")
+
+// Session groups the reads of one visit, e.g. a family registering
+// together. A session without a reader covers every reader that has none of
+// its own. It is the payload of SESSION_STARTED and SESSION_ENDED.
+type Session struct {
+	ID          string     `json:"sessionId"`
+	Reader      string     `json:"reader,omitempty"`
+	ReaderAlias string     `json:"readerAlias,omitempty"`
+	Label       string     `json:"label,omitempty"`
+	StartedAt   time.Time  `json:"startedAt"`
+	EndedAt     *time.Time `json:"endedAt,omitempty"`
+	// Reads counts the cards announced in the session
+	Reads int `json:"reads"`
+}
+
+// Batches tracks the open session of each reader. They're called batches
+// here as CardSessions already tracks each reader's current card.
+type Batches struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+func NewBatches() *Batches {
+	return &Batches{sessions: make(map[string]*Session)}
+}
+
+// Start opens session for its reader.
+func (b *Batches) Start(session Session) (Session, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.sessions[session.Reader]; ok {
+		return Session{}, ErrSessionOpen
+	}
+	b.sessions[session.Reader] = &session
+	return session, nil
+}
+
+// End closes the session of reader and returns it.
+func (b *Batches) End(reader string) (Session, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	session, ok := b.sessions[reader]
+	if !ok {
+		return Session{}, ErrNoSession
+	}
+	delete(b.sessions, reader)
+	now := time.Now()
+	session.EndedAt = &now
+	return *session, nil
+}
+
+// ID returns the ID of the session events from reader belong to: the
+// reader's own, else the one for all readers, else none.
+func (b *Batches) ID(reader string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if session := b.find(reader); session != nil {
+		return session.ID
+	}
+	return ""
+}
+
+// Record counts a card read in reader towards its session.
+func (b *Batches) Record(reader string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if session := b.find(reader); session != nil {
+		session.Reads++
+	}
+}
+
+// Open returns the open sessions ordered by reader, the one for all readers
+// first.
+func (b *Batches) Open() []Session {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sessions := make([]Session, 0, len(b.sessions))
+	for _, session := range b.sessions {
+		sessions = append(sessions, *session)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Reader < sessions[j].Reader
+	})
+	return sessions
+}
+
+func (b *Batches) find(reader string) *Session {
+	if session, ok := b.sessions[reader]; ok {
+		return session
+	}
+	return b.sessions[""]
+}
@@ -0,0 +1,37 @@
+package domain
+
+// Capabilities describes what this build and configuration support, so
+// clients can feature-detect rather than compare version numbers.
+type Capabilities struct {
+	Version string           `json:"version"`
+	Cards   CardCapabilities `json:"cards"`
+	Photo   PhotoCapability  `json:"photo"`
+	// Protocols are the WebSocket subprotocols, newest first
+	Protocols []string `json:"protocols"`
+	// Sinks are the ways events are delivered: websocket, sse, socketio,
+	// compat:<format> and printer
+	Sinks []string `json:"sinks"`
+	// Features are the enabled feature flags
+	Features []string `json:"features"`
+}
+
+// CardCapabilities lists which cards and data can be read.
+type CardCapabilities struct {
+	// ThaiID is the contact chip of the Thai national ID card
+	ThaiID      bool `json:"thaiId"`
+	Contactless bool `json:"contactless"`
+	// NHSO is the National Health Security Office applet
+	NHSO bool `json:"nhso"`
+	// LaserID is the laser-engraved code on the back of the card
+	LaserID bool `json:"laserId"`
+	// Mode is full, or cid-only when only the citizen ID (and maybe the
+	// names) is read
+	Mode string `json:"mode"`
+}
+
+// PhotoCapability describes how the card photo is delivered.
+type PhotoCapability struct {
+	Enabled  bool   `json:"enabled"`
+	Deferred bool   `json:"deferred"`
+	Delivery string `json:"delivery"`
+}
@@ -1,6 +1,11 @@
 package domain
 
-import "strings"
+import (
+	"context"
+	"math"
+	"strings"
+	"time"
+)
 
 type Address struct {
 	HouseNo     string `json:"houseNo"`
@@ -10,61 +15,254 @@ type Address struct {
 	Subdistrict string `json:"subdistrict"`
 	District    string `json:"district"`
 	Province    string `json:"province"`
+	// Building, Floor and Room locate condominium and apartment addresses
+	Building string `json:"building,omitempty"`
+	Floor    string `json:"floor,omitempty"`
+	Room     string `json:"room,omitempty"`
+	// FullAddress is the address as written on the card
 	FullAddress string `json:"fullAddress"`
+	// ParseConfidence is between 0 and 1; a low value means parts had to be
+	// guessed or couldn't be placed, and a manual correction may be needed
+	ParseConfidence float64 `json:"parseConfidence"`
+	// Location is where the address is, when the geocode step found it
+	Location *GeoLocation `json:"location,omitempty"`
+}
+
+// Precisions of a GeoLocation.
+const (
+	PrecisionAddress  = "address"
+	PrecisionProvince = "province"
+)
+
+// GeoLocation places an address on the map. Precision is PrecisionAddress
+// when a geocoding provider found it, or PrecisionProvince for the
+// approximate centre of its province.
+type GeoLocation struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Precision string  `json:"precision"`
+	// Source is the provider that found it, or "province"
+	Source string `json:"source"`
+}
+
+// RawFields are card fields as decoded from TIS-620, before they're split,
+// normalized or parsed, for systems with parsers of their own. Names and
+// the address keep their # separators; dates are Buddhist Era YYYYMMDD.
+type RawFields struct {
+	NameTH      string `json:"nameTh"`
+	NameEN      string `json:"nameEn"`
+	DateOfBirth string `json:"dateOfBirth"`
+	IssueDate   string `json:"issueDate"`
+	ExpireDate  string `json:"expireDate"`
+	Address     string `json:"address"`
+}
+
+type CardInfo struct {
+	ChipSerial    string `json:"chipSerial"`
+	ChipType      string `json:"chipType"`
+	AppletVersion string `json:"appletVersion"`
 }
 
 type ThaiIdCard struct {
-	CitizenID    string   `json:"citizenId"`
-	PrefixNameTH string   `json:"prefixNameTh"`
-	FirstNameTH  string   `json:"firstNameTh"`
-	MiddleNameTH string   `json:"middleNameTh"`
-	LastNameTH   string   `json:"lastNameTh"`
-	PrefixNameEN string   `json:"prefixNameEN"`
-	FirstNameEN  string   `json:"firstNameEn"`
-	MiddleNameEN string   `json:"middleNameEN"`
-	LastNameEN   string   `json:"lastNameEn"`
-	DateOfBirth  string   `json:"dateOfBirth"`
-	Gender       string   `json:"gender"`
-	Address      *Address `json:"address"`
-	IssueDate    string   `json:"issueDate"`
-	ExpireDate   string   `json:"expireDate"`
-	PhotoBase64  string   `json:"photoBase64"`
+	Reader      string `json:"reader"`
+	ReaderAlias string `json:"readerAlias,omitempty"`
+	CitizenID   string `json:"citizenId"`
+	// CitizenIDHash replaces CitizenID in hash-only mode; see
+	// HashCitizenID
+	CitizenIDHash string `json:"citizenIdHash,omitempty"`
+	// CitizenIDInfo is the structure of CitizenID and its check digit validity
+	CitizenIDInfo *CitizenID `json:"citizenIdInfo,omitempty"`
+	PrefixNameTH  string     `json:"prefixNameTh"`
+	// PrefixCode and PrefixStandardEN are the prefix normalized from the
+	// Thai one, e.g. MISS and "Miss" for both นางสาว and น.ส.
+	PrefixCode       PrefixCode `json:"prefixCode"`
+	PrefixStandardEN string     `json:"prefixStandardEn"`
+	FirstNameTH      string     `json:"firstNameTh"`
+	MiddleNameTH     string     `json:"middleNameTh"`
+	LastNameTH       string     `json:"lastNameTh"`
+	PrefixNameEN     string     `json:"prefixNameEN"`
+	FirstNameEN      string     `json:"firstNameEn"`
+	MiddleNameEN     string     `json:"middleNameEN"`
+	LastNameEN       string     `json:"lastNameEn"`
+	// Transliterated is set when the English names were romanized from the
+	// Thai ones because the card's were blank or garbled
+	Transliterated bool   `json:"transliterated,omitempty"`
+	DateOfBirth    string `json:"dateOfBirth"`
+	// DateOfBirthParts gives the birth date with unknown month or day as null
+	DateOfBirthParts *PartialDate `json:"dateOfBirthParts"`
+	Gender           string       `json:"gender"`
+	// GenderCode is the raw code from the card: 1 male, 2 female, anything
+	// else unspecified
+	GenderCode string   `json:"genderCode"`
+	Address    *Address `json:"address"`
+	IssueDate  string   `json:"issueDate"`
+	ExpireDate string   `json:"expireDate"`
+	// Thai display strings with Buddhist Era years, when enabled per field
+	DateOfBirthDisplay string `json:"dateOfBirthDisplay,omitempty"`
+	IssueDateDisplay   string `json:"issueDateDisplay,omitempty"`
+	ExpireDateDisplay  string `json:"expireDateDisplay,omitempty"`
+	PhotoBase64        string `json:"photoBase64"`
+	PhotoChunks        int    `json:"photoChunks,omitempty"`
+	PhotoURL           string `json:"photoUrl,omitempty"`
+	PhotoToken         string `json:"photoToken,omitempty"`
+	// PhotoDeferred means the photo wasn't read; GET /card/photo reads it
+	PhotoDeferred bool `json:"photoDeferred,omitempty"`
+	// Raw holds the fields as read, when card.includeRaw is set
+	Raw *RawFields `json:"raw,omitempty"`
+	// CIDOnly means only the citizen ID, and maybe the names, were read
+	CIDOnly bool `json:"cidOnly,omitempty"`
+	// Retry means the card was read again on request, with RETRY_READ or
+	// POST /card/retry, rather than on insertion
+	Retry bool `json:"retry,omitempty"`
+	// Partial means some fields failed to read; MissingFields lists them,
+	// so a field that isn't on the card can be told from one that failed
+	Partial       bool     `json:"partial,omitempty"`
+	MissingFields []string `json:"missingFields,omitempty"`
+	// AgeChecks are the only data of a card read in age-only mode
+	AgeChecks []AgeCheck `json:"ageChecks,omitempty"`
+	// Annotations are notes operators attached to the read
+	Annotations []Annotation `json:"annotations,omitempty"`
+	// SessionID is the session the read was grouped under, if any
+	SessionID string `json:"sessionId,omitempty"`
+	// Directory holds attributes of the card holder's LDAP entry, e.g.
+	// employeeID and department
+	Directory   map[string]string `json:"directory,omitempty"`
+	CardInfo    *CardInfo         `json:"cardInfo"`
+	ATR         string            `json:"atr"`
+	ReaderModel string            `json:"readerModel"`
+	ReadTimeMs  int64             `json:"readTimeMs"`
+	// RequestID identifies the read in the logs: the X-Request-ID of an on
+	// demand read, or one generated for a read on insertion
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// Annotation ties a read to a business transaction: a free-text note and a
+// purpose code, e.g. an order or visit number and "ADMISSION".
+type Annotation struct {
+	Note    string `json:"note,omitempty"`
+	Purpose string `json:"purpose,omitempty"`
+	// By is the client that attached it
+	By string    `json:"by"`
+	At time.Time `json:"at"`
+}
+
+// AgeCheck tells whether the card holder is at least MinAge years old.
+type AgeCheck struct {
+	MinAge int  `json:"minAge"`
+	Passed bool `json:"passed"`
+}
+
+// Card fields listed in MissingFields when they failed to read.
+const (
+	FieldCitizenID   = "citizenId"
+	FieldNameTH      = "nameTh"
+	FieldNameEN      = "nameEn"
+	FieldDateOfBirth = "dateOfBirth"
+	FieldGender      = "gender"
+	FieldIssueDate   = "issueDate"
+	FieldExpireDate  = "expireDate"
+	FieldAddress     = "address"
+	FieldPhoto       = "photo"
+)
+
+// MarkMissing records that field failed to read, making the card partial.
+func (c *ThaiIdCard) MarkMissing(field string) {
+	c.Partial = true
+	c.MissingFields = append(c.MissingFields, field)
+}
+
+// HolderID identifies the card holder: the citizen ID, or its digest in
+// hash-only mode.
+func (c *ThaiIdCard) HolderID() string {
+	if c.CitizenIDHash != "" {
+		return c.CitizenIDHash
+	}
+	return c.CitizenID
 }
 
 type CardReaderService interface {
 	StartMonitoring() error
 	StopMonitoring()
-	OnCardInserted(handler func(card *ThaiIdCard, err error))
-	OnCardRemoved(handler func())
+	// ReadCard and ReadPhoto tag their log lines with the request ID of ctx
+	ReadCard(ctx context.Context, reader string) (*ThaiIdCard, error)
+	// ReadPhoto reads only the photo of the card in reader, returning the
+	// card's citizen ID with the base64 JPEG
+	ReadPhoto(ctx context.Context, reader string) (citizenID, photoBase64 string, err error)
+	// RetryRead resets the card in reader and reads it again, reporting the
+	// read to the OnCardInserted handler with Retry set. It only fails when
+	// there's no card to read
+	RetryRead(ctx context.Context, reader string) error
+	OnCardInserted(handler func(reader string, card *ThaiIdCard, err error))
+	OnCardIdentified(handler func(reader string, card *ThaiIdCard))
+	OnCardRemoved(handler func(reader string))
+	OnCardBusy(handler func(reader string))
+	OnCardChanged(handler func(reader string))
+	OnReaderConflict(handler func(conflict ReaderConflictEvent))
+	OnReaderFailover(handler func(from, to string))
+	// OnReaderDegraded is called when the circuit breaker stops reading from
+	// a reader, OnReaderRecovered when it reads a card again
+	OnReaderDegraded(handler func(reader string, failures int))
+	OnReaderRecovered(handler func(reader string))
+	// OnMonitorStalled is called when the monitor loop stops making progress,
+	// OnMonitorRecovered when it moves again; MonitorHealth returns the
+	// current stall, or nil
+	OnMonitorStalled(handler func(stall MonitorStall, resetContext bool))
+	OnMonitorRecovered(handler func(stall MonitorStall))
+	MonitorHealth() *MonitorStall
+	SelfTest() SelfTestReport
+	// PCSCInfo lists the readers with their state and ATR for diagnostics
+	PCSCInfo() PCSCInfo
+	// MonitorStrategy is MonitorPoll or MonitorEvents; SetMonitorStrategy
+	// switches while monitoring
+	MonitorStrategy() string
+	SetMonitorStrategy(strategy string) error
 }
 
-// ParseThaiAddress parses a Thai address string into structured format
+// Monitor strategies. Some old CCID readers misbehave with status change
+// waits and need polling.
+const (
+	MonitorPoll   = "poll"
+	MonitorEvents = "events"
+)
+
+// ParseThaiAddress parses a Thai address string into structured format.
+// Parts without a prefix are placed by their position where the card's
+// layout allows it, and ParseConfidence tells how much of the address was
+// recognized. FullAddress is always the whole address as written.
 func ParseThaiAddress(addressStr string) *Address {
 	if addressStr == "" {
 		return nil
 	}
 
 	parts := strings.Split(addressStr, "#")
-	if len(parts) == 0 {
-		return &Address{FullAddress: addressStr}
-	}
+	addr := &Address{FullAddress: joinAddressParts(parts)}
+	var confidence addressConfidence
 
-	addr := &Address{}
-
-	// Extract house number from first part
-	if len(parts) > 0 && parts[0] != "" {
-		addr.HouseNo = strings.TrimSpace(parts[0])
+	// Extract house number from first part, which may also name the soi,
+	// street, building, floor and room
+	if house := strings.TrimSpace(parts[0]); house != "" {
+		addr.HouseNo = addr.takeBuilding(addr.takeStreet(house))
+		if strings.ContainsAny(addr.HouseNo, "0123456789") {
+			confidence.found(weightHouseNo)
+		} else {
+			confidence.inferred(weightHouseNo)
+		}
 	}
 
 	// Extract province from last part first (may or may not have prefix)
 	if len(parts) > 1 {
 		lastPart := strings.TrimSpace(parts[len(parts)-1])
-		if lastPart != "" {
-			if strings.HasPrefix(lastPart, "จังหวัด") {
-				addr.Province = strings.TrimSpace(strings.TrimPrefix(lastPart, "จังหวัด"))
+		if province, ok := trimAnyPrefix(lastPart, "จังหวัด", "จ."); ok {
+			addr.Province = province
+			confidence.found(weightProvince)
+		} else if lastPart != "" {
+			// Assume last part is province even without prefix, as
+			// Bangkok's always is
+			addr.Province = lastPart
+			if lastPart == "กรุงเทพมหานคร" {
+				confidence.found(weightProvince)
 			} else {
-				// Assume last part is province even without prefix
-				addr.Province = lastPart
+				confidence.inferred(weightProvince)
 			}
 		}
 	}
@@ -75,65 +273,213 @@ func ParseThaiAddress(addressStr string) *Address {
 		endIdx = len(parts)
 	}
 
+	// unprefixed are the middle parts nothing was recognized in, and
+	// nonEmpty the indexes of all middle parts with text
+	type addressPart struct {
+		index int
+		text  string
+	}
+	var unprefixed []addressPart
+	var nonEmpty []int
 	for i := 1; i < endIdx; i++ {
 		part := strings.TrimSpace(parts[i])
 		if part == "" {
 			continue
 		}
+		nonEmpty = append(nonEmpty, i)
 
-		// Check for Moo (village)
-		if strings.HasPrefix(part, "หมู่ที่") {
-			addr.Moo = strings.TrimSpace(strings.TrimPrefix(part, "หมู่ที่"))
-		} else if strings.HasPrefix(part, "ซอย") {
-			// Check for Soi (alley)
-			addr.Soi = strings.TrimSpace(strings.TrimPrefix(part, "ซอย"))
-		} else if strings.HasPrefix(part, "ตำบล") || strings.HasPrefix(part, "แขวง") {
+		if moo, ok := trimAnyPrefix(part, "หมู่ที่", "หมู่", "ม."); ok && !strings.HasPrefix(part, "หมู่บ้าน") {
+			// Check for Moo (village)
+			addr.Moo = moo
+		} else if subdistrict, ok := trimAnyPrefix(part, "ตำบล", "แขวง", "ต."); ok {
 			// Check for Subdistrict
-			addr.Subdistrict = strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(part, "ตำบล"), "แขวง"))
-		} else if strings.HasPrefix(part, "อำเภอ") || strings.HasPrefix(part, "เขต") {
+			addr.Subdistrict = subdistrict
+			confidence.found(weightSubdistrict)
+		} else if district, ok := trimAnyPrefix(part, "อำเภอ", "เขต", "อ."); ok {
 			// Check for District
-			addr.District = strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(part, "อำเภอ"), "เขต"))
-		} else if strings.HasPrefix(part, "จังหวัด") {
+			addr.District = district
+			confidence.found(weightDistrict)
+		} else if province, ok := trimAnyPrefix(part, "จังหวัด", "จ."); ok {
 			// If province appears in middle parts with prefix, override the last part
-			addr.Province = strings.TrimSpace(strings.TrimPrefix(part, "จังหวัด"))
-		} else if addr.Street == "" {
-			// If no prefix, assume it's a street name
-			addr.Street = part
+			addr.Province = province
+		} else if rest := addr.takeBuilding(addr.takeStreet(part)); rest == "" {
+			// Only soi, street, building, floor and room, e.g.
+			// "ซอย 5 ถนนพหลโยธิน"
+			continue
+		} else if i == 1 && addr.Moo == "" && isNumber(rest) {
+			// A bare number right after the house number is the Moo, as on
+			// the card
+			addr.Moo = rest
+		} else if addr.Building == "" && isBuildingName(rest) {
+			// A condominium or apartment named without อาคาร
+			addr.Building = rest
+		} else {
+			unprefixed = append(unprefixed, addressPart{index: i, text: rest})
+		}
+	}
+
+	// Without prefixes, the parts just before the province are the
+	// district and the subdistrict, in the card's order
+	if n := len(unprefixed); addr.District == "" && n > 0 && unprefixed[n-1].index == nonEmpty[len(nonEmpty)-1] {
+		addr.District = unprefixed[n-1].text
+		confidence.inferred(weightDistrict)
+		unprefixed = unprefixed[:n-1]
+		if n := len(unprefixed); addr.Subdistrict == "" && n > 0 && unprefixed[n-1].index == nonEmpty[len(nonEmpty)-2] {
+			addr.Subdistrict = unprefixed[n-1].text
+			confidence.inferred(weightSubdistrict)
+			unprefixed = unprefixed[:n-1]
 		}
 	}
 
-	// Build full address
-	var fullAddressParts []string
-	if addr.HouseNo != "" {
-		fullAddressParts = append(fullAddressParts, addr.HouseNo)
+	// If no prefix, assume the first other part is the street name; any
+	// further ones are left in FullAddress only
+	if len(unprefixed) > 0 && addr.Street == "" {
+		addr.Street = unprefixed[0].text
+		unprefixed = unprefixed[1:]
 	}
-	if addr.Moo != "" {
-		fullAddressParts = append(fullAddressParts, "หมู่ที่ "+addr.Moo)
+	confidence.unrecognized(len(unprefixed))
+
+	addr.ParseConfidence = confidence.score()
+	return addr
+}
+
+// joinAddressParts joins the #-separated parts of an address with spaces,
+// leaving out empty ones.
+func joinAddressParts(parts []string) string {
+	var nonEmpty []string
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			nonEmpty = append(nonEmpty, part)
+		}
 	}
-	if addr.Soi != "" {
-		fullAddressParts = append(fullAddressParts, "ซอย"+addr.Soi)
+	return strings.Join(nonEmpty, " ")
+}
+
+// trimAnyPrefix returns s without the first of prefixes it starts with, and
+// whether it started with one.
+func trimAnyPrefix(s string, prefixes ...string) (string, bool) {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return strings.TrimSpace(strings.TrimPrefix(s, prefix)), true
+		}
 	}
-	if addr.Street != "" {
-		fullAddressParts = append(fullAddressParts, addr.Street)
+	return s, false
+}
+
+// takeStreet moves the soi (alley) and street (ถนน) in s to addr, returning
+// the rest of s. A soi named after its street keeps its number, e.g.
+// "ซอยสุขุมวิท 71 ถนนสุขุมวิท" is soi สุขุมวิท 71 off street สุขุมวิท.
+func (addr *Address) takeStreet(s string) string {
+	for {
+		// The last keyword's value runs to the end of s
+		at, keyword := -1, ""
+		for _, k := range []string{"ซอย", "ซ.", "ถนน", "ถ."} {
+			if i := lastWordIndex(s, k); i > at {
+				at, keyword = i, k
+			}
+		}
+		if at < 0 {
+			return s
+		}
+
+		value := strings.TrimSpace(s[at+len(keyword):])
+		if keyword == "ซอย" || keyword == "ซ." {
+			addr.Soi = value
+		} else {
+			addr.Street = value
+		}
+		s = strings.TrimSpace(s[:at])
 	}
-	if addr.Subdistrict != "" {
-		prefix := "ตำบล"
-		if strings.Contains(addressStr, "แขวง") {
-			prefix = "แขวง"
+}
+
+// lastWordIndex returns the index of the last occurrence of prefix in s that
+// starts a word, or -1.
+func lastWordIndex(s, prefix string) int {
+	for end := len(s); end > 0; {
+		i := strings.LastIndex(s[:end], prefix)
+		if i <= 0 || s[i-1] == ' ' {
+			return i
 		}
-		fullAddressParts = append(fullAddressParts, prefix+addr.Subdistrict)
+		end = i
 	}
-	if addr.District != "" {
-		prefix := "อำเภอ"
-		if strings.Contains(addressStr, "เขต") {
-			prefix = "เขต"
+	return -1
+}
+
+// buildingKeywords start the building, floor and room of an address line,
+// e.g. "99/12 อาคารเอ ชั้น 5 ห้อง 501".
+var buildingKeywords = []string{"อาคาร", "ชั้น", "ห้องเลขที่", "ห้อง"}
+
+// takeBuilding moves the building, floor and room in s to addr, returning
+// the rest of s.
+func (addr *Address) takeBuilding(s string) string {
+	for {
+		// The last keyword's value runs to the end of s
+		at, keyword := -1, ""
+		for _, k := range buildingKeywords {
+			if i := strings.LastIndex(s, k); i > at {
+				at, keyword = i, k
+			}
+		}
+		if at < 0 {
+			return s
+		}
+
+		value := strings.TrimSpace(s[at+len(keyword):])
+		switch keyword {
+		case "อาคาร":
+			addr.Building = value
+		case "ชั้น":
+			addr.Floor = value
+		default:
+			addr.Room = value
 		}
-		fullAddressParts = append(fullAddressParts, prefix+addr.District)
+		s = strings.TrimSpace(s[:at])
 	}
-	if addr.Province != "" {
-		fullAddressParts = append(fullAddressParts, "จังหวัด"+addr.Province)
+}
+
+func isNumber(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789") == ""
+}
+
+// buildingNames mark names of condominiums and apartment buildings.
+var buildingNames = []string{"คอนโด", "แมนชั่น", "อพาร์ทเม้นท์", "อพาร์ตเมนต์", "ทาวเวอร์", "เรสซิเดนซ์", "แฟลต"}
+
+func isBuildingName(s string) bool {
+	for _, name := range buildingNames {
+		if strings.Contains(s, name) {
+			return true
+		}
 	}
+	return false
+}
 
-	addr.FullAddress = strings.Join(fullAddressParts, " ")
-	return addr
+// Confidence weights of the parts every address has. A part placed by its
+// position counts half, and every part that couldn't be placed costs
+// weightUnrecognized.
+const (
+	weightHouseNo      = 0.2
+	weightSubdistrict  = 0.25
+	weightDistrict     = 0.25
+	weightProvince     = 0.3
+	weightUnrecognized = 0.1
+)
+
+// addressConfidence adds up how sure ParseThaiAddress is of an address.
+type addressConfidence float64
+
+func (c *addressConfidence) found(weight float64) {
+	*c += addressConfidence(weight)
+}
+
+func (c *addressConfidence) inferred(weight float64) {
+	*c += addressConfidence(weight / 2)
+}
+
+func (c *addressConfidence) unrecognized(parts int) {
+	*c -= addressConfidence(float64(parts) * weightUnrecognized)
+}
+
+// score is the confidence between 0 and 1, to two decimals.
+func (c addressConfidence) score() float64 {
+	return math.Round(min(max(float64(c), 0), 1)*100) / 100
 }
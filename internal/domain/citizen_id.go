@@ -0,0 +1,80 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+var personTypes = map[int]string{
+	0: "Not of Thai nationality, specially registered",
+	1: "Thai, born on or after 1984 and registered on time",
+	2: "Thai, born on or after 1984 and registered late",
+	3: "Thai or foreigner in a house registration before 1984",
+	4: "Thai or foreigner who moved in before 1984 without an ID number",
+	5: "Thai added to the house registration later",
+	6: "Foreigner with temporary residence or entered illegally",
+	7: "Child of a type 6 person, born in Thailand",
+	8: "Foreigner granted residence or Thai nationality",
+}
+
+// CitizenID is the structure of a 13-digit Thai citizen ID number.
+type CitizenID struct {
+	ID string `json:"id"`
+	// PersonType is the first digit, describing how the person was registered
+	PersonType            int    `json:"personType"`
+	PersonTypeDescription string `json:"personTypeDescription"`
+	// ProvinceCode and DistrictCode (digits 2-5) identify the registration office
+	ProvinceCode string `json:"provinceCode"`
+	DistrictCode string `json:"districtCode"`
+	// Group and Sequence (digits 6-12) number the person within the office
+	Group      string `json:"group"`
+	Sequence   string `json:"sequence"`
+	CheckDigit int    `json:"checkDigit"`
+	// Valid is whether the check digit matches the other digits
+	Valid bool `json:"valid"`
+}
+
+// ParseCitizenID parses a citizen ID, ignoring dashes and spaces. It fails if
+// the ID is not 13 digits; a wrong check digit is reported as Valid false.
+func ParseCitizenID(s string) (*CitizenID, error) {
+	id := strings.NewReplacer("-", "", " ", "").Replace(s)
+	if len(id) != 13 {
+		return nil, fmt.Errorf("citizen ID must have 13 digits")
+	}
+
+	digits := make([]int, 13)
+	for i, c := range id {
+		if c < '0' || c > '9' {
+			return nil, fmt.Errorf("citizen ID must have 13 digits")
+		}
+		digits[i] = int(c - '0')
+	}
+
+	sum := 0
+	for i := 0; i < 12; i++ {
+		sum += digits[i] * (13 - i)
+	}
+	check := (11 - sum%11) % 10
+
+	return &CitizenID{
+		ID:                    id,
+		PersonType:            digits[0],
+		PersonTypeDescription: personTypes[digits[0]],
+		ProvinceCode:          id[1:3],
+		DistrictCode:          id[1:5],
+		Group:                 id[5:10],
+		Sequence:              id[10:12],
+		CheckDigit:            digits[12],
+		Valid:                 check == digits[12],
+	}, nil
+}
+
+// HashCitizenID returns the hex SHA-256 of salt followed by the citizen ID,
+// so deployments that must not keep national IDs can still tell card
+// holders apart. The same salt gives the same digest across devices.
+func HashCitizenID(salt, id string) string {
+	sum := sha256.Sum256([]byte(salt + id))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,67 @@
+package domain
+
+import "testing"
+
+func TestParseCitizenID(t *testing.T) {
+	tests := []struct {
+		name      string
+		in        string
+		wantErr   bool
+		wantID    string
+		wantValid bool
+		wantCheck int
+	}{
+		{name: "valid", in: "3100602345671", wantID: "3100602345671", wantValid: true, wantCheck: 1},
+		{name: "dashes", in: "3-1006-02345-67-1", wantID: "3100602345671", wantValid: true, wantCheck: 1},
+		{name: "spaces", in: "1 2345 67890 12 1", wantID: "1234567890121", wantValid: true, wantCheck: 1},
+		// The check digit is (11 - sum % 11) % 10: a remainder of 1 gives 0
+		// rather than 10, and 0 gives 1 rather than 11
+		{name: "remainder 1", in: "1101700203450", wantID: "1101700203450", wantValid: true, wantCheck: 0},
+		{name: "remainder 0", in: "0000000000001", wantID: "0000000000001", wantValid: true, wantCheck: 1},
+		{name: "wrong check digit", in: "1101700203451", wantID: "1101700203451", wantValid: false, wantCheck: 1},
+		{name: "too short", in: "110170020345", wantErr: true},
+		{name: "too long", in: "11017002034501", wantErr: true},
+		{name: "letter", in: "11017002034X0", wantErr: true},
+		{name: "Thai digits", in: "๑๑๐๑๗๐๐๒๐๓๔๕๐", wantErr: true},
+		{name: "empty", in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := ParseCitizenID(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseCitizenID(%q) = %+v, want an error", tt.in, id)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseCitizenID(%q): %v", tt.in, err)
+			}
+			if id.ID != tt.wantID || id.Valid != tt.wantValid || id.CheckDigit != tt.wantCheck {
+				t.Errorf("ParseCitizenID(%q) = %s valid %v check %d, want %s valid %v check %d",
+					tt.in, id.ID, id.Valid, id.CheckDigit, tt.wantID, tt.wantValid, tt.wantCheck)
+			}
+		})
+	}
+}
+
+func TestParseCitizenIDParts(t *testing.T) {
+	id, err := ParseCitizenID("3100602345671")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := CitizenID{
+		ID:                    "3100602345671",
+		PersonType:            3,
+		PersonTypeDescription: personTypes[3],
+		ProvinceCode:          "10",
+		DistrictCode:          "1006",
+		Group:                 "02345",
+		Sequence:              "67",
+		CheckDigit:            1,
+		Valid:                 true,
+	}
+	if *id != want {
+		t.Errorf("ParseCitizenID = %+v, want %+v", *id, want)
+	}
+}
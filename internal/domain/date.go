@@ -0,0 +1,109 @@
+package domain
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// PartialDate is a card date whose month or day may be unknown. Cards of
+// elderly citizens often record only the birth year, with month and day 00.
+type PartialDate struct {
+	Year  int  `json:"year"`
+	Month *int `json:"month"`
+	Day   *int `json:"day"`
+}
+
+// ParseCardDate parses a Buddhist Era YYYYMMDD date as stored on the card.
+// It returns false if there is no usable year.
+func ParseCardDate(raw string) (*PartialDate, bool) {
+	if len(raw) < 8 {
+		return nil, false
+	}
+
+	year, err := strconv.Atoi(raw[0:4])
+	if err != nil || year <= 543 {
+		return nil, false
+	}
+	month, err := strconv.Atoi(raw[4:6])
+	if err != nil {
+		return nil, false
+	}
+	day, err := strconv.Atoi(raw[6:8])
+	if err != nil {
+		return nil, false
+	}
+
+	date := &PartialDate{Year: year - 543}
+	if month >= 1 && month <= 12 {
+		date.Month = &month
+		// A day without a month means nothing
+		if day >= 1 && day <= 31 {
+			date.Day = &day
+		}
+	}
+	return date, true
+}
+
+// String formats the date as ISO 8601 with only the known parts: "1947",
+// "1947-05" or "1947-05-12".
+func (d PartialDate) String() string {
+	switch {
+	case d.Month == nil:
+		return fmt.Sprintf("%04d", d.Year)
+	case d.Day == nil:
+		return fmt.Sprintf("%04d-%02d", d.Year, *d.Month)
+	default:
+		return fmt.Sprintf("%04d-%02d-%02d", d.Year, *d.Month, *d.Day)
+	}
+}
+
+var thaiMonths = [...]string{
+	"มกราคม", "กุมภาพันธ์", "มีนาคม", "เมษายน", "พฤษภาคม", "มิถุนายน",
+	"กรกฎาคม", "สิงหาคม", "กันยายน", "ตุลาคม", "พฤศจิกายน", "ธันวาคม",
+}
+
+// ISO formats the date like String, in the given calendar.
+func (d PartialDate) ISO(calendar string) string {
+	if calendar == CalendarBuddhist {
+		d.Year += 543
+	}
+	return d.String()
+}
+
+// ThaiDisplay formats the date the way Thai documents show it, with the
+// Buddhist Era year, e.g. "12 พฤษภาคม 2490".
+func (d PartialDate) ThaiDisplay() string {
+	year := d.Year + 543
+	switch {
+	case d.Month == nil:
+		return strconv.Itoa(year)
+	case d.Day == nil:
+		return fmt.Sprintf("%s %d", thaiMonths[*d.Month-1], year)
+	default:
+		return fmt.Sprintf("%d %s %d", *d.Day, thaiMonths[*d.Month-1], year)
+	}
+}
+
+// Partial reports whether the month or day is unknown.
+func (d PartialDate) Partial() bool {
+	return d.Month == nil || d.Day == nil
+}
+
+// AgeAtLeast reports whether someone born on d is at least years old at now.
+// An unknown month or day counts as the last one possible, so a partial
+// date never makes the holder older than they are.
+func (d PartialDate) AgeAtLeast(years int, now time.Time) bool {
+	month, day := 12, 31
+	if d.Month != nil {
+		month = *d.Month
+		// Day 0 of the next month is the last day of this one
+		day = time.Date(d.Year, time.Month(month)+1, 0, 0, 0, 0, 0, time.UTC).Day()
+		if d.Day != nil {
+			day = *d.Day
+		}
+	}
+	// A 29 February birthday comes of age on 1 March in common years
+	birthday := time.Date(d.Year+years, time.Month(month), day, 0, 0, 0, 0, now.Location())
+	return !now.Before(birthday)
+}
@@ -0,0 +1,38 @@
+package domain
+
+// ReaderStatus is a reader as PC/SC sees it, without connecting to the card.
+type ReaderStatus struct {
+	Name  string `json:"name"`
+	Alias string `json:"alias,omitempty"`
+	// State lists the PC/SC state flags, e.g. present and inuse
+	State  []string      `json:"state"`
+	ATR    string        `json:"atr,omitempty"`
+	Driver *ReaderDriver `json:"driver,omitempty"`
+}
+
+// ReaderDriver is what the reader's driver reports about the device. Drivers
+// report different subsets, so any field may be empty.
+type ReaderDriver struct {
+	Vendor string `json:"vendor,omitempty"`
+	Model  string `json:"model,omitempty"`
+	// IFDVersion is the device version as major.minor.build; CCID drivers
+	// report the USB bcdDevice, i.e. the firmware revision
+	IFDVersion string `json:"ifdVersion,omitempty"`
+	Serial     string `json:"serial,omitempty"`
+	// VendorID and ProductID are the USB IDs in hex, e.g. 072F and 90CC
+	VendorID  string `json:"vendorId,omitempty"`
+	ProductID string `json:"productId,omitempty"`
+	// Firmware is the firmware ID reported by the reader itself
+	Firmware string `json:"firmware,omitempty"`
+	// Features are the PC/SC v2 part 10 features, e.g. verifyPinDirect
+	Features []string `json:"features,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// PCSCInfo describes the PC/SC stack and its readers for the diagnostics
+// bundle.
+type PCSCInfo struct {
+	Stack   string         `json:"stack"`
+	Readers []ReaderStatus `json:"readers"`
+	Error   string         `json:"error,omitempty"`
+}
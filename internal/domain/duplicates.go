@@ -0,0 +1,55 @@
+package domain
+
+import (
+	"sync"
+	"time"
+)
+
+// RecentScans remembers when each citizen ID was last announced so repeated
+// insertions within a window can be suppressed.
+type RecentScans struct {
+	mu     sync.Mutex
+	window time.Duration
+	seen   map[string]time.Time
+}
+
+func NewRecentScans(window time.Duration) *RecentScans {
+	return &RecentScans{
+		window: window,
+		seen:   make(map[string]time.Time),
+	}
+}
+
+// Duplicate returns when key was announced if that was within the window.
+func (s *RecentScans) Duplicate(key string) (time.Time, bool) {
+	if s.window <= 0 {
+		return time.Time{}, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	at, ok := s.seen[key]
+	if !ok || time.Since(at) > s.window {
+		return time.Time{}, false
+	}
+	return at, true
+}
+
+// Record notes that key was announced now, forgetting expired entries.
+func (s *RecentScans) Record(key string) {
+	if s.window <= 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for k, at := range s.seen {
+		if now.Sub(at) > s.window {
+			delete(s.seen, k)
+		}
+	}
+	s.seen[key] = now
+}
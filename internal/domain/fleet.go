@@ -0,0 +1,78 @@
+package domain
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// ErrAgentConfigured is returned when an agent registers under the name of
+// an agent listed in remote.agents.
+var ErrAgentConfigured = errors.New("an agent with this name is configured on the aggregator")
+
+// FleetAgent is an agent as it registers with an aggregator.
+type FleetAgent struct {
+	Name string `json:"name"`
+	Site string `json:"site,omitempty"`
+	// URL is where the aggregator reaches the agent
+	URL     string `json:"url"`
+	Version string `json:"version,omitempty"`
+}
+
+// AgentStatus is the health of an agent whose cards an aggregator serves.
+type AgentStatus struct {
+	FleetAgent
+	// Registered is false for agents listed in remote.agents
+	Registered bool `json:"registered"`
+	Connected  bool `json:"connected"`
+	// Since is when the agent connected, or was last lost
+	Since time.Time `json:"since"`
+	// LastSeenAt is when a registered agent last registered
+	LastSeenAt  *time.Time `json:"lastSeenAt,omitempty"`
+	LastEventAt *time.Time `json:"lastEventAt,omitempty"`
+	Events      int        `json:"events"`
+	// Stall is set while the agent's own card monitor is stalled
+	Stall *MonitorStall `json:"stall,omitempty"`
+}
+
+// SiteStatus groups the agents of one site for the fleet dashboard.
+type SiteStatus struct {
+	Site      string        `json:"site"`
+	Connected int           `json:"connected"`
+	Agents    []AgentStatus `json:"agents"`
+}
+
+// Fleet is a card reader service that serves the cards of other agents and
+// accepts more at runtime.
+type Fleet interface {
+	// Register adds agent, or refreshes it when it registered before
+	Register(agent FleetAgent) (AgentStatus, error)
+	Agents() []AgentStatus
+}
+
+// GroupBySite groups agents by site, sites and agents in name order.
+// Agents without a site come first.
+func GroupBySite(agents []AgentStatus) []SiteStatus {
+	bySite := make(map[string]*SiteStatus)
+	var sites []*SiteStatus
+	for _, agent := range agents {
+		site, ok := bySite[agent.Site]
+		if !ok {
+			site = &SiteStatus{Site: agent.Site}
+			bySite[agent.Site] = site
+			sites = append(sites, site)
+		}
+		site.Agents = append(site.Agents, agent)
+		if agent.Connected {
+			site.Connected++
+		}
+	}
+
+	sort.Slice(sites, func(i, j int) bool { return sites[i].Site < sites[j].Site })
+	result := make([]SiteStatus, 0, len(sites))
+	for _, site := range sites {
+		sort.Slice(site.Agents, func(i, j int) bool { return site.Agents[i].Name < site.Agents[j].Name })
+		result = append(result, *site)
+	}
+	return result
+}
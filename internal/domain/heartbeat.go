@@ -0,0 +1,20 @@
+package domain
+
+import "time"
+
+// Heartbeat is what an agent POSTs to heartbeat.url so fleet operators
+// notice dead kiosks. It never holds card data: readers are reported
+// without the ATR of the card in them.
+type Heartbeat struct {
+	AgentID string    `json:"agentId"`
+	Version string    `json:"version"`
+	OS      string    `json:"os"`
+	SentAt  time.Time `json:"sentAt"`
+	// Readers and ReaderError are as in GET /admin/readers
+	Readers     []ReaderStatus `json:"readers"`
+	ReaderError string         `json:"readerError,omitempty"`
+	// MonitorStall is set while the card monitor is stalled
+	MonitorStall *MonitorStall `json:"monitorStall,omitempty"`
+	Clients      int           `json:"clients"`
+	Stats        StatsSnapshot `json:"stats"`
+}
@@ -0,0 +1,60 @@
+package domain
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// NewEventID returns a random (version 4) UUID identifying one event. Resent
+// and replayed events keep their ID.
+func NewEventID() string {
+	var id [16]byte
+	_, _ = rand.Read(id[:])
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:])
+}
+
+// IdempotencyKeys derives the idempotency keys of card read events, so a
+// sink that gets the same read twice (e.g. from an agent and an aggregator, or
+// read again within the window) can tell. A key is a keyed hash of the event
+// type, citizen ID, reader and the window the card was inserted in, so it
+// doesn't give the citizen ID away.
+type IdempotencyKeys struct {
+	key    []byte
+	window time.Duration
+}
+
+// NewIdempotencyKeys returns keys hashed with salt, or with a random key when
+// salt is empty, in which case they're only stable until the process exits.
+func NewIdempotencyKeys(salt string, window time.Duration) *IdempotencyKeys {
+	key := []byte(salt)
+	if salt == "" {
+		key = make([]byte, 32)
+		_, _ = rand.Read(key)
+	}
+	return &IdempotencyKeys{key: key, window: window}
+}
+
+// Key returns the idempotency key of a messageType event about the card of
+// holderID inserted in reader at insertedAt, or "" without a holder.
+func (k *IdempotencyKeys) Key(messageType, holderID, reader string, insertedAt time.Time) string {
+	if holderID == "" {
+		return ""
+	}
+	bucket := insertedAt.UnixMilli()
+	if k.window > 0 {
+		bucket /= k.window.Milliseconds()
+	}
+	mac := hmac.New(sha256.New, k.key)
+	for _, part := range []string{messageType, holderID, reader, strconv.FormatInt(bucket, 10)} {
+		mac.Write([]byte(part))
+		mac.Write([]byte{0})
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
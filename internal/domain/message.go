@@ -1,25 +1,356 @@
 package domain
 
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
 type WebSocketMessage struct {
-	Type    string      `json:"type"`
-	Payload interface{} `json:"payload"`
+	// Seq numbers broadcast events so a reconnecting client can ask for the
+	// ones it missed. Replies to a single client have no sequence number.
+	Seq  uint64 `json:"seq,omitempty"`
+	Type string `json:"type"`
+	// Timestamp (RFC 3339) and Reader, the PC/SC name of the reader the
+	// event concerns, are only sent with ProtocolV2 or when Timestamp is
+	// listed in server.envelopeMetadata
+	Timestamp string `json:"timestamp,omitempty"`
+	Reader    string `json:"reader,omitempty"`
+	// AgentID, Sequence and ReaderName are sent to every client when listed
+	// in server.envelopeMetadata. Sequence numbers each message sent on a
+	// connection, so a gap means messages were dropped; ReaderName is the
+	// reader's alias, or its PC/SC name without one
+	AgentID    string `json:"agentId,omitempty"`
+	Sequence   uint64 `json:"sequence,omitempty"`
+	ReaderName string `json:"readerName,omitempty"`
+	// SessionID is the session started with START_SESSION that the event
+	// belongs to, in every protocol version
+	SessionID string `json:"sessionId,omitempty"`
+	// EventID is a UUID unique to each broadcast event, and IdempotencyKey
+	// is the same for every event of a type about one card insertion, so
+	// at-least-once sinks can drop duplicates; see IdempotencyKeys
+	EventID        string      `json:"eventId,omitempty"`
+	IdempotencyKey string      `json:"idempotencyKey,omitempty"`
+	Payload        interface{} `json:"payload"`
+}
+
+// WebSocket subprotocols, negotiated with Sec-WebSocket-Protocol so the
+// envelope can evolve without breaking existing frontends. Clients that ask
+// for none get ProtocolV1.
+const (
+	// ProtocolV1 is the original envelope: seq, type and payload
+	ProtocolV1 = "thaiid.v1.json"
+	// ProtocolV2 adds when the event happened and the reader it concerns
+	ProtocolV2 = "thaiid.v2.json"
+)
+
+// Protocols lists the supported subprotocols, newest first.
+var Protocols = []string{ProtocolV2, ProtocolV1}
+
+// Envelope metadata that can be added to every message, whatever the
+// protocol version, with server.envelopeMetadata. None is sent by default so
+// legacy frontends that check the envelope's keys keep working.
+const (
+	EnvelopeTimestamp  = "timestamp"
+	EnvelopeAgentID    = "agentId"
+	EnvelopeSequence   = "sequence"
+	EnvelopeReaderName = "readerName"
+)
+
+// EnvelopeMetadata lists the envelope metadata that can be enabled.
+var EnvelopeMetadata = []string{EnvelopeTimestamp, EnvelopeAgentID, EnvelopeSequence, EnvelopeReaderName}
+
+// CardBusyEvent is the payload of CARD_BUSY, sent while waiting for another
+// application to release the card.
+type CardBusyEvent struct {
+	Reader      string `json:"reader"`
+	ReaderAlias string `json:"readerAlias,omitempty"`
+	TimeoutMs   int64  `json:"timeoutMs"`
+}
+
+// ReaderConflictEvent is the payload of READER_CONFLICT, sent when an OS
+// component (e.g. macOS CryptoTokenKit) is holding the reader.
+type ReaderConflictEvent struct {
+	Reader      string `json:"reader"`
+	ReaderAlias string `json:"readerAlias,omitempty"`
+	Holder      string `json:"holder"`
+	Remediation string `json:"remediation"`
+}
+
+// ReaderFailoverEvent is the payload of READER_FAILOVER, sent when the active
+// reader changes because the preferred reader disappeared or came back.
+type ReaderFailoverEvent struct {
+	From      string `json:"from"`
+	FromAlias string `json:"fromAlias,omitempty"`
+	To        string `json:"to"`
+	ToAlias   string `json:"toAlias,omitempty"`
+}
+
+// ReaderDegradedEvent is the payload of READER_DEGRADED, sent when a reader
+// has failed so many reads in a row that it is only tried every
+// ProbeIntervalMs until a read succeeds.
+type ReaderDegradedEvent struct {
+	Reader          string `json:"reader"`
+	ReaderAlias     string `json:"readerAlias,omitempty"`
+	Failures        int    `json:"failures"`
+	ProbeIntervalMs int64  `json:"probeIntervalMs"`
+}
+
+// ReaderRecoveredEvent is the payload of READER_RECOVERED, sent when a
+// degraded reader reads a card again.
+type ReaderRecoveredEvent struct {
+	Reader      string `json:"reader"`
+	ReaderAlias string `json:"readerAlias,omitempty"`
+}
+
+// MonitorStall describes a card monitor loop that stopped making progress:
+// what it was doing, in which reader, and since when.
+type MonitorStall struct {
+	Stage  string    `json:"stage"`
+	Reader string    `json:"reader,omitempty"`
+	Since  time.Time `json:"since"`
+}
+
+// MonitorStalledEvent is the payload of MONITOR_STALLED, sent when the card
+// monitor hasn't completed an iteration within the watchdog's stall timeout,
+// e.g. because a driver hangs in a transmit. ResetContext is set when the
+// PC/SC context is being reset to recover.
+type MonitorStalledEvent struct {
+	Stage        string `json:"stage"`
+	Reader       string `json:"reader,omitempty"`
+	ReaderAlias  string `json:"readerAlias,omitempty"`
+	StalledMs    int64  `json:"stalledMs"`
+	ResetContext bool   `json:"resetContext"`
+}
+
+// MonitorRecoveredEvent is the payload of MONITOR_RECOVERED, sent when a
+// stalled card monitor moves again.
+type MonitorRecoveredEvent struct {
+	StalledMs int64 `json:"stalledMs"`
+}
+
+// ReadAnnotatedEvent is the payload of READ_ANNOTATED, sent when a client
+// attaches an annotation to a reader's current card.
+type ReadAnnotatedEvent struct {
+	Reader      string     `json:"reader"`
+	ReaderAlias string     `json:"readerAlias,omitempty"`
+	RequestID   string     `json:"requestId,omitempty"`
+	Annotation  Annotation `json:"annotation"`
+}
+
+// TicketIssuedEvent is the payload of TICKET_ISSUED, sent when a queue
+// ticket has been sent to the printer for the card just read.
+type TicketIssuedEvent struct {
+	Reader      string `json:"reader"`
+	ReaderAlias string `json:"readerAlias,omitempty"`
+	Number      string `json:"number"`
+}
+
+// ReaderDriverMissingEvent is the payload of READER_DRIVER_MISSING, sent
+// when a smart card reader is plugged in over USB but PC/SC doesn't list it.
+type ReaderDriverMissingEvent struct {
+	VendorID     string `json:"vendorId"`
+	ProductID    string `json:"productId"`
+	Manufacturer string `json:"manufacturer,omitempty"`
+	Product      string `json:"product,omitempty"`
+	Remediation  string `json:"remediation"`
+}
+
+// UnsupportedCard describes a card that isn't a Thai ID card.
+type UnsupportedCard struct {
+	ATR         string `json:"atr"`
+	CardType    string `json:"cardType"`
+	Reader      string `json:"reader"`
+	ReaderAlias string `json:"readerAlias,omitempty"`
+}
+
+const (
+	CardTypeEMV     = "EMV"
+	CardTypeSIM     = "SIM"
+	CardTypeMIFARE  = "MIFARE"
+	CardTypeUnknown = "UNKNOWN"
+)
+
+// UnsupportedCardError is returned when the Thai ID applet can't be selected.
+type UnsupportedCardError struct {
+	Card UnsupportedCard
+	Err  error
+}
+
+func (e *UnsupportedCardError) Error() string {
+	return fmt.Sprintf("%s: %v", ErrMsgUnsupportedCard, e.Err)
+}
+
+func (e *UnsupportedCardError) Unwrap() error {
+	return e.Err
+}
+
+// CardRejectedError is returned when a post-read processing step rejects a
+// card that was read successfully.
+type CardRejectedError struct {
+	Step string
+	Err  error
+}
+
+func (e *CardRejectedError) Error() string {
+	return fmt.Sprintf("card rejected by the %s step: %v", e.Step, e.Err)
+}
+
+func (e *CardRejectedError) Unwrap() error {
+	return e.Err
+}
+
+// FieldError is a card field that failed to read and why.
+type FieldError struct {
+	Field string `json:"field"`
+	Error string `json:"error"`
+}
+
+// IncompleteReadError is returned in strict mode when any field failed to
+// read, instead of a partial card.
+type IncompleteReadError struct {
+	Fields []FieldError
+}
+
+func (e *IncompleteReadError) Error() string {
+	fields := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		fields[i] = field.Field + ": " + field.Error
+	}
+	return fmt.Sprintf("failed to read %s", strings.Join(fields, "; "))
+}
+
+// ClientCommand is a message sent by a WebSocket client to the service.
+type ClientCommand struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+	// RequestID correlates the command with the service's logs; one is
+	// generated when it's missing
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// CommandError is the payload of COMMAND_ERROR, sent back to a client whose
+// command could not be handled.
+type CommandError struct {
+	Command   string `json:"command"`
+	Message   string `json:"message"`
+	RequestID string `json:"requestId,omitempty"`
 }
 
 type ErrorResponse struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+	Code        int    `json:"code"`
+	Message     string `json:"message"`
+	Reader      string `json:"reader,omitempty"`
+	ReaderAlias string `json:"readerAlias,omitempty"`
+	// Partial holds the fields read before a read timed out
+	Partial *ThaiIdCard `json:"partial,omitempty"`
+	// Fields are the fields that failed to read in strict mode
+	Fields []FieldError `json:"fields,omitempty"`
+}
+
+// NewErrorResponse maps a card reader error to its error code and message.
+func NewErrorResponse(err error) ErrorResponse {
+	var unsupported *UnsupportedCardError
+	var rejected *CardRejectedError
+	var incomplete *IncompleteReadError
+
+	switch {
+	case err.Error() == ErrMsgReaderNotFound:
+		return ErrorResponse{Code: ErrCodeReaderNotFound, Message: ErrMsgReaderNotFound}
+	case err.Error() == ErrMsgCardNotDetected:
+		return ErrorResponse{Code: ErrCodeCardNotDetected, Message: ErrMsgCardNotDetected}
+	case err.Error() == ErrMsgCardInUse:
+		return ErrorResponse{Code: ErrCodeCardInUse, Message: ErrMsgCardInUse}
+	case err.Error() == ErrMsgReaderConflict:
+		return ErrorResponse{Code: ErrCodeReaderConflict, Message: ErrMsgReaderConflict}
+	case err.Error() == ErrMsgServiceDisabled:
+		return ErrorResponse{Code: ErrCodeServiceDisabled, Message: ErrMsgServiceDisabled}
+	case err.Error() == ErrMsgServiceStopped:
+		return ErrorResponse{Code: ErrCodeServiceStopped, Message: ErrMsgServiceStopped}
+	case errors.As(err, &unsupported):
+		return ErrorResponse{Code: ErrCodeUnsupportedCard, Message: ErrMsgUnsupportedCard}
+	case errors.As(err, &rejected):
+		return ErrorResponse{Code: ErrCodeCardRejected, Message: ErrMsgCardRejected}
+	case errors.As(err, &incomplete):
+		return ErrorResponse{Code: ErrCodeIncompleteRead, Message: ErrMsgIncompleteRead, Fields: incomplete.Fields}
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorResponse{Code: ErrCodeReadTimeout, Message: ErrMsgReadTimeout}
+	default:
+		return ErrorResponse{Code: ErrCodeReadFailed, Message: ErrMsgReadFailed}
+	}
+}
+
+// CardRemovedEvent is the payload of CARD_REMOVED.
+type CardRemovedEvent struct {
+	Reader      string `json:"reader"`
+	ReaderAlias string `json:"readerAlias,omitempty"`
+}
+
+// DuplicateScanEvent is the payload of DUPLICATE_SCAN, sent instead of
+// CARD_INSERTED when the same card was announced within the duplicate window.
+type DuplicateScanEvent struct {
+	Reader      string `json:"reader"`
+	ReaderAlias string `json:"readerAlias,omitempty"`
+	CitizenID   string `json:"citizenId"`
+	// CitizenIDHash replaces CitizenID in hash-only mode
+	CitizenIDHash string    `json:"citizenIdHash,omitempty"`
+	LastScanAt    time.Time `json:"lastScanAt"`
+}
+
+// CardChangedEvent is the payload of CARD_CHANGED, sent when a different card
+// is found in a reader without its removal having been seen.
+type CardChangedEvent struct {
+	Reader      string `json:"reader"`
+	ReaderAlias string `json:"readerAlias,omitempty"`
+}
+
+// ClearDataEvent is the payload of CLEAR_DATA, telling kiosk screens to stop
+// showing the card from reader.
+type ClearDataEvent struct {
+	Reader      string `json:"reader"`
+	ReaderAlias string `json:"readerAlias,omitempty"`
+	Reason      string `json:"reason"`
 }
 
 const (
-	ErrCodeReaderNotFound  = 1001
-	ErrMsgReaderNotFound   = "No smart card reader found."
-	
+	ClearReasonRemoved = "removed"
+	ClearReasonTimeout = "timeout"
+)
+
+const (
+	ErrCodeReaderNotFound = 1001
+	ErrMsgReaderNotFound  = "No smart card reader found."
+
 	ErrCodeCardNotDetected = 1002
 	ErrMsgCardNotDetected  = "No smart card detected in the reader."
-	
-	ErrCodeReadFailed      = 1003
-	ErrMsgReadFailed       = "Failed to read data from the smart card."
-	
+
+	ErrCodeReadFailed = 1003
+	ErrMsgReadFailed  = "Failed to read data from the smart card."
+
 	ErrCodeUnsupportedCard = 1004
 	ErrMsgUnsupportedCard  = "The inserted card is not a supported Thai ID card."
-)
\ No newline at end of file
+
+	ErrCodeCardInUse = 1005
+	ErrMsgCardInUse  = "The card is in use by another application."
+
+	ErrCodeServiceDisabled = 1006
+	ErrMsgServiceDisabled  = "The smart card service is disabled."
+
+	ErrCodeServiceStopped = 1007
+	ErrMsgServiceStopped  = "The smart card service is not running."
+
+	ErrCodeReaderConflict = 1008
+	ErrMsgReaderConflict  = "The reader is held by the operating system's smart card subsystem."
+
+	ErrCodeReadTimeout = 1009
+	ErrMsgReadTimeout  = "Timed out reading the smart card."
+
+	ErrCodeCardRejected = 1010
+	ErrMsgCardRejected  = "The card was rejected by post-read processing."
+
+	ErrCodeIncompleteRead = 1011
+	ErrMsgIncompleteRead  = "Some fields could not be read from the smart card."
+)
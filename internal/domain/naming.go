@@ -0,0 +1,158 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// Key naming conventions clients can ask for. Payload keys are sent as
+// declared by default, which mixes e.g. prefixNameEN and firstNameEn.
+const (
+	NamingCamel = "camel"
+	NamingSnake = "snake"
+)
+
+// ValidNaming reports whether naming is a supported convention, or "" for
+// keys as declared.
+func ValidNaming(naming string) bool {
+	return naming == "" || naming == NamingCamel || naming == NamingSnake
+}
+
+// verbatimKeys hold maps keyed by data, e.g. reader names or directory
+// attributes, whose keys are kept as they are.
+var verbatimKeys = map[string]bool{
+	"directory":      true,
+	"readers":        true,
+	"failuresByCode": true,
+}
+
+// RenameKeys rewrites the object keys of the JSON document data to naming,
+// keeping their order: prefixNameEN becomes prefixNameEn or
+// prefix_name_en.
+func RenameKeys(data []byte, naming string) ([]byte, error) {
+	if naming == "" {
+		return data, nil
+	}
+	convert := toCamel
+	if naming == NamingSnake {
+		convert = toSnake
+	}
+
+	type container struct {
+		object   bool
+		verbatim bool
+		// n counts the keys and values written so far
+		n int
+	}
+	var stack []container
+	var out bytes.Buffer
+	// separate writes the comma before an element
+	separate := func() {
+		if len(stack) == 0 {
+			return
+		}
+		top := &stack[len(stack)-1]
+		if top.n > 0 && (!top.object || top.n%2 == 0) {
+			out.WriteByte(',')
+		}
+		top.n++
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	lastKey := ""
+	for {
+		token, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if delim, ok := token.(json.Delim); ok {
+			switch delim {
+			case '{', '[':
+				top := len(stack) - 1
+				value := top >= 0 && stack[top].object && stack[top].n%2 == 1
+				separate()
+				stack = append(stack, container{object: delim == '{', verbatim: delim == '{' && value && verbatimKeys[lastKey]})
+			case '}', ']':
+				stack = stack[:len(stack)-1]
+			}
+			out.WriteByte(byte(delim))
+			continue
+		}
+
+		key := len(stack) > 0 && stack[len(stack)-1].object && stack[len(stack)-1].n%2 == 0
+		separate()
+		if key {
+			lastKey = token.(string)
+			name := lastKey
+			if !stack[len(stack)-1].verbatim {
+				name = convert(name)
+			}
+			token = name
+		}
+		encoded, err := json.Marshal(token)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(encoded)
+		if key {
+			out.WriteByte(':')
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// words splits a key at case changes and underscores, keeping acronyms and
+// trailing digits together: prefixNameEN is prefix, Name, EN and
+// photoBase64 is photo, Base64.
+func words(key string) []string {
+	var result []string
+	runes := []rune(key)
+	start := 0
+	for i := 1; i <= len(runes); i++ {
+		boundary := i == len(runes) || runes[i] == '_'
+		if !boundary {
+			prev, cur := runes[i-1], runes[i]
+			next := rune(0)
+			if i+1 < len(runes) {
+				next = runes[i+1]
+			}
+			boundary = unicode.IsUpper(cur) && (unicode.IsLower(prev) || unicode.IsDigit(prev) ||
+				(unicode.IsUpper(prev) && unicode.IsLower(next)))
+		}
+		if boundary {
+			if word := string(runes[start:i]); word != "" && word != "_" {
+				result = append(result, strings.Trim(word, "_"))
+			}
+			start = i
+		}
+	}
+	return result
+}
+
+func toSnake(key string) string {
+	parts := words(key)
+	for i, part := range parts {
+		parts[i] = strings.ToLower(part)
+	}
+	return strings.Join(parts, "_")
+}
+
+func toCamel(key string) string {
+	parts := words(key)
+	for i, part := range parts {
+		part = strings.ToLower(part)
+		if i > 0 && part != "" {
+			part = strings.ToUpper(part[:1]) + part[1:]
+		}
+		parts[i] = part
+	}
+	return strings.Join(parts, "")
+}
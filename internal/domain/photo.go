@@ -0,0 +1,121 @@
+package domain
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// PhotoChunk is the payload of PHOTO_CHUNK. Concatenating Data of all chunks
+// in Index order gives the card's base64 photo.
+type PhotoChunk struct {
+	Reader    string `json:"reader"`
+	CitizenID string `json:"citizenId"`
+	Index     int    `json:"index"`
+	Total     int    `json:"total"`
+	Data      string `json:"data"`
+}
+
+// SplitPhoto splits the card's base64 photo into chunks of at most size
+// characters. size is rounded down to a multiple of 4 so every chunk is valid
+// base64 on its own.
+func SplitPhoto(card *ThaiIdCard, size int) []PhotoChunk {
+	size -= size % 4
+	if size <= 0 {
+		size = 4096
+	}
+
+	photo := card.PhotoBase64
+	total := (len(photo) + size - 1) / size
+	chunks := make([]PhotoChunk, 0, total)
+
+	for i := 0; i < total; i++ {
+		end := min((i+1)*size, len(photo))
+		chunks = append(chunks, PhotoChunk{
+			Reader:    card.Reader,
+			CitizenID: card.CitizenID,
+			Index:     i,
+			Total:     total,
+			Data:      photo[i*size : end],
+		})
+	}
+
+	return chunks
+}
+
+type photoGrant struct {
+	reader  string
+	photo   string
+	expires time.Time
+}
+
+// PhotoTokens hands out single-use tokens for fetching a card photo over REST
+// so the photo itself never goes out in a broadcast.
+type PhotoTokens struct {
+	mu     sync.Mutex
+	ttl    time.Duration
+	grants map[string]photoGrant
+}
+
+func NewPhotoTokens(ttl time.Duration) *PhotoTokens {
+	return &PhotoTokens{
+		ttl:    ttl,
+		grants: make(map[string]photoGrant),
+	}
+}
+
+// Issue stores the card's photo and returns a token that redeems it once.
+func (t *PhotoTokens) Issue(card *ThaiIdCard) (string, error) {
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(raw)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for key, grant := range t.grants {
+		if now.After(grant.expires) {
+			delete(t.grants, key)
+		}
+	}
+
+	t.grants[token] = photoGrant{
+		reader:  card.Reader,
+		photo:   card.PhotoBase64,
+		expires: now.Add(t.ttl),
+	}
+	return token, nil
+}
+
+// Redeem returns the base64 photo for token and invalidates it.
+func (t *PhotoTokens) Redeem(token string) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	grant, ok := t.grants[token]
+	if !ok {
+		return "", false
+	}
+	delete(t.grants, token)
+
+	if time.Now().After(grant.expires) {
+		return "", false
+	}
+	return grant.photo, true
+}
+
+// Revoke invalidates all outstanding tokens for the card in reader.
+func (t *PhotoTokens) Revoke(reader string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key, grant := range t.grants {
+		if grant.reader == reader {
+			delete(t.grants, key)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitPhoto(t *testing.T) {
+	tests := []struct {
+		name     string
+		photo    int
+		size     int
+		wantLens []int
+	}{
+		{"no photo", 0, 8, nil},
+		{"shorter than a chunk", 5, 8, []int{5}},
+		{"exactly one chunk", 8, 8, []int{8}},
+		{"one over", 9, 8, []int{8, 1}},
+		{"exact multiple", 24, 8, []int{8, 8, 8}},
+		{"size rounded down to a multiple of 4", 20, 10, []int{8, 8, 4}},
+		{"size below 4 uses the default", 5000, 3, []int{4096, 904}},
+		{"zero size uses the default", 4096, 0, []int{4096}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Distinct characters show a chunk cut in the wrong place
+			photo := strings.Repeat("ABCDEFGHIJKLMNOPQRSTUVWXYZ", tt.photo/26+1)[:tt.photo]
+			card := &ThaiIdCard{Reader: "counter-1", CitizenID: "1101700203450", PhotoBase64: photo}
+
+			chunks := SplitPhoto(card, tt.size)
+			if len(chunks) != len(tt.wantLens) {
+				t.Fatalf("got %d chunks, want %d", len(chunks), len(tt.wantLens))
+			}
+			var joined strings.Builder
+			for i, chunk := range chunks {
+				if len(chunk.Data) != tt.wantLens[i] {
+					t.Errorf("chunk %d has %d characters, want %d", i, len(chunk.Data), tt.wantLens[i])
+				}
+				if chunk.Index != i || chunk.Total != len(chunks) || chunk.Reader != card.Reader || chunk.CitizenID != card.CitizenID {
+					t.Errorf("chunk %d = %+v", i, chunk)
+				}
+				joined.WriteString(chunk.Data)
+			}
+			if joined.String() != photo {
+				t.Error("chunks don't join back into the photo")
+			}
+		})
+	}
+}
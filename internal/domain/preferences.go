@@ -0,0 +1,106 @@
+package domain
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	LocaleEnglish = "en"
+	LocaleThai    = "th"
+
+	CalendarGregorian = "gregorian"
+	CalendarBuddhist  = "buddhist"
+)
+
+// ClientPreferences are what a client asks for in HELLO. The zero value is
+// the default rendering: English messages, unmasked, Gregorian dates, photo
+// included.
+type ClientPreferences struct {
+	Locale   string `json:"locale,omitempty"`
+	Mask     bool   `json:"mask,omitempty"`
+	Calendar string `json:"calendar,omitempty"`
+	// Photo set to false leaves the photo out of card events
+	Photo *bool `json:"photo,omitempty"`
+	// Naming renames payload keys to NamingCamel or NamingSnake
+	Naming string `json:"naming,omitempty"`
+}
+
+// Validate checks that the locale, calendar and naming are supported.
+func (p ClientPreferences) Validate() error {
+	switch p.Locale {
+	case "", LocaleEnglish, LocaleThai:
+	default:
+		return fmt.Errorf("unsupported locale %q", p.Locale)
+	}
+
+	switch p.Calendar {
+	case "", CalendarGregorian, CalendarBuddhist:
+	default:
+		return fmt.Errorf("unsupported calendar %q", p.Calendar)
+	}
+
+	if !ValidNaming(p.Naming) {
+		return fmt.Errorf("unsupported naming %q", p.Naming)
+	}
+
+	return nil
+}
+
+func (p ClientPreferences) IncludePhoto() bool {
+	return p.Photo == nil || *p.Photo
+}
+
+// MaskCitizenID hides all but the last four digits of a citizen ID.
+func MaskCitizenID(id string) string {
+	if len(id) <= 4 {
+		return id
+	}
+	return strings.Repeat("X", len(id)-4) + id[len(id)-4:]
+}
+
+// ConvertDate converts an ISO 8601 date (possibly partial) between the
+// Gregorian and Buddhist calendars.
+func ConvertDate(date string, from, to string) string {
+	if from == "" {
+		from = CalendarGregorian
+	}
+	if to == "" || to == from || len(date) < 4 {
+		return date
+	}
+
+	year, err := strconv.Atoi(date[:4])
+	if err != nil {
+		return date
+	}
+	if to == CalendarBuddhist {
+		year += 543
+	} else {
+		year -= 543
+	}
+	return fmt.Sprintf("%04d%s", year, date[4:])
+}
+
+var errorMessagesTH = map[int]string{
+	ErrCodeReaderNotFound:  "ไม่พบเครื่องอ่านบัตร",
+	ErrCodeCardNotDetected: "ไม่พบบัตรในเครื่องอ่าน",
+	ErrCodeReadFailed:      "อ่านข้อมูลจากบัตรไม่สำเร็จ",
+	ErrCodeUnsupportedCard: "บัตรที่เสียบไม่ใช่บัตรประจำตัวประชาชนที่รองรับ",
+	ErrCodeCardInUse:       "บัตรกำลังถูกใช้งานโดยโปรแกรมอื่น",
+	ErrCodeServiceDisabled: "บริการสมาร์ทการ์ดถูกปิดใช้งาน",
+	ErrCodeServiceStopped:  "บริการสมาร์ทการ์ดไม่ได้ทำงาน",
+	ErrCodeReaderConflict:  "เครื่องอ่านบัตรถูกระบบปฏิบัติการใช้งานอยู่",
+	ErrCodeCardRejected:    "บัตรไม่ผ่านการตรวจสอบหลังการอ่าน",
+	ErrCodeIncompleteRead:  "อ่านข้อมูลบางส่วนจากบัตรไม่สำเร็จ",
+}
+
+// Localize returns the error with its message in the given locale.
+func (e ErrorResponse) Localize(locale string) ErrorResponse {
+	if locale == LocaleThai {
+		if message, ok := errorMessagesTH[e.Code]; ok {
+			e.Message = message
+		}
+	}
+	return e
+}
@@ -0,0 +1,86 @@
+package domain
+
+import "strings"
+
+// PrefixCode is the structured form of a name prefix (title).
+type PrefixCode string
+
+const (
+	PrefixMr     PrefixCode = "MR"
+	PrefixMrs    PrefixCode = "MRS"
+	PrefixMiss   PrefixCode = "MISS"
+	PrefixMaster PrefixCode = "MASTER"
+	PrefixGirl   PrefixCode = "GIRL"
+	PrefixRank   PrefixCode = "RANK"
+	PrefixMonk   PrefixCode = "MONK"
+	PrefixOther  PrefixCode = "OTHER"
+)
+
+type prefixEntry struct {
+	code PrefixCode
+	en   string
+}
+
+// prefixes maps Thai prefixes found on cards, without spaces, to their code
+// and English equivalent.
+var prefixes = map[string]prefixEntry{
+	"นาย":      {PrefixMr, "Mr."},
+	"นาง":      {PrefixMrs, "Mrs."},
+	"นางสาว":   {PrefixMiss, "Miss"},
+	"น.ส.":     {PrefixMiss, "Miss"},
+	"เด็กชาย":  {PrefixMaster, "Master"},
+	"ด.ช.":     {PrefixMaster, "Master"},
+	"เด็กหญิง": {PrefixGirl, "Miss"},
+	"ด.ญ.":     {PrefixGirl, "Miss"},
+
+	"พระ":      {PrefixMonk, "Phra"},
+	"พระภิกษุ": {PrefixMonk, "Phra"},
+	"สามเณร":   {PrefixMonk, "Novice"},
+	"แม่ชี":    {PrefixMonk, "Mae Chi"},
+
+	"พลทหาร": {PrefixRank, "Pvt."},
+	"ส.ต.":   {PrefixRank, "Cpl."},
+	"ส.ท.":   {PrefixRank, "Sgt."},
+	"ส.อ.":   {PrefixRank, "S.Sgt."},
+	"จ.ส.ต.": {PrefixRank, "M.Sgt. 3rd Class"},
+	"จ.ส.ท.": {PrefixRank, "M.Sgt. 2nd Class"},
+	"จ.ส.อ.": {PrefixRank, "M.Sgt. 1st Class"},
+	"ร.ต.":   {PrefixRank, "Sub Lt."},
+	"ร.ท.":   {PrefixRank, "Lt."},
+	"ร.อ.":   {PrefixRank, "Capt."},
+	"พ.ต.":   {PrefixRank, "Maj."},
+	"พ.ท.":   {PrefixRank, "Lt. Col."},
+	"พ.อ.":   {PrefixRank, "Col."},
+	"พล.ต.":  {PrefixRank, "Maj. Gen."},
+	"พล.ท.":  {PrefixRank, "Lt. Gen."},
+	"พล.อ.":  {PrefixRank, "Gen."},
+
+	"ส.ต.ต.":  {PrefixRank, "Pol. L/C."},
+	"ส.ต.ท.":  {PrefixRank, "Pol. Cpl."},
+	"ส.ต.อ.":  {PrefixRank, "Pol. Sgt."},
+	"ด.ต.":    {PrefixRank, "Pol. Sen. Sgt. Maj."},
+	"ร.ต.ต.":  {PrefixRank, "Pol. Sub Lt."},
+	"ร.ต.ท.":  {PrefixRank, "Pol. Lt."},
+	"ร.ต.อ.":  {PrefixRank, "Pol. Capt."},
+	"พ.ต.ต.":  {PrefixRank, "Pol. Maj."},
+	"พ.ต.ท.":  {PrefixRank, "Pol. Lt. Col."},
+	"พ.ต.อ.":  {PrefixRank, "Pol. Col."},
+	"พล.ต.ต.": {PrefixRank, "Pol. Maj. Gen."},
+	"พล.ต.ท.": {PrefixRank, "Pol. Lt. Gen."},
+	"พล.ต.อ.": {PrefixRank, "Pol. Gen."},
+}
+
+// ParsePrefix maps a Thai prefix from the card to its code and English
+// equivalent. Unknown prefixes are PrefixOther with no English equivalent.
+func ParsePrefix(prefixTH string) (PrefixCode, string) {
+	key := strings.ReplaceAll(prefixTH, " ", "")
+	if key == "" {
+		return "", ""
+	}
+
+	entry, ok := prefixes[key]
+	if !ok {
+		return PrefixOther, ""
+	}
+	return entry.code, entry.en
+}
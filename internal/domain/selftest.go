@@ -0,0 +1,50 @@
+package domain
+
+import "time"
+
+const (
+	SelfTestPass = "pass"
+	SelfTestFail = "fail"
+	SelfTestSkip = "skip"
+)
+
+// SelfTestStep is the outcome of one self-test check.
+type SelfTestStep struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Detail     string `json:"detail,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// SelfTestReport is the result of POST /admin/selftest and card-cli selftest.
+type SelfTestReport struct {
+	Passed bool           `json:"passed"`
+	At     time.Time      `json:"at"`
+	Steps  []SelfTestStep `json:"steps"`
+}
+
+func NewSelfTestReport() *SelfTestReport {
+	return &SelfTestReport{Passed: true, At: time.Now()}
+}
+
+// Add records a step that started at start. A non-nil err fails the step
+// and the report.
+func (r *SelfTestReport) Add(name string, start time.Time, err error, detail string) {
+	step := SelfTestStep{
+		Name:       name,
+		Status:     SelfTestPass,
+		Detail:     detail,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		step.Status = SelfTestFail
+		step.Detail = err.Error()
+		r.Passed = false
+	}
+	r.Steps = append(r.Steps, step)
+}
+
+// Skip records a step that couldn't run, without failing the report.
+func (r *SelfTestReport) Skip(name string, reason string) {
+	r.Steps = append(r.Steps, SelfTestStep{Name: name, Status: SelfTestSkip, Detail: reason})
+}
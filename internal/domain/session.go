@@ -0,0 +1,157 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// ErrReadChanged is returned when an annotation names a read that is no
+// longer the reader's current card.
+var ErrReadChanged = errors.New("the card in the reader has changed")
+
+// CardSessions tracks the card currently inserted in each reader.
+type CardSessions struct {
+	mu    sync.RWMutex
+	cards map[string]*ThaiIdCard
+	// reads counts the cards set per reader, so Wait can tell a new read
+	// from an annotated one; set is closed and replaced on every Set
+	reads map[string]uint64
+	set   chan struct{}
+	// waiters counts the calls blocked in Wait
+	waiters int
+}
+
+func NewCardSessions() *CardSessions {
+	return &CardSessions{
+		cards: make(map[string]*ThaiIdCard),
+		reads: make(map[string]uint64),
+		set:   make(chan struct{}),
+	}
+}
+
+func (s *CardSessions) Set(reader string, card *ThaiIdCard) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cards[reader] = card
+	s.reads[reader]++
+	close(s.set)
+	s.set = make(chan struct{})
+}
+
+// Replace swaps the card in reader for an updated copy of the same read,
+// e.g. with its deferred photo filled in. Unlike Set it isn't a new read, so
+// waiters aren't woken. Nothing is replaced once the card has been removed
+// or another card read, or when the card has no RequestID to tell the read
+// by, and false is returned.
+func (s *CardSessions) Replace(reader string, card *ThaiIdCard) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.cards[reader]
+	if !ok || card.RequestID == "" || current.RequestID != card.RequestID {
+		return false
+	}
+	s.cards[reader] = card
+	return true
+}
+
+// Wait returns the card in reader, or in the first reader with a card when
+// reader is empty, waiting for one to be read until ctx is done. With next
+// the cards already inserted are passed over for one read after the call.
+func (s *CardSessions) Wait(ctx context.Context, reader string, next bool) (*ThaiIdCard, error) {
+	s.mu.Lock()
+	seen := make(map[string]uint64, len(s.reads))
+	if next {
+		for name, reads := range s.reads {
+			seen[name] = reads
+		}
+	}
+	s.waiters++
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.waiters--
+		s.mu.Unlock()
+	}()
+
+	for {
+		s.mu.RLock()
+		set := s.set
+		var found *ThaiIdCard
+		foundIn := ""
+		for name, card := range s.cards {
+			if (reader == "" || name == reader) && s.reads[name] > seen[name] &&
+				(found == nil || name < foundIn) {
+				found, foundIn = card, name
+			}
+		}
+		s.mu.RUnlock()
+		if found != nil {
+			return found, nil
+		}
+
+		select {
+		case <-set:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Waiters returns the number of calls waiting for a card in Wait.
+func (s *CardSessions) Waiters() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.waiters
+}
+
+func (s *CardSessions) Remove(reader string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.cards, reader)
+}
+
+func (s *CardSessions) Get(reader string) (*ThaiIdCard, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	card, ok := s.cards[reader]
+	return card, ok
+}
+
+// All returns the current cards ordered by reader name.
+func (s *CardSessions) All() []*ThaiIdCard {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cards := make([]*ThaiIdCard, 0, len(s.cards))
+	for _, card := range s.cards {
+		cards = append(cards, card)
+	}
+	sort.Slice(cards, func(i, j int) bool {
+		return cards[i].Reader < cards[j].Reader
+	})
+	return cards
+}
+
+// Annotate adds a to the card in reader and returns the annotated card. With
+// a requestID the card must be from that read, so a note meant for one
+// holder never lands on the next. The stored card is replaced, not changed,
+// as earlier copies may still be being sent.
+func (s *CardSessions) Annotate(reader, requestID string, a Annotation) (*ThaiIdCard, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	card, ok := s.cards[reader]
+	if !ok {
+		return nil, errors.New(ErrMsgCardNotDetected)
+	}
+	if requestID != "" && card.RequestID != requestID {
+		return nil, ErrReadChanged
+	}
+
+	annotated := *card
+	annotated.Annotations = append(slices.Clone(card.Annotations), a)
+	s.cards[reader] = &annotated
+	return &annotated, nil
+}
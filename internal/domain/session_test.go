@@ -0,0 +1,77 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCardSessionsReplace(t *testing.T) {
+	sessions := NewCardSessions()
+	read := &ThaiIdCard{Reader: "counter-1", RequestID: "r1", PhotoDeferred: true}
+	sessions.Set("counter-1", read)
+
+	// A waiter for the next read must not take the photo fill-in for one
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	waited := make(chan error, 1)
+	go func() {
+		_, err := sessions.Wait(ctx, "counter-1", true)
+		waited <- err
+	}()
+
+	updated := *read
+	updated.PhotoBase64, updated.PhotoDeferred = "/9j/", false
+	if !sessions.Replace("counter-1", &updated) {
+		t.Fatal("Replace of the current read = false")
+	}
+	if card, _ := sessions.Get("counter-1"); card.PhotoBase64 != "/9j/" {
+		t.Errorf("card not replaced: %+v", card)
+	}
+	if err := <-waited; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait = %v, want it to time out", err)
+	}
+
+	tests := []struct {
+		name  string
+		setup func()
+	}{
+		{"another card read", func() { sessions.Set("counter-1", &ThaiIdCard{RequestID: "r2"}) }},
+		{"card removed", func() { sessions.Remove("counter-1") }},
+		{"no request ID", func() {
+			sessions.Set("counter-1", &ThaiIdCard{})
+			updated.RequestID = ""
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setup()
+			if sessions.Replace("counter-1", &updated) {
+				t.Error("Replace = true, want the stale read refused")
+			}
+		})
+	}
+}
+
+func TestCardSessionsWaiters(t *testing.T) {
+	sessions := NewCardSessions()
+	ctx, cancel := context.WithCancel(context.Background())
+	waited := make(chan struct{})
+	go func() {
+		_, _ = sessions.Wait(ctx, "", false)
+		close(waited)
+	}()
+
+	for deadline := time.Now().Add(time.Second); sessions.Waiters() != 1; {
+		if time.Now().After(deadline) {
+			t.Fatalf("Waiters = %d, want 1", sessions.Waiters())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-waited
+	if n := sessions.Waiters(); n != 0 {
+		t.Errorf("Waiters after Wait returned = %d, want 0", n)
+	}
+}
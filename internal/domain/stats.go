@@ -0,0 +1,96 @@
+package domain
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ReaderStats counts reads in one reader.
+type ReaderStats struct {
+	Reads    uint64 `json:"reads"`
+	Failures uint64 `json:"failures"`
+}
+
+// StatsSnapshot is the payload of GET /stats and STATS.
+type StatsSnapshot struct {
+	StartedAt         time.Time              `json:"startedAt"`
+	UptimeSeconds     int64                  `json:"uptimeSeconds"`
+	Reads             uint64                 `json:"reads"`
+	Failures          uint64                 `json:"failures"`
+	FailuresByCode    map[string]uint64      `json:"failuresByCode"`
+	AverageReadTimeMs int64                  `json:"averageReadTimeMs"`
+	Readers           map[string]ReaderStats `json:"readers"`
+}
+
+// Stats tracks card read totals since the service started.
+type Stats struct {
+	mu             sync.Mutex
+	started        time.Time
+	reads          uint64
+	failures       uint64
+	failuresByCode map[int]uint64
+	readTime       time.Duration
+	readers        map[string]*ReaderStats
+}
+
+func NewStats() *Stats {
+	return &Stats{
+		started:        time.Now(),
+		failuresByCode: make(map[int]uint64),
+		readers:        make(map[string]*ReaderStats),
+	}
+}
+
+// RecordRead counts a successful read that took duration.
+func (s *Stats) RecordRead(reader string, duration time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.reads++
+	s.readTime += duration
+	s.reader(reader).Reads++
+}
+
+// RecordFailure counts a failed read with its error code.
+func (s *Stats) RecordFailure(reader string, code int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures++
+	s.failuresByCode[code]++
+	s.reader(reader).Failures++
+}
+
+func (s *Stats) reader(name string) *ReaderStats {
+	stats, ok := s.readers[name]
+	if !ok {
+		stats = &ReaderStats{}
+		s.readers[name] = stats
+	}
+	return stats
+}
+
+func (s *Stats) Snapshot() StatsSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := StatsSnapshot{
+		StartedAt:      s.started,
+		UptimeSeconds:  int64(time.Since(s.started).Seconds()),
+		Reads:          s.reads,
+		Failures:       s.failures,
+		FailuresByCode: make(map[string]uint64, len(s.failuresByCode)),
+		Readers:        make(map[string]ReaderStats, len(s.readers)),
+	}
+	if s.reads > 0 {
+		snapshot.AverageReadTimeMs = (s.readTime / time.Duration(s.reads)).Milliseconds()
+	}
+	for code, count := range s.failuresByCode {
+		snapshot.FailuresByCode[strconv.Itoa(code)] = count
+	}
+	for name, stats := range s.readers {
+		snapshot.Readers[name] = *stats
+	}
+	return snapshot
+}
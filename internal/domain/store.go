@@ -0,0 +1,101 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// StoredRead is a successful card read as a ReadStore keeps it.
+type StoredRead struct {
+	ID            int64     `json:"id"`
+	ReadAt        time.Time `json:"readAt"`
+	Reader        string    `json:"reader"`
+	ReaderAlias   string    `json:"readerAlias,omitempty"`
+	CitizenID     string    `json:"citizenId,omitempty"`
+	CitizenIDHash string    `json:"citizenIdHash,omitempty"`
+	SessionID     string    `json:"sessionId,omitempty"`
+	RequestID     string    `json:"requestId,omitempty"`
+	// Card is the card as announced, without its photo
+	Card *ThaiIdCard `json:"card"`
+}
+
+// NewStoredRead returns the read of card at readAt, leaving out the photo,
+// which would make stores grow fast.
+func NewStoredRead(card *ThaiIdCard, readAt time.Time) StoredRead {
+	stored := *card
+	stored.PhotoBase64 = ""
+	stored.PhotoChunks = 0
+	stored.PhotoURL = ""
+	stored.PhotoToken = ""
+	return StoredRead{
+		ReadAt:        readAt,
+		Reader:        card.Reader,
+		ReaderAlias:   card.ReaderAlias,
+		CitizenID:     card.CitizenID,
+		CitizenIDHash: card.CitizenIDHash,
+		SessionID:     card.SessionID,
+		RequestID:     card.RequestID,
+		Card:          &stored,
+	}
+}
+
+// ReadQuery selects stored reads. Empty fields match any read.
+type ReadQuery struct {
+	// CitizenID matches the citizen ID, or its digest in hash-only mode
+	CitizenID string
+	Reader    string
+	// From is inclusive, To exclusive
+	From time.Time
+	To   time.Time
+	// Limit of 0 returns every match, ignoring Offset
+	Limit  int
+	Offset int
+}
+
+// ReadStore persists successful reads, so deployments can keep them in
+// their own database.
+type ReadStore interface {
+	// Save stores read, giving it the next ID
+	Save(ctx context.Context, read StoredRead) error
+	// Search returns the matching reads, newest first
+	Search(ctx context.Context, query ReadQuery) ([]StoredRead, error)
+	Close() error
+}
+
+// ReadHistory is a page of stored reads, newest first. NextOffset is the
+// offset of the next page, or 0 on the last one.
+type ReadHistory struct {
+	Reads      []StoredRead `json:"reads"`
+	Limit      int          `json:"limit"`
+	Offset     int          `json:"offset"`
+	NextOffset int          `json:"nextOffset,omitempty"`
+	Masked     bool         `json:"masked"`
+}
+
+// Mask hides all but the last four digits of the read's citizen ID and
+// leaves out everything else about the holder: names, dates, gender,
+// address, age checks and directory attributes. What remains tells when,
+// where and how the card was read.
+func (r StoredRead) Mask() StoredRead {
+	r.CitizenID = MaskCitizenID(r.CitizenID)
+	if r.Card != nil {
+		r.Card = &ThaiIdCard{
+			Reader:        r.Card.Reader,
+			ReaderAlias:   r.Card.ReaderAlias,
+			CitizenID:     MaskCitizenID(r.Card.CitizenID),
+			CitizenIDHash: r.Card.CitizenIDHash,
+			CIDOnly:       r.Card.CIDOnly,
+			Retry:         r.Card.Retry,
+			Partial:       r.Card.Partial,
+			MissingFields: r.Card.MissingFields,
+			Annotations:   r.Card.Annotations,
+			SessionID:     r.Card.SessionID,
+			CardInfo:      r.Card.CardInfo,
+			ATR:           r.Card.ATR,
+			ReaderModel:   r.Card.ReaderModel,
+			ReadTimeMs:    r.Card.ReadTimeMs,
+			RequestID:     r.Card.RequestID,
+		}
+	}
+	return r
+}
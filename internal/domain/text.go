@@ -0,0 +1,28 @@
+package domain
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// NormalizeThaiText cleans up text decoded from the card: it drops control
+// bytes, turns no-break spaces (0xA0 in TIS-620) into plain spaces, applies
+// Unicode NFC and collapses runs of whitespace, so the result can be used
+// for exact-match lookups.
+func NormalizeThaiText(s string) string {
+	cleaned := strings.Map(func(r rune) rune {
+		switch {
+		case r == ' ':
+			return ' '
+		case unicode.IsControl(r) && !unicode.IsSpace(r):
+			return -1
+		case r == unicode.ReplacementChar:
+			return -1
+		}
+		return r
+	}, s)
+
+	return strings.Join(strings.Fields(norm.NFC.String(cleaned)), " ")
+}
@@ -0,0 +1,124 @@
+// Package fleet registers this agent with an aggregator, which then serves
+// the agent's cards and shows its health to the operations team.
+package fleet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/config"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/crash"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/version"
+)
+
+// requestTimeout bounds one registration.
+const requestTimeout = 10 * time.Second
+
+// Registrar registers the agent with the aggregator every interval, which
+// also tells the aggregator the agent is still there.
+type Registrar struct {
+	endpoint string
+	token    string
+	interval time.Duration
+	agent    domain.FleetAgent
+	client   *http.Client
+	stop     chan struct{}
+}
+
+// NewRegistrar creates a registrar for cfg, naming the agent after the host
+// when fleet.name is empty.
+func NewRegistrar(cfg config.FleetConfig) *Registrar {
+	name := cfg.Name
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+	return &Registrar{
+		endpoint: strings.TrimRight(cfg.Aggregator, "/") + "/fleet/register",
+		token:    cfg.Token,
+		interval: cfg.Interval,
+		agent: domain.FleetAgent{
+			Name:    name,
+			Site:    cfg.Site,
+			URL:     cfg.URL,
+			Version: version.Version,
+		},
+		client: &http.Client{Timeout: requestTimeout},
+		stop:   make(chan struct{}),
+	}
+}
+
+// Run registers until Stop is called.
+func (r *Registrar) Run() {
+	defer crash.Recover()
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	registered := false
+	lastErr := ""
+	for {
+		// Log changes rather than every interval, e.g. while the aggregator
+		// is down
+		err := r.register()
+		switch {
+		case err == nil && !registered:
+			log.Printf("Registered as %s with the aggregator at %s", r.agent.Name, r.endpoint)
+		case err != nil && err.Error() != lastErr:
+			log.Printf("Failed to register with the aggregator: %v", err)
+		}
+		registered = err == nil
+		lastErr = ""
+		if err != nil {
+			lastErr = err.Error()
+		}
+
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Registrar) Stop() {
+	close(r.stop)
+}
+
+func (r *Registrar) register() error {
+	body, err := json.Marshal(r.agent)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var payload struct {
+			Error string `json:"error"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&payload)
+		return fmt.Errorf("aggregator returned %d %s", resp.StatusCode, payload.Error)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+// Package ldap looks up card holders in an LDAP directory or Active
+// Directory by citizen ID: a simple bind, over ldaps:// or StartTLS when
+// configured, and a search for one entry by an attribute's value.
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/config"
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+// ErrNotFound is returned when no entry has the citizen ID.
+var ErrNotFound = errors.New("no directory entry for citizen ID")
+
+// Directory looks up entries in the configured server. Each lookup uses its
+// own connection, which suits the rate cards are read at.
+type Directory struct {
+	config config.LDAPConfig
+}
+
+// New returns a directory for cfg, or nil when no server is configured.
+func New(cfg config.LDAPConfig) *Directory {
+	if cfg.URL == "" {
+		return nil
+	}
+	return &Directory{config: cfg}
+}
+
+// Lookup finds the entry whose citizen ID attribute is citizenID and
+// returns the first value of each configured attribute it has.
+func (d *Directory) Lookup(ctx context.Context, citizenID string) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.config.Timeout)
+	defer cancel()
+
+	conn, err := d.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	// The client takes no context: closing the connection ends whatever
+	// request is waiting once ctx is done
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetTimeout(time.Until(deadline))
+	}
+
+	if d.config.StartTLS {
+		if err := conn.StartTLS(d.tlsConfig()); err != nil {
+			return nil, fmt.Errorf("LDAP StartTLS failed: %w", err)
+		}
+	}
+	if d.config.BindDN != "" {
+		if err := conn.Bind(d.config.BindDN, d.config.BindPassword); err != nil {
+			return nil, fmt.Errorf("LDAP bind failed: %w", err)
+		}
+	}
+
+	entry, err := d.search(conn, citizenID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Attribute names are case-insensitive; key them as configured
+	attrs := make(map[string]string)
+	for _, name := range d.config.Attributes {
+		for _, attr := range entry.Attributes {
+			if strings.EqualFold(attr.Name, name) && len(attr.Values) > 0 {
+				attrs[name] = attr.Values[0]
+			}
+		}
+	}
+	return attrs, nil
+}
+
+func (d *Directory) dial(ctx context.Context) (*goldap.Conn, error) {
+	dialer := &net.Dialer{}
+	if deadline, ok := ctx.Deadline(); ok {
+		dialer.Deadline = deadline
+	}
+	conn, err := goldap.DialURL(d.config.URL, goldap.DialWithDialer(dialer))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to LDAP server: %w", err)
+	}
+	return conn, nil
+}
+
+// tlsConfig verifies the server against the host name in the URL.
+func (d *Directory) tlsConfig() *tls.Config {
+	u, _ := url.Parse(d.config.URL)
+	return &tls.Config{ServerName: u.Hostname()}
+}
+
+func (d *Directory) search(conn *goldap.Conn, citizenID string) (*goldap.Entry, error) {
+	filter := fmt.Sprintf("(%s=%s)", goldap.EscapeFilter(d.config.CitizenIDAttribute), goldap.EscapeFilter(citizenID))
+	req := goldap.NewSearchRequest(
+		d.config.BaseDN,
+		goldap.ScopeWholeSubtree,
+		goldap.NeverDerefAliases,
+		// Two entries are enough to tell the match is ambiguous
+		2,
+		int(max(d.config.Timeout/time.Second, 1)),
+		false,
+		filter,
+		d.config.Attributes,
+		nil,
+	)
+
+	// Referrals to other servers aren't followed. More entries than the
+	// size limit end in sizeLimitExceeded, which is ambiguous too
+	result, err := conn.Search(req)
+	if goldap.IsErrorWithCode(err, goldap.LDAPResultSizeLimitExceeded) && len(result.Entries) > 0 {
+		return nil, fmt.Errorf("%d or more directory entries share the citizen ID", len(result.Entries)+1)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("LDAP search failed: %w", err)
+	}
+	switch len(result.Entries) {
+	case 0:
+		return nil, ErrNotFound
+	case 1:
+		return result.Entries[0], nil
+	default:
+		return nil, fmt.Errorf("%d directory entries share the citizen ID", len(result.Entries))
+	}
+}
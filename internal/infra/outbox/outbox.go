@@ -0,0 +1,458 @@
+// Package outbox keeps what a sink couldn't deliver in an on-disk queue and
+// delivers it in order once the destination is back, so kiosks on flaky
+// links don't lose check-ins during an outage.
+package outbox
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/config"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/crash"
+)
+
+// pendingSize is how many entries may wait in memory for the queue's
+// goroutine.
+const pendingSize = 64
+
+// Entry flags, the first byte of an entry file.
+const (
+	flagPlain     byte = 0
+	flagEncrypted byte = 1
+)
+
+// headerSize is the flag byte and the enqueue time in Unix nanoseconds.
+const headerSize = 1 + 8
+
+// rejectedDir holds the entries moved aside, at most maxRejected of them.
+const (
+	rejectedDir = "rejected"
+	maxRejected = 100
+)
+
+// ErrFull is returned when entries are still waiting to be queued.
+var ErrFull = errors.New("outbox is full")
+
+// Sender delivers an entry to the sink's destination. An error from
+// Rejected moves the entry aside rather than retrying it.
+type Sender func(data []byte) error
+
+// Rejected marks err as the destination refusing the entry itself, e.g. an
+// HTTP 400, which sending it again won't change.
+func Rejected(err error) error {
+	return rejectedError{err}
+}
+
+type rejectedError struct {
+	err error
+}
+
+func (e rejectedError) Error() string { return e.err.Error() }
+func (e rejectedError) Unwrap() error { return e.err }
+
+type entry struct {
+	data []byte
+	pii  bool
+	at   time.Time
+}
+
+// Queue delivers entries to its sink in order. An entry is sent right away
+// while nothing is queued; one that fails, and any after it, go to disk and
+// are retried every retry interval. Entries holding personal data are only
+// written encrypted.
+//
+// An entry the sink rejects, or that has failed outbox.maxAttempts times
+// while the entry behind it goes through, is moved to the rejected
+// directory, so one bad entry doesn't hold up the queue.
+type Queue struct {
+	name    string
+	dir     string
+	config  config.OutboxConfig
+	maxAge  time.Duration
+	aead    cipher.AEAD
+	send    Sender
+	pending chan entry
+	stop    chan struct{}
+	done    chan struct{}
+	// attempts counts the failed deliveries of the entry files at the
+	// head of the queue; only run uses it
+	attempts map[string]int
+
+	// mu guards next and stopped
+	mu      sync.Mutex
+	next    uint64
+	stopped bool
+}
+
+// Open starts the queue of the sink called name, picking up entries left
+// on disk by an earlier run. It returns nil when cfg has no directory, in
+// which case the sink delivers as it did before.
+func Open(cfg config.OutboxConfig, name string, send Sender) (*Queue, error) {
+	if cfg.Dir == "" {
+		return nil, nil
+	}
+	dir := filepath.Join(cfg.Dir, name)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create the %s outbox: %w", name, err)
+	}
+
+	q := &Queue{
+		name:    name,
+		dir:     dir,
+		config:  cfg,
+		maxAge:  cfg.MaxAge.For(name),
+		send:    send,
+		pending: make(chan entry, pendingSize),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+
+		attempts: make(map[string]int),
+	}
+	if cfg.Key != "" {
+		// Any passphrase will do; it is stretched to an AES-256 key
+		key := sha256.Sum256([]byte(cfg.Key))
+		block, err := aes.NewCipher(key[:])
+		if err != nil {
+			return nil, err
+		}
+		if q.aead, err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+
+	files, err := q.files()
+	if err != nil {
+		return nil, err
+	}
+	if len(files) > 0 {
+		q.next = sequenceOf(files[len(files)-1]) + 1
+		log.Printf("Outbox %s has %d undelivered entries", name, len(files))
+	}
+
+	go q.run()
+	return q, nil
+}
+
+// Enqueue hands data to the queue for delivery. pii marks data holding
+// personal data, which is only written to disk encrypted with outbox.key.
+func (q *Queue) Enqueue(data []byte, pii bool) error {
+	select {
+	case q.pending <- entry{data: data, pii: pii, at: time.Now()}:
+		return nil
+	default:
+		return ErrFull
+	}
+}
+
+// Len returns how many entries wait on disk.
+func (q *Queue) Len() int {
+	files, _ := q.files()
+	return len(files)
+}
+
+// Close stops delivering. Entries still in memory are written to disk, so
+// the next run delivers them.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	if q.stopped {
+		q.mu.Unlock()
+		return
+	}
+	q.stopped = true
+	q.mu.Unlock()
+
+	close(q.stop)
+	<-q.done
+}
+
+func (q *Queue) run() {
+	defer crash.Recover()
+	defer close(q.done)
+
+	for {
+		if q.deliverSpooled() {
+			// Nothing on disk: send the next entry right away
+			select {
+			case e := <-q.pending:
+				if err := q.send(e.data); err != nil {
+					log.Printf("Failed to deliver to %s, queuing: %v", q.name, err)
+					q.spool(e)
+				}
+			case <-q.stop:
+				q.spoolPending()
+				return
+			}
+			continue
+		}
+
+		// The destination is down: queue up behind what's on disk until
+		// the next attempt
+		retry := time.NewTimer(q.config.RetryInterval)
+	wait:
+		for {
+			select {
+			case e := <-q.pending:
+				q.spool(e)
+			case <-retry.C:
+				break wait
+			case <-q.stop:
+				retry.Stop()
+				q.spoolPending()
+				return
+			}
+		}
+	}
+}
+
+// deliverSpooled sends the entries on disk in order, removing each once it
+// is delivered. It reports whether the disk queue is empty.
+func (q *Queue) deliverSpooled() bool {
+	files, err := q.files()
+	if err != nil {
+		log.Printf("Failed to list the %s outbox: %v", q.name, err)
+		return false
+	}
+	for name := range q.attempts {
+		if !slices.Contains(files, name) {
+			delete(q.attempts, name)
+		}
+	}
+
+	delivered := 0
+	// suspect is a head entry past outbox.maxAttempts, moved aside if the
+	// entry behind it is delivered
+	suspect := ""
+	for _, name := range files {
+		path := filepath.Join(q.dir, name)
+		e, err := q.load(path)
+		if err != nil {
+			log.Printf("Dropping unreadable %s outbox entry %s: %v", q.name, name, err)
+			_ = os.Remove(path)
+			continue
+		}
+		if q.maxAge > 0 && time.Since(e.at) > q.maxAge {
+			log.Printf("Dropping %s outbox entry %s: older than outbox.maxAge.%s", q.name, name, q.name)
+			_ = os.Remove(path)
+			continue
+		}
+
+		err = q.send(e.data)
+		var rejected rejectedError
+		switch {
+		case err == nil:
+			_ = os.Remove(path)
+			delivered++
+			if suspect != "" {
+				log.Printf("Moving %s outbox entry %s aside after %d failed attempts", q.name, suspect, q.attempts[suspect])
+				q.setAside(suspect)
+				suspect = ""
+			}
+			continue
+		case errors.As(err, &rejected):
+			log.Printf("Moving %s outbox entry %s aside, it was rejected: %v", q.name, name, err)
+			q.setAside(name)
+			continue
+		case suspect == "":
+			q.attempts[name]++
+			if q.config.MaxAttempts > 0 && q.attempts[name] >= q.config.MaxAttempts {
+				// Try the entry behind it: if that gets through, the
+				// destination is up and this entry is the problem
+				suspect = name
+				continue
+			}
+		default:
+			// The entry behind failed too, so the destination is down
+			// rather than the suspect bad
+			delete(q.attempts, suspect)
+		}
+
+		if delivered > 0 {
+			log.Printf("Delivered %d queued entries to %s before it failed again: %v", delivered, q.name, err)
+		}
+		return false
+	}
+	if delivered > 0 {
+		log.Printf("Delivered %d queued entries to %s", delivered, q.name)
+	}
+	return suspect == ""
+}
+
+// setAside moves the entry file name to the rejected directory, dropping the
+// oldest ones there beyond maxRejected.
+func (q *Queue) setAside(name string) {
+	delete(q.attempts, name)
+	dir := filepath.Join(q.dir, rejectedDir)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		log.Printf("Dropping %s outbox entry %s: %v", q.name, name, err)
+		_ = os.Remove(filepath.Join(q.dir, name))
+		return
+	}
+	if err := os.Rename(filepath.Join(q.dir, name), filepath.Join(dir, name)); err != nil {
+		log.Printf("Dropping %s outbox entry %s: %v", q.name, name, err)
+		_ = os.Remove(filepath.Join(q.dir, name))
+		return
+	}
+
+	files, err := entryFiles(dir)
+	if err != nil {
+		return
+	}
+	for _, old := range files[:max(len(files)-maxRejected, 0)] {
+		_ = os.Remove(filepath.Join(dir, old))
+	}
+}
+
+// spool writes e to disk behind the queued entries, dropping the oldest
+// ones beyond outbox.maxBytes.
+func (q *Queue) spool(e entry) {
+	flag, payload := flagPlain, e.data
+	if e.pii {
+		if q.aead == nil {
+			log.Printf("Dropping undelivered %s entry: it holds personal data and outbox.key isn't set", q.name)
+			return
+		}
+		nonce := make([]byte, q.aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			log.Printf("Dropping undelivered %s entry: %v", q.name, err)
+			return
+		}
+		flag, payload = flagEncrypted, q.aead.Seal(nonce, nonce, e.data, nil)
+	}
+
+	data := make([]byte, headerSize, headerSize+len(payload))
+	data[0] = flag
+	binary.BigEndian.PutUint64(data[1:], uint64(e.at.UnixNano()))
+	data = append(data, payload...)
+
+	q.mu.Lock()
+	name := fmt.Sprintf("%020d.entry", q.next)
+	q.next++
+	q.mu.Unlock()
+
+	// Write aside and rename, so a crash never leaves half an entry
+	path := filepath.Join(q.dir, name)
+	if err := os.WriteFile(path+".tmp", data, 0o600); err != nil {
+		log.Printf("Failed to queue %s entry: %v", q.name, err)
+		return
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		_ = os.Remove(path + ".tmp")
+		log.Printf("Failed to queue %s entry: %v", q.name, err)
+		return
+	}
+	q.trim()
+}
+
+// spoolPending writes the entries waiting in memory to disk.
+func (q *Queue) spoolPending() {
+	for {
+		select {
+		case e := <-q.pending:
+			q.spool(e)
+		default:
+			return
+		}
+	}
+}
+
+// trim drops the oldest entries while the queue is over outbox.maxBytes.
+func (q *Queue) trim() {
+	files, err := q.files()
+	if err != nil {
+		return
+	}
+	sizes := make([]int64, len(files))
+	var total int64
+	for i, name := range files {
+		if info, err := os.Stat(filepath.Join(q.dir, name)); err == nil {
+			sizes[i] = info.Size()
+			total += sizes[i]
+		}
+	}
+
+	dropped := 0
+	for i := 0; total > q.config.MaxBytes && i < len(files)-1; i++ {
+		if err := os.Remove(filepath.Join(q.dir, files[i])); err == nil {
+			total -= sizes[i]
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		log.Printf("Outbox %s is over outbox.maxBytes, dropped the %d oldest entries", q.name, dropped)
+	}
+}
+
+// load reads and, if needed, decrypts the entry at path.
+func (q *Queue) load(path string) (entry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return entry{}, err
+	}
+	if len(data) < headerSize {
+		return entry{}, errors.New("truncated entry")
+	}
+	e := entry{
+		at:   time.Unix(0, int64(binary.BigEndian.Uint64(data[1:headerSize]))),
+		data: data[headerSize:],
+	}
+
+	switch data[0] {
+	case flagPlain:
+	case flagEncrypted:
+		if q.aead == nil {
+			return entry{}, errors.New("entry is encrypted and outbox.key isn't set")
+		}
+		size := q.aead.NonceSize()
+		if len(e.data) < size {
+			return entry{}, errors.New("truncated entry")
+		}
+		if e.data, err = q.aead.Open(nil, e.data[:size], e.data[size:], nil); err != nil {
+			return entry{}, fmt.Errorf("can't decrypt entry, was outbox.key changed? %w", err)
+		}
+		e.pii = true
+	default:
+		return entry{}, fmt.Errorf("unknown entry flag %d", data[0])
+	}
+	return e, nil
+}
+
+// files lists the queued entries, oldest first.
+func (q *Queue) files() ([]string, error) {
+	return entryFiles(q.dir)
+}
+
+// entryFiles lists the entry files in dir, oldest first.
+func entryFiles(dir string) ([]string, error) {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range dirEntries {
+		if strings.HasSuffix(e.Name(), ".entry") {
+			files = append(files, e.Name())
+		}
+	}
+	// Zero-padded sequence numbers sort in queue order
+	slices.Sort(files)
+	return files, nil
+}
+
+// sequenceOf returns the sequence number in an entry's file name.
+func sequenceOf(name string) uint64 {
+	var seq uint64
+	_, _ = fmt.Sscanf(name, "%d.entry", &seq)
+	return seq
+}
@@ -0,0 +1,266 @@
+package outbox
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/config"
+)
+
+// destination records what the queue delivers and fails while down. It
+// never takes the entry bad, rejecting it when reject is set.
+type destination struct {
+	mu        sync.Mutex
+	down      bool
+	bad       string
+	reject    bool
+	delivered []string
+}
+
+func (d *destination) send(data []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.down {
+		return errors.New("destination is down")
+	}
+	if d.bad != "" && string(data) == d.bad {
+		if d.reject {
+			return Rejected(errors.New("bad entry"))
+		}
+		return errors.New("bad entry")
+	}
+	d.delivered = append(d.delivered, string(data))
+	return nil
+}
+
+func (d *destination) setDown(down bool) {
+	d.mu.Lock()
+	d.down = down
+	d.mu.Unlock()
+}
+
+func (d *destination) got() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return slices.Clone(d.delivered)
+}
+
+func testConfig(t *testing.T) config.OutboxConfig {
+	return config.OutboxConfig{
+		Dir:           t.TempDir(),
+		MaxBytes:      1 << 20,
+		RetryInterval: 10 * time.Millisecond,
+	}
+}
+
+// eventually waits for cond, failing the test after a second.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestOpenWithoutDir(t *testing.T) {
+	q, err := Open(config.OutboxConfig{}, "printer", func([]byte) error { return nil })
+	if q != nil || err != nil {
+		t.Errorf("Open = %v, %v, want nil, nil", q, err)
+	}
+}
+
+func TestDeliversInOrderAfterOutage(t *testing.T) {
+	dest := &destination{}
+	q, err := Open(testConfig(t), "printer", dest.send)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer q.Close()
+
+	if err := q.Enqueue([]byte("1"), false); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	eventually(t, "the first entry", func() bool { return len(dest.got()) == 1 })
+
+	dest.setDown(true)
+	for _, data := range []string{"2", "3", "4"} {
+		if err := q.Enqueue([]byte(data), false); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+	eventually(t, "entries on disk", func() bool { return q.Len() == 3 })
+
+	dest.setDown(false)
+	eventually(t, "the queued entries", func() bool { return len(dest.got()) == 4 })
+	if got, want := dest.got(), []string{"1", "2", "3", "4"}; !slices.Equal(got, want) {
+		t.Errorf("delivered %v, want %v", got, want)
+	}
+	if n := q.Len(); n != 0 {
+		t.Errorf("%d entries left on disk", n)
+	}
+}
+
+func TestReopenDeliversLeftovers(t *testing.T) {
+	cfg := testConfig(t)
+	dest := &destination{down: true}
+	q, err := Open(cfg, "heartbeat", dest.send)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	for _, data := range []string{"a", "b"} {
+		_ = q.Enqueue([]byte(data), false)
+	}
+	eventually(t, "entries on disk", func() bool { return q.Len() == 2 })
+	q.Close()
+
+	dest.setDown(false)
+	q, err = Open(cfg, "heartbeat", dest.send)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer q.Close()
+	_ = q.Enqueue([]byte("c"), false)
+	eventually(t, "all entries", func() bool { return len(dest.got()) == 3 })
+	if got, want := dest.got(), []string{"a", "b", "c"}; !slices.Equal(got, want) {
+		t.Errorf("delivered %v, want %v", got, want)
+	}
+}
+
+func TestPersonalData(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      string
+		wantDisk int
+	}{
+		{"dropped without a key", "", 0},
+		{"encrypted with a key", "passphrase", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.Key = tt.key
+			dest := &destination{down: true}
+			q, err := Open(cfg, "printer", dest.send)
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			_ = q.Enqueue([]byte("Somchai J."), true)
+			q.Close()
+
+			files, _ := filepath.Glob(filepath.Join(cfg.Dir, "printer", "*.entry"))
+			if len(files) != tt.wantDisk {
+				t.Fatalf("%d entries on disk, want %d", len(files), tt.wantDisk)
+			}
+			if tt.wantDisk == 0 {
+				return
+			}
+			data, err := os.ReadFile(files[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(data), "Somchai") {
+				t.Error("entry is written in the clear")
+			}
+
+			dest.setDown(false)
+			q, err = Open(cfg, "printer", dest.send)
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			defer q.Close()
+			eventually(t, "the decrypted entry", func() bool { return len(dest.got()) == 1 })
+			if got := dest.got()[0]; got != "Somchai J." {
+				t.Errorf("delivered %q", got)
+			}
+		})
+	}
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		adjust func(*config.OutboxConfig)
+		want   []string
+	}{
+		// Each entry is the header and one byte; three don't fit
+		{"maxBytes drops the oldest", func(c *config.OutboxConfig) { c.MaxBytes = 2 * (headerSize + 1) }, []string{"2", "3"}},
+		{"maxAge drops stale entries", func(c *config.OutboxConfig) { c.MaxAge.Printer = time.Nanosecond }, nil},
+		{"maxAge of another sink", func(c *config.OutboxConfig) { c.MaxAge.Heartbeat = time.Nanosecond }, []string{"1", "2", "3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			tt.adjust(&cfg)
+			dest := &destination{down: true}
+			q, err := Open(cfg, "printer", dest.send)
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			for _, data := range []string{"1", "2", "3"} {
+				_ = q.Enqueue([]byte(data), false)
+			}
+			q.Close()
+
+			dest.setDown(false)
+			q, err = Open(cfg, "printer", dest.send)
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			defer q.Close()
+			eventually(t, "an empty queue", func() bool { return q.Len() == 0 })
+			if got := dest.got(); !slices.Equal(got, tt.want) {
+				t.Errorf("delivered %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBadEntrySetAside(t *testing.T) {
+	tests := []struct {
+		name   string
+		reject bool
+	}{
+		{"rejected", true},
+		{"failing past maxAttempts", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.MaxAttempts = 3
+			dest := &destination{down: true, bad: "2", reject: tt.reject}
+			q, err := Open(cfg, "printer", dest.send)
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			defer q.Close()
+
+			for _, data := range []string{"1", "2", "3"} {
+				_ = q.Enqueue([]byte(data), false)
+			}
+			// An outage is no reason to move entries aside
+			time.Sleep(10 * cfg.RetryInterval)
+			if n := q.Len(); n != 3 {
+				t.Fatalf("%d entries queued during the outage, want 3", n)
+			}
+
+			dest.setDown(false)
+			eventually(t, "an empty queue", func() bool { return q.Len() == 0 })
+			if got := dest.got(); !slices.Equal(got, []string{"1", "3"}) {
+				t.Errorf("delivered %v, want [1 3]", got)
+			}
+			rejected, _ := filepath.Glob(filepath.Join(cfg.Dir, "printer", rejectedDir, "*.entry"))
+			if len(rejected) != 1 {
+				t.Errorf("%d entries set aside, want 1", len(rejected))
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package printer
+
+import (
+	"bytes"
+	"time"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// ESC/POS commands.
+var (
+	escInit        = []byte{0x1B, 0x40}
+	escAlignCenter = []byte{0x1B, 0x61, 0x01}
+	// GS ! with width and height multiplied by 4
+	gsSizeLarge  = []byte{0x1D, 0x21, 0x33}
+	gsSizeNormal = []byte{0x1D, 0x21, 0x00}
+	escBoldOn    = []byte{0x1B, 0x45, 0x01}
+	escBoldOff   = []byte{0x1B, 0x45, 0x00}
+	// ESC d 4 feeds past the cutter, GS V 1 cuts partially
+	escFeed = []byte{0x1B, 0x64, 0x04}
+	gsCut   = []byte{0x1D, 0x56, 0x01}
+)
+
+// Ticket is what is printed on a queue ticket.
+type Ticket struct {
+	Header string
+	Number string
+	Name   string
+	Time   time.Time
+}
+
+// encodeTicket renders ticket as ESC/POS. A non-zero codePage is selected
+// with ESC t and the text encoded as TIS-620 (Windows-874), which the
+// printer's Thai code page must match.
+func encodeTicket(ticket Ticket, codePage int) []byte {
+	var out bytes.Buffer
+	text := func(s string) {
+		if codePage > 0 {
+			if encoded, err := charmap.Windows874.NewEncoder().String(s); err == nil {
+				s = encoded
+			}
+		}
+		out.WriteString(s)
+		out.WriteByte('\n')
+	}
+
+	out.Write(escInit)
+	if codePage > 0 {
+		out.Write([]byte{0x1B, 0x74, byte(codePage)})
+	}
+	out.Write(escAlignCenter)
+	if ticket.Header != "" {
+		text(ticket.Header)
+	}
+
+	out.Write(gsSizeLarge)
+	out.Write(escBoldOn)
+	text(ticket.Number)
+	out.Write(escBoldOff)
+	out.Write(gsSizeNormal)
+
+	if ticket.Name != "" {
+		text(ticket.Name)
+	}
+	text(ticket.Time.Format("2006-01-02 15:04"))
+
+	out.Write(escFeed)
+	out.Write(gsCut)
+	return out.Bytes()
+}
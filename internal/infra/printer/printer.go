@@ -0,0 +1,178 @@
+// Package printer prints queue tickets on ESC/POS receipt printers, turning
+// a kiosk with a card reader into a self check-in point.
+package printer
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/config"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/crash"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/infra/outbox"
+)
+
+// queueSize is how many tickets may wait for a slow or offline printer.
+const queueSize = 16
+
+// ErrBusy is returned when tickets are still waiting for the printer.
+var ErrBusy = errors.New("printer queue is full")
+
+// Printer numbers tickets and prints them in the background, so a slow or
+// offline printer never holds up card reads.
+type Printer struct {
+	config config.PrinterConfig
+	queue  chan []byte
+	// outbox keeps tickets the printer didn't take on disk; nil when
+	// outbox.dir isn't set
+	outbox *outbox.Queue
+
+	mu   sync.Mutex
+	last int
+	day  string
+}
+
+// New starts printing to the configured printer, or returns nil when none
+// is configured. Tickets go through the outbox when outboxCfg has a
+// directory, so they're printed once an offline printer is back.
+func New(cfg config.PrinterConfig, outboxCfg config.OutboxConfig) *Printer {
+	if cfg.Address == "" {
+		return nil
+	}
+	p := &Printer{config: cfg}
+	queue, err := outbox.Open(outboxCfg, "printer", p.write)
+	if err != nil {
+		log.Printf("Printing without an outbox: %v", err)
+	}
+	if queue != nil {
+		p.outbox = queue
+		return p
+	}
+	p.queue = make(chan []byte, queueSize)
+	go p.run()
+	return p
+}
+
+// Close stops printing, keeping tickets not yet printed in the outbox.
+func (p *Printer) Close() {
+	if p.outbox != nil {
+		p.outbox.Close()
+	}
+}
+
+// Issue gives the holder of card the next queue number and queues their
+// ticket. The number is returned for display.
+func (p *Printer) Issue(card *domain.ThaiIdCard) (string, error) {
+	now := time.Now()
+	number := p.nextNumber(now)
+	ticket := Ticket{
+		Header: p.config.Header,
+		Number: number,
+		Name:   ticketName(card, p.config.Name),
+		Time:   now,
+	}
+
+	codePage := 0
+	if p.config.Name == config.PrinterNameTH {
+		codePage = p.config.CodePage
+	}
+	data := encodeTicket(ticket, codePage)
+	if p.outbox != nil {
+		// A name on the ticket is personal data
+		if err := p.outbox.Enqueue(data, ticket.Name != ""); err != nil {
+			return number, ErrBusy
+		}
+		return number, nil
+	}
+	select {
+	case p.queue <- data:
+		return number, nil
+	default:
+		return number, ErrBusy
+	}
+}
+
+func (p *Printer) nextNumber(now time.Time) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if day := now.Format(time.DateOnly); p.config.ResetDaily && day != p.day {
+		p.day = day
+		p.last = 0
+	}
+	p.last++
+	return fmt.Sprintf("%s%03d", p.config.Prefix, p.last)
+}
+
+func (p *Printer) run() {
+	defer crash.Recover()
+	for data := range p.queue {
+		if err := p.write(data); err != nil {
+			log.Printf("Failed to print queue ticket: %v", err)
+		}
+	}
+}
+
+// write sends data to a network printer, or writes it to the printer's
+// device or share.
+func (p *Printer) write(data []byte) error {
+	if addr, ok := strings.CutPrefix(p.config.Address, "tcp://"); ok {
+		conn, err := net.DialTimeout("tcp", addr, p.config.Timeout)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		_ = conn.SetWriteDeadline(time.Now().Add(p.config.Timeout))
+		_, err = conn.Write(data)
+		return err
+	}
+
+	f, err := os.OpenFile(p.config.Address, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ticketName is the holder's first name and last name initial, so the
+// ticket can be matched to its owner without printing the full name.
+func ticketName(card *domain.ThaiIdCard, mode string) string {
+	var first, last string
+	switch mode {
+	case config.PrinterNameEN:
+		first, last = card.FirstNameEN, card.LastNameEN
+	case config.PrinterNameTH:
+		first, last = card.FirstNameTH, card.LastNameTH
+	default:
+		return ""
+	}
+	if last == "" {
+		return first
+	}
+	return first + " " + initial(last) + "."
+}
+
+// initial returns the first letter of name. A Thai leading vowel (เ แ โ ใ ไ)
+// is kept with the consonant after it, and marks above or below stay with
+// their letter.
+func initial(name string) string {
+	runes := []rune(name)
+	n := 1
+	if runes[0] >= 'เ' && runes[0] <= 'ไ' && len(runes) > 1 {
+		n = 2
+	}
+	for n < len(runes) && unicode.Is(unicode.Mn, runes[n]) {
+		n++
+	}
+	return string(runes[:n])
+}
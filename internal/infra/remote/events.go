@@ -0,0 +1,142 @@
+package remote
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+	"github.com/cortex-x/go-thai-id-card-reader/pkg/client"
+)
+
+// dispatch passes an agent's event to the handler of the same event here,
+// renaming its readers. Events the agent derives from card events, e.g.
+// DUPLICATE_SCAN or TICKET_ISSUED, are left out as this service derives its
+// own.
+func (r *Reader) dispatch(a *agent, event client.CardEvent) {
+	reader := a.reader(event.Reader)
+	a.mu.Lock()
+	a.lastEvent = time.Now()
+	a.events++
+	a.mu.Unlock()
+
+	switch event.Type {
+	case client.EventCardInserted:
+		if event.Card == nil || r.cardInsertHandler == nil {
+			return
+		}
+		card := event.Card
+		card.Reader = reader
+		if card.PhotoChunks > 0 || card.PhotoToken != "" {
+			// The photo was sent apart; GET /card/photo fetches it instead
+			card.PhotoChunks, card.PhotoToken, card.PhotoURL = 0, "", ""
+			card.PhotoDeferred = true
+		}
+		r.cardInsertHandler(reader, card, nil)
+
+	case client.EventError:
+		// Unsupported cards are passed on with their UNSUPPORTED_CARD event
+		if event.Error == nil || event.Error.Code == domain.ErrCodeUnsupportedCard || r.cardInsertHandler == nil {
+			return
+		}
+		r.cardInsertHandler(reader, nil, a.cardError(*event.Error))
+
+	case "UNSUPPORTED_CARD":
+		var card domain.UnsupportedCard
+		if !decode(a, event, &card) || r.cardInsertHandler == nil {
+			return
+		}
+		card.Reader, card.ReaderAlias = reader, ""
+		r.cardInsertHandler(reader, nil, &domain.UnsupportedCardError{
+			Card: card,
+			Err:  fmt.Errorf("agent %s: %s card", a.name, card.CardType),
+		})
+
+	case client.EventCardIdentified:
+		if event.Card == nil || r.cardIdentHandler == nil {
+			return
+		}
+		event.Card.Reader = reader
+		r.cardIdentHandler(reader, event.Card)
+
+	case client.EventCardRemoved:
+		if r.cardRemoveHandler != nil {
+			r.cardRemoveHandler(reader)
+		}
+
+	case "CARD_BUSY":
+		if r.cardBusyHandler != nil {
+			r.cardBusyHandler(reader)
+		}
+
+	case "CARD_CHANGED":
+		if r.cardChangeHandler != nil {
+			r.cardChangeHandler(reader)
+		}
+
+	case "READER_CONFLICT":
+		var conflict domain.ReaderConflictEvent
+		if decode(a, event, &conflict) && r.conflictHandler != nil {
+			conflict.Reader, conflict.ReaderAlias = reader, ""
+			r.conflictHandler(conflict)
+		}
+
+	case "READER_FAILOVER":
+		var failover domain.ReaderFailoverEvent
+		if decode(a, event, &failover) && r.failoverHandler != nil {
+			r.failoverHandler(a.reader(failover.From), a.reader(failover.To))
+		}
+
+	case "READER_DEGRADED":
+		var degraded domain.ReaderDegradedEvent
+		if decode(a, event, &degraded) && r.degradedHandler != nil {
+			r.degradedHandler(reader, degraded.Failures)
+		}
+
+	case "READER_RECOVERED":
+		if r.recoveredHandler != nil {
+			r.recoveredHandler(reader)
+		}
+
+	case "MONITOR_STALLED":
+		var stalled domain.MonitorStalledEvent
+		if !decode(a, event, &stalled) {
+			return
+		}
+		stall := domain.MonitorStall{
+			Stage:  stalled.Stage,
+			Reader: a.reader(stalled.Reader),
+			Since:  time.Now().Add(-time.Duration(stalled.StalledMs) * time.Millisecond),
+		}
+		a.mu.Lock()
+		a.upstream = &stall
+		a.mu.Unlock()
+		if r.stalledHandler != nil {
+			r.stalledHandler(stall, stalled.ResetContext)
+		}
+
+	case "MONITOR_RECOVERED":
+		a.mu.Lock()
+		stall := a.upstream
+		a.upstream = nil
+		a.mu.Unlock()
+		if stall != nil && r.unstalledHandler != nil {
+			r.unstalledHandler(*stall)
+		}
+	}
+}
+
+// decode decodes the payload of event, logging payloads it can't.
+func decode(a *agent, event client.CardEvent, v interface{}) bool {
+	err := json.Unmarshal(event.Payload, v)
+	if err == nil && len(event.Payload) == 0 {
+		err = errors.New("no payload")
+	}
+	if err != nil {
+		log.Printf("Ignoring %s from agent %s: %v", event.Type, a.name, err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,131 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+)
+
+// Register adds an agent that registered itself, or refreshes it when it
+// registered before. An agent that moved to another URL is reconnected.
+func (r *Reader) Register(info domain.FleetAgent) (domain.AgentStatus, error) {
+	if info.Name == "" || strings.Contains(info.Name, "/") {
+		return domain.AgentStatus{}, fmt.Errorf("invalid agent name %q", info.Name)
+	}
+	if r.ttl <= 0 {
+		return domain.AgentStatus{}, errors.New("this service doesn't accept agents")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := slices.IndexFunc(r.agents, func(a *agent) bool { return a.name == info.Name })
+	if i >= 0 {
+		a := r.agents[i]
+		if !a.registered {
+			return domain.AgentStatus{}, domain.ErrAgentConfigured
+		}
+		a.mu.Lock()
+		sameURL := a.info.URL == info.URL
+		if sameURL {
+			a.info = info
+			a.lastSeen = time.Now()
+		}
+		a.mu.Unlock()
+		if sameURL {
+			return a.status(), nil
+		}
+		log.Printf("Agent %s moved to %s", info.Name, info.URL)
+		r.stop(i)
+	}
+
+	a, err := r.newAgent(info)
+	if err != nil {
+		return domain.AgentStatus{}, err
+	}
+	a.registered = true
+	a.lastSeen = time.Now()
+	r.agents = append(r.agents, a)
+	if r.ctx != nil {
+		r.start(a)
+	}
+	log.Printf("Agent %s registered from %s", info.Name, info.URL)
+	return a.status(), nil
+}
+
+// Agents returns the status of every agent served.
+func (r *Reader) Agents() []domain.AgentStatus {
+	agents := r.list()
+	statuses := make([]domain.AgentStatus, len(agents))
+	for i, a := range agents {
+		statuses[i] = a.status()
+	}
+	return statuses
+}
+
+// expire drops registered agents that haven't registered again within the
+// TTL, until ctx is done.
+func (r *Reader) expire(ctx context.Context) {
+	ticker := time.NewTicker(max(r.ttl/4, time.Second))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		r.mu.Lock()
+		deadline := time.Now().Add(-r.ttl)
+		for i := len(r.agents) - 1; i >= 0; i-- {
+			a := r.agents[i]
+			a.mu.Lock()
+			expired := a.registered && a.lastSeen.Before(deadline)
+			a.mu.Unlock()
+			if expired {
+				log.Printf("Agent %s stopped registering, dropping it", a.name)
+				r.stop(i)
+			}
+		}
+		r.mu.Unlock()
+	}
+}
+
+// stop disconnects the i-th agent and forgets it. r.mu must be held.
+func (r *Reader) stop(i int) {
+	if a := r.agents[i]; a.cancel != nil {
+		a.cancel()
+	}
+	r.agents = slices.Delete(r.agents, i, i+1)
+}
+
+func (a *agent) status() domain.AgentStatus {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	status := domain.AgentStatus{
+		FleetAgent: a.info,
+		Registered: a.registered,
+		Connected:  a.ctx != nil && a.down == nil,
+		Since:      a.since,
+		Events:     a.events,
+	}
+	if a.registered {
+		lastSeen := a.lastSeen
+		status.LastSeenAt = &lastSeen
+	}
+	if !a.lastEvent.IsZero() {
+		lastEvent := a.lastEvent
+		status.LastEventAt = &lastEvent
+	}
+	if a.upstream != nil {
+		stall := *a.upstream
+		status.Stall = &stall
+	}
+	return status
+}
@@ -0,0 +1,443 @@
+// Package remote serves the cards of other agents as if their readers were
+// local, so a central server can offer one API over many counter agents.
+// Each agent's readers are named <agent>/<reader>.
+package remote
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/config"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/crash"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/version"
+	"github.com/cortex-x/go-thai-id-card-reader/pkg/client"
+)
+
+// StageRemote is the monitor stage reported while an agent is unreachable.
+const StageRemote = "remote"
+
+// healthTimeout bounds the self test's check of each agent.
+const healthTimeout = 5 * time.Second
+
+// Reader implements domain.CardReaderService over the event streams and
+// REST APIs of the configured agents.
+type Reader struct {
+	// ttl drops registered agents that stop registering; 0 accepts none
+	ttl time.Duration
+
+	mu     sync.RWMutex
+	agents []*agent
+	// ctx is set while monitoring, for agents that register meanwhile
+	ctx context.Context
+
+	cardInsertHandler func(reader string, card *domain.ThaiIdCard, err error)
+	cardIdentHandler  func(reader string, card *domain.ThaiIdCard)
+	cardRemoveHandler func(reader string)
+	failoverHandler   func(from, to string)
+	cardBusyHandler   func(reader string)
+	cardChangeHandler func(reader string)
+	conflictHandler   func(conflict domain.ReaderConflictEvent)
+	degradedHandler   func(reader string, failures int)
+	recoveredHandler  func(reader string)
+	stalledHandler    func(stall domain.MonitorStall, resetContext bool)
+	unstalledHandler  func(stall domain.MonitorStall)
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// agent is one upstream agent and the state of its connection.
+type agent struct {
+	name   string
+	client *client.Client
+	// registered agents registered themselves and expire
+	registered bool
+	ctx        context.Context
+	cancel     context.CancelFunc
+
+	mu   sync.Mutex
+	info domain.FleetAgent
+	// down is set while the agent is unreachable, upstream while its own
+	// monitor is stalled; reported says whether down was announced
+	down      *domain.MonitorStall
+	reported  bool
+	upstream  *domain.MonitorStall
+	since     time.Time
+	lastSeen  time.Time
+	lastEvent time.Time
+	events    int
+}
+
+// New creates clients for the agents in cfg.Remote, and accepts agents
+// registering themselves when cfg.Fleet.Accept is on. Call StartMonitoring
+// to connect.
+func New(cfg *config.Config) (*Reader, error) {
+	r := &Reader{}
+	if cfg.Fleet.Accept {
+		r.ttl = cfg.Fleet.TTL
+	}
+	for _, ac := range cfg.Remote.Agents {
+		a, err := r.newAgent(domain.FleetAgent{Name: ac.Name, Site: ac.Site, URL: ac.URL})
+		if err != nil {
+			return nil, fmt.Errorf("agent %s: %w", ac.Name, err)
+		}
+		r.agents = append(r.agents, a)
+	}
+	return r, nil
+}
+
+func (r *Reader) newAgent(info domain.FleetAgent) (*agent, error) {
+	a := &agent{name: info.Name, info: info}
+	c, err := client.New(client.Options{
+		URL:     info.URL,
+		Name:    "thaiid-remote",
+		Version: version.Version,
+		// Unacknowledged cards are sent again after a reconnect
+		Ack:          true,
+		Logf:         log.Printf,
+		OnConnection: func(connected bool) { r.connectionChanged(a, connected) },
+	})
+	if err != nil {
+		return nil, err
+	}
+	a.client = c
+	return a, nil
+}
+
+func (r *Reader) StartMonitoring() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cancel != nil {
+		return errors.New("already monitoring")
+	}
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+
+	for _, a := range r.agents {
+		r.start(a)
+	}
+	if r.ttl > 0 {
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			defer crash.Recover()
+			r.expire(r.ctx)
+		}()
+	}
+	return nil
+}
+
+// start connects to a and passes its events on until a.cancel is called.
+// r.mu must be held.
+func (r *Reader) start(a *agent) {
+	a.mu.Lock()
+	a.ctx, a.cancel = context.WithCancel(r.ctx)
+	a.since = time.Now()
+	a.down = &domain.MonitorStall{Stage: StageRemote, Reader: a.name, Since: a.since}
+	a.reported = false
+	a.mu.Unlock()
+
+	r.wg.Add(2)
+	go func() {
+		defer r.wg.Done()
+		defer crash.Recover()
+		_ = a.client.Run(a.ctx)
+	}()
+	go func() {
+		defer r.wg.Done()
+		defer crash.Recover()
+		for event := range a.client.Events() {
+			r.dispatch(a, event)
+		}
+	}()
+}
+
+func (r *Reader) StopMonitoring() {
+	r.mu.Lock()
+	if r.cancel == nil {
+		r.mu.Unlock()
+		return
+	}
+	r.cancel()
+	r.ctx, r.cancel = nil, nil
+	r.mu.Unlock()
+	r.wg.Wait()
+}
+
+// stopped reports whether a is being disconnected on purpose.
+func (a *agent) stopped() bool {
+	return a.ctx == nil || a.ctx.Err() != nil
+}
+
+// list returns the agents, for iterating without holding r.mu.
+func (r *Reader) list() []*agent {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Clone(r.agents)
+}
+
+// connectionChanged reports an agent that became unreachable as a stalled
+// monitor, and its return as a recovery. Agents being stopped aren't
+// reported.
+func (r *Reader) connectionChanged(a *agent, connected bool) {
+	a.mu.Lock()
+	if connected {
+		stall, reported := a.down, a.reported
+		a.down, a.reported = nil, false
+		a.since = time.Now()
+		a.mu.Unlock()
+		log.Printf("Connected to agent %s", a.name)
+		if stall != nil && reported && r.unstalledHandler != nil {
+			r.unstalledHandler(*stall)
+		}
+		return
+	}
+
+	stall := domain.MonitorStall{Stage: StageRemote, Reader: a.name, Since: time.Now()}
+	a.down, a.reported, a.since = &stall, true, stall.Since
+	a.mu.Unlock()
+	if a.stopped() {
+		return
+	}
+	log.Printf("Lost connection to agent %s", a.name)
+	if r.stalledHandler != nil {
+		r.stalledHandler(stall, false)
+	}
+}
+
+// MonitorHealth returns the longest running stall: an unreachable agent, or
+// an agent whose own monitor is stalled.
+func (r *Reader) MonitorHealth() *domain.MonitorStall {
+	var oldest *domain.MonitorStall
+	for _, a := range r.list() {
+		a.mu.Lock()
+		for _, stall := range []*domain.MonitorStall{a.down, a.upstream} {
+			if stall != nil && (oldest == nil || stall.Since.Before(oldest.Since)) {
+				s := *stall
+				oldest = &s
+			}
+		}
+		a.mu.Unlock()
+	}
+	return oldest
+}
+
+// ReadCard reads the card in reader through its agent. Without a reader
+// the agents are tried in turn.
+func (r *Reader) ReadCard(ctx context.Context, reader string) (*domain.ThaiIdCard, error) {
+	if reader == "" {
+		err := errors.New(domain.ErrMsgReaderNotFound)
+		for _, a := range r.list() {
+			var card *domain.ThaiIdCard
+			if card, err = r.readCard(ctx, a, ""); err == nil {
+				return card, nil
+			}
+		}
+		return nil, err
+	}
+
+	a, upstream, ok := r.find(reader)
+	if !ok {
+		return nil, errors.New(domain.ErrMsgReaderNotFound)
+	}
+	return r.readCard(ctx, a, upstream)
+}
+
+func (r *Reader) readCard(ctx context.Context, a *agent, upstream string) (*domain.ThaiIdCard, error) {
+	card, err := a.client.ReadCard(ctx, upstream)
+	if err != nil {
+		var apiErr *client.APIError
+		if errors.As(err, &apiErr) && apiErr.Partial != nil {
+			// What the agent read before it timed out
+			card = apiErr.Partial
+			card.Reader = a.reader(card.Reader)
+		}
+		return card, a.readError(err)
+	}
+	card.Reader = a.reader(card.Reader)
+	return card, nil
+}
+
+// ReadPhoto fetches the photo of the card in reader from its agent, which
+// reads it if it deferred it.
+func (r *Reader) ReadPhoto(ctx context.Context, reader string) (string, string, error) {
+	a, upstream, ok := r.find(reader)
+	if !ok {
+		return "", "", errors.New(domain.ErrMsgReaderNotFound)
+	}
+	card, err := a.client.CurrentCard(ctx, upstream)
+	if err != nil {
+		return "", "", a.readError(err)
+	}
+	photo, err := a.client.CardPhoto(ctx, upstream)
+	if err != nil {
+		return "", "", a.readError(err)
+	}
+	return card.CitizenID, base64.StdEncoding.EncodeToString(photo), nil
+}
+
+// RetryRead asks the agent of reader to read its card again. The agent
+// announces the read, which arrives with the agent's other events.
+func (r *Reader) RetryRead(ctx context.Context, reader string) error {
+	a, upstream, ok := r.find(reader)
+	if !ok {
+		return errors.New(domain.ErrMsgReaderNotFound)
+	}
+	if err := a.client.RetryRead(ctx, upstream); err != nil {
+		return a.readError(err)
+	}
+	return nil
+}
+
+// find splits a reader name into its agent and the agent's name for it.
+func (r *Reader) find(reader string) (*agent, string, bool) {
+	name, upstream, _ := strings.Cut(reader, "/")
+	for _, a := range r.list() {
+		if a.name == name {
+			return a, upstream, true
+		}
+	}
+	return nil, "", false
+}
+
+// reader names an agent's reader locally. Events about the agent itself,
+// e.g. that it has no reader, are named after the agent.
+func (a *agent) reader(upstream string) string {
+	if upstream == "" {
+		return a.name
+	}
+	return a.name + "/" + upstream
+}
+
+// readError turns an error from the agent's REST API into the error the
+// agent's reader gave, so it maps to the same error code here.
+func (a *agent) readError(err error) error {
+	var apiErr *client.APIError
+	if !errors.As(err, &apiErr) || apiErr.Code == 0 {
+		return fmt.Errorf("agent %s: %w", a.name, err)
+	}
+	return a.cardError(apiErr.ErrorResponse)
+}
+
+// errorMessages are the card errors identified by their message.
+var errorMessages = map[int]string{
+	domain.ErrCodeReaderNotFound:  domain.ErrMsgReaderNotFound,
+	domain.ErrCodeCardNotDetected: domain.ErrMsgCardNotDetected,
+	domain.ErrCodeCardInUse:       domain.ErrMsgCardInUse,
+	domain.ErrCodeServiceDisabled: domain.ErrMsgServiceDisabled,
+	domain.ErrCodeServiceStopped:  domain.ErrMsgServiceStopped,
+	domain.ErrCodeReaderConflict:  domain.ErrMsgReaderConflict,
+}
+
+// cardError rebuilds the error an agent reported, whatever language the
+// agent wrote its message in.
+func (a *agent) cardError(resp domain.ErrorResponse) error {
+	switch resp.Code {
+	case domain.ErrCodeReadTimeout:
+		return fmt.Errorf("agent %s: %w", a.name, context.DeadlineExceeded)
+	case domain.ErrCodeUnsupportedCard:
+		return &domain.UnsupportedCardError{
+			Card: domain.UnsupportedCard{Reader: a.reader(resp.Reader)},
+			Err:  fmt.Errorf("agent %s: %s", a.name, resp.Message),
+		}
+	case domain.ErrCodeCardRejected:
+		return &domain.CardRejectedError{Step: "agent " + a.name, Err: errors.New(resp.Message)}
+	case domain.ErrCodeIncompleteRead:
+		return &domain.IncompleteReadError{Fields: resp.Fields}
+	}
+	if message, ok := errorMessages[resp.Code]; ok {
+		return errors.New(message)
+	}
+	return fmt.Errorf("agent %s: %s", a.name, resp.Message)
+}
+
+// SelfTest checks that each agent answers.
+func (r *Reader) SelfTest() domain.SelfTestReport {
+	report := domain.NewSelfTestReport()
+	for _, a := range r.list() {
+		start := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), healthTimeout)
+		err := a.client.Health(ctx)
+		cancel()
+		report.Add("agent "+a.name, start, err, "")
+	}
+	return *report
+}
+
+// PCSCInfo reports the agents that can't be reached; their readers are
+// listed by each agent's own diagnostics.
+func (r *Reader) PCSCInfo() domain.PCSCInfo {
+	info := domain.PCSCInfo{Stack: StageRemote, Readers: []domain.ReaderStatus{}}
+	var down []string
+	for _, a := range r.list() {
+		a.mu.Lock()
+		if a.down != nil {
+			down = append(down, a.name)
+		}
+		a.mu.Unlock()
+	}
+	if len(down) > 0 {
+		info.Error = "not connected to " + strings.Join(down, ", ")
+	}
+	return info
+}
+
+// MonitorStrategy is events, as agents push their card events.
+func (r *Reader) MonitorStrategy() string {
+	return domain.MonitorEvents
+}
+
+func (r *Reader) SetMonitorStrategy(strategy string) error {
+	return errors.New("the monitor strategy is set on each agent")
+}
+
+func (r *Reader) OnCardInserted(handler func(reader string, card *domain.ThaiIdCard, err error)) {
+	r.cardInsertHandler = handler
+}
+
+func (r *Reader) OnCardIdentified(handler func(reader string, card *domain.ThaiIdCard)) {
+	r.cardIdentHandler = handler
+}
+
+func (r *Reader) OnCardRemoved(handler func(reader string)) {
+	r.cardRemoveHandler = handler
+}
+
+func (r *Reader) OnCardBusy(handler func(reader string)) {
+	r.cardBusyHandler = handler
+}
+
+func (r *Reader) OnCardChanged(handler func(reader string)) {
+	r.cardChangeHandler = handler
+}
+
+func (r *Reader) OnReaderConflict(handler func(conflict domain.ReaderConflictEvent)) {
+	r.conflictHandler = handler
+}
+
+func (r *Reader) OnReaderFailover(handler func(from, to string)) {
+	r.failoverHandler = handler
+}
+
+func (r *Reader) OnReaderDegraded(handler func(reader string, failures int)) {
+	r.degradedHandler = handler
+}
+
+func (r *Reader) OnReaderRecovered(handler func(reader string)) {
+	r.recoveredHandler = handler
+}
+
+func (r *Reader) OnMonitorStalled(handler func(stall domain.MonitorStall, resetContext bool)) {
+	r.stalledHandler = handler
+}
+
+func (r *Reader) OnMonitorRecovered(handler func(stall domain.MonitorStall)) {
+	r.unstalledHandler = handler
+}
@@ -0,0 +1,55 @@
+//go:build darwin
+
+package smartcard
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+)
+
+const arbitrationRemediation = "macOS CryptoTokenKit has claimed the card with the %s token driver. Quit other apps using the card, " +
+	"or stop the driver claiming it with " +
+	"'sudo defaults write /Library/Preferences/com.apple.security.smartcard DisabledTokens -array-add %s' " +
+	"and reinsert the card."
+
+// detectReaderConflict checks whether CryptoTokenKit has made a token of an
+// inserted card, which explains a sharing violation on reader. Its daemons
+// run whenever a reader is attached, so only a token shows it actually
+// claimed the card.
+func detectReaderConflict(reader string) *domain.ReaderConflictEvent {
+	out, err := exec.Command("security", "list-smartcards").Output()
+	if err != nil {
+		return nil
+	}
+	tokens := smartcardTokens(out)
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	// Token IDs are the driver's class ID and an instance ID
+	driver, _, _ := strings.Cut(tokens[0], ":")
+	return &domain.ReaderConflictEvent{
+		Reader:      reader,
+		Holder:      driver,
+		Remediation: fmt.Sprintf(arbitrationRemediation, driver, driver),
+	}
+}
+
+// smartcardTokens returns the token IDs listed by 'security list-smartcards',
+// which prints one per line, or a message when there are none.
+func smartcardTokens(out []byte) []string {
+	var tokens []string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.ContainsAny(line, " \t") && strings.Contains(line, ":") {
+			tokens = append(tokens, line)
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,10 @@
+//go:build !darwin
+
+package smartcard
+
+import "github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+
+// detectReaderConflict only applies to macOS reader arbitration.
+func detectReaderConflict(reader string) *domain.ReaderConflictEvent {
+	return nil
+}
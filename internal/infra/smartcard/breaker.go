@@ -0,0 +1,88 @@
+package smartcard
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+)
+
+// breakerState counts the failed reads of a reader. Once open, the monitor
+// leaves the reader alone until probeAt, then reads the card once more.
+type breakerState struct {
+	failures int
+	open     bool
+	probeAt  time.Time
+}
+
+func (r *PCSCReader) OnReaderDegraded(handler func(reader string, failures int)) {
+	r.degradedHandler = handler
+}
+
+func (r *PCSCReader) OnReaderRecovered(handler func(reader string)) {
+	r.recoveredHandler = handler
+}
+
+// circuitOpen reports whether reads from reader are suspended, and whether
+// it's time to probe it. The caller holds cardMu.
+func (r *PCSCReader) circuitOpen(reader string) (open, probe bool) {
+	state, ok := r.breakers[reader]
+	if !ok || !state.open {
+		return false, false
+	}
+	return true, !time.Now().Before(state.probeAt)
+}
+
+// deferProbe moves the next probe of an open circuit a probe interval on,
+// for probes that found no card to read. The caller holds cardMu.
+func (r *PCSCReader) deferProbe(reader string) {
+	if state, ok := r.breakers[reader]; ok && state.open {
+		state.probeAt = time.Now().Add(r.breaker.ProbeInterval)
+	}
+}
+
+// recordRead feeds the outcome of a read to the reader's circuit breaker.
+// Only failures of the reader or card count: unsupported cards, cards held
+// by another application and abandoned on-demand reads don't. The caller
+// holds cardMu.
+func (r *PCSCReader) recordRead(reader string, err error) {
+	if r.breaker.Failures <= 0 || reader == "" {
+		return
+	}
+
+	var unsupported *domain.UnsupportedCardError
+	if err != nil && (errors.As(err, &unsupported) || errors.Is(err, context.Canceled) ||
+		err.Error() == domain.ErrMsgCardInUse || err.Error() == domain.ErrMsgReaderConflict ||
+		err.Error() == domain.ErrMsgCardNotDetected || err.Error() == domain.ErrMsgReaderNotFound) {
+		return
+	}
+
+	state, ok := r.breakers[reader]
+	if err == nil {
+		if ok && state.open {
+			log.Printf("Reader %s recovered", reader)
+			if r.recoveredHandler != nil {
+				r.recoveredHandler(reader)
+			}
+		}
+		delete(r.breakers, reader)
+		return
+	}
+
+	if !ok {
+		state = &breakerState{}
+		r.breakers[reader] = state
+	}
+	state.failures++
+	state.probeAt = time.Now().Add(r.breaker.ProbeInterval)
+
+	if !state.open && state.failures >= r.breaker.Failures {
+		state.open = true
+		log.Printf("Reader %s failed %d reads in a row, probing every %v", reader, state.failures, r.breaker.ProbeInterval)
+		if r.degradedHandler != nil {
+			r.degradedHandler(reader, state.failures)
+		}
+	}
+}
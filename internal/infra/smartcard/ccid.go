@@ -0,0 +1,226 @@
+package smartcard
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// CCID messages, from the USB CCID specification.
+const (
+	ccidPowerOn       byte = 0x62
+	ccidPowerOff      byte = 0x63
+	ccidGetSlotStatus byte = 0x65
+	ccidXfrBlock      byte = 0x6F
+	ccidDataBlock     byte = 0x80
+	ccidSlotStatus    byte = 0x81
+	ccidNotifySlot    byte = 0x50
+
+	ccidHeaderLen = 10
+)
+
+// Serial framing used by CCID readers on a serial line, as in libccid's
+// serial driver: SYNC, CTRL, the CCID message and an XOR checksum (LRC).
+const (
+	serialSync    byte = 0x03
+	serialAck     byte = 0x06
+	serialNak     byte = 0x15
+	maxSerialNaks      = 3
+)
+
+// iccAbsent is the ICC status in bits 0-1 of bStatus when there's no card.
+const iccAbsent = 2
+
+// ccidMaxData bounds a response so a corrupted length can't allocate much.
+const ccidMaxData = 65544
+
+var (
+	errNoCard          = errors.New("no card in reader")
+	errSerialChecksum  = errors.New("CCID frame checksum mismatch")
+	errSerialRejected  = errors.New("reader rejected the CCID frame")
+	errCCIDUnexpected  = errors.New("unexpected CCID response")
+	errReaderNoRespond = errors.New("reader is not responding")
+)
+
+// CCIDTransport drives a CCID reader attached by serial or Bluetooth SPP,
+// which exchanges CCID messages over a byte stream instead of USB bulk
+// endpoints. The reader must exchange APDUs (short or extended APDU level),
+// as the readers in enrollment kits do; TPDU level readers aren't supported.
+type CCIDTransport struct {
+	name string
+	port io.ReadWriter
+	seq  byte
+	atr  []byte
+}
+
+// NewCCIDTransport drives the reader on port. name is the reader name used in
+// events.
+func NewCCIDTransport(name string, port io.ReadWriter) *CCIDTransport {
+	return &CCIDTransport{name: name, port: port}
+}
+
+// ReaderName returns the reader name given to NewCCIDTransport.
+func (t *CCIDTransport) ReaderName() string {
+	return t.name
+}
+
+// CardStatus returns the ATR from the last PowerOn and the reader name,
+// which serves as the model too.
+func (t *CCIDTransport) CardStatus() ([]byte, string, string, error) {
+	if t.atr == nil {
+		return nil, "", "", errNoCard
+	}
+	return t.atr, t.name, t.name, nil
+}
+
+// CardPresent asks the reader whether a card is inserted.
+func (t *CCIDTransport) CardPresent() (bool, error) {
+	rsp, _, err := t.exchange(ccidGetSlotStatus, [3]byte{}, nil, ccidSlotStatus)
+	if err != nil {
+		return false, err
+	}
+	return rsp[7]&0x03 != iccAbsent, nil
+}
+
+// PowerOn activates the card and returns its ATR.
+func (t *CCIDTransport) PowerOn() ([]byte, error) {
+	// bPowerSelect 0 lets the reader choose the voltage
+	_, data, err := t.exchange(ccidPowerOn, [3]byte{}, nil, ccidDataBlock)
+	if err != nil {
+		return nil, err
+	}
+	t.atr = data
+	return data, nil
+}
+
+// PowerOff deactivates the card.
+func (t *CCIDTransport) PowerOff() error {
+	t.atr = nil
+	_, _, err := t.exchange(ccidPowerOff, [3]byte{}, nil, ccidSlotStatus)
+	return err
+}
+
+// Transmit sends an APDU to the card with PC_to_RDR_XfrBlock.
+func (t *CCIDTransport) Transmit(cmd []byte) ([]byte, error) {
+	_, data, err := t.exchange(ccidXfrBlock, [3]byte{}, cmd, ccidDataBlock)
+	return data, err
+}
+
+// exchange sends a CCID message and returns the response header and data.
+// Time extension requests from the reader are waited out.
+func (t *CCIDTransport) exchange(msgType byte, params [3]byte, data []byte, want byte) ([]byte, []byte, error) {
+	t.seq++
+	msg := make([]byte, ccidHeaderLen+len(data))
+	msg[0] = msgType
+	binary.LittleEndian.PutUint32(msg[1:5], uint32(len(data)))
+	msg[5] = 0 // bSlot
+	msg[6] = t.seq
+	copy(msg[7:10], params[:])
+	copy(msg[ccidHeaderLen:], data)
+
+	for naks := 0; ; {
+		if err := t.writeFrame(msg); err != nil {
+			return nil, nil, err
+		}
+
+		for {
+			header, body, err := t.readFrame()
+			if errors.Is(err, errSerialRejected) && naks < maxSerialNaks {
+				naks++
+				break
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			if header[0] != want || header[6] != t.seq {
+				return nil, nil, fmt.Errorf("%w: type %02X seq %d", errCCIDUnexpected, header[0], header[6])
+			}
+
+			status, slotError := header[7], header[8]
+			switch status >> 6 {
+			case 0:
+				return header, body, nil
+			case 2:
+				// Time extension: the card needs longer
+				continue
+			}
+			if status&0x03 == iccAbsent {
+				return nil, nil, errNoCard
+			}
+			return nil, nil, fmt.Errorf("CCID command %02X failed: bStatus=%02X bError=%02X", msgType, status, slotError)
+		}
+	}
+}
+
+func (t *CCIDTransport) writeFrame(msg []byte) error {
+	frame := make([]byte, 0, len(msg)+3)
+	frame = append(frame, serialSync, serialAck)
+	frame = append(frame, msg...)
+	frame = append(frame, lrc(frame))
+	_, err := t.port.Write(frame)
+	return err
+}
+
+// readFrame reads a framed CCID message, skipping slot change notifications.
+func (t *CCIDTransport) readFrame() ([]byte, []byte, error) {
+	for {
+		prefix := make([]byte, 3)
+		if err := t.read(prefix); err != nil {
+			return nil, nil, err
+		}
+		if prefix[0] != serialSync {
+			return nil, nil, fmt.Errorf("%w: frame starts with %02X", errCCIDUnexpected, prefix[0])
+		}
+		if prefix[1] == serialNak {
+			// SYNC NAK LRC: the reader wants the frame again
+			return nil, nil, errSerialRejected
+		}
+
+		if prefix[2] == ccidNotifySlot {
+			// RDR_to_PC_NotifySlotChange: bmSlotICCState, then the LRC
+			rest := make([]byte, 2)
+			if err := t.read(rest); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		header := make([]byte, ccidHeaderLen)
+		header[0] = prefix[2]
+		if err := t.read(header[1:]); err != nil {
+			return nil, nil, err
+		}
+		length := binary.LittleEndian.Uint32(header[1:5])
+		if length > ccidMaxData {
+			return nil, nil, fmt.Errorf("%w: length %d", errCCIDUnexpected, length)
+		}
+		body := make([]byte, length+1)
+		if err := t.read(body); err != nil {
+			return nil, nil, err
+		}
+
+		sum := lrc(prefix[:2]) ^ lrc(header) ^ lrc(body)
+		if sum != 0 {
+			return nil, nil, errSerialChecksum
+		}
+		return header, body[:length], nil
+	}
+}
+
+func (t *CCIDTransport) read(buf []byte) error {
+	_, err := io.ReadFull(t.port, buf)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return errReaderNoRespond
+	}
+	return err
+}
+
+// lrc is the XOR of all bytes.
+func lrc(data []byte) byte {
+	var sum byte
+	for _, b := range data {
+		sum ^= b
+	}
+	return sum
+}
@@ -0,0 +1,79 @@
+package smartcard
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+	"github.com/ebfe/scard"
+)
+
+var stateNames = []struct {
+	flag scard.StateFlag
+	name string
+}{
+	{scard.StateUnavailable, "unavailable"},
+	{scard.StateEmpty, "empty"},
+	{scard.StatePresent, "present"},
+	{scard.StateExclusive, "exclusive"},
+	{scard.StateInuse, "inuse"},
+	{scard.StateMute, "mute"},
+	{scard.StateUnpowered, "unpowered"},
+}
+
+// ListReaders returns the names of the readers PC/SC lists. It needs no
+// PCSCReader, so it also works when the reader failed to initialize.
+func ListReaders() ([]string, error) {
+	ctx, err := scard.EstablishContext()
+	if err != nil {
+		return nil, err
+	}
+	defer ctx.Release()
+	return ctx.ListReaders()
+}
+
+// PCSCInfo reports the PC/SC stack and each reader's state, ATR and driver
+// details. It uses a context of its own and doesn't connect to the cards, so
+// it works while the monitor holds a card or its context is broken.
+func (r *PCSCReader) PCSCInfo() domain.PCSCInfo {
+	info := domain.PCSCInfo{Stack: pcscStack(), Readers: []domain.ReaderStatus{}}
+
+	ctx, err := scard.EstablishContext()
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+	defer ctx.Release()
+
+	readers, err := ctx.ListReaders()
+	if err != nil {
+		if !errors.Is(err, scard.ErrNoReadersAvailable) {
+			info.Error = err.Error()
+		}
+		return info
+	}
+
+	states := make([]scard.ReaderState, len(readers))
+	for i, reader := range readers {
+		states[i] = scard.ReaderState{Reader: reader, CurrentState: scard.StateUnaware}
+	}
+	if err := ctx.GetStatusChange(states, 0); err != nil && !errors.Is(err, scard.ErrTimeout) {
+		info.Error = err.Error()
+	}
+
+	for _, state := range states {
+		status := domain.ReaderStatus{Name: state.Reader, State: []string{}}
+		for _, s := range stateNames {
+			if state.EventState&s.flag != 0 {
+				status.State = append(status.State, s.name)
+			}
+		}
+		if len(state.Atr) > 0 {
+			status.ATR = strings.ToUpper(hex.EncodeToString(state.Atr))
+		}
+		status.Driver = r.readerDriver(ctx, state.Reader)
+		info.Readers = append(info.Readers, status)
+	}
+	return info
+}
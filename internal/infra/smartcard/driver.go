@@ -0,0 +1,136 @@
+package smartcard
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+	"github.com/ebfe/scard"
+)
+
+// PC/SC v2 Part 10 feature names, for the features a reader advertises.
+var featureNames = map[byte]string{
+	0x01: "verifyPinStart",
+	0x02: "verifyPinFinish",
+	0x03: "modifyPinStart",
+	0x04: "modifyPinFinish",
+	0x05: "getKeyPressed",
+	0x06: "verifyPinDirect",
+	0x07: "modifyPinDirect",
+	0x08: "mctReaderDirect",
+	0x09: "mctUniversal",
+	0x0A: "ifdPinProperties",
+	0x0B: "abort",
+	0x0C: "setSpeMessage",
+	0x0D: "verifyPinDirectAppId",
+	0x0E: "modifyPinDirectAppId",
+	0x0F: "writeDisplay",
+	0x10: "getKey",
+	0x11: "ifdDisplayProperties",
+	0x12: "getTlvProperties",
+	0x13: "ccidEscCommand",
+	0x20: "executePace",
+}
+
+// GET_TLV_PROPERTIES tags
+const (
+	propertyFirmwareID byte = 0x08
+	propertyIDVendor   byte = 0x0B
+	propertyIDProduct  byte = 0x0C
+)
+
+// acsFirmwareCommand is the ACS escape command returning the firmware
+// version string, for ACS readers whose driver doesn't report sFirmwareID.
+var acsFirmwareCommand = []byte{0xE0, 0x00, 0x00, 0x18, 0x00}
+
+// driverLockWait is how long driver queries wait for a card read to finish.
+const driverLockWait = 2 * time.Second
+
+// readerDriver asks the driver of reader about the device through a direct
+// connection, which works with or without a card. It waits briefly for an
+// ongoing read rather than interfere with it.
+func (r *PCSCReader) readerDriver(ctx *scard.Context, reader string) *domain.ReaderDriver {
+	driver := &domain.ReaderDriver{}
+
+	deadline := time.Now().Add(driverLockWait)
+	for !r.cardMu.TryLock() {
+		if time.Now().After(deadline) {
+			driver.Error = "reader is busy reading a card"
+			return driver
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	defer r.cardMu.Unlock()
+
+	card, err := ctx.Connect(reader, scard.ShareDirect, scard.ProtocolUndefined)
+	if err != nil {
+		driver.Error = err.Error()
+		return driver
+	}
+	defer card.Disconnect(scard.LeaveCard)
+
+	driver.Vendor = attribString(card, scard.AttrVendorName)
+	driver.Model = attribString(card, scard.AttrVendorIfdType)
+	driver.Serial = attribString(card, scard.AttrVendorIfdSerialNo)
+	if version, err := card.GetAttrib(scard.AttrVendorIfdVersion); err == nil && len(version) >= 4 {
+		// 0xMMmmbbbb; major and minor are BCD coded by CCID drivers
+		v := binary.LittleEndian.Uint32(version)
+		driver.IFDVersion = fmt.Sprintf("%X.%X.%d", v>>24, v>>16&0xFF, v&0xFFFF)
+	}
+
+	if features, err := readerFeatures(card); err == nil {
+		for tag := range features {
+			if name, ok := featureNames[tag]; ok {
+				driver.Features = append(driver.Features, name)
+			}
+		}
+		sort.Strings(driver.Features)
+
+		if code, ok := features[featureGetTLVProperties]; ok {
+			if rsp, err := card.Control(code, nil); err == nil {
+				parseTLVProperties(rsp, driver)
+			}
+		}
+	}
+
+	if driver.Firmware == "" && supportsFeedback(reader) {
+		if rsp, err := card.Control(acsEscapeCode, acsFirmwareCommand); err == nil && len(rsp) > 5 && rsp[0] == 0xE1 {
+			driver.Firmware = string(bytes.Trim(rsp[5:], " \x00"))
+		}
+	}
+
+	return driver
+}
+
+// parseTLVProperties fills in the USB IDs and firmware ID from a
+// GET_TLV_PROPERTIES response: tag, length and little-endian value.
+func parseTLVProperties(rsp []byte, driver *domain.ReaderDriver) {
+	for i := 0; i+2 <= len(rsp); {
+		tag, length := rsp[i], int(rsp[i+1])
+		if i+2+length > len(rsp) {
+			return
+		}
+		value := rsp[i+2 : i+2+length]
+		i += 2 + length
+
+		switch {
+		case tag == propertyFirmwareID:
+			driver.Firmware = string(bytes.Trim(value, " \x00"))
+		case tag == propertyIDVendor && length == 2:
+			driver.VendorID = fmt.Sprintf("%04X", binary.LittleEndian.Uint16(value))
+		case tag == propertyIDProduct && length == 2:
+			driver.ProductID = fmt.Sprintf("%04X", binary.LittleEndian.Uint16(value))
+		}
+	}
+}
+
+func attribString(card *scard.Card, id scard.Attrib) string {
+	value, err := card.GetAttrib(id)
+	if err != nil {
+		return ""
+	}
+	return string(bytes.Trim(value, " \x00"))
+}
@@ -0,0 +1,54 @@
+package smartcard
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ebfe/scard"
+)
+
+// ACS readers (ACR1252/ACR1281 family) accept LED and buzzer commands through
+// the CCID escape control code.
+var acsEscapeCode = scard.CtlCode(3500)
+
+const (
+	acsLEDRed   byte = 0x01
+	acsLEDGreen byte = 0x02
+
+	// Buzzer duration is in 10ms units
+	acsBeepDuration byte = 0x0A
+	acsFlashTime         = 300 * time.Millisecond
+)
+
+func supportsFeedback(reader string) bool {
+	name := strings.ToUpper(reader)
+	return strings.Contains(name, "ACS") || strings.Contains(name, "ACR")
+}
+
+// signalReadResult flashes the reader LED green after a successful read, or
+// red with a beep after a failure, on readers that support it.
+func (r *PCSCReader) signalReadResult(reader string, card *scard.Card, success bool) {
+	if !r.feedback || !supportsFeedback(reader) {
+		return
+	}
+
+	led := acsLEDGreen
+	if !success {
+		led = acsLEDRed
+		r.sendEscape(card, []byte{0xE0, 0x00, 0x00, 0x28, 0x01, acsBeepDuration})
+	}
+
+	if r.sendEscape(card, []byte{0xE0, 0x00, 0x00, 0x29, 0x01, led}) {
+		time.Sleep(acsFlashTime)
+		r.sendEscape(card, []byte{0xE0, 0x00, 0x00, 0x29, 0x01, 0x00})
+	}
+}
+
+func (r *PCSCReader) sendEscape(card *scard.Card, cmd []byte) bool {
+	if _, err := card.Control(acsEscapeCode, cmd); err != nil {
+		log.Printf("Reader feedback command failed: %v", err)
+		return false
+	}
+	return true
+}
@@ -1,35 +1,157 @@
 package smartcard
 
 import (
-	"bytes"
+	"context"
 	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/cortex-x/go-thai-id-card-reader/internal/config"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/crash"
 	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/logging"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/thaiid"
 	"github.com/ebfe/scard"
-	"golang.org/x/text/encoding/charmap"
 )
 
+const (
+	lockRetryInterval = 250 * time.Millisecond
+	minBusyBackoff    = 1 * time.Second
+	maxBusyBackoff    = 30 * time.Second
+	// monitorStopTimeout bounds how long StopMonitoring waits for a read
+	// in progress to finish
+	monitorStopTimeout = 5 * time.Second
+)
+
+// busyState tracks a reader whose card is held by another application.
+type busyState struct {
+	conflict *domain.ReaderConflictEvent
+	since    time.Time
+	reported bool
+	retryAt  time.Time
+	backoff  time.Duration
+}
+
 type PCSCReader struct {
 	context           *scard.Context
-	cardInsertHandler func(card *domain.ThaiIdCard, err error)
-	cardRemoveHandler func()
-	stopChan          chan bool
+	cardInsertHandler func(reader string, card *domain.ThaiIdCard, err error)
+	cardIdentHandler  func(reader string, card *domain.ThaiIdCard)
+	cardRemoveHandler func(reader string)
+	failoverHandler   func(from, to string)
+	cardBusyHandler   func(reader string)
+	cardChangeHandler func(reader string)
+	conflictHandler   func(conflict domain.ReaderConflictEvent)
+	degradedHandler   func(reader string, failures int)
+	recoveredHandler  func(reader string)
+	idleCheck         func() bool
+	idle              bool
+	monitorStop       chan struct{}
+	monitorDone       chan struct{}
 	monitoring        bool
+	disposition       scard.Disposition
+	keepConnected     bool
+	feedback          bool
+	held              map[string]*scard.Card
+	busy              map[string]*busyState
+	breaker           config.CircuitBreakerConfig
+	breakers          map[string]*breakerState
+	lockTimeout       time.Duration
+	startService      bool
+	serviceReported   bool
+	preferredReader   string
+	activeReader      string
+	// lastCID is the holder ID (citizen ID or its digest) of the card last
+	// read in each reader, used to spot a swap that polling didn't see as a
+	// removal
+	lastCID map[string]string
+	// cards reads the Thai ID applet over a connected card
+	cards *thaiid.Reader
+	// waitForChanges blocks in GetStatusChange between polls; readerStates
+	// holds the last state seen for each reader. It can be switched while
+	// monitoring
+	waitForChanges atomic.Bool
+	readerStates   map[string]scard.StateFlag
+	pnpSupported   bool
+	// serial are the readers on serial ports, polled apart from PC/SC;
+	// serialStop ends their polling
+	serial     []*serialReader
+	serialStop chan struct{}
+	// The watchdog reports a monitor whose beat is older than stallTimeout
+	// as stalled; beat and stall are guarded by beatMu
+	stallTimeout     time.Duration
+	resetOnStall     bool
+	stalledHandler   func(stall domain.MonitorStall, resetContext bool)
+	unstalledHandler func(stall domain.MonitorStall)
+	watchdogStop     chan struct{}
+	beatMu           sync.Mutex
+	beat             monitorBeat
+	stall            *domain.MonitorStall
+
+	// cardMu serializes card access between the monitor and on-demand reads
+	cardMu sync.Mutex
 }
 
-func NewPCSCReader() (*PCSCReader, error) {
+func NewPCSCReader(cfg *config.Config) (*PCSCReader, error) {
 	ctx, err := scard.EstablishContext()
 	if err != nil {
-		return nil, fmt.Errorf("failed to establish context: %w", err)
+		// The smart card service may be stopped or disabled
+		if svcErr := checkSmartCardService(cfg.Card.StartService); svcErr != nil {
+			return nil, svcErr
+		}
+		if ctx, err = scard.EstablishContext(); err != nil {
+			return nil, fmt.Errorf("failed to establish context: %w", err)
+		}
+	}
+
+	disposition, keepConnected := parseDisposition(cfg.Card.Disposition)
+
+	r := &PCSCReader{
+		context:       ctx,
+		disposition:   disposition,
+		keepConnected: keepConnected,
+		feedback:      cfg.Card.Feedback,
+		held:          make(map[string]*scard.Card),
+		busy:          make(map[string]*busyState),
+		breaker:       cfg.Card.CircuitBreaker,
+		breakers:      make(map[string]*breakerState),
+		lastCID:       make(map[string]string),
+		lockTimeout:   cfg.Card.LockTimeout,
+		startService:  cfg.Card.StartService,
+		// An alias is accepted as well as the PC/SC reader name
+		preferredReader: cfg.Readers.Resolve(cfg.Readers.Preferred),
+		cards:           thaiid.NewReader(thaiid.OptionsFromConfig(cfg)),
+		readerStates:    make(map[string]scard.StateFlag),
+		pnpSupported:    true,
+		serial:          newSerialReaders(cfg.Readers.Serial),
+		stallTimeout:    cfg.Card.Watchdog.StallTimeout,
+		resetOnStall:    cfg.Card.Watchdog.ResetContext,
 	}
+	r.waitForChanges.Store(cfg.Card.WaitForChanges || cfg.Feature(config.FeatureEventMonitoring))
+	return r, nil
+}
 
-	return &PCSCReader{
-		context:  ctx,
-		stopChan: make(chan bool),
-	}, nil
+// parseDisposition maps the configured card disposition to the PC/SC value
+// used when disconnecting. "keep" leaves the card connected until removal.
+func parseDisposition(value string) (scard.Disposition, bool) {
+	switch value {
+	case "", "leave":
+		return scard.LeaveCard, false
+	case "reset":
+		return scard.ResetCard, false
+	case "unpower":
+		return scard.UnpowerCard, false
+	case "keep":
+		return scard.LeaveCard, true
+	default:
+		log.Printf("Unknown card disposition %q, using leave", value)
+		return scard.LeaveCard, false
+	}
 }
 
 func (r *PCSCReader) StartMonitoring() error {
@@ -38,334 +160,632 @@ func (r *PCSCReader) StartMonitoring() error {
 	}
 
 	r.monitoring = true
-	go r.monitorLoop()
+	r.heartbeat(stageListing, "")
+	r.monitorStop = make(chan struct{})
+	r.monitorDone = make(chan struct{})
+	go r.monitorLoop(r.monitorStop, r.monitorDone)
+	if r.stallTimeout > 0 {
+		r.watchdogStop = make(chan struct{})
+		go r.watchdog(r.watchdogStop)
+	}
+	if len(r.serial) > 0 {
+		r.serialStop = make(chan struct{})
+		go r.monitorSerial(r.serialStop)
+	}
 
 	return nil
 }
 
 func (r *PCSCReader) StopMonitoring() {
 	if r.monitoring {
-		r.stopChan <- true
+		if r.waitForChanges.Load() {
+			// Wake the monitor from GetStatusChange
+			_ = r.context.Cancel()
+		}
+		// Closing never blocks, even when the monitor has already returned
+		close(r.monitorStop)
+		select {
+		case <-r.monitorDone:
+		case <-time.After(monitorStopTimeout):
+			log.Printf("Card monitor didn't stop within %v", monitorStopTimeout)
+		}
+		if r.watchdogStop != nil {
+			close(r.watchdogStop)
+			r.watchdogStop = nil
+		}
+		if r.serialStop != nil {
+			close(r.serialStop)
+			r.serialStop = nil
+		}
 		r.monitoring = false
 	}
 }
 
-func (r *PCSCReader) OnCardInserted(handler func(card *domain.ThaiIdCard, err error)) {
+// LastReadTelemetry returns the timings of the most recent card read.
+func (r *PCSCReader) LastReadTelemetry() thaiid.Telemetry {
+	return r.cards.LastTelemetry()
+}
+
+func (r *PCSCReader) OnCardInserted(handler func(reader string, card *domain.ThaiIdCard, err error)) {
 	r.cardInsertHandler = handler
 }
 
-func (r *PCSCReader) OnCardRemoved(handler func()) {
+func (r *PCSCReader) OnCardIdentified(handler func(reader string, card *domain.ThaiIdCard)) {
+	r.cardIdentHandler = handler
+}
+
+func (r *PCSCReader) OnCardRemoved(handler func(reader string)) {
 	r.cardRemoveHandler = handler
 }
 
-func (r *PCSCReader) monitorLoop() {
+func (r *PCSCReader) OnCardBusy(handler func(reader string)) {
+	r.cardBusyHandler = handler
+}
+
+func (r *PCSCReader) OnCardChanged(handler func(reader string)) {
+	r.cardChangeHandler = handler
+}
+
+func (r *PCSCReader) OnReaderConflict(handler func(conflict domain.ReaderConflictEvent)) {
+	r.conflictHandler = handler
+}
+
+func (r *PCSCReader) OnReaderFailover(handler func(from, to string)) {
+	r.failoverHandler = handler
+}
+
+// SetIdleCheck pauses polling whenever check reports that nobody is listening,
+// so card data isn't read when there's no one to deliver it to.
+func (r *PCSCReader) SetIdleCheck(check func() bool) {
+	r.idleCheck = check
+}
+
+// monitorLoop watches the readers until stop is closed, and closes done when
+// it returns.
+func (r *PCSCReader) monitorLoop(stop <-chan struct{}, done chan<- struct{}) {
+	defer crash.Recover()
+	defer close(done)
 	lastState := make(map[string]bool)
+	// lastStatus is each reader's status when its card was last connected
+	// to, telling whether it may have been swapped since
+	lastStatus := make(map[string]readerStatus)
 
 	for {
 		select {
-		case <-r.stopChan:
+		case <-stop:
+			r.releaseHeld()
 			return
 		default:
+			if r.idleCheck != nil && r.idleCheck() {
+				r.heartbeat(stageIdle, "")
+				if !r.idle {
+					log.Println("No active clients, pausing card polling")
+					r.idle = true
+
+					// Forget card state so a card already inserted is read on resume
+					r.cardMu.Lock()
+					r.releaseHeld()
+					clear(lastState)
+					clear(lastStatus)
+					clear(r.lastCID)
+					r.cardMu.Unlock()
+				}
+				time.Sleep(500 * time.Millisecond)
+				continue
+			}
+			if r.idle {
+				log.Println("Client connected, resuming card polling")
+				r.idle = false
+			}
+
+			r.heartbeat(stageListing, "")
 			readers, err := r.context.ListReaders()
 			if err != nil {
 				log.Printf("Error listing readers: %v", err)
+				if errors.Is(err, scard.ErrNoService) || errors.Is(err, scard.ErrServiceStopped) {
+					r.recoverContext()
+				}
 				time.Sleep(2 * time.Second)
 				continue
 			}
+			r.serviceReported = false
 
 			if len(readers) == 0 {
 				if r.cardInsertHandler != nil {
-					r.cardInsertHandler(nil, fmt.Errorf("%s", domain.ErrMsgReaderNotFound))
+					r.cardInsertHandler("", nil, fmt.Errorf("%s", domain.ErrMsgReaderNotFound))
 				}
 				time.Sleep(2 * time.Second)
 				continue
 			}
 
+			if r.preferredReader != "" {
+				readers = []string{r.selectActiveReader(readers)}
+			}
+
+			// Readers that went away take their cards with them
+			for reader, present := range lastState {
+				if present && !slices.Contains(readers, reader) {
+					lastState[reader] = false
+					delete(lastStatus, reader)
+					delete(r.lastCID, reader)
+					if r.cardRemoveHandler != nil {
+						r.cardRemoveHandler(reader)
+					}
+				}
+			}
+
+			// A failed query leaves the statuses unknown, and cards are
+			// connected to as they would be without it
+			statuses, err := r.statuses(readers)
+			if err != nil {
+				logging.Debugf("Failed to get reader statuses: %v", err)
+			}
+
+			r.heartbeat(stageLocking, "")
+			r.cardMu.Lock()
 			for _, reader := range readers {
+				r.heartbeat(stageReading, reader)
+				if held, ok := r.held[reader]; ok {
+					// Keep-connected mode: the card stays connected until it's removed
+					if _, err := held.Status(); err == nil {
+						continue
+					}
+					_ = held.Disconnect(scard.LeaveCard)
+					delete(r.held, reader)
+				}
+
+				// Back off while another application holds the card
+				if state, ok := r.busy[reader]; ok && time.Now().Before(state.retryAt) {
+					continue
+				}
+
+				// Leave a degraded reader alone between probes
+				open, probe := r.circuitOpen(reader)
+				if open && !probe {
+					continue
+				}
+
+				status, known := statuses[reader]
+				if known && !status.present {
+					if lastState[reader] {
+						lastState[reader] = false
+						delete(lastStatus, reader)
+						delete(r.lastCID, reader)
+						if r.cardRemoveHandler != nil {
+							r.cardRemoveHandler(reader)
+						}
+					}
+					continue
+				}
+				// Don't touch a card that was read and hasn't changed since,
+				// which other applications may be using
+				if known && lastState[reader] && !probe && status == lastStatus[reader] {
+					continue
+				}
+
 				// Use exclusive mode for more stable connection
 				card, err := r.context.Connect(reader, scard.ShareExclusive, scard.ProtocolT0|scard.ProtocolT1)
 
+				if errors.Is(err, scard.ErrSharingViolation) {
+					r.backOffBusyReader(reader, lastState[reader])
+					continue
+				}
+				delete(r.busy, reader)
+
 				if err == nil {
-					if !lastState[reader] {
+					if !known {
+						// Without the reader's status, the card's own ATR
+						// tells a different card model apart
+						status = readerStatus{present: true, atr: cardATR(card)}
+					}
+					previous := lastStatus[reader]
+					lastStatus[reader] = status
+					read := false
+					if !lastState[reader] || probe {
 						lastState[reader] = true
-
-						if r.cardInsertHandler != nil {
-							// Add retry logic for card reading
-							var cardData *domain.ThaiIdCard
-							var readErr error
-
-							for retry := 0; retry < 3; retry++ {
-								cardData, readErr = r.readCard(card)
-								if readErr == nil {
-									break
-								}
-
-								// If applet not found, try to reconnect
-								if retry < 2 && readErr != nil &&
-									(readErr.Error() == "applet not found" ||
-										readErr.Error() == "select applet failed: SW=6A82") {
-									_ = card.Disconnect(scard.ResetCard)
-									time.Sleep(200 * time.Millisecond)
-									card, err = r.context.Connect(reader, scard.ShareExclusive, scard.ProtocolT0|scard.ProtocolT1)
-									if err != nil {
-										break
-									}
-								}
-
-								// Wait a bit before retry
-								time.Sleep(100 * time.Millisecond)
-							}
-
-							r.cardInsertHandler(cardData, readErr)
+						card = r.handleInsertion(reader, card)
+						read = true
+					} else if (!known && status.atr != previous.atr) || r.cardSwapped(reader, card) {
+						// Report the swap as a removal and insertion pair
+						log.Printf("Card in %s was swapped without a removal being seen", reader)
+						if r.cardChangeHandler != nil {
+							r.cardChangeHandler(reader)
+						}
+						if r.cardRemoveHandler != nil {
+							r.cardRemoveHandler(reader)
+						}
+						card = r.handleInsertion(reader, card)
+						read = true
+					}
+					if card != nil {
+						if read {
+							r.releaseCard(reader, card)
+						} else {
+							// Only a read leaves the card as card.disposition says
+							_ = card.Disconnect(scard.LeaveCard)
 						}
 					}
-					_ = card.Disconnect(scard.LeaveCard)
 				} else {
+					if probe {
+						r.deferProbe(reader)
+					}
 					if lastState[reader] {
 						lastState[reader] = false
+						delete(lastStatus, reader)
+						delete(r.lastCID, reader)
 
 						if r.cardRemoveHandler != nil {
-							r.cardRemoveHandler()
+							r.cardRemoveHandler(reader)
 						}
 					}
 				}
 			}
+			r.cardMu.Unlock()
 
-			time.Sleep(500 * time.Millisecond)
+			r.heartbeat(stageWaiting, "")
+			r.pause(readers)
 		}
 	}
 }
 
-func (r *PCSCReader) readCard(card *scard.Card) (*domain.ThaiIdCard, error) {
-	// Add small delay before applet selection
-	time.Sleep(50 * time.Millisecond)
+// ReadCard reads the card in the given reader on demand. An empty reader
+// reads the first reader that has a card.
+func (r *PCSCReader) ReadCard(ctx context.Context, reader string) (*domain.ThaiIdCard, error) {
+	r.cardMu.Lock()
+	defer r.cardMu.Unlock()
+	logRequest(ctx)
 
-	if err := r.selectApplet(card); err != nil {
-		return nil, fmt.Errorf("%s: %w", domain.ErrMsgUnsupportedCard, err)
+	if s := r.serialReader(reader); s != nil {
+		return r.readSerial(ctx, s, nil)
 	}
 
-	thaiCard := &domain.ThaiIdCard{}
+	readers, err := r.context.ListReaders()
+	if (err != nil || len(readers) == 0) && (reader != "" || len(r.serial) == 0) {
+		return nil, fmt.Errorf("%s", domain.ErrMsgReaderNotFound)
+	}
 
-	// Read CID
-	data, err := r.readBinary(card, 0x00, 0x04, 0x0D)
-	if err == nil {
-		thaiCard.CitizenID = string(bytes.Trim(data, "\x00"))
-	} else {
-		log.Printf("Failed to read CID: %v", err)
-	}
-
-	// Read Thai Fullname
-	data, err = r.readBinary(card, 0x00, 0x11, 0x64)
-	if err == nil {
-		names := r.decodeThaiString(data)
-		// Thai names are space-separated
-		parts := bytes.Split([]byte(names), []byte("#"))
-		if len(parts) >= 4 {
-			thaiCard.PrefixNameTH = string(bytes.Trim(parts[0], " \x00"))
-			thaiCard.FirstNameTH = string(bytes.Trim(parts[1], " \x00"))
-			thaiCard.MiddleNameTH = string(bytes.Trim(parts[2], " \x00"))
-			thaiCard.LastNameTH = string(bytes.Trim(parts[3], " \x00"))
+	if reader != "" {
+		if !slices.Contains(readers, reader) {
+			return nil, fmt.Errorf("%s", domain.ErrMsgReaderNotFound)
 		}
+		readers = []string{reader}
 	}
 
-	// Read English Fullname
-	data, err = r.readBinary(card, 0x00, 0x75, 0x64)
-	if err == nil {
-		names := string(bytes.Trim(data, "\x00"))
-		// English names are space-separated
-		parts := bytes.Split([]byte(names), []byte("#"))
-		if len(parts) >= 4 {
-			thaiCard.PrefixNameEN = string(bytes.Trim(parts[0], " \x00"))
-			thaiCard.FirstNameEN = string(bytes.Trim(parts[1], " \x00"))
-			thaiCard.MiddleNameEN = string(bytes.Trim(parts[2], " \x00"))
-			thaiCard.LastNameEN = string(bytes.Trim(parts[3], " \x00"))
+	inUse := false
+	for _, name := range readers {
+		// Reuse the connection in keep-connected mode
+		if card, ok := r.held[name]; ok {
+			data, readErr := r.cards.Read(ctx, name, pcscCard{card}, nil)
+			r.recordRead(name, readErr)
+			return data, readErr
 		}
-	}
 
-	// Read Date of Birth
-	data, err = r.readBinary(card, 0x00, 0xD9, 0x08)
-	if err == nil {
-		thaiCard.DateOfBirth = r.formatDate(string(data))
+		card, err := r.connectWaiting(name)
+		if err != nil {
+			if errors.Is(err, scard.ErrSharingViolation) {
+				inUse = true
+			}
+			continue
+		}
+
+		data, readErr := r.cards.Read(ctx, name, pcscCard{card}, nil)
+		_ = card.Disconnect(r.disposition)
+		r.recordRead(name, readErr)
+		return data, readErr
 	}
 
-	// Read Gender
-	data, err = r.readBinary(card, 0x00, 0xE1, 0x01)
-	if err == nil && len(data) >= 1 {
-		switch data[0] {
-		case '1':
-			thaiCard.Gender = "male"
-		case '2':
-			thaiCard.Gender = "female"
+	// Serial readers come after the PC/SC readers
+	if reader == "" {
+		for _, s := range r.serial {
+			if err := r.powerOnSerial(s); err != nil {
+				continue
+			}
+			data, readErr := r.cards.Read(ctx, s.config.Name, s.ccid, nil)
+			_ = s.ccid.PowerOff()
+			return data, readErr
 		}
 	}
 
-	// Read Issue Date
-	data, err = r.readBinary(card, 0x01, 0x67, 0x08)
-	if err == nil {
-		thaiCard.IssueDate = r.formatDate(string(data))
+	if inUse {
+		if conflict := detectReaderConflict(reader); conflict != nil {
+			return nil, fmt.Errorf("%s", domain.ErrMsgReaderConflict)
+		}
+		return nil, fmt.Errorf("%s", domain.ErrMsgCardInUse)
 	}
+	return nil, fmt.Errorf("%s", domain.ErrMsgCardNotDetected)
+}
 
-	// Read Expire Date
-	data, err = r.readBinary(card, 0x01, 0x6F, 0x08)
-	if err == nil {
-		thaiCard.ExpireDate = r.formatDate(string(data))
+// ReadPhoto reads only the photo of the card in reader, for cards whose
+// photo was deferred. The citizen ID is returned so the caller can check the
+// card is still the one it expects.
+func (r *PCSCReader) ReadPhoto(ctx context.Context, reader string) (string, string, error) {
+	r.cardMu.Lock()
+	defer r.cardMu.Unlock()
+	logRequest(ctx)
+
+	var card thaiid.Transport
+	if s := r.serialReader(reader); s != nil {
+		if err := r.powerOnSerial(s); err != nil {
+			return "", "", err
+		}
+		defer s.ccid.PowerOff()
+		card = s.ccid
+	} else if held, ok := r.held[reader]; ok {
+		card = pcscCard{held}
+	} else {
+		connected, err := r.connectWaiting(reader)
+		if errors.Is(err, scard.ErrSharingViolation) {
+			return "", "", fmt.Errorf("%s", domain.ErrMsgCardInUse)
+		} else if err != nil {
+			return "", "", fmt.Errorf("%s", domain.ErrMsgCardNotDetected)
+		}
+		defer connected.Disconnect(r.disposition)
+		card = pcscCard{connected}
 	}
 
-	// Read Address
-	data, err = r.readBinary(card, 0x15, 0x79, 0x64)
-	if err == nil {
-		addressStr := r.decodeThaiString(data)
-		thaiCard.Address = domain.ParseThaiAddress(addressStr)
+	if err := thaiid.SelectApplet(ctx, card); err != nil {
+		return "", "", thaiid.Unsupported(card, err)
+	}
+	cid, err := thaiid.ReadCitizenID(ctx, card)
+	if err != nil {
+		return "", "", fmt.Errorf("reading citizen ID: %w", err)
 	}
 
-	// Read Photo
-	photoData, err := r.readPhoto(card)
-	if err == nil && len(photoData) > 0 {
-		thaiCard.PhotoBase64 = base64.StdEncoding.EncodeToString(photoData)
+	photo, err := thaiid.ReadPhoto(ctx, card)
+	if err != nil {
+		return "", "", fmt.Errorf("reading photo: %w", err)
 	}
 
-	return thaiCard, nil
+	return cid, base64.StdEncoding.EncodeToString(photo), nil
 }
 
-func (r *PCSCReader) selectApplet(card *scard.Card) error {
-	cmd := []byte{0x00, 0xa4, 0x04, 0x00, 0x08, 0xa0, 0x00, 0x00, 0x00, 0x54, 0x48, 0x00, 0x01}
-
-	rsp, err := card.Transmit(cmd)
-	if err != nil {
-		return err
+// recoverContext handles the smart card service going away: it reports a
+// stopped or disabled service once, and re-establishes the PC/SC context so
+// monitoring resumes when the service comes back.
+func (r *PCSCReader) recoverContext() {
+	if err := checkSmartCardService(r.startService); err != nil {
+		if !r.serviceReported && r.cardInsertHandler != nil {
+			r.serviceReported = true
+			r.cardInsertHandler("", nil, err)
+		}
+		return
 	}
 
-	if len(rsp) < 2 {
-		return fmt.Errorf("invalid response")
+	ctx, err := scard.EstablishContext()
+	if err != nil {
+		log.Printf("Failed to re-establish context: %v", err)
+		return
 	}
 
-	sw1, sw2 := rsp[len(rsp)-2], rsp[len(rsp)-1]
+	r.cardMu.Lock()
+	_ = r.context.Release()
+	r.context = ctx
+	clear(r.held)
+	r.cardMu.Unlock()
+	log.Println("PC/SC context re-established")
+}
 
-	// Handle GET RESPONSE if needed
-	if sw1 == 0x61 {
-		// sw2 contains the length of data available
-		getResponseCmd := []byte{0x00, 0xC0, 0x00, 0x00, sw2}
-		rsp, err = card.Transmit(getResponseCmd)
-		if err != nil {
-			return fmt.Errorf("GET RESPONSE failed: %w", err)
+// connectWaiting connects exclusively, retrying sharing violations until the
+// lock timeout expires.
+func (r *PCSCReader) connectWaiting(reader string) (*scard.Card, error) {
+	deadline := time.Now().Add(r.lockTimeout)
+	for {
+		card, err := r.context.Connect(reader, scard.ShareExclusive, scard.ProtocolT0|scard.ProtocolT1)
+		if !errors.Is(err, scard.ErrSharingViolation) || time.Now().After(deadline) {
+			return card, err
 		}
+		time.Sleep(lockRetryInterval)
+	}
+}
 
-		if len(rsp) < 2 {
-			return fmt.Errorf("invalid GET RESPONSE")
+// backOffBusyReader records a sharing violation on reader. While within the
+// lock timeout it keeps retrying at the polling rate; after that the error is
+// reported once and retries back off exponentially. Events are only sent for
+// cards we haven't read yet.
+func (r *PCSCReader) backOffBusyReader(reader string, alreadyRead bool) {
+	state, ok := r.busy[reader]
+	if !ok {
+		state = &busyState{since: time.Now(), conflict: detectReaderConflict(reader)}
+		r.busy[reader] = state
+
+		if state.conflict != nil {
+			log.Printf("Reader %s is held by %s", reader, state.conflict.Holder)
+			if r.conflictHandler != nil {
+				r.conflictHandler(*state.conflict)
+			}
+		} else {
+			log.Printf("Card in %s is in use by another application", reader)
+			if !alreadyRead && r.lockTimeout > 0 && r.cardBusyHandler != nil {
+				r.cardBusyHandler(reader)
+			}
 		}
-
-		sw1, sw2 = rsp[len(rsp)-2], rsp[len(rsp)-1]
 	}
 
-	// Accept multiple success status codes
-	if (sw1 == 0x90 && sw2 == 0x00) || (sw1 == 0x97 && sw2 == 0x10) {
-		return nil
+	if time.Since(state.since) < r.lockTimeout {
+		return
 	}
 
-	// 6A82 means file/application not found - might need to reset card
-	if sw1 == 0x6A && sw2 == 0x82 {
-		return fmt.Errorf("applet not found (SW=%02X%02X) - card may need reset", sw1, sw2)
+	if !state.reported {
+		state.reported = true
+		state.backoff = minBusyBackoff
+
+		msg := domain.ErrMsgCardInUse
+		if state.conflict != nil {
+			msg = domain.ErrMsgReaderConflict
+		}
+		if !alreadyRead && r.cardInsertHandler != nil {
+			r.cardInsertHandler(reader, nil, fmt.Errorf("%s", msg))
+		}
+	} else if state.backoff < maxBusyBackoff {
+		state.backoff *= 2
+		if state.backoff > maxBusyBackoff {
+			state.backoff = maxBusyBackoff
+		}
 	}
 
-	return fmt.Errorf("select applet failed: SW=%02X%02X", sw1, sw2)
+	state.retryAt = time.Now().Add(state.backoff)
 }
 
-func (r *PCSCReader) readBinary(card *scard.Card, p1, p2, le byte) ([]byte, error) {
-	// Send READ BINARY command for Thai ID card
-	cmd := []byte{0x80, 0xB0, p1, p2, 0x02, 0x00, le}
+// selectActiveReader picks the preferred reader when it's connected, and
+// otherwise stays on the current reader or fails over to the first available.
+func (r *PCSCReader) selectActiveReader(readers []string) string {
+	active := readers[0]
+	if slices.Contains(readers, r.preferredReader) {
+		active = r.preferredReader
+	} else if slices.Contains(readers, r.activeReader) {
+		active = r.activeReader
+	}
 
-	rsp, err := card.Transmit(cmd)
-	if err != nil {
-		return nil, err
+	if r.activeReader != "" && active != r.activeReader {
+		log.Printf("Reader failover: %s -> %s", r.activeReader, active)
+		if r.failoverHandler != nil {
+			r.failoverHandler(r.activeReader, active)
+		}
 	}
+	r.activeReader = active
 
-	if len(rsp) < 2 {
-		return nil, fmt.Errorf("invalid response")
+	return active
+}
+
+// handleInsertion reads a newly inserted card and reports the result. It
+// returns the card handle to release, which may differ from card if the read
+// needed a reconnect, or nil if the card is no longer connected.
+func (r *PCSCReader) handleInsertion(reader string, card *scard.Card) *scard.Card {
+	if r.cardInsertHandler == nil {
+		return card
 	}
 
-	sw1, sw2 := rsp[len(rsp)-2], rsp[len(rsp)-1]
+	ctx := logging.WithRequestID(context.Background(), logging.NewRequestID())
+	logRequest(ctx)
 
-	// Check if we need to GET RESPONSE
-	if sw1 == 0x61 {
-		// sw2 contains the length of data available
-		getResponseCmd := []byte{0x00, 0xC0, 0x00, 0x00, sw2}
-		rsp, err = card.Transmit(getResponseCmd)
-		if err != nil {
-			return nil, err
+	// Add retry logic for card reading
+	var cardData *domain.ThaiIdCard
+	var readErr error
+	identified := false
+
+	for retry := 0; retry < 3; retry++ {
+		cardData, readErr = r.cards.Read(ctx, reader, pcscCard{card}, func(c *domain.ThaiIdCard) {
+			// Only announce the identity once per insertion, even across retries
+			if !identified && r.cardIdentHandler != nil {
+				identified = true
+				r.cardIdentHandler(reader, c)
+			}
+		})
+		if readErr == nil {
+			break
 		}
 
-		if len(rsp) < 2 {
-			return nil, fmt.Errorf("invalid GET RESPONSE")
+		// If applet not found, try to reconnect
+		if retry < 2 && errors.Is(readErr, thaiid.ErrAppletNotFound) {
+			_ = card.Disconnect(scard.ResetCard)
+			time.Sleep(200 * time.Millisecond)
+
+			var err error
+			card, err = r.context.Connect(reader, scard.ShareExclusive, scard.ProtocolT0|scard.ProtocolT1)
+			if err != nil {
+				card = nil
+				break
+			}
 		}
 
-		sw1, sw2 = rsp[len(rsp)-2], rsp[len(rsp)-1]
+		// Wait a bit before retry
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if card != nil {
+		r.signalReadResult(reader, card, readErr == nil)
 	}
 
-	if sw1 != 0x90 || sw2 != 0x00 {
-		return nil, fmt.Errorf("read binary failed: SW=%02X%02X", sw1, sw2)
+	if readErr == nil {
+		r.lastCID[reader] = cardData.HolderID()
+	} else {
+		delete(r.lastCID, reader)
 	}
+	r.recordRead(reader, readErr)
 
-	return rsp[:len(rsp)-2], nil
+	r.cardInsertHandler(reader, cardData, readErr)
+	return card
 }
 
-func (r *PCSCReader) readPhoto(card *scard.Card) ([]byte, error) {
-	var photoData []byte
+// readerStatus is what PC/SC tells about the card in a reader without
+// connecting to it.
+type readerStatus struct {
+	present bool
+	// events counts the insertions and removals in the reader, with
+	// drivers that keep count, so a swap between polls changes it
+	events uint32
+	atr    string
+}
 
-	// Photo is split into 20 parts
-	photoCommands := []struct{ p1, p2 byte }{
-		{0x01, 0x7B}, {0x02, 0x7A}, {0x03, 0x79}, {0x04, 0x78}, {0x05, 0x77},
-		{0x06, 0x76}, {0x07, 0x75}, {0x08, 0x74}, {0x09, 0x73}, {0x0A, 0x72},
-		{0x0B, 0x71}, {0x0C, 0x70}, {0x0D, 0x6F}, {0x0E, 0x6E}, {0x0F, 0x6D},
-		{0x10, 0x6C}, {0x11, 0x6B}, {0x12, 0x6A}, {0x13, 0x69}, {0x14, 0x68},
+// statuses gets the status of readers without connecting to their cards, so
+// a card that was already read isn't disturbed on every poll.
+func (r *PCSCReader) statuses(readers []string) (map[string]readerStatus, error) {
+	states := make([]scard.ReaderState, len(readers))
+	for i, reader := range readers {
+		states[i] = scard.ReaderState{Reader: reader, CurrentState: scard.StateUnaware}
+	}
+	if err := r.context.GetStatusChange(states, 0); err != nil {
+		return nil, err
 	}
 
-	for _, cmd := range photoCommands {
-		data, err := r.readBinary(card, cmd.p1, cmd.p2, 0xFF)
-		if err != nil {
-			// Some cards might not have all photo parts
-			break
+	statuses := make(map[string]readerStatus, len(states))
+	for _, state := range states {
+		statuses[state.Reader] = readerStatus{
+			present: state.EventState&scard.StatePresent != 0,
+			// The upper 16 bits of the event state are the event counter
+			events: uint32(state.EventState) >> 16,
+			atr:    hex.EncodeToString(state.Atr),
 		}
-		photoData = append(photoData, data...)
 	}
+	return statuses, nil
+}
 
-	// Find the end of JPEG data (FFD9 marker) and trim padding
-	jpegEnd := bytes.Index(photoData, []byte{0xFF, 0xD9})
-	if jpegEnd != -1 {
-		// Include the FFD9 marker
-		photoData = photoData[:jpegEnd+2]
-	} else {
-		// If no JPEG end marker found, trim trailing spaces (0x20)
-		photoData = bytes.TrimRight(photoData, " ")
+// cardSwapped reads the citizen ID of a card we've already read and reports
+// whether it differs from the one read last. Failures count as unchanged. It
+// is only called when the reader's status changed since the card was read,
+// or couldn't be had and the ATR is unchanged.
+func (r *PCSCReader) cardSwapped(reader string, card *scard.Card) bool {
+	last, ok := r.lastCID[reader]
+	if !ok || last == "" {
+		return false
 	}
 
-	return photoData, nil
-}
-
-func (r *PCSCReader) decodeThaiString(data []byte) string {
-	// Thai ID cards use TIS-620 encoding
-	decoder := charmap.Windows874.NewDecoder()
-	decoded, err := decoder.Bytes(data)
+	ctx := context.Background()
+	if err := thaiid.SelectApplet(ctx, pcscCard{card}); err != nil {
+		return false
+	}
+	cid, err := thaiid.ReadCitizenID(ctx, pcscCard{card})
 	if err != nil {
-		// Fallback to original if decoding fails
-		return string(bytes.Trim(data, "\x00"))
+		return false
 	}
-	return string(bytes.Trim(decoded, "\x00"))
+
+	return r.cards.HolderID(cid) != last
 }
 
-func (r *PCSCReader) formatDate(dateStr string) string {
-	dateStr = string(bytes.Trim([]byte(dateStr), "\x00"))
-	if len(dateStr) < 8 {
+// cardATR returns the hex ATR of a connected card, or "" when the card's
+// status can't be had.
+func cardATR(card *scard.Card) string {
+	status, err := card.Status()
+	if err != nil {
 		return ""
 	}
+	return hex.EncodeToString(status.Atr)
+}
 
-	year := dateStr[0:4]
-	month := dateStr[4:6]
-	day := dateStr[6:8]
-
-	// Convert Buddhist Era to Gregorian
-	var thaiYear int
-	_, _ = fmt.Sscanf(year, "%d", &thaiYear)
-	gregorianYear := thaiYear - 543
+// releaseHeld disconnects all cards held in keep-connected mode.
+func (r *PCSCReader) releaseHeld() {
+	for reader, card := range r.held {
+		_ = card.Disconnect(scard.LeaveCard)
+		delete(r.held, reader)
+	}
+}
 
-	return fmt.Sprintf("%04d-%s-%s", gregorianYear, month, day)
+// releaseCard disconnects the card using the configured disposition, or holds
+// on to it when running in keep-connected mode.
+func (r *PCSCReader) releaseCard(reader string, card *scard.Card) {
+	if r.keepConnected {
+		r.held[reader] = card
+		return
+	}
+	_ = card.Disconnect(r.disposition)
 }
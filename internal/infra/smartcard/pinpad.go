@@ -0,0 +1,109 @@
+package smartcard
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ebfe/scard"
+)
+
+// PC/SC v2 Part 10 feature tags
+const (
+	featureVerifyPINDirect  byte = 0x06
+	featureGetTLVProperties byte = 0x12
+)
+
+// getFeatureRequestCode is CM_IOCTL_GET_FEATURE_REQUEST.
+var getFeatureRequestCode = scard.CtlCode(3400)
+
+// PINVerifyParams describes a secure PIN entry on a pinpad reader. The PIN is
+// typed on the reader and inserted into APDU by the reader firmware, so it
+// never reaches the host.
+type PINVerifyParams struct {
+	// APDU is the VERIFY command template, including the PIN block placeholder
+	APDU []byte
+	// Timeout in seconds for PIN entry (0 uses the reader default)
+	Timeout   byte
+	MinLength byte
+	MaxLength byte
+	// FormatString, PINBlockString and PINLengthFormat follow the
+	// PIN_VERIFY_STRUCTURE definitions (bmFormatString etc.)
+	FormatString    byte
+	PINBlockString  byte
+	PINLengthFormat byte
+}
+
+// readerFeatures returns the Part 10 control codes advertised by the reader.
+func readerFeatures(card *scard.Card) (map[byte]uint32, error) {
+	rsp, err := card.Control(getFeatureRequestCode, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	features := make(map[byte]uint32)
+	// Response is a list of TLVs: tag, length (4), big-endian control code
+	for i := 0; i+6 <= len(rsp); i += 6 {
+		if rsp[i+1] != 4 {
+			return nil, fmt.Errorf("invalid feature TLV length %d", rsp[i+1])
+		}
+		features[rsp[i]] = binary.BigEndian.Uint32(rsp[i+2 : i+6])
+	}
+
+	return features, nil
+}
+
+// SupportsPINPad reports whether the reader can verify a PIN on its own keypad.
+func (r *PCSCReader) SupportsPINPad(card *scard.Card) bool {
+	features, err := readerFeatures(card)
+	if err != nil {
+		return false
+	}
+	_, ok := features[featureVerifyPINDirect]
+	return ok
+}
+
+// VerifyPINDirect asks the reader to collect the PIN on its keypad and send
+// the VERIFY command itself. It returns the card's response including SW1 SW2.
+func (r *PCSCReader) VerifyPINDirect(card *scard.Card, params PINVerifyParams) ([]byte, error) {
+	features, err := readerFeatures(card)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query reader features: %w", err)
+	}
+
+	code, ok := features[featureVerifyPINDirect]
+	if !ok {
+		return nil, fmt.Errorf("reader does not support secure PIN verification")
+	}
+
+	rsp, err := card.Control(code, buildPINVerifyStructure(params))
+	if err != nil {
+		return nil, fmt.Errorf("secure PIN verification failed: %w", err)
+	}
+
+	if len(rsp) < 2 {
+		return nil, fmt.Errorf("invalid PIN verification response")
+	}
+
+	return rsp, nil
+}
+
+// buildPINVerifyStructure encodes PIN_VERIFY_STRUCTURE (multi-byte fields are
+// little-endian).
+func buildPINVerifyStructure(p PINVerifyParams) []byte {
+	buf := []byte{
+		p.Timeout,         // bTimerOut
+		p.Timeout,         // bTimerOut2
+		p.FormatString,    // bmFormatString
+		p.PINBlockString,  // bmPINBlockString
+		p.PINLengthFormat, // bmPINLengthFormat
+		p.MaxLength,       // wPINMaxExtraDigit (max, min)
+		p.MinLength,
+		0x02,       // bEntryValidationCondition: validation key pressed
+		0x01,       // bNumberMessage
+		0x09, 0x04, // wLangId: English (0x0409)
+		0x00,             // bMsgIndex
+		0x00, 0x00, 0x00, // bTeoPrologue
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(p.APDU)))
+	return append(buf, p.APDU...)
+}
@@ -0,0 +1,106 @@
+package smartcard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+	"github.com/ebfe/scard"
+)
+
+// RetryRead resets the card in reader and reads it again, reporting the read
+// to the OnCardInserted handler like an insertion, so the user can try again
+// after a failed or partial read without reinserting the card. An empty
+// reader retries the first reader with a card. The error is only set when
+// there is no card to read.
+func (r *PCSCReader) RetryRead(ctx context.Context, reader string) error {
+	r.cardMu.Lock()
+	defer r.cardMu.Unlock()
+	logRequest(ctx)
+
+	if s := r.serialReader(reader); s != nil {
+		// Serial cards are powered off between reads, so powering one on
+		// resets it
+		if err := r.powerOnSerial(s); err != nil {
+			return err
+		}
+		card, readErr := r.cards.Read(ctx, s.config.Name, s.ccid, nil)
+		_ = s.ccid.PowerOff()
+		r.reportRetry(s.config.Name, card, readErr)
+		return nil
+	}
+
+	readers, err := r.context.ListReaders()
+	if (err != nil || len(readers) == 0) && (reader != "" || len(r.serial) == 0) {
+		return fmt.Errorf("%s", domain.ErrMsgReaderNotFound)
+	}
+
+	if reader != "" {
+		if !slices.Contains(readers, reader) {
+			return fmt.Errorf("%s", domain.ErrMsgReaderNotFound)
+		}
+		readers = []string{reader}
+	}
+
+	inUse := false
+	for _, name := range readers {
+		card, held := r.held[name]
+		if !held {
+			if card, err = r.connectWaiting(name); err != nil {
+				if errors.Is(err, scard.ErrSharingViolation) {
+					inUse = true
+				}
+				continue
+			}
+		}
+
+		// A failed reset leaves the card as it is; the read tells whether
+		// it can still be used
+		if err := card.Reconnect(scard.ShareExclusive, scard.ProtocolT0|scard.ProtocolT1, scard.ResetCard); err != nil {
+			log.Printf("Failed to reset the card in %s: %v", name, err)
+		}
+		data, readErr := r.cards.Read(ctx, name, pcscCard{card}, nil)
+		r.signalReadResult(name, card, readErr == nil)
+		if !held {
+			_ = card.Disconnect(r.disposition)
+		}
+		r.reportRetry(name, data, readErr)
+		return nil
+	}
+
+	if reader == "" {
+		for _, s := range r.serial {
+			if err := r.powerOnSerial(s); err != nil {
+				continue
+			}
+			card, readErr := r.cards.Read(ctx, s.config.Name, s.ccid, nil)
+			_ = s.ccid.PowerOff()
+			r.reportRetry(s.config.Name, card, readErr)
+			return nil
+		}
+	}
+
+	if inUse {
+		return fmt.Errorf("%s", domain.ErrMsgCardInUse)
+	}
+	return fmt.Errorf("%s", domain.ErrMsgCardNotDetected)
+}
+
+// reportRetry records a retried read as handleInsertion does and reports it.
+// The caller holds cardMu.
+func (r *PCSCReader) reportRetry(reader string, card *domain.ThaiIdCard, readErr error) {
+	if readErr == nil {
+		card.Retry = true
+		r.lastCID[reader] = card.HolderID()
+	} else {
+		delete(r.lastCID, reader)
+	}
+	r.recordRead(reader, readErr)
+
+	if r.cardInsertHandler != nil {
+		r.cardInsertHandler(reader, card, readErr)
+	}
+}
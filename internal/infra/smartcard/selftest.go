@@ -0,0 +1,94 @@
+package smartcard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/thaiid"
+	"github.com/ebfe/scard"
+)
+
+// SelfTest checks the PC/SC stack step by step: a fresh context can be
+// established, readers are listed and, for the first reader with a card, the
+// Thai ID applet is selected and the citizen ID read.
+func (r *PCSCReader) SelfTest() domain.SelfTestReport {
+	report := domain.NewSelfTestReport()
+
+	start := time.Now()
+	ctx, err := scard.EstablishContext()
+	if err == nil {
+		_ = ctx.Release()
+	}
+	report.Add("context", start, err, "")
+
+	r.cardMu.Lock()
+	defer r.cardMu.Unlock()
+
+	start = time.Now()
+	readers, err := r.context.ListReaders()
+	if err == nil && len(readers) == 0 {
+		err = fmt.Errorf("%s", domain.ErrMsgReaderNotFound)
+	}
+	report.Add("readers", start, err, strings.Join(readers, ", "))
+	if err != nil {
+		report.Skip("card", "no reader")
+		return *report
+	}
+
+	for _, reader := range readers {
+		start = time.Now()
+		card, held := r.held[reader]
+		if !held {
+			card, err = r.context.Connect(reader, scard.ShareExclusive, scard.ProtocolT0|scard.ProtocolT1)
+			if errors.Is(err, scard.ErrNoSmartcard) || errors.Is(err, scard.ErrRemovedCard) {
+				continue
+			}
+			if errors.Is(err, scard.ErrSharingViolation) {
+				err = fmt.Errorf("%s", domain.ErrMsgCardInUse)
+			}
+		}
+		report.Add("card", start, err, reader)
+		if err != nil {
+			return *report
+		}
+
+		r.testCard(report, card)
+		if !held {
+			_ = card.Disconnect(scard.LeaveCard)
+		}
+		return *report
+	}
+
+	report.Skip("card", "no card inserted")
+	return *report
+}
+
+// testCard selects the applet and reads the citizen ID, which is reported
+// masked.
+func (r *PCSCReader) testCard(report *domain.SelfTestReport, card *scard.Card) {
+	ctx := context.Background()
+	start := time.Now()
+	if err := thaiid.SelectApplet(ctx, pcscCard{card}); err != nil {
+		report.Add("applet", start, err, "")
+		report.Skip("cid", "applet not selected")
+		return
+	}
+	report.Add("applet", start, nil, "")
+
+	start = time.Now()
+	cid, err := thaiid.ReadCitizenID(ctx, pcscCard{card})
+	if err != nil {
+		report.Add("cid", start, err, "")
+		return
+	}
+
+	id, err := domain.ParseCitizenID(cid)
+	if err == nil && !id.Valid {
+		err = fmt.Errorf("citizen ID %s has an invalid check digit", domain.MaskCitizenID(cid))
+	}
+	report.Add("cid", start, err, domain.MaskCitizenID(cid))
+}
@@ -0,0 +1,201 @@
+package smartcard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/config"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/crash"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/logging"
+)
+
+const (
+	// serialReadTimeout is how long a serial reader may stay silent before
+	// it's considered gone
+	serialReadTimeout = 5 * time.Second
+	// serialPollInterval is the pause between card presence checks, kept
+	// longer than pollInterval to spare Bluetooth links
+	serialPollInterval = time.Second
+	// serialRetryInterval paces reopening a reader that was unplugged or
+	// went out of Bluetooth range
+	serialRetryInterval = 5 * time.Second
+	defaultBaudRate     = 9600
+)
+
+// serialReader is a CCID reader on a serial port. Its fields are guarded by
+// cardMu.
+type serialReader struct {
+	config  config.SerialReader
+	port    io.ReadWriteCloser
+	ccid    *CCIDTransport
+	present bool
+	lastErr string
+	retryAt time.Time
+}
+
+func newSerialReaders(configs []config.SerialReader) []*serialReader {
+	readers := make([]*serialReader, len(configs))
+	for i, c := range configs {
+		if c.BaudRate == 0 {
+			c.BaudRate = defaultBaudRate
+		}
+		readers[i] = &serialReader{config: c}
+	}
+	return readers
+}
+
+// open opens the port unless it's open already.
+func (s *serialReader) open() error {
+	if s.ccid != nil {
+		return nil
+	}
+	port, err := openSerial(s.config.Device, s.config.BaudRate)
+	if err != nil {
+		return err
+	}
+	s.port = port
+	s.ccid = NewCCIDTransport(s.config.Name, port)
+	log.Printf("Serial reader %s connected on %s", s.config.Name, s.config.Device)
+	return nil
+}
+
+func (s *serialReader) close() {
+	if s.port != nil {
+		_ = s.port.Close()
+	}
+	s.port = nil
+	s.ccid = nil
+}
+
+// serialReader returns the serial reader with the given name, or nil.
+func (r *PCSCReader) serialReader(name string) *serialReader {
+	for _, s := range r.serial {
+		if s.config.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// monitorSerial polls the serial readers for card insertion and removal
+// until stop is closed.
+func (r *PCSCReader) monitorSerial(stop chan struct{}) {
+	defer crash.Recover()
+	ticker := time.NewTicker(serialPollInterval)
+	defer ticker.Stop()
+
+	for {
+		r.cardMu.Lock()
+		idle := r.idleCheck != nil && r.idleCheck()
+		for _, s := range r.serial {
+			if idle {
+				// Read a card already inserted on resume
+				s.present = false
+				continue
+			}
+			r.pollSerial(s)
+		}
+		r.cardMu.Unlock()
+
+		select {
+		case <-stop:
+			r.cardMu.Lock()
+			for _, s := range r.serial {
+				s.close()
+			}
+			r.cardMu.Unlock()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pollSerial checks one serial reader, reading a newly inserted card. The
+// caller holds cardMu.
+func (r *PCSCReader) pollSerial(s *serialReader) {
+	name := s.config.Name
+	if s.ccid == nil {
+		if time.Now().Before(s.retryAt) {
+			return
+		}
+		if err := s.open(); err != nil {
+			// Log a failure once rather than every retry, e.g. while the
+			// kit is switched off
+			if err.Error() != s.lastErr {
+				log.Printf("Failed to open serial reader %s: %v", name, err)
+				s.lastErr = err.Error()
+			}
+			s.retryAt = time.Now().Add(serialRetryInterval)
+			return
+		}
+		s.lastErr = ""
+	}
+
+	present, err := s.ccid.CardPresent()
+	if err != nil {
+		log.Printf("Serial reader %s stopped responding: %v", name, err)
+		s.close()
+		present = false
+	}
+	if present == s.present {
+		return
+	}
+	s.present = present
+
+	if !present {
+		delete(r.lastCID, name)
+		if r.cardRemoveHandler != nil {
+			r.cardRemoveHandler(name)
+		}
+		return
+	}
+
+	if r.cardInsertHandler == nil {
+		return
+	}
+	ctx := logging.WithRequestID(context.Background(), logging.NewRequestID())
+	logRequest(ctx)
+
+	cardData, readErr := r.readSerial(ctx, s, func(c *domain.ThaiIdCard) {
+		if r.cardIdentHandler != nil {
+			r.cardIdentHandler(name, c)
+		}
+	})
+	if readErr == nil {
+		r.lastCID[name] = cardData.HolderID()
+	} else {
+		delete(r.lastCID, name)
+	}
+	r.cardInsertHandler(name, cardData, readErr)
+}
+
+// readSerial powers on the card in a serial reader, reads it with the same
+// logic as PC/SC cards and powers it off again. The caller holds cardMu.
+func (r *PCSCReader) readSerial(ctx context.Context, s *serialReader, onIdentified func(*domain.ThaiIdCard)) (*domain.ThaiIdCard, error) {
+	if err := r.powerOnSerial(s); err != nil {
+		return nil, err
+	}
+	defer s.ccid.PowerOff()
+
+	return r.cards.Read(ctx, s.config.Name, s.ccid, onIdentified)
+}
+
+// powerOnSerial opens the reader if needed and activates its card.
+func (r *PCSCReader) powerOnSerial(s *serialReader) error {
+	if err := s.open(); err != nil {
+		log.Printf("Failed to open serial reader %s: %v", s.config.Name, err)
+		return fmt.Errorf("%s", domain.ErrMsgReaderNotFound)
+	}
+	if _, err := s.ccid.PowerOn(); err != nil {
+		if !errors.Is(err, errNoCard) {
+			log.Printf("Failed to power on the card in %s: %v", s.config.Name, err)
+		}
+		return fmt.Errorf("%s", domain.ErrMsgCardNotDetected)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+//go:build linux
+
+package smartcard
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+var baudRates = map[int]uint32{
+	9600:   unix.B9600,
+	19200:  unix.B19200,
+	38400:  unix.B38400,
+	57600:  unix.B57600,
+	115200: unix.B115200,
+}
+
+// openSerial opens a serial device, e.g. /dev/ttyUSB0 or a Bluetooth SPP
+// link bound with rfcomm (/dev/rfcomm0), in raw 8N1 mode. Reads give up
+// after serialReadTimeout without data.
+func openSerial(device string, baud int) (io.ReadWriteCloser, error) {
+	speed, ok := baudRates[baud]
+	if !ok {
+		return nil, fmt.Errorf("unsupported baud rate %d", baud)
+	}
+
+	fd, err := unix.Open(device, unix.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: device, Err: err}
+	}
+
+	tio, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		_ = unix.Close(fd)
+		return nil, fmt.Errorf("%s is not a serial device: %w", device, err)
+	}
+	tio.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON | unix.IXOFF
+	tio.Oflag &^= unix.OPOST
+	tio.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	tio.Cflag &^= unix.CSIZE | unix.PARENB | unix.CSTOPB | unix.CRTSCTS | unix.CBAUD
+	tio.Cflag |= unix.CS8 | unix.CREAD | unix.CLOCAL | speed
+	tio.Ispeed = speed
+	tio.Ospeed = speed
+	// Return after the first byte, or after VTIME tenths of a second without
+	// any
+	tio.Cc[unix.VMIN] = 0
+	tio.Cc[unix.VTIME] = uint8(serialReadTimeout.Milliseconds() / 100)
+	if err := unix.IoctlSetTermios(fd, unix.TCSETS, tio); err != nil {
+		_ = unix.Close(fd)
+		return nil, fmt.Errorf("configuring %s: %w", device, err)
+	}
+	_ = unix.IoctlSetInt(fd, unix.TCFLSH, unix.TCIOFLUSH)
+
+	return os.NewFile(uintptr(fd), device), nil
+}
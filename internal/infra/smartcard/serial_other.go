@@ -0,0 +1,12 @@
+//go:build !linux && !windows
+
+package smartcard
+
+import (
+	"errors"
+	"io"
+)
+
+func openSerial(device string, baud int) (io.ReadWriteCloser, error) {
+	return nil, errors.New("serial readers are not supported on this platform")
+}
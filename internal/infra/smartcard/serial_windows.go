@@ -0,0 +1,58 @@
+//go:build windows
+
+package smartcard
+
+import (
+	"io"
+	"os"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// dcbBinary is fBinary in the DCB flags, which must be set on Windows.
+const dcbBinary = 0x1
+
+// openSerial opens a COM port, e.g. COM3, which is also how Windows exposes a
+// paired Bluetooth SPP device, in 8N1 mode. Reads give up after
+// serialReadTimeout without data.
+func openSerial(device string, baud int) (io.ReadWriteCloser, error) {
+	path := device
+	if !strings.HasPrefix(path, `\\.\`) {
+		// COM10 and above are only reachable through the device namespace
+		path = `\\.\` + path
+	}
+	name, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	handle, err := windows.CreateFile(name, windows.GENERIC_READ|windows.GENERIC_WRITE, 0, nil, windows.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: device, Err: err}
+	}
+
+	var dcb windows.DCB
+	dcb.DCBlength = uint32(unsafe.Sizeof(dcb))
+	if err := windows.GetCommState(handle, &dcb); err != nil {
+		_ = windows.CloseHandle(handle)
+		return nil, &os.PathError{Op: "configure", Path: device, Err: err}
+	}
+	dcb.BaudRate = uint32(baud)
+	dcb.ByteSize = 8
+	dcb.Parity = windows.NOPARITY
+	dcb.StopBits = windows.ONESTOPBIT
+	dcb.Flags = dcbBinary
+	if err := windows.SetCommState(handle, &dcb); err != nil {
+		_ = windows.CloseHandle(handle)
+		return nil, &os.PathError{Op: "configure", Path: device, Err: err}
+	}
+
+	timeouts := windows.CommTimeouts{ReadTotalTimeoutConstant: uint32(serialReadTimeout.Milliseconds())}
+	if err := windows.SetCommTimeouts(handle, &timeouts); err != nil {
+		_ = windows.CloseHandle(handle)
+		return nil, &os.PathError{Op: "configure", Path: device, Err: err}
+	}
+
+	return os.NewFile(uintptr(handle), device), nil
+}
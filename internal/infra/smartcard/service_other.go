@@ -0,0 +1,23 @@
+//go:build !windows
+
+package smartcard
+
+import (
+	"runtime"
+
+	"github.com/ebfe/scard"
+)
+
+// checkSmartCardService is a no-op outside Windows; pcscd is started on
+// demand by the OS.
+func checkSmartCardService(start bool) error {
+	return nil
+}
+
+// pcscStack describes the PC/SC implementation for the diagnostics bundle.
+func pcscStack() string {
+	if runtime.GOOS == "darwin" {
+		return "PCSC.framework " + scard.Version()
+	}
+	return "pcsc-lite " + scard.Version()
+}
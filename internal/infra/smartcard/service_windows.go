@@ -0,0 +1,107 @@
+//go:build windows
+
+package smartcard
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const smartCardServiceName = "SCardSvr"
+
+// checkSmartCardService inspects the Windows Smart Card service. It returns
+// nil when the service is running, or was started because start is set and
+// the process is elevated.
+func checkSmartCardService(start bool) error {
+	scm, err := windows.OpenSCManager(nil, nil, windows.SC_MANAGER_CONNECT)
+	if err != nil {
+		log.Printf("Failed to connect to service manager: %v", err)
+		return nil
+	}
+	defer windows.CloseServiceHandle(scm)
+
+	name, err := windows.UTF16PtrFromString(smartCardServiceName)
+	if err != nil {
+		return nil
+	}
+
+	// Starting needs SERVICE_START, which is only granted when elevated
+	access := uint32(windows.SERVICE_QUERY_STATUS | windows.SERVICE_QUERY_CONFIG)
+	h, err := windows.OpenService(scm, name, access|windows.SERVICE_START)
+	if err != nil {
+		h, err = windows.OpenService(scm, name, access)
+		if err != nil {
+			log.Printf("Failed to open %s service: %v", smartCardServiceName, err)
+			return nil
+		}
+	}
+	s := &mgr.Service{Name: smartCardServiceName, Handle: h}
+	defer s.Close()
+
+	config, err := s.Config()
+	if err == nil && config.StartType == mgr.StartDisabled {
+		log.Printf("The %s service is disabled. Enable it with: sc config %s start= demand", smartCardServiceName, smartCardServiceName)
+		return fmt.Errorf("%s", domain.ErrMsgServiceDisabled)
+	}
+
+	status, err := s.Query()
+	if err != nil || status.State == svc.Running {
+		return nil
+	}
+
+	if !start {
+		log.Printf("The %s service is not running. Start it with: sc start %s", smartCardServiceName, smartCardServiceName)
+		return fmt.Errorf("%s", domain.ErrMsgServiceStopped)
+	}
+
+	log.Printf("Starting the %s service", smartCardServiceName)
+	if err := s.Start(); err != nil {
+		log.Printf("Failed to start %s service (is the agent running elevated?): %v", smartCardServiceName, err)
+		return fmt.Errorf("%s", domain.ErrMsgServiceStopped)
+	}
+
+	// Give the service a moment to come up before establishing a context
+	for i := 0; i < 10; i++ {
+		if status, err := s.Query(); err == nil && status.State == svc.Running {
+			return nil
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	return fmt.Errorf("%s", domain.ErrMsgServiceStopped)
+}
+
+var serviceStates = map[svc.State]string{
+	svc.Stopped:         "stopped",
+	svc.StartPending:    "starting",
+	svc.StopPending:     "stopping",
+	svc.Running:         "running",
+	svc.ContinuePending: "resuming",
+	svc.PausePending:    "pausing",
+	svc.Paused:          "paused",
+}
+
+// pcscStack describes WinSCard and the state of the Smart Card service for
+// the diagnostics bundle.
+func pcscStack() string {
+	state := "unknown"
+	scm, err := windows.OpenSCManager(nil, nil, windows.SC_MANAGER_CONNECT)
+	if err == nil {
+		defer windows.CloseServiceHandle(scm)
+		name, _ := windows.UTF16PtrFromString(smartCardServiceName)
+		if h, err := windows.OpenService(scm, name, windows.SERVICE_QUERY_STATUS); err == nil {
+			s := &mgr.Service{Name: smartCardServiceName, Handle: h}
+			if status, err := s.Query(); err == nil {
+				state = serviceStates[status.State]
+			}
+			s.Close()
+		}
+	}
+	return fmt.Sprintf("WinSCard, %s service %s", smartCardServiceName, state)
+}
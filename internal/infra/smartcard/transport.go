@@ -0,0 +1,38 @@
+package smartcard
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/logging"
+	"github.com/ebfe/scard"
+)
+
+// pcscCard adapts a PC/SC card connection to thaiid.StatusTransport.
+type pcscCard struct {
+	*scard.Card
+}
+
+// CardStatus returns the card ATR, the reader name and the reader model,
+// which is the vendor's IFD type when the driver reports it.
+func (c pcscCard) CardStatus() ([]byte, string, string, error) {
+	status, err := c.Status()
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	model := status.Reader
+	if ifdType, err := c.GetAttrib(scard.AttrVendorIfdType); err == nil {
+		if name := string(bytes.Trim(ifdType, " \x00")); name != "" {
+			model = name
+		}
+	}
+	return status.Atr, status.Reader, model, nil
+}
+
+// logRequest notes the request ID of a read in the debug log.
+func logRequest(ctx context.Context) {
+	if id := logging.RequestID(ctx); id != "" {
+		logging.Debugf("Request %s: reading card", id)
+	}
+}
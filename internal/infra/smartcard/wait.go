@@ -0,0 +1,88 @@
+package smartcard
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+	"github.com/ebfe/scard"
+)
+
+const (
+	// pollInterval is the pause between polls of the readers
+	pollInterval = 500 * time.Millisecond
+	// changeWaitTimeout bounds a wait for a state change, so readers that
+	// can't be watched through PnP notification are still picked up
+	changeWaitTimeout = 30 * time.Second
+	// pnpNotification is the pseudo reader that changes when a reader is
+	// added or removed
+	pnpNotification = `\\?PnP?\Notification`
+)
+
+// pause waits before the next poll. In wait-for-changes mode it blocks in
+// GetStatusChange until a card or reader changes instead of waking every
+// pollInterval, which lets the CPU and USB bus idle on battery-powered units.
+func (r *PCSCReader) pause(readers []string) {
+	if !r.waitForChanges.Load() {
+		// Forget the states from any earlier waits, so switching back
+		// starts afresh
+		clear(r.readerStates)
+		time.Sleep(pollInterval)
+		return
+	}
+	// A busy reader is retried on a timer, not on a state change
+	if len(r.busy) > 0 {
+		time.Sleep(pollInterval)
+		return
+	}
+
+	states := make([]scard.ReaderState, 0, len(readers)+1)
+	for _, reader := range readers {
+		states = append(states, scard.ReaderState{Reader: reader, CurrentState: r.readerStates[reader]})
+	}
+	if r.pnpSupported {
+		states = append(states, scard.ReaderState{Reader: pnpNotification, CurrentState: r.readerStates[pnpNotification]})
+	}
+
+	err := r.context.GetStatusChange(states, changeWaitTimeout)
+	switch {
+	case err == nil:
+		for _, state := range states {
+			r.readerStates[state.Reader] = state.EventState &^ scard.StateChanged
+		}
+	case errors.Is(err, scard.ErrTimeout), errors.Is(err, scard.ErrCancelled):
+	case r.pnpSupported && errors.Is(err, scard.ErrUnknownReader):
+		log.Println("Reader PnP notification isn't supported, new readers are found on the next timeout")
+		r.pnpSupported = false
+	default:
+		log.Printf("Error waiting for reader changes: %v", err)
+		time.Sleep(pollInterval)
+	}
+}
+
+func (r *PCSCReader) MonitorStrategy() string {
+	if r.waitForChanges.Load() {
+		return domain.MonitorEvents
+	}
+	return domain.MonitorPoll
+}
+
+// SetMonitorStrategy switches between polling and waiting for state changes.
+// Switching to polling wakes a monitor blocked in GetStatusChange, which
+// some old CCID readers never return from.
+func (r *PCSCReader) SetMonitorStrategy(strategy string) error {
+	switch strategy {
+	case domain.MonitorPoll:
+		if r.waitForChanges.Swap(false) && r.monitoring {
+			_ = r.context.Cancel()
+		}
+	case domain.MonitorEvents:
+		r.waitForChanges.Store(true)
+	default:
+		return fmt.Errorf("unknown monitor strategy %q (expected %s or %s)", strategy, domain.MonitorPoll, domain.MonitorEvents)
+	}
+	log.Printf("Card monitor strategy set to %s", strategy)
+	return nil
+}
@@ -0,0 +1,149 @@
+package smartcard
+
+import (
+	"log"
+	"time"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/crash"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+	"github.com/ebfe/scard"
+)
+
+// Monitor stages, reported with a stall.
+const (
+	stageIdle    = "idle"
+	stageListing = "listing readers"
+	stageLocking = "waiting for card access"
+	stageReading = "reading"
+	stageWaiting = "waiting for changes"
+)
+
+// stallResetWait bounds how long a context reset waits for card access.
+const stallResetWait = 5 * time.Second
+
+// monitorBeat is the monitor's last sign of progress.
+type monitorBeat struct {
+	at     time.Time
+	stage  string
+	reader string
+}
+
+// heartbeat records that the monitor started stage, in reader if it's
+// specific to one.
+func (r *PCSCReader) heartbeat(stage, reader string) {
+	r.beatMu.Lock()
+	r.beat = monitorBeat{at: time.Now(), stage: stage, reader: reader}
+	r.beatMu.Unlock()
+}
+
+func (r *PCSCReader) OnMonitorStalled(handler func(stall domain.MonitorStall, resetContext bool)) {
+	r.stalledHandler = handler
+}
+
+func (r *PCSCReader) OnMonitorRecovered(handler func(stall domain.MonitorStall)) {
+	r.unstalledHandler = handler
+}
+
+// MonitorHealth returns the current monitor stall, or nil while the monitor
+// is making progress.
+func (r *PCSCReader) MonitorHealth() *domain.MonitorStall {
+	r.beatMu.Lock()
+	defer r.beatMu.Unlock()
+	if r.stall == nil {
+		return nil
+	}
+	stall := *r.stall
+	return &stall
+}
+
+// watchdog checks the monitor's heartbeat until stop is closed.
+func (r *PCSCReader) watchdog(stop chan struct{}) {
+	defer crash.Recover()
+	ticker := time.NewTicker(max(r.stallTimeout/4, time.Second))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			r.beatMu.Lock()
+			r.stall = nil
+			r.beatMu.Unlock()
+			return
+		case <-ticker.C:
+			r.checkStall()
+		}
+	}
+}
+
+// checkStall reports the monitor as stalled once its last heartbeat is older
+// than the stall timeout, and as recovered when it beats again.
+func (r *PCSCReader) checkStall() {
+	r.beatMu.Lock()
+	beat, stall := r.beat, r.stall
+	limit := r.stallTimeout
+	if beat.stage == stageWaiting {
+		// GetStatusChange legitimately blocks until its timeout
+		limit += changeWaitTimeout
+	}
+	stalled := time.Since(beat.at) > limit
+	switch {
+	case stalled && stall == nil:
+		r.stall = &domain.MonitorStall{Stage: beat.stage, Reader: beat.reader, Since: beat.at}
+		stall = r.stall
+	case !stalled && stall != nil:
+		r.stall = nil
+	default:
+		r.beatMu.Unlock()
+		return
+	}
+	r.beatMu.Unlock()
+
+	if !stalled {
+		log.Printf("Card monitor recovered after %v", time.Since(stall.Since).Round(time.Second))
+		if r.unstalledHandler != nil {
+			r.unstalledHandler(*stall)
+		}
+		return
+	}
+
+	where := stall.Stage
+	if stall.Reader != "" {
+		where += " " + stall.Reader
+	}
+	log.Printf("Card monitor stalled for %v while %s", time.Since(stall.Since).Round(time.Second), where)
+	if r.stalledHandler != nil {
+		r.stalledHandler(*stall, r.resetOnStall)
+	}
+	if r.resetOnStall {
+		go r.resetStalledContext()
+	}
+}
+
+// resetStalledContext wakes a monitor blocked in GetStatusChange and
+// replaces the PC/SC context, which makes most hung drivers give up. A card
+// transaction that never returns keeps cardMu, and then only replugging the
+// reader or restarting helps.
+func (r *PCSCReader) resetStalledContext() {
+	defer crash.Recover()
+	_ = r.context.Cancel()
+
+	deadline := time.Now().Add(stallResetWait)
+	for !r.cardMu.TryLock() {
+		if time.Now().After(deadline) {
+			log.Println("Card access is stuck in the reader driver; replug the reader or restart the service")
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	defer r.cardMu.Unlock()
+
+	ctx, err := scard.EstablishContext()
+	if err != nil {
+		log.Printf("Failed to re-establish context: %v", err)
+		return
+	}
+	_ = r.context.Release()
+	r.context = ctx
+	clear(r.held)
+	log.Println("PC/SC context reset after the card monitor stalled")
+}
@@ -0,0 +1,9 @@
+package store
+
+// The database/sql drivers of the SQL stores, both pure Go so the service
+// still builds without cgo: modernc.org/sqlite registers "sqlite" and pgx
+// registers "pgx".
+import (
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
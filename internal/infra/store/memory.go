@@ -0,0 +1,87 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+)
+
+// Memory keeps the most recent reads in memory, for kiosks that only need
+// today's history and can lose it on restart.
+type Memory struct {
+	mu       sync.RWMutex
+	reads    []domain.StoredRead
+	maxReads int
+	nextID   int64
+}
+
+// NewMemory returns a store holding at most maxReads reads, dropping the
+// oldest first.
+func NewMemory(maxReads int) *Memory {
+	return &Memory{maxReads: maxReads}
+}
+
+func (m *Memory) Save(ctx context.Context, read domain.StoredRead) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	read.ID = m.nextID
+	// Reads are saved concurrently, so one may arrive after a later one
+	at := len(m.reads)
+	for at > 0 && m.reads[at-1].ReadAt.After(read.ReadAt) {
+		at--
+	}
+	m.reads = slices.Insert(m.reads, at, read)
+	if len(m.reads) > m.maxReads {
+		m.reads = slices.Delete(m.reads, 0, len(m.reads)-m.maxReads)
+	}
+	return nil
+}
+
+func (m *Memory) Search(ctx context.Context, query domain.ReadQuery) ([]domain.StoredRead, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var found []domain.StoredRead
+	skip := query.Offset
+	for i := len(m.reads) - 1; i >= 0; i-- {
+		read := m.reads[i]
+		if !matches(read, query) {
+			continue
+		}
+		if query.Limit > 0 {
+			if skip > 0 {
+				skip--
+				continue
+			}
+			if len(found) == query.Limit {
+				break
+			}
+		}
+		found = append(found, read)
+	}
+	return found, nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
+
+// matches reports whether read is selected by query.
+func matches(read domain.StoredRead, query domain.ReadQuery) bool {
+	if query.CitizenID != "" && read.CitizenID != query.CitizenID && read.CitizenIDHash != query.CitizenID {
+		return false
+	}
+	if query.Reader != "" && read.Reader != query.Reader {
+		return false
+	}
+	if !query.From.IsZero() && read.ReadAt.Before(query.From) {
+		return false
+	}
+	if !query.To.IsZero() && !read.ReadAt.Before(query.To) {
+		return false
+	}
+	return true
+}
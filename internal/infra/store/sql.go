@@ -0,0 +1,169 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+)
+
+// dialect holds what differs between the databases reads are stored in.
+type dialect struct {
+	name string
+	// schema creates the reads table and its indexes if they don't exist
+	schema []string
+	// placeholder returns the nth (1-based) query parameter
+	placeholder func(n int) string
+}
+
+var dialectSQLite = dialect{
+	name: "sqlite",
+	schema: []string{
+		`CREATE TABLE IF NOT EXISTS card_reads (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			read_at BIGINT NOT NULL,
+			reader TEXT NOT NULL,
+			reader_alias TEXT NOT NULL,
+			citizen_id TEXT NOT NULL,
+			citizen_id_hash TEXT NOT NULL,
+			session_id TEXT NOT NULL,
+			request_id TEXT NOT NULL,
+			card TEXT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS card_reads_citizen_id ON card_reads (citizen_id, read_at)`,
+		`CREATE INDEX IF NOT EXISTS card_reads_read_at ON card_reads (read_at)`,
+	},
+	placeholder: func(int) string { return "?" },
+}
+
+var dialectPostgres = dialect{
+	name: "postgres",
+	schema: []string{
+		`CREATE TABLE IF NOT EXISTS card_reads (
+			id BIGSERIAL PRIMARY KEY,
+			read_at BIGINT NOT NULL,
+			reader TEXT NOT NULL,
+			reader_alias TEXT NOT NULL,
+			citizen_id TEXT NOT NULL,
+			citizen_id_hash TEXT NOT NULL,
+			session_id TEXT NOT NULL,
+			request_id TEXT NOT NULL,
+			card JSONB NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS card_reads_citizen_id ON card_reads (citizen_id, read_at)`,
+		`CREATE INDEX IF NOT EXISTS card_reads_read_at ON card_reads (read_at)`,
+	},
+	placeholder: func(n int) string { return "$" + strconv.Itoa(n) },
+}
+
+// SQL stores reads in the card_reads table of an SQL database, which it
+// creates if needed. Read times are Unix milliseconds, so they compare the
+// same way in every database.
+type SQL struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+// openSQL connects to the database at dsn with the database/sql driver
+// registered as driver. The build links the drivers in drivers.go; a custom
+// build can add another with a blank import and name it in store.driver.
+func openSQL(d dialect, driver, dsn string) (*SQL, error) {
+	if !slices.Contains(sql.Drivers(), driver) {
+		return nil, fmt.Errorf("no %q database driver in this build for %s; a custom build must link one", driver, d.name)
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, statement := range d.schema {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to create the card_reads table: %w", err)
+		}
+	}
+	return &SQL{db: db, dialect: d}, nil
+}
+
+func (s *SQL) Save(ctx context.Context, read domain.StoredRead) error {
+	card, err := json.Marshal(read.Card)
+	if err != nil {
+		return err
+	}
+	placeholders := make([]string, 8)
+	for i := range placeholders {
+		placeholders[i] = s.dialect.placeholder(i + 1)
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO card_reads
+		(read_at, reader, reader_alias, citizen_id, citizen_id_hash, session_id, request_id, card)
+		VALUES (`+strings.Join(placeholders, ", ")+`)`,
+		read.ReadAt.UnixMilli(), read.Reader, read.ReaderAlias, read.CitizenID, read.CitizenIDHash,
+		read.SessionID, read.RequestID, string(card))
+	return err
+}
+
+func (s *SQL) Search(ctx context.Context, query domain.ReadQuery) ([]domain.StoredRead, error) {
+	var where []string
+	var args []interface{}
+	param := func(value interface{}) string {
+		args = append(args, value)
+		return s.dialect.placeholder(len(args))
+	}
+	if query.CitizenID != "" {
+		where = append(where, "(citizen_id = "+param(query.CitizenID)+" OR citizen_id_hash = "+param(query.CitizenID)+")")
+	}
+	if query.Reader != "" {
+		where = append(where, "reader = "+param(query.Reader))
+	}
+	if !query.From.IsZero() {
+		where = append(where, "read_at >= "+param(query.From.UnixMilli()))
+	}
+	if !query.To.IsZero() {
+		where = append(where, "read_at < "+param(query.To.UnixMilli()))
+	}
+
+	statement := `SELECT id, read_at, reader, reader_alias, citizen_id, citizen_id_hash, session_id, request_id, card
+		FROM card_reads`
+	if len(where) > 0 {
+		statement += " WHERE " + strings.Join(where, " AND ")
+	}
+	statement += " ORDER BY read_at DESC, id DESC"
+	if query.Limit > 0 {
+		statement += fmt.Sprintf(" LIMIT %d OFFSET %d", query.Limit, max(query.Offset, 0))
+	}
+
+	rows, err := s.db.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reads []domain.StoredRead
+	for rows.Next() {
+		var read domain.StoredRead
+		var readAt int64
+		var card []byte
+		if err := rows.Scan(&read.ID, &readAt, &read.Reader, &read.ReaderAlias, &read.CitizenID,
+			&read.CitizenIDHash, &read.SessionID, &read.RequestID, &card); err != nil {
+			return nil, err
+		}
+		read.ReadAt = time.UnixMilli(readAt)
+		if err := json.Unmarshal(card, &read.Card); err != nil {
+			return nil, fmt.Errorf("read %d: invalid card: %w", read.ID, err)
+		}
+		reads = append(reads, read)
+	}
+	return reads, rows.Err()
+}
+
+func (s *SQL) Close() error {
+	return s.db.Close()
+}
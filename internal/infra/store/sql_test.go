@@ -0,0 +1,81 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/config"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+)
+
+func TestSQLiteSaveSearch(t *testing.T) {
+	s, err := Open(config.StoreConfig{
+		Type: config.StoreSQLite,
+		DSN:  filepath.Join(t.TempDir(), "reads.db"),
+	})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close()
+
+	ctx := context.Background()
+	base := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+	reads := []struct {
+		cid    string
+		reader string
+		at     time.Time
+	}{
+		{"1101700203451", "counter-1", base},
+		{"3100602345678", "counter-2", base.Add(time.Minute)},
+		{"1101700203451", "counter-2", base.Add(2 * time.Minute)},
+	}
+	for _, r := range reads {
+		card := &domain.ThaiIdCard{Reader: r.reader, CitizenID: r.cid, FirstNameEN: "Somchai", PhotoBase64: "/9j/"}
+		if err := s.Save(ctx, domain.NewStoredRead(card, r.at)); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query domain.ReadQuery
+		want  []string
+	}{
+		{"all newest first", domain.ReadQuery{}, []string{"counter-2", "counter-2", "counter-1"}},
+		{"by citizen ID", domain.ReadQuery{CitizenID: "1101700203451"}, []string{"counter-2", "counter-1"}},
+		{"by reader", domain.ReadQuery{Reader: "counter-1"}, []string{"counter-1"}},
+		{"from is inclusive", domain.ReadQuery{From: base.Add(time.Minute)}, []string{"counter-2", "counter-2"}},
+		{"to is exclusive", domain.ReadQuery{To: base.Add(time.Minute)}, []string{"counter-1"}},
+		{"page", domain.ReadQuery{Limit: 1, Offset: 1}, []string{"counter-2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Search(ctx, tt.query)
+			if err != nil {
+				t.Fatalf("Search: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d reads, want %d", len(got), len(tt.want))
+			}
+			for i, read := range got {
+				if read.Reader != tt.want[i] {
+					t.Errorf("read %d: reader %q, want %q", i, read.Reader, tt.want[i])
+				}
+			}
+		})
+	}
+
+	got, err := s.Search(ctx, domain.ReadQuery{Limit: 1})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	read := got[0]
+	if read.ID == 0 || !read.ReadAt.Equal(base.Add(2*time.Minute)) || read.CitizenID != "1101700203451" {
+		t.Errorf("read = %+v", read)
+	}
+	if read.Card == nil || read.Card.FirstNameEN != "Somchai" || read.Card.PhotoBase64 != "" {
+		t.Errorf("card = %+v, want the card without its photo", read.Card)
+	}
+}
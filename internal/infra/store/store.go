@@ -0,0 +1,38 @@
+// Package store persists card reads in memory or in an SQL database, as
+// store.type selects.
+package store
+
+import (
+	"fmt"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/config"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+)
+
+// Open returns the store cfg selects, or nil when reads aren't stored.
+func Open(cfg config.StoreConfig) (domain.ReadStore, error) {
+	switch cfg.Type {
+	case config.StoreNone:
+		return nil, nil
+	case config.StoreMemory:
+		return NewMemory(cfg.MaxReads), nil
+	case config.StoreSQLite, config.StorePostgres:
+		d, driver := dialectSQLite, driverOr(cfg.Driver, "sqlite")
+		if cfg.Type == config.StorePostgres {
+			d, driver = dialectPostgres, driverOr(cfg.Driver, "pgx")
+		}
+		db, err := openSQL(d, driver, cfg.DSN)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	}
+	return nil, fmt.Errorf("unknown store type %q", cfg.Type)
+}
+
+func driverOr(driver, fallback string) string {
+	if driver == "" {
+		return fallback
+	}
+	return driver
+}
@@ -0,0 +1,144 @@
+// Package usb spots smart card readers on the USB bus that PC/SC can't see,
+// which usually means their driver isn't installed.
+package usb
+
+import (
+	"errors"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/config"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/crash"
+)
+
+// classSmartCard is the USB interface class of CCID smart card readers.
+const classSmartCard = "0B"
+
+var errUnsupported = errors.New("USB device enumeration is not supported on this platform")
+
+// Device is a USB device that looks like a smart card reader.
+type Device struct {
+	// Path identifies the device while it stays plugged in
+	Path string
+	// VendorID and ProductID are in upper-case hex, e.g. 072F and 90CC
+	VendorID     string
+	ProductID    string
+	Manufacturer string
+	Product      string
+	// SmartCardClass is set for CCID class devices
+	SmartCardClass bool
+	// DriverProblem is set when the OS reports that the device has no
+	// working driver (Windows)
+	DriverProblem bool
+}
+
+// ID is the device's VID:PID.
+func (d Device) ID() string {
+	return d.VendorID + ":" + d.ProductID
+}
+
+// Watcher periodically compares the USB smart card readers with the readers
+// PC/SC lists and reports each device PC/SC doesn't know, once per plug-in.
+type Watcher struct {
+	interval    time.Duration
+	devices     []string
+	listReaders func() ([]string, error)
+	onMissing   func(Device)
+	stop        chan struct{}
+}
+
+// NewWatcher creates a watcher. listReaders returns the PC/SC reader names;
+// an error counts as no readers, as when the PC/SC service isn't installed.
+func NewWatcher(cfg config.USBConfig, listReaders func() ([]string, error), onMissing func(Device)) *Watcher {
+	devices := make([]string, len(cfg.Devices))
+	for i, id := range cfg.Devices {
+		devices[i] = strings.ToUpper(id)
+	}
+	return &Watcher{
+		interval:    cfg.Interval,
+		devices:     devices,
+		listReaders: listReaders,
+		onMissing:   onMissing,
+		stop:        make(chan struct{}),
+	}
+}
+
+// Run watches until Stop is called.
+func (w *Watcher) Run() {
+	defer crash.Recover()
+
+	reported := make(map[string]bool)
+	lastErr := ""
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		all, err := enumerate()
+		if errors.Is(err, errUnsupported) {
+			log.Printf("Warning: %v, USB reader watch disabled", err)
+			return
+		}
+		// Log a failure once rather than every interval, e.g. in containers
+		// without /sys/bus/usb
+		if err != nil && err.Error() != lastErr {
+			log.Printf("Failed to list USB devices: %v", err)
+		}
+		lastErr = ""
+		if err != nil {
+			lastErr = err.Error()
+		}
+
+		readers, _ := w.listReaders()
+		present := make(map[string]bool)
+		for _, device := range all {
+			if !device.SmartCardClass && !slices.Contains(w.devices, device.ID()) {
+				continue
+			}
+			present[device.Path] = true
+			if reported[device.Path] || servedBy(readers, device) {
+				continue
+			}
+			reported[device.Path] = true
+			log.Printf("Reader %s (%s %s) is connected but PC/SC doesn't list it; its driver may be missing", device.ID(), device.Manufacturer, device.Product)
+			w.onMissing(device)
+		}
+
+		// Report a device again once it has been unplugged
+		for path := range reported {
+			if !present[path] {
+				delete(reported, path)
+			}
+		}
+
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Watcher) Stop() {
+	close(w.stop)
+}
+
+// servedBy reports whether one of the PC/SC readers is the device. PC/SC
+// reader names contain the USB product name, e.g. "ACS ACR39U ICC Reader 00
+// 00" for "ACR39U ICC Reader"; without a product name any reader counts.
+func servedBy(readers []string, device Device) bool {
+	if device.DriverProblem {
+		return false
+	}
+	if device.Product == "" {
+		return len(readers) > 0
+	}
+	product := strings.ToLower(device.Product)
+	for _, reader := range readers {
+		if strings.Contains(strings.ToLower(reader), product) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+//go:build linux
+
+package usb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const sysfsDevices = "/sys/bus/usb/devices"
+
+// enumerate lists USB devices from sysfs, which needs no libusb or
+// permissions beyond reading /sys.
+func enumerate() ([]Device, error) {
+	entries, err := os.ReadDir(sysfsDevices)
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []Device
+	for _, entry := range entries {
+		dir := filepath.Join(sysfsDevices, entry.Name())
+		vendor := sysfsValue(dir, "idVendor")
+		// Interfaces (1-1:1.0) and root hubs' interfaces have no IDs
+		if vendor == "" {
+			continue
+		}
+
+		device := Device{
+			Path:         entry.Name(),
+			VendorID:     strings.ToUpper(vendor),
+			ProductID:    strings.ToUpper(sysfsValue(dir, "idProduct")),
+			Manufacturer: sysfsValue(dir, "manufacturer"),
+			Product:      sysfsValue(dir, "product"),
+		}
+		interfaces, _ := filepath.Glob(filepath.Join(dir, entry.Name()+":*"))
+		for _, iface := range interfaces {
+			if strings.EqualFold(sysfsValue(iface, "bInterfaceClass"), classSmartCard) {
+				device.SmartCardClass = true
+			}
+		}
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+func sysfsValue(dir, name string) string {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
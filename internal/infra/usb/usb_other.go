@@ -0,0 +1,9 @@
+//go:build !linux && !windows
+
+package usb
+
+// enumerate isn't implemented on macOS, whose built-in CCID driver covers
+// nearly all readers.
+func enumerate() ([]Device, error) {
+	return nil, errUnsupported
+}
@@ -0,0 +1,84 @@
+//go:build windows
+
+package usb
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// devpkeyBusReportedDeviceDesc is DEVPKEY_Device_BusReportedDeviceDesc, the
+// product string the device reports over USB.
+var devpkeyBusReportedDeviceDesc = windows.DEVPROPKEY{
+	FmtID: windows.DEVPROPGUID{Data1: 0x540b947e, Data2: 0x8b40, Data3: 0x45bc, Data4: [8]byte{0xa8, 0xa2, 0x6a, 0x0b, 0x89, 0x4c, 0xbd, 0xa2}},
+	PID:   4,
+}
+
+// Hardware IDs look like USB\VID_072F&PID_90CC&REV_0100
+var hardwareIDPattern = regexp.MustCompile(`(?i)VID_([0-9A-F]{4})&PID_([0-9A-F]{4})`)
+
+// enumerate lists present USB devices through SetupAPI. A device whose
+// driver isn't installed is listed with a problem code (28), which is
+// reported as DriverProblem.
+func enumerate() ([]Device, error) {
+	set, err := windows.SetupDiGetClassDevsEx(nil, "USB", 0, windows.DIGCF_PRESENT|windows.DIGCF_ALLCLASSES, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	defer set.Close()
+
+	var devices []Device
+	for i := 0; ; i++ {
+		data, err := set.EnumDeviceInfo(i)
+		if errors.Is(err, windows.ERROR_NO_MORE_ITEMS) {
+			break
+		}
+		if err != nil {
+			continue
+		}
+
+		match := hardwareIDPattern.FindStringSubmatch(strings.Join(registryStrings(set, data, windows.SPDRP_HARDWAREID), " "))
+		if match == nil {
+			continue
+		}
+		device := Device{
+			VendorID:     strings.ToUpper(match[1]),
+			ProductID:    strings.ToUpper(match[2]),
+			Manufacturer: strings.Join(registryStrings(set, data, windows.SPDRP_MFG), " "),
+		}
+		device.Path, _ = set.DeviceInstanceID(data)
+		if product, err := windows.SetupDiGetDeviceProperty(set, data, &devpkeyBusReportedDeviceDesc); err == nil {
+			device.Product, _ = product.(string)
+		}
+		for _, id := range registryStrings(set, data, windows.SPDRP_COMPATIBLEIDS) {
+			if strings.EqualFold(id, `USB\Class_`+classSmartCard) {
+				device.SmartCardClass = true
+			}
+		}
+
+		var status, problem uint32
+		if err := windows.CM_Get_DevNode_Status(&status, &problem, data.DevInst, 0); err == nil {
+			device.DriverProblem = status&windows.DN_HAS_PROBLEM != 0
+		}
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+// registryStrings returns a string or multi-string device property.
+func registryStrings(set windows.DevInfo, data *windows.DevInfoData, property windows.SPDRP) []string {
+	value, err := set.DeviceRegistryProperty(data, property)
+	if err != nil {
+		return nil
+	}
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// pendingAck is a critical event waiting for the client's ACK.
+type pendingAck struct {
+	message  outboundMessage
+	attempts int
+	due      time.Time
+}
+
+// AckStats summarises acknowledgement tracking across ack-mode clients.
+type AckStats struct {
+	Pending     int    `json:"pending"`
+	Retransmits uint64 `json:"retransmits"`
+	Expired     uint64 `json:"expired"`
+}
+
+// AckStats returns the current acknowledgement counters.
+func (h *Hub) AckStats() AckStats {
+	stats := AckStats{
+		Retransmits: h.ackRetransmits.Load(),
+		Expired:     h.ackExpired.Load(),
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for client := range h.clients {
+		client.ackMu.Lock()
+		stats.Pending += len(client.pending)
+		client.ackMu.Unlock()
+	}
+	return stats
+}
+
+// track starts waiting for an ACK if the client is in ack mode and the
+// message is a critical event.
+func (h *Hub) track(client *Client, message outboundMessage) {
+	if !client.ack || !h.ackEvents[message.typ] {
+		return
+	}
+
+	client.ackMu.Lock()
+	defer client.ackMu.Unlock()
+	if _, ok := client.pending[message.seq]; ok {
+		return
+	}
+	client.pending[message.seq] = &pendingAck{
+		message:  message,
+		attempts: 1,
+		due:      time.Now().Add(h.ackTimeout),
+	}
+}
+
+// retransmit resends unacknowledged events that are past due and gives up on
+// those that ran out of attempts. It runs on the Run goroutine.
+func (h *Hub) retransmit() {
+	h.mu.RLock()
+	clients := make([]*Client, 0, len(h.clients))
+	for client := range h.clients {
+		if client.ack {
+			clients = append(clients, client)
+		}
+	}
+	h.mu.RUnlock()
+
+	now := time.Now()
+	for _, client := range clients {
+		client.ackMu.Lock()
+		for seq, pending := range client.pending {
+			if now.Before(pending.due) {
+				continue
+			}
+
+			if h.stale(pending.message) {
+				// Resending would only act on outdated card state
+				delete(client.pending, seq)
+				client.dropStale()
+				continue
+			}
+			if pending.attempts > h.ackRetries {
+				delete(client.pending, seq)
+				h.ackExpired.Add(1)
+				log.Printf("Event %d was never acknowledged after %d attempts", seq, pending.attempts)
+				continue
+			}
+
+			pending.attempts++
+			pending.due = now.Add(h.ackTimeout)
+			if !client.reserve(len(pending.message.data)) {
+				continue
+			}
+			select {
+			case client.send <- pending.message:
+				h.ackRetransmits.Add(1)
+			default:
+				client.queuedBytes.Add(-int64(len(pending.message.data)))
+				client.overflow()
+			}
+		}
+		client.ackMu.Unlock()
+	}
+}
+
+// ackCommand handles ACK, marking an event as received by the client.
+func (h *Hub) ackCommand(client *Client, payload json.RawMessage) error {
+	var req seqRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return fmt.Errorf("invalid payload")
+	}
+
+	client.ackMu.Lock()
+	defer client.ackMu.Unlock()
+	delete(client.pending, req.Seq)
+	return nil
+}
@@ -0,0 +1,182 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+)
+
+// helloRequest is the payload of HELLO, identifying the client application.
+type helloRequest struct {
+	Name        string                   `json:"name"`
+	Version     string                   `json:"version"`
+	Preferences domain.ClientPreferences `json:"preferences"`
+}
+
+// welcomeResponse is the reply to HELLO.
+type welcomeResponse struct {
+	ClientID uint64 `json:"clientId"`
+	Seq      uint64 `json:"seq"`
+}
+
+// departedClients is how many recently disconnected clients are kept for
+// the admin clients listing.
+const departedClients = 20
+
+// ClientInfo describes a connected client for the admin clients listing.
+// Dropped counts the messages the client never got, because its send buffer
+// was full (BufferFull) or they went stale in its backlog (StaleDropped).
+type ClientInfo struct {
+	ID           uint64    `json:"id"`
+	Name         string    `json:"name,omitempty"`
+	Version      string    `json:"version,omitempty"`
+	RemoteAddr   string    `json:"remoteAddr"`
+	Transport    string    `json:"transport"`
+	Protocol     string    `json:"protocol,omitempty"`
+	Reader       string    `json:"reader,omitempty"`
+	Ack          bool      `json:"ack"`
+	ConnectedAt  time.Time `json:"connectedAt"`
+	QueuedBytes  int64     `json:"queuedBytes"`
+	Dropped      uint64    `json:"dropped"`
+	BufferFull   uint64    `json:"bufferFull"`
+	StaleDropped uint64    `json:"staleDropped"`
+	WriteErrors  uint64    `json:"writeErrors"`
+
+	// DisconnectedAt and DisconnectReason are only set for clients that
+	// have disconnected
+	DisconnectedAt   *time.Time `json:"disconnectedAt,omitempty"`
+	DisconnectReason string     `json:"disconnectReason,omitempty"`
+
+	Preferences domain.ClientPreferences `json:"preferences"`
+}
+
+// Clients lists the connected clients ordered by ID.
+func (h *Hub) Clients() []ClientInfo {
+	h.mu.RLock()
+	clients := make([]ClientInfo, 0, len(h.clients))
+	for client := range h.clients {
+		clients = append(clients, client.Info())
+	}
+	h.mu.RUnlock()
+
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].ID < clients[j].ID
+	})
+	return clients
+}
+
+// DisconnectedClients lists the most recently disconnected clients, oldest
+// first, with their delivery counters when they left, so a client that was
+// dropped for being too slow can be told apart from one that went away.
+func (h *Hub) DisconnectedClients() []ClientInfo {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return slices.Clone(h.departed)
+}
+
+// depart keeps the final state of client for DisconnectedClients. The caller
+// holds h.mu.
+func (h *Hub) depart(client *Client) {
+	info := client.Info()
+	now := time.Now()
+	info.DisconnectedAt = &now
+	info.DisconnectReason = "closed"
+	client.mu.Lock()
+	if client.closeReason != "" {
+		info.DisconnectReason = client.closeReason
+	}
+	client.mu.Unlock()
+
+	if len(h.departed) >= departedClients {
+		h.departed = slices.Delete(h.departed, 0, len(h.departed)-departedClients+1)
+	}
+	h.departed = append(h.departed, info)
+}
+
+// Info returns the client's identity and delivery state.
+func (c *Client) Info() ClientInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	transport := "websocket"
+	if c.conn == nil {
+		transport = "sse"
+	}
+
+	return ClientInfo{
+		ID:           c.id,
+		Name:         c.name,
+		Version:      c.version,
+		RemoteAddr:   c.remoteAddr,
+		Transport:    transport,
+		Protocol:     c.protocol,
+		Reader:       c.reader,
+		Ack:          c.ack,
+		ConnectedAt:  c.connectedAt,
+		QueuedBytes:  c.queuedBytes.Load(),
+		Dropped:      c.dropped.Load(),
+		BufferFull:   c.bufferFull.Load(),
+		StaleDropped: c.staleDropped.Load(),
+		WriteErrors:  c.writeErrors.Load(),
+		Preferences:  c.prefs,
+	}
+}
+
+// String identifies the client in logs, e.g. "#3 his-frontend/1.2.0 (10.0.0.5:51234)".
+func (c *Client) String() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.name == "" {
+		return fmt.Sprintf("#%d (%s)", c.id, c.remoteAddr)
+	}
+	return fmt.Sprintf("#%d %s/%s (%s)", c.id, c.name, c.version, c.remoteAddr)
+}
+
+// helloCommand handles HELLO, recording which application is connected.
+func (h *Hub) helloCommand(client *Client, payload json.RawMessage) error {
+	var req helloRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return fmt.Errorf("invalid payload")
+	}
+	if req.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if err := req.Preferences.Validate(); err != nil {
+		return err
+	}
+
+	client.mu.Lock()
+	client.name = req.Name
+	client.version = req.Version
+	if req.Preferences.Naming == "" {
+		// Keep the convention chosen when connecting
+		req.Preferences.Naming = client.prefs.Naming
+	}
+	client.prefs = req.Preferences
+	client.mu.Unlock()
+	client.identified.Store(true)
+
+	log.Printf("Client %s identified", client)
+
+	return client.SendMessage("WELCOME", welcomeResponse{
+		ClientID: client.id,
+		Seq:      h.seq.Load(),
+	})
+}
+
+// expectHello disconnects a WebSocket client that hasn't sent HELLO within
+// the configured timeout.
+func (h *Hub) expectHello(client *Client) {
+	time.AfterFunc(h.helloTimeout, func() {
+		if !client.identified.Load() {
+			log.Printf("Client %s did not send HELLO, disconnecting", client)
+			client.disconnect("no HELLO")
+		}
+	})
+}
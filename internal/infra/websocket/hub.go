@@ -2,103 +2,566 @@ package websocket
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/cortex-x/go-thai-id-card-reader/internal/config"
 	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/logging"
 	"github.com/gorilla/websocket"
 )
 
+// ErrQueueFull is returned by broadcasts while the outbound queue is full.
+var ErrQueueFull = errors.New("broadcast queue is full")
+
+// Client is a WebSocket connection, or an SSE stream when conn is nil.
 type Client struct {
+	id     uint64
 	conn   *websocket.Conn
-	send   chan []byte
+	send   chan outboundMessage
 	hub    *Hub
+	reader string
 	closed bool
 	mu     sync.Mutex
+
+	// queuedBytes is the size of messages waiting in send
+	queuedBytes atomic.Int64
+	// sequence numbers the messages queued when the envelope carries
+	// domain.EnvelopeSequence; sendMu keeps them in queue order
+	sequence atomic.Uint64
+	sendMu   sync.Mutex
+	// dropped counts messages the client never got; bufferFull, stale and
+	// writeErrors count why
+	dropped      atomic.Uint64
+	bufferFull   atomic.Uint64
+	staleDropped atomic.Uint64
+	writeErrors  atomic.Uint64
+	// closeReason tells why the client was disconnected, shown in the
+	// listing of recently disconnected clients
+	closeReason string
+
+	// replay and since request missed events when the client registers
+	replay bool
+	since  uint64
+
+	// remoteAddr, name and version identify the client in listings and logs;
+	// name and version come from HELLO
+	remoteAddr  string
+	connectedAt time.Time
+	name        string
+	version     string
+	identified  atomic.Bool
+	prefs       domain.ClientPreferences
+	// protocol is the negotiated subprotocol, empty for ProtocolV1
+	protocol string
+	// encode replaces the envelope for clients of another agent's format
+	encode Encoder
+
+	// ack clients must acknowledge critical events, which are resent
+	// until they do
+	ack     bool
+	ackMu   sync.Mutex
+	pending map[uint64]*pendingAck
+}
+
+// ClientOptions are the per-connection settings given when a client connects.
+type ClientOptions struct {
+	// Reader limits the client to one reader's events plus reader-independent ones
+	Reader string
+	// Replay sends buffered events with a sequence number above Since
+	// before live events
+	Replay bool
+	Since  uint64
+	// Ack makes the client acknowledge critical events with ACK
+	Ack bool
+	// RemoteAddr is the client's network address, for listings and logs
+	RemoteAddr string
+	// Protocol is the subprotocol negotiated for the connection
+	Protocol string
+	// Encode, when set, encodes messages for the client in place of the
+	// envelope; such clients can't send HELLO so don't have to
+	Encode Encoder
+	// Preferences are the client's initial preferences, until HELLO
+	// replaces them
+	Preferences domain.ClientPreferences
 }
 
+// Encoder encodes a message for a client, returning false to skip it.
+type Encoder func(messageType string, payload interface{}) ([]byte, bool)
+
+// outboundMessage is an encoded message and the reader it concerns, if any.
+type outboundMessage struct {
+	seq     uint64
+	typ     string
+	reader  string
+	session string
+	// id and key are the event ID and idempotency key of a broadcast
+	id      string
+	key     string
+	at      time.Time
+	payload interface{}
+	data    []byte
+}
+
+// Renderer adapts a broadcast payload to a client's preferences. A nil
+// payload means the message is sent as is; returning false skips the message
+// for that client.
+type Renderer func(prefs domain.ClientPreferences, messageType string, payload interface{}) (interface{}, bool)
+
+// resumeRequest asks the Run goroutine to replay events after since.
+type resumeRequest struct {
+	client *Client
+	since  uint64
+}
+
+// seqRequest is the payload of commands that refer to an event.
+type seqRequest struct {
+	Seq uint64 `json:"seq"`
+}
+
+// CommandHandler handles a command sent by a client. A returned error is
+// reported back to that client as COMMAND_ERROR.
+type CommandHandler func(client *Client, payload json.RawMessage) error
+
 type Hub struct {
-	clients    map[*Client]bool
-	broadcast  chan []byte
+	clients  map[*Client]bool
+	commands map[string]CommandHandler
+	// maxClientBytes caps the bytes queued for a single client
+	maxClientBytes int64
+	dropped        atomic.Uint64
+	// overflows counts broadcasts refused because the queue was full
+	overflows atomic.Uint64
+	// eventTTL is how long events of a type may wait before they're dropped
+	// as stale; staleDropped counts them
+	eventTTL     map[string]time.Duration
+	staleDropped atomic.Uint64
+	seq          atomic.Uint64
+	nextClientID atomic.Uint64
+	renderer     Renderer
+	// sessionOf returns the ID of the session a reader's events belong to
+	sessionOf func(reader string) string
+	// idempotencyKey returns the idempotency key of a broadcast, if any
+	idempotencyKey func(reader, messageType string, payload interface{}) string
+	// blocked holds quarantined client IPs
+	blocked   map[string]bool
+	blockedMu sync.RWMutex
+	// requireHello withholds broadcasts from WebSocket clients until they
+	// send HELLO, and disconnects them after helloTimeout
+	requireHello bool
+	helloTimeout time.Duration
+	// naming is the payload key convention for clients that don't choose one
+	naming string
+	// metadata holds the domain.EnvelopeMetadata added to every envelope;
+	// agentID and aliasOf fill them in
+	metadata map[string]bool
+	agentID  string
+	aliasOf  func(reader string) string
+	// publishMu keeps sequence numbers in delivery order
+	publishMu sync.Mutex
+	// history holds the most recent broadcasts, oldest first
+	history     []outboundMessage
+	historySize int
+	// broadcast is the bounded queue of messages waiting for Run, so
+	// broadcasting never waits on clients
+	broadcast  chan outboundMessage
 	register   chan *Client
 	unregister chan *Client
-	mu         sync.RWMutex
+	resume     chan resumeRequest
+	forget     chan string
+	// ackEvents are the event types ack-mode clients must acknowledge
+	ackEvents      map[string]bool
+	ackTimeout     time.Duration
+	ackRetries     int
+	ackRetransmits atomic.Uint64
+	ackExpired     atomic.Uint64
+	// departed holds the final state of recently disconnected clients,
+	// oldest first
+	departed []ClientInfo
+	mu       sync.RWMutex
 }
 
-func NewHub() *Hub {
-	return &Hub{
-		clients:    make(map[*Client]bool),
-		broadcast:  make(chan []byte),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
+func NewHub(cfg *config.Config) *Hub {
+	h := &Hub{
+		clients:        make(map[*Client]bool),
+		commands:       make(map[string]CommandHandler),
+		maxClientBytes: cfg.Server.MaxClientBufferBytes,
+		historySize:    cfg.Server.EventBuffer,
+		broadcast:      make(chan outboundMessage, max(cfg.Server.BroadcastQueue, 1)),
+		register:       make(chan *Client),
+		unregister:     make(chan *Client),
+		resume:         make(chan resumeRequest),
+		forget:         make(chan string),
+		ackEvents:      make(map[string]bool),
+		eventTTL:       make(map[string]time.Duration),
+		ackTimeout:     cfg.Server.AckTimeout,
+		ackRetries:     cfg.Server.AckRetries,
+		requireHello:   cfg.Server.RequireHello,
+		helloTimeout:   cfg.Server.HelloTimeout,
+		naming:         cfg.Server.JSONNaming,
+		blocked:        make(map[string]bool),
+		metadata:       make(map[string]bool),
+		aliasOf:        cfg.Readers.AliasFor,
+	}
+	for _, field := range cfg.Server.EnvelopeMetadata {
+		h.metadata[field] = true
+	}
+	if h.metadata[domain.EnvelopeAgentID] {
+		h.agentID = cfg.Heartbeat.ResolveAgentID()
 	}
+	for _, eventType := range cfg.Server.AckEvents {
+		h.ackEvents[eventType] = true
+	}
+	for _, ttl := range cfg.Server.EventTTL {
+		h.eventTTL[ttl.Type] = ttl.TTL
+	}
+	h.commands["SINCE"] = h.sinceCommand
+	h.commands["ACK"] = h.ackCommand
+	h.commands["HELLO"] = h.helloCommand
+	return h
 }
 
 func (h *Hub) Run() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
 	for {
 		select {
+		case <-ticker.C:
+			h.retransmit()
+
 		case client := <-h.register:
 			h.mu.Lock()
 			h.clients[client] = true
 			h.mu.Unlock()
-			log.Printf("Client registered. Total clients: %d", len(h.clients))
+			log.Printf("Client %s registered. Total clients: %d", client, len(h.clients))
 
-		case client := <-h.unregister:
-			h.mu.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
-				h.mu.Unlock()
-				log.Printf("Client unregistered. Total clients: %d", len(h.clients))
-			} else {
-				h.mu.Unlock()
+			if client.replay {
+				h.replay(client, client.since)
 			}
 
-		case message := <-h.broadcast:
-			h.mu.RLock()
-			clients := make([]*Client, 0, len(h.clients))
-			for client := range h.clients {
-				clients = append(clients, client)
+		case req := <-h.resume:
+			h.replay(req.client, req.since)
+
+		case reader := <-h.forget:
+			// Deliver what was broadcast before Forget first, so it's
+			// forgotten too
+			for len(h.broadcast) > 0 {
+				h.deliver(<-h.broadcast)
 			}
-			h.mu.RUnlock()
-
-			for _, client := range clients {
-				select {
-				case client.send <- message:
-				default:
-					// Client's send channel is full, close it
-					h.unregisterClient(client)
-				}
+			h.forgetReader(reader)
+
+		case client := <-h.unregister:
+			h.removeClient(client)
+
+		case message := <-h.broadcast:
+			h.deliver(message)
+		}
+	}
+}
+
+// deliver queues a broadcast for each client that wants it. It runs on the
+// Run goroutine.
+func (h *Hub) deliver(message outboundMessage) {
+	h.remember(message)
+
+	h.mu.RLock()
+	clients := make([]*Client, 0, len(h.clients))
+	for client := range h.clients {
+		clients = append(clients, client)
+	}
+	h.mu.RUnlock()
+
+	for _, client := range clients {
+		if client.wants(message) {
+			h.deliverTo(client, message)
+		}
+	}
+}
+
+// deliverTo queues a broadcast for client. It runs on the Run goroutine.
+func (h *Hub) deliverTo(client *Client, message outboundMessage) {
+	client.sendMu.Lock()
+	defer client.sendMu.Unlock()
+
+	message, ok := client.render(message)
+	if !ok {
+		return
+	}
+
+	if !client.reserve(len(message.data)) {
+		h.dropped.Add(1)
+		log.Printf("Dropped message for slow client %s: %d bytes already queued", client, client.queuedBytes.Load())
+		return
+	}
+
+	select {
+	case client.send <- message:
+		h.track(client, message)
+	default:
+		client.queuedBytes.Add(-int64(len(message.data)))
+		client.overflow()
+		// Client's send channel is full, close it. Run can't go through
+		// unregister, which it receives from itself
+		client.mu.Lock()
+		client.closed = true
+		client.setCloseReason("send buffer full")
+		client.mu.Unlock()
+		h.removeClient(client)
+	}
+}
+
+// removeClient drops client and closes its send channel, which ends its
+// write pump. It runs on the Run goroutine.
+func (h *Hub) removeClient(client *Client) {
+	h.mu.Lock()
+	if _, ok := h.clients[client]; !ok {
+		h.mu.Unlock()
+		return
+	}
+	delete(h.clients, client)
+	close(client.send)
+	h.depart(client)
+	h.mu.Unlock()
+	log.Printf("Client %s unregistered. Total clients: %d", client, len(h.clients))
+}
+
+// remember keeps message in the replay history, evicting the oldest event
+// once the buffer is full.
+func (h *Hub) remember(message outboundMessage) {
+	if h.historySize <= 0 {
+		return
+	}
+	if len(h.history) >= h.historySize {
+		copy(h.history, h.history[1:])
+		h.history = h.history[:len(h.history)-1]
+	}
+	h.history = append(h.history, message)
+}
+
+// Forget drops the buffered and unacknowledged events of reader, so card
+// data is no longer replayed or resent once a kiosk has cleared it.
+func (h *Hub) Forget(reader string) {
+	h.forget <- reader
+}
+
+// forgetReader runs on the Run goroutine, which owns the history.
+func (h *Hub) forgetReader(reader string) {
+	h.history = slices.DeleteFunc(h.history, func(message outboundMessage) bool {
+		return message.reader == reader
+	})
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for client := range h.clients {
+		client.ackMu.Lock()
+		for seq, pending := range client.pending {
+			if pending.message.reader == reader {
+				delete(client.pending, seq)
 			}
 		}
+		client.ackMu.Unlock()
 	}
 }
 
+// replay queues the buffered events after since. It runs on the Run
+// goroutine, so no live event can be delivered in between.
+func (h *Hub) replay(client *Client, since uint64) {
+	client.sendMu.Lock()
+	defer client.sendMu.Unlock()
+
+	replayed, stale := 0, 0
+	for _, message := range h.history {
+		if message.seq <= since || !client.wants(message) {
+			continue
+		}
+		if h.stale(message) {
+			stale++
+			continue
+		}
+		message, ok := client.render(message)
+		if !ok {
+			continue
+		}
+		if !client.reserve(len(message.data)) {
+			break
+		}
+		select {
+		case client.send <- message:
+			h.track(client, message)
+			replayed++
+		default:
+			client.queuedBytes.Add(-int64(len(message.data)))
+			client.overflow()
+			log.Printf("Replay stopped after %d events: client buffer full", replayed)
+			return
+		}
+	}
+	if replayed > 0 {
+		log.Printf("Replayed %d missed events since seq %d", replayed, since)
+	}
+	if stale > 0 {
+		h.staleDropped.Add(uint64(stale))
+		client.staleDropped.Add(uint64(stale))
+		client.dropped.Add(uint64(stale))
+		log.Printf("Skipped %d stale events in replay since seq %d", stale, since)
+	}
+}
+
+// stale reports whether message is older than the TTL of its type. Replies
+// to one client have no type and never go stale.
+func (h *Hub) stale(message outboundMessage) bool {
+	ttl, ok := h.eventTTL[message.typ]
+	return ok && time.Since(message.at) > ttl
+}
+
+// StaleDropped returns how many events were dropped for being older than
+// their TTL.
+func (h *Hub) StaleDropped() uint64 {
+	return h.staleDropped.Load()
+}
+
+// DroppedMessages returns how many messages were dropped because a client's
+// buffer was over the byte limit.
+func (h *Hub) DroppedMessages() uint64 {
+	return h.dropped.Load()
+}
+
+// QueueOverflows returns how many broadcasts failed with ErrQueueFull.
+func (h *Hub) QueueOverflows() uint64 {
+	return h.overflows.Load()
+}
+
+// QueuedBroadcasts returns how many broadcasts are waiting for delivery.
+func (h *Hub) QueuedBroadcasts() int {
+	return len(h.broadcast)
+}
+
+// ClientCount returns the number of connected clients.
+func (h *Hub) ClientCount() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients)
+}
+
 func (h *Hub) BroadcastMessage(messageType string, payload interface{}) error {
+	return h.BroadcastReaderMessage("", messageType, payload)
+}
+
+// BroadcastReaderMessage sends a message about a specific reader to all
+// clients except those subscribed to a different reader. It queues the
+// message and returns without waiting for delivery, failing with
+// ErrQueueFull rather than blocking when the queue is full.
+func (h *Hub) BroadcastReaderMessage(reader string, messageType string, payload interface{}) error {
+	h.publishMu.Lock()
+	defer h.publishMu.Unlock()
+
+	at := time.Now()
 	msg := domain.WebSocketMessage{
+		Seq:     h.seq.Load() + 1,
 		Type:    messageType,
+		EventID: domain.NewEventID(),
 		Payload: payload,
 	}
+	h.annotate(&msg, reader, at)
+	if h.sessionOf != nil {
+		msg.SessionID = h.sessionOf(reader)
+	}
+	if h.idempotencyKey != nil {
+		msg.IdempotencyKey = h.idempotencyKey(reader, messageType, payload)
+	}
 
 	data, err := json.Marshal(msg)
 	if err != nil {
 		return err
 	}
 
-	h.broadcast <- data
-	return nil
+	select {
+	case h.broadcast <- outboundMessage{seq: msg.Seq, typ: messageType, reader: reader, session: msg.SessionID, id: msg.EventID, key: msg.IdempotencyKey, at: at, payload: payload, data: data}:
+		h.seq.Store(msg.Seq)
+		return nil
+	default:
+		// The seq isn't used, so clients see no gap
+		h.overflows.Add(1)
+		return ErrQueueFull
+	}
 }
 
-func (h *Hub) RegisterClient(conn *websocket.Conn) *Client {
+// SetRenderer sets how broadcasts are adapted to each client's preferences.
+// It must be set before the hub starts accepting clients.
+func (h *Hub) SetRenderer(renderer Renderer) {
+	h.renderer = renderer
+}
+
+// SetSessionLookup sets how broadcasts find the session their reader is in,
+// which is sent in the envelope. It must be set before the first broadcast.
+func (h *Hub) SetSessionLookup(sessionOf func(reader string) string) {
+	h.sessionOf = sessionOf
+}
+
+// SetIdempotencyKeys sets how broadcasts get the idempotency key sent in the
+// envelope. It must be set before the first broadcast.
+func (h *Hub) SetIdempotencyKeys(keyOf func(reader, messageType string, payload interface{}) string) {
+	h.idempotencyKey = keyOf
+}
+
+// HandleCommand registers the handler for a client command type. Handlers
+// must be registered before the hub starts accepting clients.
+func (h *Hub) HandleCommand(commandType string, handler CommandHandler) {
+	h.commands[commandType] = handler
+}
+
+// RegisterClient adds a connection to the hub with the given options.
+func (h *Hub) RegisterClient(conn *websocket.Conn, opts ClientOptions) *Client {
 	client := &Client{
-		conn: conn,
-		send: make(chan []byte, 256),
-		hub:  h,
+		conn:    conn,
+		send:    make(chan outboundMessage, 256),
+		hub:     h,
+		reader:  opts.Reader,
+		replay:  opts.Replay,
+		since:   opts.Since,
+		ack:     opts.Ack,
+		pending: make(map[uint64]*pendingAck),
+
+		id:          h.nextClientID.Add(1),
+		remoteAddr:  opts.RemoteAddr,
+		connectedAt: time.Now(),
+		protocol:    opts.Protocol,
+		encode:      opts.Encode,
+		prefs:       opts.Preferences,
+	}
+	if opts.Encode != nil {
+		client.identified.Store(true)
 	}
 	h.register <- client
+
+	if h.requireHello && conn != nil && opts.Encode == nil {
+		h.expectHello(client)
+	}
 	return client
 }
 
+// RegisterStream adds a client without a WebSocket connection, such as a
+// Server-Sent Events stream. The caller reads Messages and calls Close.
+func (h *Hub) RegisterStream(opts ClientOptions) *Client {
+	return h.RegisterClient(nil, opts)
+}
+
+// sinceCommand handles SINCE, replaying buffered events after the given seq.
+func (h *Hub) sinceCommand(client *Client, payload json.RawMessage) error {
+	var req seqRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return fmt.Errorf("invalid payload")
+	}
+
+	h.resume <- resumeRequest{client: client, since: req.Seq}
+	return nil
+}
+
 func (h *Hub) unregisterClient(client *Client) {
 	client.mu.Lock()
 	if !client.closed {
@@ -110,39 +573,330 @@ func (h *Hub) unregisterClient(client *Client) {
 	}
 }
 
+// wants reports whether message is for this client. Clients subscribed to one
+// reader only get that reader's events.
+func (c *Client) wants(message outboundMessage) bool {
+	if c.hub.requireHello && c.conn != nil && !c.identified.Load() {
+		return false
+	}
+	return c.reader == "" || message.reader == "" || c.reader == message.reader
+}
+
+// render returns the message as this client should receive it, in its
+// protocol's envelope.
+func (c *Client) render(message outboundMessage) (outboundMessage, bool) {
+	payload := message.payload
+	rendered := false
+	if c.hub.renderer != nil && message.payload != nil {
+		c.mu.Lock()
+		prefs := c.prefs
+		c.mu.Unlock()
+
+		adapted, ok := c.hub.renderer(prefs, message.typ, message.payload)
+		if !ok {
+			return message, false
+		}
+		if adapted != nil {
+			payload = adapted
+			rendered = true
+		}
+	}
+
+	if c.encode != nil {
+		data, ok := c.encode(message.typ, payload)
+		message.data = data
+		return message, ok
+	}
+
+	if naming := c.naming(); naming != "" && payload != nil {
+		renamed, err := renameKeys(payload, naming)
+		if err != nil {
+			log.Printf("Failed to render %s for client %s: %v", message.typ, c, err)
+			return message, false
+		}
+		payload = renamed
+		rendered = true
+	}
+
+	// The broadcast was encoded once in the v1 envelope, which only lacks
+	// numbering per connection
+	if !rendered && c.protocol != domain.ProtocolV2 && !c.hub.metadata[domain.EnvelopeSequence] {
+		return message, true
+	}
+
+	msg := c.envelope(message.seq, message.typ, message.reader, message.at, payload)
+	msg.SessionID = message.session
+	msg.EventID = message.id
+	msg.IdempotencyKey = message.key
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Failed to render %s for client %s: %v", message.typ, c, err)
+		return message, false
+	}
+
+	message.data = data
+	return message, true
+}
+
+// envelope wraps a payload in the client's protocol version.
+func (c *Client) envelope(seq uint64, messageType, reader string, at time.Time, payload interface{}) domain.WebSocketMessage {
+	msg := domain.WebSocketMessage{
+		Seq:     seq,
+		Type:    messageType,
+		Payload: payload,
+	}
+	if c.protocol == domain.ProtocolV2 {
+		msg.Timestamp = at.Format(time.RFC3339Nano)
+		msg.Reader = reader
+	}
+	c.hub.annotate(&msg, reader, at)
+	if c.hub.metadata[domain.EnvelopeSequence] {
+		msg.Sequence = c.sequence.Add(1)
+	}
+	return msg
+}
+
+// annotate adds the envelope metadata that is the same for every client.
+func (h *Hub) annotate(msg *domain.WebSocketMessage, reader string, at time.Time) {
+	if h.metadata[domain.EnvelopeTimestamp] {
+		msg.Timestamp = at.Format(time.RFC3339Nano)
+	}
+	msg.AgentID = h.agentID
+	if h.metadata[domain.EnvelopeReaderName] && reader != "" {
+		msg.ReaderName = reader
+		if alias := h.aliasOf(reader); alias != "" {
+			msg.ReaderName = alias
+		}
+	}
+}
+
+// naming returns the payload key convention the client asked for, or the
+// hub's default.
+func (c *Client) naming() string {
+	c.mu.Lock()
+	naming := c.prefs.Naming
+	c.mu.Unlock()
+	if naming == "" {
+		return c.hub.naming
+	}
+	return naming
+}
+
+// renameKeys encodes payload with its keys in the given naming convention.
+func renameKeys(payload interface{}, naming string) (json.RawMessage, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return domain.RenameKeys(data, naming)
+}
+
+// reserve accounts for size bytes about to be queued, refusing when that
+// would exceed the hub's per-client limit.
+func (c *Client) reserve(size int) bool {
+	queued := c.queuedBytes.Add(int64(size))
+	if c.hub.maxClientBytes > 0 && queued > c.hub.maxClientBytes {
+		c.queuedBytes.Add(-int64(size))
+		c.overflow()
+		return false
+	}
+	return true
+}
+
+// overflow counts a message dropped because the client's send buffer was
+// full, by bytes or by messages.
+func (c *Client) overflow() {
+	c.bufferFull.Add(1)
+	c.dropped.Add(1)
+}
+
+// dropStale counts a message dropped from the client's backlog for being
+// older than its TTL.
+func (c *Client) dropStale() {
+	c.hub.staleDropped.Add(1)
+	c.staleDropped.Add(1)
+	c.dropped.Add(1)
+}
+
+// setCloseReason records why the client is being disconnected, unless a
+// reason was already given. The caller holds mu.
+func (c *Client) setCloseReason(reason string) {
+	if c.closeReason == "" {
+		c.closeReason = reason
+	}
+}
+
+// disconnect unregisters the client, recording why.
+func (c *Client) disconnect(reason string) {
+	c.mu.Lock()
+	c.setCloseReason(reason)
+	c.mu.Unlock()
+	c.hub.unregisterClient(c)
+}
+
+// WriteFailed counts an error writing to a stream client and disconnects it.
+func (c *Client) WriteFailed(err error) {
+	c.writeErrors.Add(1)
+	c.disconnect("write error: " + err.Error())
+}
+
+// SendMessage sends a message to this client only.
+func (c *Client) SendMessage(messageType string, payload interface{}) error {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	if c.encode != nil {
+		data, ok := c.encode(messageType, payload)
+		if !ok {
+			return nil
+		}
+		return c.queue(data)
+	}
+
+	if naming := c.naming(); naming != "" && payload != nil {
+		renamed, err := renameKeys(payload, naming)
+		if err != nil {
+			return err
+		}
+		payload = renamed
+	}
+
+	data, err := json.Marshal(c.envelope(0, messageType, "", time.Now(), payload))
+	if err != nil {
+		return err
+	}
+	return c.queue(data)
+}
+
+// SendRaw queues data as is, for clients with their own Encoder that need
+// to send protocol messages of their own.
+func (c *Client) SendRaw(data []byte) error {
+	return c.queue(data)
+}
+
+// queue adds an encoded reply to the client's send buffer.
+func (c *Client) queue(data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+
+	if !c.reserve(len(data)) {
+		return fmt.Errorf("client send buffer full")
+	}
+
+	select {
+	case c.send <- outboundMessage{data: data}:
+		return nil
+	default:
+		c.queuedBytes.Add(-int64(len(data)))
+		c.overflow()
+		return fmt.Errorf("client send buffer full")
+	}
+}
+
+func (c *Client) handleCommand(data []byte) {
+	var cmd domain.ClientCommand
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		_ = c.SendMessage("COMMAND_ERROR", domain.CommandError{Message: "invalid command"})
+		return
+	}
+
+	if !logging.ValidRequestID(cmd.RequestID) {
+		cmd.RequestID = logging.NewRequestID()
+	}
+	logging.Debugf("Request %s: %s command from %s", cmd.RequestID, cmd.Type, c)
+
+	handler, ok := c.hub.commands[cmd.Type]
+	if !ok {
+		_ = c.SendMessage("COMMAND_ERROR", domain.CommandError{Command: cmd.Type, Message: "unknown command", RequestID: cmd.RequestID})
+		return
+	}
+
+	if err := handler(c, cmd.Payload); err != nil {
+		logging.Debugf("Request %s: %s failed: %v", cmd.RequestID, cmd.Type, err)
+		_ = c.SendMessage("COMMAND_ERROR", domain.CommandError{Command: cmd.Type, Message: err.Error(), RequestID: cmd.RequestID})
+	}
+}
+
+// Event is a message queued for a client.
+type Event struct {
+	// Seq is the event's sequence number, or 0 for replies to this client
+	Seq  uint64
+	Data []byte
+}
+
+// Next waits for the next message of a stream client. ok is false once the
+// client has been unregistered.
+func (c *Client) Next() (Event, bool) {
+	for message := range c.send {
+		c.queuedBytes.Add(-int64(len(message.data)))
+		if c.hub.stale(message) {
+			c.dropStale()
+			continue
+		}
+		return Event{Seq: message.seq, Data: message.data}, true
+	}
+	return Event{}, false
+}
+
+// Close unregisters the client from the hub.
+func (c *Client) Close() {
+	c.hub.unregisterClient(c)
+}
+
 func (c *Client) WritePump() {
 	defer func() {
 		_ = c.conn.Close()
 	}()
 
 	for message := range c.send {
-		if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
-			log.Printf("Error writing message: %v", err)
+		c.queuedBytes.Add(-int64(len(message.data)))
+		// Messages that waited out their TTL behind a stalled connection
+		if c.hub.stale(message) {
+			c.dropStale()
+			continue
+		}
+		if err := c.conn.WriteMessage(websocket.TextMessage, message.data); err != nil {
+			log.Printf("Error writing message to client %s: %v", c, err)
+			c.writeErrors.Add(1)
+			c.mu.Lock()
+			c.setCloseReason("write error: " + err.Error())
+			c.mu.Unlock()
 			return
 		}
 	}
-	
+
 	// The channel was closed, send close message
 	_ = c.conn.WriteMessage(websocket.CloseMessage, []byte{})
 }
 
+// maxCommandSize is the largest command a client may send: an ANNOTATE with
+// a 500-byte note and purpose code fits even when each byte is escaped as
+// \u00XX in the JSON.
+const maxCommandSize = 8 << 10
+
 func (c *Client) ReadPump() {
 	defer func() {
 		c.hub.unregisterClient(c)
 		_ = c.conn.Close()
 	}()
 
-	// We don't expect any messages from the client for this application
-	// But we need to read to handle pings and connection close
-	c.conn.SetReadLimit(512)
-	
+	// Clients only send small commands; reading also handles pings and close
+	c.conn.SetReadLimit(maxCommandSize)
+
 	for {
-		_, _, err := c.conn.ReadMessage()
+		messageType, data, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("WebSocket error: %v", err)
 			}
 			break
 		}
+
+		if messageType == websocket.TextMessage {
+			c.handleCommand(data)
+		}
 	}
-}
\ No newline at end of file
+}
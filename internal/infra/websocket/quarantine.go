@@ -0,0 +1,98 @@
+package websocket
+
+import (
+	"log"
+	"net"
+	"sort"
+)
+
+// Disconnect force-closes the client with the given ID, and with block also
+// quarantines its IP. It returns the client's details, or false if no such
+// client is connected.
+func (h *Hub) Disconnect(id uint64, block bool) (ClientInfo, bool) {
+	h.mu.RLock()
+	var target *Client
+	for client := range h.clients {
+		if client.id == id {
+			target = client
+			break
+		}
+	}
+	h.mu.RUnlock()
+
+	if target == nil {
+		return ClientInfo{}, false
+	}
+
+	info := target.Info()
+	log.Printf("Disconnecting client %s by admin request", target)
+	target.disconnect("disconnected by admin")
+
+	if block {
+		h.Block(hostOf(info.RemoteAddr))
+	}
+	return info, true
+}
+
+// Block refuses new connections from ip and disconnects the clients already
+// connected from it.
+func (h *Hub) Block(ip string) {
+	h.blockedMu.Lock()
+	h.blocked[ip] = true
+	h.blockedMu.Unlock()
+	log.Printf("Blocked clients from %s", ip)
+
+	h.mu.RLock()
+	var clients []*Client
+	for client := range h.clients {
+		if hostOf(client.remoteAddr) == ip {
+			clients = append(clients, client)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, client := range clients {
+		client.disconnect("blocked")
+	}
+}
+
+// Unblock lets ip connect again. It returns false if ip wasn't blocked.
+func (h *Hub) Unblock(ip string) bool {
+	h.blockedMu.Lock()
+	defer h.blockedMu.Unlock()
+
+	if !h.blocked[ip] {
+		return false
+	}
+	delete(h.blocked, ip)
+	log.Printf("Unblocked clients from %s", ip)
+	return true
+}
+
+// IsBlocked reports whether connections from remoteAddr are refused.
+func (h *Hub) IsBlocked(remoteAddr string) bool {
+	h.blockedMu.RLock()
+	defer h.blockedMu.RUnlock()
+	return h.blocked[hostOf(remoteAddr)]
+}
+
+// Blocked lists the blocked IPs.
+func (h *Hub) Blocked() []string {
+	h.blockedMu.RLock()
+	defer h.blockedMu.RUnlock()
+
+	ips := make([]string, 0, len(h.blocked))
+	for ip := range h.blocked {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	return ips
+}
+
+func hostOf(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
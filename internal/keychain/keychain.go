@@ -0,0 +1,29 @@
+// Package keychain stores and reads secrets in the OS credential store:
+// the macOS Keychain, the Secret Service (libsecret) on Linux and Windows
+// Credential Manager.
+package keychain
+
+import "errors"
+
+// Service groups this application's entries in the credential store.
+const Service = "go-thai-id-card-reader"
+
+var (
+	ErrNotFound    = errors.New("secret not found in the OS credential store")
+	ErrUnsupported = errors.New("no OS credential store is supported on this platform")
+)
+
+// Get returns the secret stored under name.
+func Get(name string) (string, error) {
+	return get(name)
+}
+
+// Set stores secret under name, replacing any existing value.
+func Set(name, secret string) error {
+	return set(name, secret)
+}
+
+// Delete removes the secret stored under name.
+func Delete(name string) error {
+	return remove(name)
+}
@@ -0,0 +1,37 @@
+//go:build darwin
+
+package keychain
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// errItemNotFound is the exit status of security(1) for a missing item.
+const errItemNotFound = 44
+
+func get(name string) (string, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", Service, "-a", name, "-w").Output()
+	if err != nil {
+		return "", securityError(err)
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+func set(name, secret string) error {
+	// -U updates the item if it exists
+	return securityError(exec.Command("security", "add-generic-password", "-U", "-s", Service, "-a", name, "-w", secret).Run())
+}
+
+func remove(name string) error {
+	return securityError(exec.Command("security", "delete-generic-password", "-s", Service, "-a", name).Run())
+}
+
+func securityError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == errItemNotFound {
+		return ErrNotFound
+	}
+	return err
+}
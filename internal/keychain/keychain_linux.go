@@ -0,0 +1,43 @@
+//go:build linux
+
+package keychain
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// The Secret Service is used through secret-tool(1), from libsecret-tools.
+
+func get(name string) (string, error) {
+	out, err := exec.Command("secret-tool", "lookup", "service", Service, "account", name).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) == 0 {
+			// lookup exits with 1 and no message when nothing matches
+			return "", ErrNotFound
+		}
+		return "", secretToolError(err)
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+func set(name, secret string) error {
+	cmd := exec.Command("secret-tool", "store", "--label", Service+" "+name, "service", Service, "account", name)
+	// The secret is read from stdin so it doesn't show up in the process list
+	cmd.Stdin = strings.NewReader(secret)
+	return secretToolError(cmd.Run())
+}
+
+func remove(name string) error {
+	return secretToolError(exec.Command("secret-tool", "clear", "service", Service, "account", name).Run())
+}
+
+func secretToolError(err error) error {
+	if errors.Is(err, exec.ErrNotFound) {
+		return fmt.Errorf("%w: install secret-tool (libsecret-tools)", ErrUnsupported)
+	}
+	return err
+}
@@ -0,0 +1,15 @@
+//go:build !darwin && !linux && !windows
+
+package keychain
+
+func get(name string) (string, error) {
+	return "", ErrUnsupported
+}
+
+func set(name, secret string) error {
+	return ErrUnsupported
+}
+
+func remove(name string) error {
+	return ErrUnsupported
+}
@@ -0,0 +1,71 @@
+package logging
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+)
+
+// Level controls how much the service logs. Each level includes the ones
+// before it: info < debug < apdu.
+type Level int32
+
+const (
+	LevelInfo Level = iota
+	LevelDebug
+	// LevelAPDU additionally logs every APDU exchanged with the card
+	LevelAPDU
+)
+
+var levelNames = map[Level]string{
+	LevelInfo:  "info",
+	LevelDebug: "debug",
+	LevelAPDU:  "apdu",
+}
+
+var current atomic.Int32
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// ParseLevel converts a level name from config or the admin API.
+func ParseLevel(name string) (Level, error) {
+	for level, n := range levelNames {
+		if n == name {
+			return level, nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q (expected info, debug or apdu)", name)
+}
+
+// SetLevel changes the log level at runtime.
+func SetLevel(level Level) {
+	current.Store(int32(level))
+
+	// System logs add their own timestamps
+	flags := log.LstdFlags
+	if systemLog.Load() {
+		flags = 0
+	}
+	if level >= LevelDebug {
+		flags |= log.Lshortfile
+	}
+	log.SetFlags(flags)
+}
+
+func CurrentLevel() Level {
+	return Level(current.Load())
+}
+
+func Debugf(format string, args ...interface{}) {
+	if CurrentLevel() >= LevelDebug {
+		_ = log.Output(2, fmt.Sprintf(format, args...))
+	}
+}
+
+func APDUf(format string, args ...interface{}) {
+	if CurrentLevel() >= LevelAPDU {
+		_ = log.Output(2, fmt.Sprintf(format, args...))
+	}
+}
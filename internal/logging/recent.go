@@ -0,0 +1,63 @@
+package logging
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"sync"
+)
+
+// recentLines is how many application log lines are kept in memory for the
+// diagnostics bundle.
+const recentLines = 1000
+
+// ring keeps the last lines written to it. The log package writes each
+// entry with a single Write.
+type ring struct {
+	mu    sync.Mutex
+	lines [][]byte
+	next  int
+}
+
+func (r *ring) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	line := append([]byte(nil), p...)
+	if len(r.lines) < recentLines {
+		r.lines = append(r.lines, line)
+	} else {
+		r.lines[r.next] = line
+	}
+	r.next = (r.next + 1) % recentLines
+	return len(p), nil
+}
+
+func (r *ring) bytes() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var buf bytes.Buffer
+	start := 0
+	if len(r.lines) == recentLines {
+		start = r.next
+	}
+	for i := range r.lines {
+		buf.Write(r.lines[(start+i)%len(r.lines)])
+	}
+	return buf.Bytes()
+}
+
+var recent = &ring{}
+
+// KeepRecent also copies the application log into memory, so the
+// diagnostics bundle has the latest lines whatever the log output is. Call
+// it once the output is set up.
+func KeepRecent() {
+	log.SetOutput(io.MultiWriter(log.Writer(), recent))
+}
+
+// Recent returns the latest application log lines kept by KeepRecent.
+func Recent() []byte {
+	return recent.bytes()
+}
@@ -0,0 +1,51 @@
+package logging
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync/atomic"
+)
+
+var redactPII atomic.Bool
+
+// redactKey keys the hashes of redacted values. It is random per process, so
+// a hash can be followed through one run's log but not reversed by hashing
+// every possible citizen ID.
+var redactKey = func() []byte {
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	return key
+}()
+
+// SetRedactPII turns redaction of personal data in log lines on or off.
+func SetRedactPII(on bool) {
+	redactPII.Store(on)
+}
+
+// RedactingPII reports whether personal data is kept out of the log.
+func RedactingPII() bool {
+	return redactPII.Load()
+}
+
+// PII returns value for logging: unchanged, or as a short keyed hash when
+// redaction is on, so the same card can still be recognised within a run.
+func PII(value string) string {
+	if !RedactingPII() || value == "" {
+		return value
+	}
+	mac := hmac.New(sha256.New, redactKey)
+	mac.Write([]byte(value))
+	return "pii:" + hex.EncodeToString(mac.Sum(nil)[:4])
+}
+
+// APDUResponse formats an APDU response for the log. With redaction on only
+// the length and status word are shown, as the data is the card's contents.
+func APDUResponse(rsp []byte) string {
+	if !RedactingPII() || len(rsp) <= 2 {
+		return fmt.Sprintf("%X", rsp)
+	}
+	return fmt.Sprintf("[%d bytes redacted] %X", len(rsp)-2, rsp[len(rsp)-2:])
+}
@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"io"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	OutputSyslog   = "syslog"
+	OutputEventLog = "eventlog"
+)
+
+type severity int
+
+const (
+	severityInfo severity = iota
+	severityWarning
+	severityError
+)
+
+// severityOf guesses the severity of a log line from its wording, since
+// the service logs plain text without levels.
+func severityOf(line string) severity {
+	lower := strings.ToLower(line)
+	switch {
+	case strings.HasPrefix(lower, "warning"):
+		return severityWarning
+	case strings.Contains(lower, "error"), strings.Contains(lower, "fail"):
+		return severityError
+	}
+	return severityInfo
+}
+
+// systemLog is set when the log goes to syslog or the Event Log, which
+// timestamp entries themselves.
+var systemLog atomic.Bool
+
+// OpenSystemLog opens syslog or the Windows Event Log as the application
+// log. tag names the service in the entries; address is a remote syslog
+// server as network://host:port, or empty for the local one.
+func OpenSystemLog(output, tag, address string) (io.WriteCloser, error) {
+	var (
+		w   io.WriteCloser
+		err error
+	)
+	switch output {
+	case OutputSyslog:
+		w, err = openSyslog(tag, address)
+	case OutputEventLog:
+		w, err = openEventLog(tag)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	systemLog.Store(true)
+	log.SetOutput(w)
+	SetLevel(CurrentLevel())
+	return w, nil
+}
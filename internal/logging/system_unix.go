@@ -0,0 +1,57 @@
+//go:build !windows && !plan9
+
+package logging
+
+import (
+	"errors"
+	"io"
+	"log/syslog"
+	"strings"
+)
+
+// syslogWriter sends each log line to syslog with a severity matching its
+// wording.
+type syslogWriter struct {
+	w *syslog.Writer
+}
+
+func openSyslog(tag, address string) (io.WriteCloser, error) {
+	var network, raddr string
+	if address != "" {
+		var ok bool
+		network, raddr, ok = strings.Cut(address, "://")
+		if !ok {
+			return nil, errors.New("syslog address must look like udp://host:514")
+		}
+	}
+	w, err := syslog.Dial(network, raddr, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogWriter{w: w}, nil
+}
+
+func (s *syslogWriter) Write(p []byte) (int, error) {
+	line := strings.TrimSuffix(string(p), "\n")
+	var err error
+	switch severityOf(line) {
+	case severityError:
+		err = s.w.Err(line)
+	case severityWarning:
+		err = s.w.Warning(line)
+	default:
+		err = s.w.Info(line)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *syslogWriter) Close() error {
+	return s.w.Close()
+}
+
+func openEventLog(source string) (io.WriteCloser, error) {
+	return nil, errors.New("the Windows Event Log is only available on Windows")
+}
@@ -0,0 +1,60 @@
+//go:build windows
+
+package logging
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// Event IDs by severity, so the Event Viewer can filter on them
+const (
+	eventIDInfo    = 1
+	eventIDWarning = 2
+	eventIDError   = 3
+)
+
+// eventLogWriter reports each log line to the Windows Event Log.
+type eventLogWriter struct {
+	l *eventlog.Log
+}
+
+func openEventLog(source string) (io.WriteCloser, error) {
+	// Registering the source needs elevation and is only done once, so a
+	// failure here usually means it already exists
+	_ = eventlog.InstallAsEventCreate(source, eventlog.Error|eventlog.Warning|eventlog.Info)
+
+	l, err := eventlog.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	return &eventLogWriter{l: l}, nil
+}
+
+func (e *eventLogWriter) Write(p []byte) (int, error) {
+	line := strings.TrimSuffix(string(p), "\n")
+	var err error
+	switch severityOf(line) {
+	case severityError:
+		err = e.l.Error(eventIDError, line)
+	case severityWarning:
+		err = e.l.Warning(eventIDWarning, line)
+	default:
+		err = e.l.Info(eventIDInfo, line)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (e *eventLogWriter) Close() error {
+	return e.l.Close()
+}
+
+func openSyslog(tag, address string) (io.WriteCloser, error) {
+	return nil, errors.New("syslog isn't available on Windows; use eventlog")
+}
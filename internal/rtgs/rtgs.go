@@ -0,0 +1,319 @@
+// Package rtgs romanizes Thai names using the Royal Thai General System of
+// Transcription. Thai spelling doesn't fully determine pronunciation, so the
+// result is a best effort for names whose English fields are missing.
+package rtgs
+
+import (
+	"strings"
+	"unicode"
+)
+
+var initials = map[rune]string{
+	'ก': "k", 'ข': "kh", 'ฃ': "kh", 'ค': "kh", 'ฅ': "kh", 'ฆ': "kh", 'ง': "ng",
+	'จ': "ch", 'ฉ': "ch", 'ช': "ch", 'ซ': "s", 'ฌ': "ch", 'ญ': "y",
+	'ฎ': "d", 'ฏ': "t", 'ฐ': "th", 'ฑ': "th", 'ฒ': "th", 'ณ': "n",
+	'ด': "d", 'ต': "t", 'ถ': "th", 'ท': "th", 'ธ': "th", 'น': "n",
+	'บ': "b", 'ป': "p", 'ผ': "ph", 'ฝ': "f", 'พ': "ph", 'ฟ': "f", 'ภ': "ph", 'ม': "m",
+	'ย': "y", 'ร': "r", 'ล': "l", 'ว': "w", 'ศ': "s", 'ษ': "s", 'ส': "s",
+	'ห': "h", 'ฬ': "l", 'อ': "", 'ฮ': "h",
+}
+
+var finals = map[rune]string{
+	'ก': "k", 'ข': "k", 'ค': "k", 'ฆ': "k", 'ง': "ng",
+	'จ': "t", 'ช': "t", 'ซ': "t", 'ฌ': "t", 'ญ': "n",
+	'ฎ': "t", 'ฏ': "t", 'ฐ': "t", 'ฑ': "t", 'ฒ': "t", 'ณ': "n",
+	'ด': "t", 'ต': "t", 'ถ': "t", 'ท': "t", 'ธ': "t", 'น': "n",
+	'บ': "p", 'ป': "p", 'พ': "p", 'ฟ': "p", 'ภ': "p", 'ม': "m",
+	'ย': "i", 'ร': "n", 'ล': "n", 'ว': "o", 'ศ': "t", 'ษ': "t", 'ส': "t", 'ฬ': "n",
+}
+
+// Vowel signs written after (or above/below) the initial consonant.
+const followingVowels = "ะัาำิีึืุู"
+
+// Vowels written before the initial consonant.
+const leadingVowels = "เแโใไ"
+
+// Tone marks and the short-vowel mark don't change the romanization.
+const ignoredMarks = "่้๊๋็ๅ"
+
+func isConsonant(r rune) bool {
+	_, ok := initials[r]
+	return ok
+}
+
+// clusters lists the consonants that can be followed by ร, ล or ว in an
+// initial cluster.
+var clusters = map[rune]string{
+	'ร': "กขคตปพผทสศซ",
+	'ล': "กขคปพผ",
+	'ว': "กขค",
+}
+
+func isFollowingVowel(r rune) bool {
+	return strings.ContainsRune(followingVowels, r)
+}
+
+// Romanize transcribes Thai text word by word, capitalizing each word.
+func Romanize(thai string) string {
+	words := strings.Fields(thai)
+	for i, word := range words {
+		words[i] = capitalize(romanizeWord(word))
+	}
+	return strings.Join(words, " ")
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	runes := []rune(s)
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
+
+// stripSilent removes tone marks and letters silenced by the thanthakhat
+// (์), including the vowel under or over them and the ทร/ตร pairs that are
+// silenced together as in จันทร์.
+func stripSilent(word string) []rune {
+	var runes []rune
+	for _, r := range word {
+		if !strings.ContainsRune(ignoredMarks, r) {
+			runes = append(runes, r)
+		}
+	}
+
+	var out []rune
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '์' {
+			out = append(out, runes[i])
+			continue
+		}
+
+		// Drop a vowel sign under or over the silent letter
+		if n := len(out); n > 0 && (out[n-1] == 'ิ' || out[n-1] == 'ุ') {
+			out = out[:n-1]
+		}
+		if n := len(out); n > 0 && isConsonant(out[n-1]) {
+			silent := out[n-1]
+			out = out[:n-1]
+			if n := len(out); silent == 'ร' && n > 1 && (out[n-1] == 'ท' || out[n-1] == 'ต') {
+				out = out[:n-1]
+			}
+		}
+	}
+	return out
+}
+
+func romanizeWord(word string) string {
+	runes := stripSilent(word)
+	n := len(runes)
+	var b strings.Builder
+
+	for i := 0; i < n; {
+		r := runes[i]
+
+		if r == 'ฤ' {
+			b.WriteString("rue")
+			i++
+			continue
+		}
+
+		var lead rune
+		if strings.ContainsRune(leadingVowels, r) {
+			lead = r
+			i++
+			if i >= n {
+				break
+			}
+		}
+
+		if !isConsonant(runes[i]) {
+			// Stray vowel sign; skip it
+			i++
+			continue
+		}
+
+		initial := runes[i]
+		i++
+
+		// A leading ห or อ only sets the tone of the following consonant
+		if (initial == 'ห' || (initial == 'อ' && i < n && runes[i] == 'ย')) && i < n && strings.ContainsRune("งญนมยรลว", runes[i]) &&
+			(lead != 0 || i+1 >= n || isFollowingVowel(runes[i+1]) || isConsonant(runes[i+1])) {
+			initial = runes[i]
+			i++
+		}
+		onset := initials[initial]
+
+		// Consonant clusters with ร, ล or ว
+		if i < n && strings.ContainsRune(clusters[runes[i]], initial) && i+1 < n &&
+			(lead != 0 || isFollowingVowel(runes[i+1]) || runes[i+1] == 'อ') {
+			second := runes[i]
+			i++
+			switch {
+			case second == 'ร' && (initial == 'ท' || initial == 'ส' || initial == 'ศ' || initial == 'ซ'):
+				// ทร and สร are read as s
+				onset = "s"
+			default:
+				onset += initials[second]
+			}
+		}
+
+		var vowel string
+		vowel, i = readVowel(runes, i, lead)
+
+		// รร after a consonant reads "an", or "a" before a final consonant
+		if vowel == "" && i+1 < n && runes[i] == 'ร' && runes[i+1] == 'ร' {
+			i += 2
+			if i < n && isConsonant(runes[i]) && (i+1 >= n || !isFollowingVowel(runes[i+1])) {
+				vowel = "a"
+			} else {
+				vowel = "an"
+			}
+		}
+
+		final := ""
+		if i < n && isFinal(runes, i, vowel) {
+			final = finals[runes[i]]
+			i++
+
+			// ร after ช, ต or ท at the end of a word is silent, as in เพชร
+			if i == n-1 && runes[i] == 'ร' && strings.ContainsRune("ชตท", runes[i-1]) {
+				i++
+			}
+		}
+
+		if vowel == "" {
+			if final != "" {
+				// Closed syllable without a written vowel: คน is khon
+				vowel = "o"
+			} else {
+				vowel = "a"
+			}
+		}
+
+		b.WriteString(onset)
+		b.WriteString(vowel)
+		b.WriteString(final)
+	}
+
+	return b.String()
+}
+
+// isFinal reports whether the consonant at i closes the current syllable
+// rather than starting the next one.
+func isFinal(runes []rune, i int, vowel string) bool {
+	n := len(runes)
+	if !isConsonant(runes[i]) {
+		return false
+	}
+	if i+1 >= n {
+		return true
+	}
+
+	next := runes[i+1]
+	switch {
+	case isFollowingVowel(next):
+		return false
+	case next == 'อ' && vowel == "":
+		return false
+	case next == 'ร' && i+2 < n && runes[i+2] == 'ร':
+		// The consonant starts a syllable with รร, as in สวรรค์
+		return false
+	case (vowel == "ao" || vowel == "ai") && (runes[i] == 'ว' || runes[i] == 'ย'):
+		// The vowel already ends in w or y, as in เยาวลักษณ์
+		return false
+	case next == 'ร' && i+2 == n && !strings.ContainsRune("ชตท", runes[i]):
+		// A word-final ร needs its own syllable, as in ธนากร
+		return false
+	}
+	return true
+}
+
+// readVowel reads the vowel signs after the initial consonant and combines
+// them with the leading vowel, if any. It returns "" when no vowel is written.
+func readVowel(runes []rune, i int, lead rune) (string, int) {
+	n := len(runes)
+	next := func(k int) rune {
+		if i+k < n {
+			return runes[i+k]
+		}
+		return 0
+	}
+
+	switch lead {
+	case 'เ':
+		switch {
+		case next(0) == 'ี' && next(1) == 'ย':
+			if next(2) == 'ะ' {
+				return "ia", i + 3
+			}
+			return "ia", i + 2
+		case next(0) == 'ื' && next(1) == 'อ':
+			if next(2) == 'ะ' {
+				return "uea", i + 3
+			}
+			return "uea", i + 2
+		case next(0) == 'า' && next(1) == 'ะ':
+			return "o", i + 2
+		case next(0) == 'า':
+			return "ao", i + 1
+		case next(0) == 'อ':
+			if next(1) == 'ะ' {
+				return "oe", i + 2
+			}
+			return "oe", i + 1
+		case next(0) == 'ิ':
+			return "oe", i + 1
+		case next(0) == 'ะ':
+			return "e", i + 1
+		}
+		return "e", i
+	case 'แ':
+		if next(0) == 'ะ' {
+			return "ae", i + 1
+		}
+		return "ae", i
+	case 'โ':
+		if next(0) == 'ะ' {
+			return "o", i + 1
+		}
+		return "o", i
+	case 'ใ', 'ไ':
+		return "ai", i
+	}
+
+	switch next(0) {
+	case 'ั':
+		if next(1) == 'ว' {
+			return "ua", i + 2
+		}
+		return "a", i + 1
+	case 'ะ', 'า':
+		return "a", i + 1
+	case 'ำ':
+		return "am", i + 1
+	case 'ิ', 'ี':
+		return "i", i + 1
+	case 'ึ':
+		return "ue", i + 1
+	case 'ื':
+		if next(1) == 'อ' {
+			return "ue", i + 2
+		}
+		return "ue", i + 1
+	case 'ุ', 'ู':
+		return "u", i + 1
+	case 'อ':
+		// อ after a consonant is the vowel o unless it starts a new syllable
+		if !isFollowingVowel(next(1)) {
+			return "o", i + 1
+		}
+	case 'ว':
+		// ว between consonants is the vowel ua, as in ควร
+		if isConsonant(next(1)) && (i+2 >= n || !isFollowingVowel(next(2))) && !(next(1) == 'ร' && next(2) == 'ร') {
+			return "ua", i + 1
+		}
+	}
+
+	return "", i
+}
@@ -0,0 +1,54 @@
+package thaiid
+
+import (
+	"bytes"
+	"encoding/hex"
+	"log"
+	"strings"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+)
+
+// GET DATA for the Card Production Life Cycle (CPLC) record, tag 9F7F.
+var getCPLCCommand = []byte{0x80, 0xCA, 0x9F, 0x7F, 0x2D}
+
+// readReaderMetadata returns the card ATR as hex and the reader model, when
+// the transport can tell.
+func readReaderMetadata(t Transport) (string, string) {
+	atr, _, model, ok := cardStatus(t)
+	if !ok {
+		return "", ""
+	}
+	return strings.ToUpper(hex.EncodeToString(atr)), model
+}
+
+// readCardInfo reads the applet version and chip identifiers. Missing values
+// are left empty since older cards don't expose all of them.
+func (c channel) readCardInfo() *domain.CardInfo {
+	info := &domain.CardInfo{}
+
+	if data, err := c.readField(fieldVersion); err == nil {
+		info.AppletVersion = string(bytes.Trim(data, " \x00"))
+	} else {
+		log.Printf("Failed to read applet version: %v", err)
+	}
+
+	data, sw, err := c.transmit(getCPLCCommand)
+	if err != nil || sw != 0x9000 {
+		log.Printf("Failed to read CPLC data: SW=%04X err=%v", sw, err)
+		return info
+	}
+
+	// Skip the 9F7F tag and length if the card includes them
+	if len(data) > 3 && data[0] == 0x9F && data[1] == 0x7F {
+		data = data[3:]
+	}
+
+	// CPLC layout: IC fabricator(2) IC type(2) ... IC serial number at 12..16
+	if len(data) >= 16 {
+		info.ChipType = strings.ToUpper(hex.EncodeToString(data[0:4]))
+		info.ChipSerial = strings.ToUpper(hex.EncodeToString(data[12:16]))
+	}
+
+	return info
+}
@@ -0,0 +1,55 @@
+package thaiid
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+)
+
+var (
+	// PC/SC Part 3 ATR prefix for contactless storage cards, followed by the
+	// PC/SC RID (A000000306)
+	contactlessATRPrefix = []byte{0x3B, 0x8F, 0x80, 0x01, 0x80, 0x4F, 0x0C, 0xA0, 0x00, 0x00, 0x03, 0x06}
+
+	// SELECT 2PAY.SYS.DDF01 (contactless) and 1PAY.SYS.DDF01 (contact)
+	selectPPSECommand = append([]byte{0x00, 0xA4, 0x04, 0x00, 0x0E}, "2PAY.SYS.DDF01"...)
+	selectPSECommand  = append([]byte{0x00, 0xA4, 0x04, 0x00, 0x0E}, "1PAY.SYS.DDF01"...)
+
+	// GSM 11.11 SELECT MF
+	selectGSMMasterFile = []byte{0xA0, 0xA4, 0x00, 0x00, 0x02, 0x3F, 0x00}
+)
+
+// Unsupported wraps a failed applet selection with what we can tell about
+// the inserted card, so clients can guide the user.
+func Unsupported(t Transport, err error) error {
+	info := domain.UnsupportedCard{CardType: domain.CardTypeUnknown}
+
+	atr, reader, _, ok := cardStatus(t)
+	if ok {
+		info.ATR = strings.ToUpper(hex.EncodeToString(atr))
+		info.Reader = reader
+	}
+
+	if ok && bytes.HasPrefix(atr, contactlessATRPrefix) {
+		info.CardType = domain.CardTypeMIFARE
+	} else if probe(t, selectPPSECommand) || probe(t, selectPSECommand) {
+		info.CardType = domain.CardTypeEMV
+	} else if probe(t, selectGSMMasterFile) {
+		info.CardType = domain.CardTypeSIM
+	}
+
+	return &domain.UnsupportedCardError{Card: info, Err: err}
+}
+
+// probe reports whether the card accepts cmd (9000, 61xx or GSM 9Fxx).
+func probe(t Transport, cmd []byte) bool {
+	rsp, err := t.Transmit(cmd)
+	if err != nil || len(rsp) < 2 {
+		return false
+	}
+
+	sw1, sw2 := rsp[len(rsp)-2], rsp[len(rsp)-1]
+	return (sw1 == 0x90 && sw2 == 0x00) || sw1 == 0x61 || sw1 == 0x9F
+}
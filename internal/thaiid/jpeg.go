@@ -0,0 +1,82 @@
+package thaiid
+
+import "bytes"
+
+// JPEG markers used to find where the photo ends.
+const (
+	jpegSOI = 0xD8
+	jpegEOI = 0xD9
+	jpegSOS = 0xDA
+	jpegTEM = 0x01
+	jpegRST = 0xD0 // RST0-RST7 are 0xD0-0xD7
+)
+
+// jpegEnd returns the length of the JPEG image at the start of data, or 0
+// while the image isn't complete yet. The card doesn't store the photo
+// length, so the JPEG's own structure stands in for it: marker segments are
+// skipped by their length, which keeps an FFD9 inside a table from ending
+// the photo early, and the entropy-coded data after SOS, where FF is always
+// stuffed, is scanned for the next marker. Data that doesn't parse as JPEG
+// falls back to the first FFD9.
+func jpegEnd(data []byte) int {
+	if len(data) < 2 {
+		return 0
+	}
+	if data[0] != 0xFF || data[1] != jpegSOI {
+		return markerEnd(data, 0)
+	}
+
+	i := 2
+	for {
+		if i+1 >= len(data) {
+			return 0
+		}
+		if data[i] != 0xFF {
+			return markerEnd(data, i)
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xFF:
+			// Fill byte before a marker
+			i++
+			continue
+		case marker == jpegEOI:
+			return i + 2
+		case marker == jpegTEM || marker&0xF8 == jpegRST:
+			i += 2
+			continue
+		}
+
+		if i+3 >= len(data) {
+			return 0
+		}
+		length := int(data[i+2])<<8 | int(data[i+3])
+		if length < 2 {
+			return markerEnd(data, i)
+		}
+		i += 2 + length
+		if marker != jpegSOS {
+			continue
+		}
+
+		// Entropy-coded data runs to the next marker other than RSTn
+		for {
+			if i+1 >= len(data) {
+				return 0
+			}
+			if data[i] == 0xFF && data[i+1] != 0x00 && data[i+1]&0xF8 != jpegRST {
+				break
+			}
+			i++
+		}
+	}
+}
+
+// markerEnd returns the length of data up to the first FFD9 from i, or 0 if
+// there is none yet.
+func markerEnd(data []byte, i int) int {
+	if end := bytes.Index(data[i:], []byte{0xFF, jpegEOI}); end != -1 {
+		return i + end + 2
+	}
+	return 0
+}
@@ -0,0 +1,76 @@
+package thaiid
+
+import "testing"
+
+// jpegOf joins JPEG segments into one byte slice.
+func jpegOf(parts ...[]byte) []byte {
+	var data []byte
+	for _, part := range parts {
+		data = append(data, part...)
+	}
+	return data
+}
+
+var (
+	soi = []byte{0xFF, 0xD8}
+	eoi = []byte{0xFF, 0xD9}
+	// app0 is a marker segment whose payload holds FFD9
+	app0 = []byte{0xFF, 0xE0, 0x00, 0x06, 0x4A, 0xFF, 0xD9, 0x00}
+	sos  = []byte{0xFF, 0xDA, 0x00, 0x02}
+)
+
+func TestJPEGEnd(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"empty", nil, 0},
+		{"one byte", []byte{0xFF}, 0},
+		{"just SOI and EOI", jpegOf(soi, eoi), 4},
+		{
+			name: "space padding after EOI",
+			data: jpegOf(soi, sos, []byte{0x12, 0x34}, eoi, []byte("    ")),
+			want: 10,
+		},
+		{
+			name: "NUL padding after EOI",
+			data: jpegOf(soi, sos, []byte{0x12}, eoi, make([]byte, 16)),
+			want: 9,
+		},
+		{
+			name: "FFD9 inside a marker segment",
+			data: jpegOf(soi, app0, sos, []byte{0x01}, eoi),
+			want: 17,
+		},
+		{
+			// FF00 is a stuffed FF data byte and FFD0-FFD7 are restart
+			// markers; neither ends the entropy-coded data
+			name: "stuffed bytes and restart markers in entropy data",
+			data: jpegOf(soi, sos, []byte{0xFF, 0x00, 0xD9, 0xFF, 0xD3, 0x42, 0xFF, 0x00}, eoi),
+			want: 16,
+		},
+		{
+			name: "FFD9 embedded in entropy data after a stuffed FF",
+			data: jpegOf(soi, sos, []byte{0x10, 0xFF, 0x00, 0xD9, 0xFF, 0xD9}),
+			want: 12,
+		},
+		{
+			name: "fill bytes before EOI",
+			data: jpegOf(soi, sos, []byte{0x33}, []byte{0xFF, 0xFF}, eoi),
+			want: 11,
+		},
+		{"incomplete segment", jpegOf(soi, app0[:5]), 0},
+		{"entropy data not ended yet", jpegOf(soi, sos, []byte{0x10, 0xFF, 0x00}), 0},
+		{"marker length too short falls back to the first FFD9", jpegOf(soi, []byte{0xFF, 0xE1, 0x00, 0x01}, eoi), 8},
+		{"not a JPEG falls back to the first FFD9", []byte{0x00, 0x01, 0xFF, 0xD9, 0xFF, 0xD9}, 4},
+		{"not a JPEG without FFD9", []byte{0x00, 0x01, 0x02}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jpegEnd(tt.data); got != tt.want {
+				t.Errorf("jpegEnd(% X) = %d, want %d", tt.data, got, tt.want)
+			}
+		})
+	}
+}
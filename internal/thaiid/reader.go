@@ -0,0 +1,698 @@
+// Package thaiid reads Thai national ID cards over any Transport: the APDU
+// flow, field parsing and photo read shared by the PC/SC and serial readers
+// of the service and by the mobile bindings.
+package thaiid
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/config"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/logging"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/rtgs"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// maxReadChunk is the largest Le a single READ BINARY may request.
+const maxReadChunk = 0xFF
+
+// ErrAppletNotFound is returned, wrapped, when the card answers SELECT with
+// 6A82; resetting the card sometimes helps.
+var ErrAppletNotFound = errors.New("applet not found")
+
+// cardField describes where a data element lives in the Thai ID applet. The
+// card doesn't store field lengths: size is the room the field has before
+// the next one, and the card may hold less.
+type cardField struct {
+	offset uint16
+	size   int
+}
+
+var (
+	fieldVersion    = cardField{0x0000, 0x04}
+	fieldCID        = cardField{0x0004, 0x0D}
+	fieldFullNameTH = cardField{0x0011, 0x64}
+	fieldFullNameEN = cardField{0x0075, 0x64}
+	fieldBirthDate  = cardField{0x00D9, 0x08}
+	fieldGender     = cardField{0x00E1, 0x01}
+	fieldIssueDate  = cardField{0x0167, 0x08}
+	fieldExpireDate = cardField{0x016F, 0x08}
+	fieldAddress    = cardField{0x1579, 0xA0}
+	// fieldPhoto is the area holding the JPEG photo, which runs up to the
+	// address; the photo itself is usually shorter and padded
+	fieldPhoto = cardField{0x017B, 0x13FE}
+)
+
+// selectAppletCommand selects the Thai ID applet, A000000054480001.
+var selectAppletCommand = []byte{0x00, 0xa4, 0x04, 0x00, 0x08, 0xa0, 0x00, 0x00, 0x00, 0x54, 0x48, 0x00, 0x01}
+
+// Options control how card data is decoded and what is read.
+type Options struct {
+	Dates         config.DatesConfig
+	Gender        config.GenderConfig
+	Transliterate bool
+	Photo         bool
+	// PhotoDeferred leaves the photo out of the read; ReadPhoto fetches it
+	PhotoDeferred bool
+	// CIDOnly stops after the citizen ID, or after the names with
+	// IncludeName
+	CIDOnly     bool
+	IncludeName bool
+	// HashSalt, when set, replaces the citizen ID with its salted digest
+	// and stops after it, for hash-only mode
+	HashSalt string
+	// AgeThresholds, when set, read only the date of birth and give just
+	// whether the holder is at least each age, for age-only mode
+	AgeThresholds []int
+	// Raw keeps the names, dates and address as read in the card's Raw
+	Raw bool
+	// Strict fails the read with a domain.IncompleteReadError when any
+	// field fails to read, instead of returning a partial card
+	Strict bool
+}
+
+// OptionsFromConfig returns the options set in the service configuration.
+func OptionsFromConfig(cfg *config.Config) Options {
+	return Options{
+		Dates:         cfg.Dates,
+		Gender:        cfg.Gender,
+		Transliterate: cfg.Card.Transliterate,
+		Photo:         cfg.Photo.Enabled,
+		PhotoDeferred: cfg.Photo.Deferred,
+		CIDOnly:       cfg.Card.CIDOnly(),
+		IncludeName:   cfg.Card.IncludeName,
+		HashSalt:      hashSalt(cfg.Card),
+		AgeThresholds: ageThresholds(cfg.Card),
+		Raw:           cfg.Card.IncludeRaw,
+		Strict:        cfg.Card.StrictRead,
+	}
+}
+
+func ageThresholds(cfg config.CardConfig) []int {
+	if cfg.Mode != config.CardModeAgeOnly {
+		return nil
+	}
+	return cfg.AgeThresholds
+}
+
+func hashSalt(cfg config.CardConfig) string {
+	if cfg.Mode != config.CardModeHashOnly {
+		return ""
+	}
+	return cfg.HashSalt
+}
+
+// Telemetry holds timings measured during a card read.
+type Telemetry struct {
+	TotalReadTime time.Duration
+	PhotoReadTime time.Duration
+	PhotoBytes    int
+}
+
+// Reader reads cards with a fixed set of options. It doesn't serialize card
+// access; callers sharing a transport must.
+type Reader struct {
+	opts Options
+
+	telemetryMu sync.Mutex
+	telemetry   Telemetry
+}
+
+func NewReader(opts Options) *Reader {
+	return &Reader{opts: opts}
+}
+
+// LastTelemetry returns the timings of the most recent read.
+func (r *Reader) LastTelemetry() Telemetry {
+	r.telemetryMu.Lock()
+	defer r.telemetryMu.Unlock()
+	return r.telemetry
+}
+
+// Read reads all public data from the card. onIdentified is called as soon
+// as the citizen ID and names are known, before the slower address and photo
+// reads. Once ctx is done the remaining fields are skipped and the fields
+// read so far are returned with ctx's error. APDU log lines and the card are
+// tagged with the request ID of ctx.
+func (r *Reader) Read(ctx context.Context, reader string, t Transport, onIdentified func(*domain.ThaiIdCard)) (*domain.ThaiIdCard, error) {
+	start := time.Now()
+	card := newChannel(ctx, t)
+	readField := func(field cardField) ([]byte, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return card.readField(field)
+	}
+
+	// Add small delay before applet selection
+	time.Sleep(50 * time.Millisecond)
+
+	if err := card.selectApplet(); err != nil {
+		return nil, Unsupported(card, err)
+	}
+
+	thaiCard := &domain.ThaiIdCard{Reader: reader, RequestID: logging.RequestID(ctx)}
+	thaiCard.ATR, thaiCard.ReaderModel = readReaderMetadata(card)
+
+	// failures are the fields that failed to read, and why, for strict mode
+	var failures []domain.FieldError
+	fieldFailed := func(field string, err error) {
+		log.Printf("Failed to read %s: %v", field, err)
+		thaiCard.MarkMissing(field)
+		failures = append(failures, domain.FieldError{Field: field, Error: err.Error()})
+	}
+
+	if len(r.opts.AgeThresholds) > 0 {
+		return r.readAgeOnly(thaiCard, start, readField)
+	}
+
+	// raw is filled as fields are read, and attached to the card at the end
+	// so onIdentified doesn't get it half done
+	var raw domain.RawFields
+
+	// Read CID
+	data, err := readField(fieldCID)
+	if err == nil {
+		thaiCard.CitizenID = string(bytes.Trim(data, "\x00"))
+		if id, err := domain.ParseCitizenID(thaiCard.CitizenID); err == nil {
+			thaiCard.CitizenIDInfo = id
+			if !id.Valid {
+				log.Printf("Citizen ID on card has an invalid check digit")
+			}
+		}
+	} else {
+		fieldFailed(domain.FieldCitizenID, err)
+	}
+
+	if r.opts.HashSalt != "" {
+		// The raw ID goes no further than this
+		if thaiCard.CitizenID != "" {
+			thaiCard.CitizenIDHash = r.HolderID(thaiCard.CitizenID)
+		}
+		thaiCard.CitizenID = ""
+		thaiCard.CitizenIDInfo = nil
+		if err := r.strictError(ctx, failures); err != nil {
+			return nil, err
+		}
+		return r.finishCIDOnly(thaiCard, start, onIdentified)
+	}
+	if r.opts.CIDOnly && !r.opts.IncludeName {
+		if err := r.strictError(ctx, failures); err != nil {
+			return nil, err
+		}
+		return r.finishCIDOnly(thaiCard, start, onIdentified)
+	}
+
+	// Read Thai Fullname
+	data, err = readField(fieldFullNameTH)
+	if err == nil {
+		names := decodeThaiString(data)
+		raw.NameTH = rawString(names)
+		// Thai names are space-separated
+		parts := bytes.Split([]byte(names), []byte("#"))
+		if len(parts) >= 4 {
+			thaiCard.PrefixNameTH = domain.NormalizeThaiText(string(parts[0]))
+			thaiCard.FirstNameTH = domain.NormalizeThaiText(string(parts[1]))
+			thaiCard.MiddleNameTH = domain.NormalizeThaiText(string(parts[2]))
+			thaiCard.LastNameTH = domain.NormalizeThaiText(string(parts[3]))
+			thaiCard.PrefixCode, thaiCard.PrefixStandardEN = domain.ParsePrefix(thaiCard.PrefixNameTH)
+		}
+	} else {
+		fieldFailed(domain.FieldNameTH, err)
+	}
+
+	// Read English Fullname
+	data, err = readField(fieldFullNameEN)
+	if err == nil {
+		names := string(bytes.Trim(data, "\x00"))
+		raw.NameEN = rawString(names)
+		// English names are space-separated
+		parts := bytes.Split([]byte(names), []byte("#"))
+		if len(parts) >= 4 {
+			thaiCard.PrefixNameEN = domain.NormalizeThaiText(string(parts[0]))
+			thaiCard.FirstNameEN = domain.NormalizeThaiText(string(parts[1]))
+			thaiCard.MiddleNameEN = domain.NormalizeThaiText(string(parts[2]))
+			thaiCard.LastNameEN = domain.NormalizeThaiText(string(parts[3]))
+		}
+	} else {
+		fieldFailed(domain.FieldNameEN, err)
+	}
+
+	if r.opts.Transliterate && needsRomanization(thaiCard) {
+		romanizeNames(thaiCard)
+	}
+
+	if r.opts.CIDOnly {
+		if r.opts.Raw {
+			thaiCard.Raw = &raw
+		}
+		if err := r.strictError(ctx, failures); err != nil {
+			return nil, err
+		}
+		return r.finishCIDOnly(thaiCard, start, onIdentified)
+	}
+
+	// A strict read doesn't announce a holder whose names failed to read
+	if err := r.strictError(ctx, failures); err != nil {
+		return nil, err
+	}
+	if thaiCard.CitizenID != "" && onIdentified != nil {
+		identity := *thaiCard
+		onIdentified(&identity)
+	}
+
+	// Read Date of Birth
+	data, err = readField(fieldBirthDate)
+	if err == nil {
+		raw.DateOfBirth = rawString(string(data))
+		thaiCard.DateOfBirth, thaiCard.DateOfBirthDisplay = formatDate(string(data), r.opts.Dates.DateOfBirth)
+		if date, ok := domain.ParseCardDate(string(bytes.Trim(data, "\x00"))); ok {
+			thaiCard.DateOfBirthParts = date
+		}
+	} else {
+		fieldFailed(domain.FieldDateOfBirth, err)
+	}
+
+	// Read Gender
+	data, err = readField(fieldGender)
+	if err != nil {
+		fieldFailed(domain.FieldGender, err)
+	} else if len(data) >= 1 {
+		// Blank, 0 and 3 are found on real cards and mean unspecified
+		thaiCard.GenderCode = strings.TrimSpace(strings.Trim(string(data[:1]), "\x00"))
+		thaiCard.Gender = r.opts.Gender.Label(thaiCard.GenderCode)
+	}
+
+	// Read Issue Date
+	data, err = readField(fieldIssueDate)
+	if err == nil {
+		raw.IssueDate = rawString(string(data))
+		thaiCard.IssueDate, thaiCard.IssueDateDisplay = formatDate(string(data), r.opts.Dates.IssueDate)
+	} else {
+		fieldFailed(domain.FieldIssueDate, err)
+	}
+
+	// Read Expire Date
+	data, err = readField(fieldExpireDate)
+	if err == nil {
+		raw.ExpireDate = rawString(string(data))
+		thaiCard.ExpireDate, thaiCard.ExpireDateDisplay = formatDate(string(data), r.opts.Dates.ExpireDate)
+	} else {
+		fieldFailed(domain.FieldExpireDate, err)
+	}
+
+	// Read Address
+	data, err = readField(fieldAddress)
+	if err == nil {
+		decoded := decodeThaiString(data)
+		raw.Address = rawString(decoded)
+		// Normalize each #-separated part so the separators survive
+		parts := strings.Split(decoded, "#")
+		for i, part := range parts {
+			parts[i] = domain.NormalizeThaiText(part)
+		}
+		addressStr := strings.Join(parts, "#")
+		thaiCard.Address = domain.ParseThaiAddress(addressStr)
+	} else {
+		fieldFailed(domain.FieldAddress, err)
+	}
+	if r.opts.Raw {
+		thaiCard.Raw = &raw
+	}
+
+	if err := ctx.Err(); err != nil {
+		log.Printf("Card read stopped after %v: %v", time.Since(start), err)
+		if r.opts.Photo && !r.opts.PhotoDeferred {
+			thaiCard.MarkMissing(domain.FieldPhoto)
+		}
+		return thaiCard, err
+	}
+	thaiCard.CardInfo = card.readCardInfo()
+
+	// Read Photo
+	photoStart := time.Now()
+	var photoData []byte
+	if r.opts.Photo && r.opts.PhotoDeferred {
+		thaiCard.PhotoDeferred = true
+	} else if r.opts.Photo && ctx.Err() == nil {
+		photoBuf := photoBuffers.Get().(*[]byte)
+		photoData, err = card.readPhoto(photoBuf)
+		if err != nil {
+			fieldFailed(domain.FieldPhoto, err)
+		} else if len(photoData) > 0 {
+			thaiCard.PhotoBase64 = base64.StdEncoding.EncodeToString(photoData)
+		}
+		*photoBuf = photoData[:0]
+		photoBuffers.Put(photoBuf)
+	}
+
+	telemetry := Telemetry{
+		TotalReadTime: time.Since(start),
+		PhotoReadTime: time.Since(photoStart),
+		PhotoBytes:    len(photoData),
+	}
+	r.telemetryMu.Lock()
+	r.telemetry = telemetry
+	r.telemetryMu.Unlock()
+	thaiCard.ReadTimeMs = telemetry.TotalReadTime.Milliseconds()
+	log.Printf("Card read in %v (photo %d bytes in %v)", telemetry.TotalReadTime, telemetry.PhotoBytes, telemetry.PhotoReadTime)
+
+	if err := r.strictError(ctx, failures); err != nil {
+		return nil, err
+	}
+	return thaiCard, nil
+}
+
+// strictError returns the error a strict read fails with when fields failed
+// to read. Fields skipped because ctx is done are reported as ctx's error by
+// the caller instead.
+func (r *Reader) strictError(ctx context.Context, failures []domain.FieldError) error {
+	if !r.opts.Strict || len(failures) == 0 || ctx.Err() != nil {
+		return nil
+	}
+	return &domain.IncompleteReadError{Fields: failures}
+}
+
+// finishCIDOnly completes a cid-only read, which skips the dates, address,
+// card info and photo.
+func (r *Reader) finishCIDOnly(thaiCard *domain.ThaiIdCard, start time.Time, onIdentified func(*domain.ThaiIdCard)) (*domain.ThaiIdCard, error) {
+	thaiCard.CIDOnly = true
+	if thaiCard.HolderID() != "" && onIdentified != nil {
+		identity := *thaiCard
+		onIdentified(&identity)
+	}
+
+	telemetry := Telemetry{TotalReadTime: time.Since(start)}
+	r.telemetryMu.Lock()
+	r.telemetry = telemetry
+	r.telemetryMu.Unlock()
+	thaiCard.ReadTimeMs = telemetry.TotalReadTime.Milliseconds()
+	log.Printf("Card read in %v (citizen ID only)", telemetry.TotalReadTime)
+
+	return thaiCard, nil
+}
+
+// readAgeOnly completes an age-only read: the date of birth is read, but only
+// the outcome of each age check leaves the reader.
+func (r *Reader) readAgeOnly(thaiCard *domain.ThaiIdCard, start time.Time, readField func(cardField) ([]byte, error)) (*domain.ThaiIdCard, error) {
+	data, err := readField(fieldBirthDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read date of birth: %w", err)
+	}
+	birth, ok := domain.ParseCardDate(string(bytes.Trim(data, "\x00")))
+	if !ok {
+		return nil, fmt.Errorf("date of birth on card has no year")
+	}
+
+	now := time.Now()
+	for _, age := range r.opts.AgeThresholds {
+		thaiCard.AgeChecks = append(thaiCard.AgeChecks, domain.AgeCheck{
+			MinAge: age,
+			Passed: birth.AgeAtLeast(age, now),
+		})
+	}
+
+	telemetry := Telemetry{TotalReadTime: time.Since(start)}
+	r.telemetryMu.Lock()
+	r.telemetry = telemetry
+	r.telemetryMu.Unlock()
+	thaiCard.ReadTimeMs = telemetry.TotalReadTime.Milliseconds()
+	log.Printf("Card read in %v (age checks only)", telemetry.TotalReadTime)
+
+	return thaiCard, nil
+}
+
+// HolderID returns what identifies the holder of the card with citizenID in
+// this reader's cards: the ID itself, or its digest in hash-only mode.
+func (r *Reader) HolderID(citizenID string) string {
+	if r.opts.HashSalt == "" {
+		return citizenID
+	}
+	return domain.HashCitizenID(r.opts.HashSalt, citizenID)
+}
+
+// SelectApplet selects the Thai ID applet.
+func SelectApplet(ctx context.Context, t Transport) error {
+	return newChannel(ctx, t).selectApplet()
+}
+
+// ReadCitizenID reads the citizen ID of a card whose applet is selected.
+func ReadCitizenID(ctx context.Context, t Transport) (string, error) {
+	data, err := newChannel(ctx, t).readField(fieldCID)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes.Trim(data, "\x00")), nil
+}
+
+// ReadPhoto reads the JPEG photo of a card whose applet is selected.
+func ReadPhoto(ctx context.Context, t Transport) ([]byte, error) {
+	return newChannel(ctx, t).readPhoto(new([]byte))
+}
+
+func (c channel) selectApplet() error {
+	rsp, err := c.Transmit(selectAppletCommand)
+	if err != nil {
+		return err
+	}
+
+	if len(rsp) < 2 {
+		return fmt.Errorf("invalid response")
+	}
+
+	sw1, sw2 := rsp[len(rsp)-2], rsp[len(rsp)-1]
+
+	// Handle GET RESPONSE if needed
+	if sw1 == 0x61 {
+		// sw2 contains the length of data available
+		getResponseCmd := []byte{0x00, 0xC0, 0x00, 0x00, sw2}
+		rsp, err = c.Transmit(getResponseCmd)
+		if err != nil {
+			return fmt.Errorf("GET RESPONSE failed: %w", err)
+		}
+
+		if len(rsp) < 2 {
+			return fmt.Errorf("invalid GET RESPONSE")
+		}
+
+		sw1, sw2 = rsp[len(rsp)-2], rsp[len(rsp)-1]
+	}
+
+	// Accept multiple success status codes
+	if (sw1 == 0x90 && sw2 == 0x00) || (sw1 == 0x97 && sw2 == 0x10) {
+		return nil
+	}
+
+	// 6A82 means file/application not found - might need to reset card
+	if sw1 == 0x6A && sw2 == 0x82 {
+		return fmt.Errorf("%w (SW=%02X%02X) - card may need reset", ErrAppletNotFound, sw1, sw2)
+	}
+
+	return fmt.Errorf("select applet failed: SW=%02X%02X", sw1, sw2)
+}
+
+// readBinary sends the Thai ID applet's READ BINARY for le bytes at offset.
+func (c channel) readBinary(offset uint16, le byte) ([]byte, uint16, error) {
+	return c.transmit([]byte{0x80, 0xB0, byte(offset >> 8), byte(offset), 0x02, 0x00, le})
+}
+
+// transmit sends an APDU whose last byte is Le and returns the response data
+// and status word. 61xx is followed up with GET RESPONSE and 6Cxx is retried
+// once with the exact length reported by the card; a card that answers the
+// retry with 6Cxx again is an error.
+func (c channel) transmit(cmd []byte) ([]byte, uint16, error) {
+	data, sw, err := c.exchange(cmd)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// 6Cxx means wrong Le; sw2 carries the exact length available
+	le := byte(sw)
+	if sw>>8 == 0x6C && le != 0x00 && le != cmd[len(cmd)-1] {
+		retry := append([]byte(nil), cmd...)
+		retry[len(retry)-1] = le
+		data, sw, err = c.exchange(retry)
+		if err == nil && sw>>8 == 0x6C {
+			return nil, sw, fmt.Errorf("wrong length again after retrying with Le %02X: SW=%04X", le, sw)
+		}
+	}
+	return data, sw, err
+}
+
+// exchange sends one APDU, following 61xx up with GET RESPONSE.
+func (c channel) exchange(cmd []byte) ([]byte, uint16, error) {
+	logging.APDUf("%s > %X", c.tag, cmd)
+	rsp, err := c.Transmit(cmd)
+	if err != nil {
+		return nil, 0, err
+	}
+	logging.APDUf("%s < %s", c.tag, logging.APDUResponse(rsp))
+
+	if len(rsp) < 2 {
+		return nil, 0, fmt.Errorf("invalid response")
+	}
+
+	sw1, sw2 := rsp[len(rsp)-2], rsp[len(rsp)-1]
+
+	// Check if we need to GET RESPONSE
+	if sw1 == 0x61 {
+		// sw2 contains the length of data available
+		getResponseCmd := []byte{0x00, 0xC0, 0x00, 0x00, sw2}
+		logging.APDUf("%s > %X", c.tag, getResponseCmd)
+		rsp, err = c.Transmit(getResponseCmd)
+		if err != nil {
+			return nil, 0, err
+		}
+		logging.APDUf("%s < %s", c.tag, logging.APDUResponse(rsp))
+
+		if len(rsp) < 2 {
+			return nil, 0, fmt.Errorf("invalid GET RESPONSE")
+		}
+
+		sw1, sw2 = rsp[len(rsp)-2], rsp[len(rsp)-1]
+	}
+
+	return rsp[:len(rsp)-2], uint16(sw1)<<8 | uint16(sw2), nil
+}
+
+// readField reads a whole field.
+func (c channel) readField(field cardField) ([]byte, error) {
+	return c.readArea(field, make([]byte, 0, field.size), nil)
+}
+
+// readArea appends up to field.size bytes of field to buf, in READ BINARY
+// chunks of at most maxReadChunk bytes. The card has the last word on the
+// length: 6Cxx is asked again with the length it gives, 6700 halves the
+// chunk for cards with smaller buffers, and a short response or 6B00, an
+// offset past the end of the file, ends the field there. done, when not
+// nil, stops the read once it reports the data complete.
+func (c channel) readArea(field cardField, buf []byte, done func([]byte) bool) ([]byte, error) {
+	data := buf[:0]
+	chunk := maxReadChunk
+
+	for len(data) < field.size {
+		le := min(field.size-len(data), chunk)
+		rsp, sw, err := c.readBinary(field.offset+uint16(len(data)), byte(le))
+		if err == nil && sw == 0x6700 && le > 1 {
+			chunk = le / 2
+			continue
+		}
+		if err == nil && sw != 0x9000 {
+			err = fmt.Errorf("read binary failed: SW=%04X", sw)
+		}
+		if err != nil {
+			if len(data) > 0 {
+				// Keep what we have; the field ends before its room does
+				break
+			}
+			return nil, err
+		}
+
+		// A card answering 6Cxx may give more than the field has room for
+		data = append(data, rsp[:min(len(rsp), field.size-len(data))]...)
+		if done != nil && done(data) {
+			break
+		}
+		if len(rsp) < le {
+			break
+		}
+	}
+
+	return data, nil
+}
+
+// photoBuffers recycles photo read buffers between reads.
+var photoBuffers = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, fieldPhoto.size)
+		return &buf
+	},
+}
+
+// readPhoto reads the JPEG photo into buf, which is reused from photoBuffers.
+func (c channel) readPhoto(buf *[]byte) ([]byte, error) {
+	// Read until the JPEG is complete rather than the whole area, so short
+	// photos skip the padding
+	photoData, err := c.readArea(fieldPhoto, *buf, func(data []byte) bool {
+		return jpegEnd(data) > 0
+	})
+	if err != nil {
+		return (*buf)[:0], err
+	}
+	if end := jpegEnd(photoData); end > 0 {
+		return photoData[:end], nil
+	}
+
+	// If no JPEG end marker found, trim trailing spaces (0x20)
+	return bytes.TrimRight(photoData, " "), nil
+}
+
+// needsRomanization reports whether the card's English name is blank or
+// contains characters that can't be part of a romanized name.
+func needsRomanization(card *domain.ThaiIdCard) bool {
+	if card.FirstNameTH == "" {
+		return false
+	}
+	if card.FirstNameEN == "" && card.LastNameEN == "" {
+		return true
+	}
+
+	for _, name := range []string{card.FirstNameEN, card.MiddleNameEN, card.LastNameEN} {
+		for _, c := range name {
+			if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || strings.ContainsRune(" .'-", c)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// romanizeNames replaces the English name with an RTGS romanization of the
+// Thai name.
+func romanizeNames(card *domain.ThaiIdCard) {
+	card.PrefixNameEN = card.PrefixStandardEN
+	card.FirstNameEN = rtgs.Romanize(card.FirstNameTH)
+	card.MiddleNameEN = rtgs.Romanize(card.MiddleNameTH)
+	card.LastNameEN = rtgs.Romanize(card.LastNameTH)
+	card.Transliterated = true
+}
+
+func decodeThaiString(data []byte) string {
+	// Thai ID cards use TIS-620 encoding
+	decoder := charmap.Windows874.NewDecoder()
+	decoded, err := decoder.Bytes(data)
+	if err != nil {
+		// Fallback to original if decoding fails
+		return string(bytes.Trim(data, "\x00"))
+	}
+	return string(bytes.Trim(decoded, "\x00"))
+}
+
+// rawString strips the NUL and space padding of a field as read.
+func rawString(s string) string {
+	return strings.TrimRight(s, "\x00 ")
+}
+
+// formatDate converts a Buddhist Era YYYYMMDD card date to an ISO 8601 date
+// in the configured calendar, plus a Thai display string if enabled. Unknown
+// months and days (00) are left out, e.g. "1947".
+func formatDate(dateStr string, format config.DateFormat) (string, string) {
+	date, ok := domain.ParseCardDate(string(bytes.Trim([]byte(dateStr), "\x00")))
+	if !ok {
+		return "", ""
+	}
+
+	display := ""
+	if format.Display {
+		display = date.ThaiDisplay()
+	}
+	return date.ISO(format.Calendar), display
+}
@@ -0,0 +1,168 @@
+package thaiid
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+// fakeCard answers the applet's READ BINARY from file the way cards in the
+// field do: short at the end of the file, 6B00 past it, and 6700 or 6Cxx to
+// an Le its buffer can't take.
+type fakeCard struct {
+	file []byte
+	// maxLe is the largest Le the card takes; 0 takes any
+	maxLe int
+	// exactLe answers 6Cxx with maxLe instead of 6700
+	exactLe bool
+	// shrinkLe answers every Le with 6Cxx for one less, as a card that
+	// never settles on a length
+	shrinkLe bool
+	// reads are the offset and Le of each READ BINARY
+	reads [][2]int
+}
+
+func (f *fakeCard) Transmit(cmd []byte) ([]byte, error) {
+	if len(cmd) != 7 || cmd[0] != 0x80 || cmd[1] != 0xB0 {
+		return []byte{0x6D, 0x00}, nil
+	}
+	offset, le := int(cmd[2])<<8|int(cmd[3]), int(cmd[6])
+	f.reads = append(f.reads, [2]int{offset, le})
+
+	if f.shrinkLe {
+		return []byte{0x6C, byte(le - 1)}, nil
+	}
+	if f.maxLe > 0 && le > f.maxLe {
+		if f.exactLe {
+			return []byte{0x6C, byte(f.maxLe)}, nil
+		}
+		return []byte{0x67, 0x00}, nil
+	}
+	if offset >= len(f.file) {
+		return []byte{0x6B, 0x00}, nil
+	}
+	data := f.file[offset:min(offset+le, len(f.file))]
+	return append(append([]byte(nil), data...), 0x90, 0x00), nil
+}
+
+// pattern returns n bytes that differ from their neighbours, so a chunk
+// appended at the wrong offset shows.
+func pattern(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*7 + i/251)
+	}
+	return data
+}
+
+func TestReadArea(t *testing.T) {
+	file := pattern(0x300)
+	tests := []struct {
+		name      string
+		card      fakeCard
+		field     cardField
+		want      []byte
+		wantReads int
+		wantErr   bool
+	}{
+		{
+			name:      "one chunk",
+			card:      fakeCard{file: file},
+			field:     cardField{0x0011, 0x64},
+			want:      file[0x11:0x75],
+			wantReads: 1,
+		},
+		{
+			name:      "reassembled from chunks",
+			card:      fakeCard{file: file},
+			field:     cardField{0x0010, 0x200},
+			want:      file[0x10:0x210],
+			wantReads: 3,
+		},
+		{
+			name:  "6700 halves the chunk",
+			card:  fakeCard{file: file, maxLe: 0x80},
+			field: cardField{0x0000, 0x100},
+			want:  file[:0x100],
+			// FF is refused, then 7F, 7F and 02 are taken
+			wantReads: 4,
+		},
+		{
+			name:  "6Cxx gives the length",
+			card:  fakeCard{file: file, maxLe: 0x20, exactLe: true},
+			field: cardField{0x0000, 0x64},
+			want:  file[:0x20],
+			// The short answer to the retry ends the field
+			wantReads: 2,
+		},
+		{
+			name:  "6Cxx is retried once",
+			card:  fakeCard{file: file, shrinkLe: true},
+			field: cardField{0x0000, 0x64},
+			// 64 asks for 63, whose answer asks for 62
+			wantReads: 2,
+			wantErr:   true,
+		},
+		{
+			name:      "file shorter than the field",
+			card:      fakeCard{file: file[:0x140]},
+			field:     cardField{0x0100, 0x200},
+			want:      file[0x100:0x140],
+			wantReads: 1,
+		},
+		{
+			name:      "6B00 after a full chunk",
+			card:      fakeCard{file: file[:0x1FE]},
+			field:     cardField{0x0000, 0x200},
+			want:      file[:0x1FE],
+			wantReads: 3,
+		},
+		{
+			name:      "6B00 at the start",
+			card:      fakeCard{file: file[:0x10]},
+			field:     cardField{0x0100, 0x08},
+			wantReads: 1,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newChannel(context.Background(), &tt.card).readField(tt.field)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readField error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("readField = % X, want % X", got, tt.want)
+			}
+			if len(tt.card.reads) != tt.wantReads {
+				t.Errorf("%d READ BINARY (%v), want %d", len(tt.card.reads), tt.card.reads, tt.wantReads)
+			}
+		})
+	}
+}
+
+func TestReadPhotoStopsAtJPEGEnd(t *testing.T) {
+	// SOI, an APP0 segment, SOS and entropy data spanning chunks, EOI, then
+	// padding to the end of the photo area
+	jpeg := []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x04, 0x01, 0x02, 0xFF, 0xDA, 0x00, 0x02}
+	jpeg = append(jpeg, bytes.Repeat([]byte{0x55, 0xFF, 0x00}, 200)...)
+	jpeg = append(jpeg, 0xFF, 0xD9)
+
+	file := make([]byte, int(fieldPhoto.offset)+fieldPhoto.size)
+	copy(file[fieldPhoto.offset:], jpeg)
+	for i := int(fieldPhoto.offset) + len(jpeg); i < len(file); i++ {
+		file[i] = ' '
+	}
+
+	card := &fakeCard{file: file}
+	got, err := ReadPhoto(context.Background(), card)
+	if err != nil {
+		t.Fatalf("ReadPhoto: %v", err)
+	}
+	if !bytes.Equal(got, jpeg) {
+		t.Errorf("ReadPhoto returned %d bytes, want the %d byte JPEG", len(got), len(jpeg))
+	}
+	if len(card.reads) != 3 {
+		t.Errorf("%d READ BINARY, want 3 up to the end of the JPEG", len(card.reads))
+	}
+}
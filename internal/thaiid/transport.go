@@ -0,0 +1,52 @@
+package thaiid
+
+import (
+	"context"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/logging"
+)
+
+// Transport carries APDUs to a card: a PC/SC connection, a serial or
+// Bluetooth link, or a reader API of a mobile app.
+type Transport interface {
+	// Transmit sends a command APDU and returns the response APDU,
+	// including the status word
+	Transmit(cmd []byte) ([]byte, error)
+}
+
+// StatusTransport is implemented by transports that know the card's ATR and
+// the reader. The reader model is the vendor's reader type when the driver
+// reports it, or else the reader name.
+type StatusTransport interface {
+	Transport
+	CardStatus() (atr []byte, reader, model string, err error)
+}
+
+// channel is a transport whose APDU log lines are tagged with the request
+// ID of the read.
+type channel struct {
+	Transport
+	tag string
+}
+
+func newChannel(ctx context.Context, t Transport) channel {
+	tag := "APDU"
+	if id := logging.RequestID(ctx); id != "" {
+		tag = "[" + id + "] APDU"
+	}
+	return channel{Transport: t, tag: tag}
+}
+
+// cardStatus returns the transport's card status; ok is false when it can't
+// tell.
+func cardStatus(t Transport) (atr []byte, reader, model string, ok bool) {
+	st, isStatus := t.(StatusTransport)
+	if c, isChannel := t.(channel); isChannel {
+		st, isStatus = c.Transport.(StatusTransport)
+	}
+	if !isStatus {
+		return nil, "", "", false
+	}
+	atr, reader, model, err := st.CardStatus()
+	return atr, reader, model, err == nil
+}
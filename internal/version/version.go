@@ -0,0 +1,38 @@
+// Package version identifies the build in logs, crash reports and the
+// diagnostics bundle.
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Version is set at build time with
+// -ldflags "-X github.com/cortex-x/go-thai-id-card-reader/internal/version.Version=...".
+var Version = "dev"
+
+// Info describes the running build.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	GoVersion string `json:"goVersion"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+}
+
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+	}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			if setting.Key == "vcs.revision" {
+				info.Commit = setting.Value
+			}
+		}
+	}
+	return info
+}
@@ -0,0 +1,326 @@
+// Package client is a Go client for the Thai ID card agent. It keeps a
+// WebSocket connection open, reconnecting and replaying missed events as
+// needed, and wraps the REST API:
+//
+//	c, err := client.New(client.Options{URL: "http://localhost:8080", Name: "his-backend"})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	go c.Run(ctx)
+//	for event := range c.Events() {
+//		if event.Type == client.EventCardInserted && event.Card != nil {
+//			log.Println(event.Card.CitizenID)
+//		}
+//	}
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	defaultMinBackoff = time.Second
+	defaultMaxBackoff = 30 * time.Second
+	eventBuffer       = 64
+	// seenWindow is how far back delivered sequence numbers are remembered
+	// to drop replays that arrive after newer live events
+	seenWindow   = 4096
+	writeTimeout = 10 * time.Second
+)
+
+// Options configure a Client.
+type Options struct {
+	// URL is the agent's base URL, e.g. http://localhost:8080
+	URL string
+	// Name and Version identify the client in HELLO
+	Name    string
+	Version string
+	// Preferences are sent in HELLO
+	Preferences Preferences
+	// Reader only receives events from this reader (name or alias)
+	Reader string
+	// Ack connects with ?ack=true and acknowledges each CARD_INSERTED once
+	// it has been taken from Events
+	Ack bool
+	// Protocols lists the subprotocols to offer, preferred first; default
+	// ProtocolV2 then ProtocolV1
+	Protocols []string
+	// MinBackoff and MaxBackoff bound the wait between reconnects, which
+	// doubles after each failed attempt; default 1s and 30s
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// HTTPClient is used for REST calls; default http.DefaultClient
+	HTTPClient *http.Client
+	// Logf receives connection state changes; default discards them
+	Logf func(format string, args ...interface{})
+	// OnConnection is called when a connection is established and when it
+	// is lost
+	OnConnection func(connected bool)
+}
+
+// Client talks to one agent. Its methods are safe for concurrent use.
+type Client struct {
+	opts    Options
+	baseURL *url.URL
+	events  chan CardEvent
+
+	mu       sync.Mutex
+	conn     *websocket.Conn
+	protocol string
+	lastSeq  uint64
+	seen     map[uint64]bool
+}
+
+// New checks the options and returns a client; call Run to connect.
+func New(opts Options) (*Client, error) {
+	base, err := url.Parse(strings.TrimRight(opts.URL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("invalid URL %q: scheme must be http or https", opts.URL)
+	}
+	if len(opts.Protocols) == 0 {
+		opts.Protocols = []string{ProtocolV2, ProtocolV1}
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = defaultMinBackoff
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = max(defaultMaxBackoff, opts.MinBackoff)
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	if opts.Logf == nil {
+		opts.Logf = func(string, ...interface{}) {}
+	}
+	if opts.OnConnection == nil {
+		opts.OnConnection = func(bool) {}
+	}
+
+	return &Client{
+		opts:    opts,
+		baseURL: base,
+		events:  make(chan CardEvent, eventBuffer),
+		seen:    make(map[uint64]bool),
+	}, nil
+}
+
+// Events returns the events received, without duplicates across
+// reconnects. Replayed events can arrive after newer live ones; Seq gives
+// their order. It's closed when Run returns.
+func (c *Client) Events() <-chan CardEvent {
+	return c.events
+}
+
+// Protocol returns the subprotocol negotiated on the current connection,
+// or "" while disconnected.
+func (c *Client) Protocol() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.protocol
+}
+
+// Run connects and delivers events until ctx is done, reconnecting after
+// failures. Events missed while disconnected are replayed as far as the
+// agent's event buffer reaches.
+func (c *Client) Run(ctx context.Context) error {
+	defer close(c.events)
+
+	backoff := c.opts.MinBackoff
+	for {
+		connected, err := c.session(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if connected {
+			backoff = c.opts.MinBackoff
+		}
+		c.opts.Logf("thaiid client: disconnected: %v, reconnecting in %v", err, backoff)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, c.opts.MaxBackoff)
+	}
+}
+
+// session runs one connection until it fails. connected reports whether
+// the connection was established.
+func (c *Client) session(ctx context.Context) (connected bool, err error) {
+	c.mu.Lock()
+	since := c.lastSeq
+	c.mu.Unlock()
+
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: 10 * time.Second,
+		Subprotocols:     c.opts.Protocols,
+	}
+	conn, _, err := dialer.DialContext(ctx, c.wsURL(since), nil)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	// Clients that ask for no subprotocol, or none the agent knows, get v1
+	protocol := conn.Subprotocol()
+	if protocol == "" {
+		protocol = ProtocolV1
+	}
+	c.mu.Lock()
+	c.conn, c.protocol = conn, protocol
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.conn, c.protocol = nil, ""
+		c.mu.Unlock()
+		c.opts.OnConnection(false)
+	}()
+	c.opts.Logf("thaiid client: connected to %s using %s", c.baseURL, protocol)
+	c.opts.OnConnection(true)
+
+	// Close the connection when ctx is done so ReadMessage returns
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	if err := c.send(command{Type: "HELLO", Payload: helloPayload{
+		Name:        c.opts.Name,
+		Version:     c.opts.Version,
+		Preferences: c.opts.Preferences,
+	}}); err != nil {
+		return true, err
+	}
+	// The URL asked for the missed events too, but an agent requiring
+	// HELLO only replays them on SINCE
+	if since > 0 {
+		if err := c.send(command{Type: "SINCE", Payload: seqPayload{Seq: since}}); err != nil {
+			return true, err
+		}
+	}
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return true, err
+		}
+		var msg envelope
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.opts.Logf("thaiid client: ignoring malformed message: %v", err)
+			continue
+		}
+		if msg.Type == "WELCOME" {
+			c.welcome(msg.Payload)
+			continue
+		}
+		if err := c.deliver(ctx, msg); err != nil {
+			return true, err
+		}
+	}
+}
+
+// deliver passes an event on, skipping events already delivered, and
+// acknowledges it in ack mode.
+func (c *Client) deliver(ctx context.Context, msg envelope) error {
+	if msg.Seq > 0 {
+		c.mu.Lock()
+		duplicate := c.seen[msg.Seq] || msg.Seq+seenWindow <= c.lastSeq
+		c.mu.Unlock()
+		if duplicate {
+			// A replay, or a resend of an event whose ACK was lost
+			return c.ack(msg)
+		}
+	}
+
+	select {
+	case c.events <- msg.decode():
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if msg.Seq > 0 {
+		c.mu.Lock()
+		c.seen[msg.Seq] = true
+		if msg.Seq > c.lastSeq {
+			c.lastSeq = msg.Seq
+		}
+		if len(c.seen) > 2*seenWindow {
+			for seq := range c.seen {
+				if seq+seenWindow <= c.lastSeq {
+					delete(c.seen, seq)
+				}
+			}
+		}
+		c.mu.Unlock()
+	}
+	return c.ack(msg)
+}
+
+// welcome handles the reply to HELLO. A current seq below the last one seen
+// means the agent restarted and numbers events from 1 again.
+func (c *Client) welcome(payload json.RawMessage) {
+	var welcome seqPayload
+	if json.Unmarshal(payload, &welcome) != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if welcome.Seq < c.lastSeq {
+		c.opts.Logf("thaiid client: agent restarted, event numbering starts over")
+		c.lastSeq = 0
+		clear(c.seen)
+	}
+}
+
+func (c *Client) ack(msg envelope) error {
+	if !c.opts.Ack || msg.Type != EventCardInserted || msg.Seq == 0 {
+		return nil
+	}
+	return c.send(command{Type: "ACK", Payload: seqPayload{Seq: msg.Seq}})
+}
+
+func (c *Client) send(cmd command) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return errors.New("not connected")
+	}
+	_ = c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return c.conn.WriteJSON(cmd)
+}
+
+func (c *Client) wsURL(since uint64) string {
+	u := *c.baseURL
+	u.Scheme = "ws"
+	if c.baseURL.Scheme == "https" {
+		u.Scheme = "wss"
+	}
+	u.Path += "/ws"
+
+	query := url.Values{}
+	if c.opts.Reader != "" {
+		query.Set("reader", c.opts.Reader)
+	}
+	if c.opts.Ack {
+		query.Set("ack", strconv.FormatBool(true))
+	}
+	if since > 0 {
+		query.Set("since", strconv.FormatUint(since, 10))
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
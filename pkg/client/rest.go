@@ -0,0 +1,151 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// APIError is an error response from the agent. Card errors carry the
+// agent's error code, e.g. 1002 when no card is inserted.
+type APIError struct {
+	StatusCode int
+	ErrorResponse
+	// Detail is the message of errors without a code, e.g. a bad request
+	Detail string
+}
+
+func (e *APIError) Error() string {
+	switch {
+	case e.Code != 0:
+		return fmt.Sprintf("agent error %d: %s", e.Code, e.Message)
+	case e.Detail != "":
+		return fmt.Sprintf("agent returned %d: %s", e.StatusCode, e.Detail)
+	}
+	return fmt.Sprintf("agent returned %d", e.StatusCode)
+}
+
+// ReadCard reads the card in reader (name or alias) on demand; an empty
+// reader reads the first reader with a card. When the read times out the
+// returned *APIError holds the fields read so far in Partial.
+func (c *Client) ReadCard(ctx context.Context, reader string) (*Card, error) {
+	body := struct {
+		Reader string `json:"reader,omitempty"`
+	}{reader}
+	var card Card
+	if err := c.do(ctx, http.MethodPost, "/read", nil, body, &card); err != nil {
+		return nil, err
+	}
+	return &card, nil
+}
+
+// RetryRead asks the agent to reset the card in reader and read it again.
+// The read is announced like an insertion, as CARD_INSERTED or ERROR.
+func (c *Client) RetryRead(ctx context.Context, reader string) error {
+	body := struct {
+		Reader string `json:"reader,omitempty"`
+	}{reader}
+	return c.do(ctx, http.MethodPost, "/card/retry", nil, body, nil)
+}
+
+// CurrentCard returns the card inserted in reader, or an *APIError with code
+// 1002 when there is none.
+func (c *Client) CurrentCard(ctx context.Context, reader string) (*Card, error) {
+	if reader == "" {
+		return nil, fmt.Errorf("no reader given; use CurrentCards for all readers")
+	}
+	var card Card
+	if err := c.do(ctx, http.MethodGet, "/card/current", url.Values{"reader": {reader}}, nil, &card); err != nil {
+		return nil, err
+	}
+	return &card, nil
+}
+
+// CurrentCards returns the cards inserted in all readers.
+func (c *Client) CurrentCards(ctx context.Context) ([]*Card, error) {
+	var cards []*Card
+	if err := c.do(ctx, http.MethodGet, "/card/current", nil, nil, &cards); err != nil {
+		return nil, err
+	}
+	return cards, nil
+}
+
+// CardPhoto returns the JPEG photo of the card inserted in reader, reading
+// it first if the agent deferred it.
+func (c *Client) CardPhoto(ctx context.Context, reader string) ([]byte, error) {
+	var photo []byte
+	if err := c.do(ctx, http.MethodGet, "/card/photo", url.Values{"reader": {reader}}, nil, &photo); err != nil {
+		return nil, err
+	}
+	return photo, nil
+}
+
+// Capabilities returns what the agent's build and configuration support.
+func (c *Client) Capabilities(ctx context.Context) (*Capabilities, error) {
+	var caps Capabilities
+	if err := c.do(ctx, http.MethodGet, "/capabilities", nil, nil, &caps); err != nil {
+		return nil, err
+	}
+	return &caps, nil
+}
+
+// Health checks that the agent is up.
+func (c *Client) Health(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, "/health", nil, nil, nil)
+}
+
+// do sends a REST request and decodes a successful response into out, or
+// copies it into out when that is a *[]byte.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	u := *c.baseURL
+	u.Path += path
+	u.RawQuery = query.Encode()
+
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.opts.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		var payload struct {
+			ErrorResponse
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&payload) == nil {
+			apiErr.ErrorResponse = payload.ErrorResponse
+			apiErr.Detail = payload.Error
+		}
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	if raw, ok := out.(*[]byte); ok {
+		*raw, err = io.ReadAll(resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
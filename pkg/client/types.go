@@ -0,0 +1,101 @@
+package client
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+)
+
+// The agent's own types, so payloads decode exactly as the agent sends them.
+type (
+	Card          = domain.ThaiIdCard
+	Address       = domain.Address
+	ErrorResponse = domain.ErrorResponse
+	Preferences   = domain.ClientPreferences
+	Capabilities  = domain.Capabilities
+)
+
+// WebSocket subprotocols the client can negotiate.
+const (
+	ProtocolV1 = domain.ProtocolV1
+	ProtocolV2 = domain.ProtocolV2
+)
+
+// Event types most clients handle; see the README for the full list.
+const (
+	EventCardInserted   = "CARD_INSERTED"
+	EventCardIdentified = "CARD_IDENTIFIED"
+	EventCardRemoved    = "CARD_REMOVED"
+	EventError          = "ERROR"
+)
+
+// CardEvent is an event broadcast by the agent.
+type CardEvent struct {
+	Seq  uint64
+	Type string
+	// Timestamp and Reader are only sent with ProtocolV2; Reader is filled
+	// from the payload with ProtocolV1 where it has one
+	Timestamp time.Time
+	Reader    string
+	// Card is set for CARD_INSERTED and CARD_IDENTIFIED, Error for ERROR
+	Card  *Card
+	Error *ErrorResponse
+	// Payload is the raw payload, for the other event types
+	Payload json.RawMessage
+}
+
+// envelope is a WebSocket message in either protocol version.
+type envelope struct {
+	Seq       uint64          `json:"seq,omitempty"`
+	Type      string          `json:"type"`
+	Timestamp string          `json:"timestamp,omitempty"`
+	Reader    string          `json:"reader,omitempty"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+type command struct {
+	Type    string      `json:"type"`
+	Payload interface{} `json:"payload"`
+}
+
+type helloPayload struct {
+	Name        string      `json:"name"`
+	Version     string      `json:"version"`
+	Preferences Preferences `json:"preferences"`
+}
+
+type seqPayload struct {
+	Seq uint64 `json:"seq"`
+}
+
+// decode turns an envelope into an event.
+func (e envelope) decode() CardEvent {
+	event := CardEvent{Seq: e.Seq, Type: e.Type, Reader: e.Reader, Payload: e.Payload}
+	if e.Timestamp != "" {
+		event.Timestamp, _ = time.Parse(time.RFC3339Nano, e.Timestamp)
+	}
+
+	switch e.Type {
+	case EventCardInserted, EventCardIdentified:
+		var card Card
+		if json.Unmarshal(e.Payload, &card) == nil {
+			event.Card = &card
+		}
+	case EventError:
+		var resp ErrorResponse
+		if json.Unmarshal(e.Payload, &resp) == nil {
+			event.Error = &resp
+		}
+	}
+
+	if event.Reader == "" {
+		var payload struct {
+			Reader string `json:"reader"`
+		}
+		if json.Unmarshal(e.Payload, &payload) == nil {
+			event.Reader = payload.Reader
+		}
+	}
+	return event
+}
@@ -0,0 +1,95 @@
+// Package geocode places card holders' addresses on the map, for the card
+// service's geocode pipeline step. The step asks the provider named in
+// geocode.provider and, when it has no answer, falls back to the approximate
+// centre of the address's province, which needs no network.
+//
+// A build that embeds the service adds its own provider, e.g. for a
+// commercial maps API, by registering it before the configuration is
+// loaded, usually from an init function:
+//
+//	func init() {
+//		geocode.Register("maps", geocode.ProviderFunc(func(ctx context.Context, addr *geocode.Address) (*geocode.Location, error) {
+//			return lookupAddress(ctx, addr.FullAddress)
+//		}))
+//	}
+//
+// and sets geocode.provider to "maps".
+package geocode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+)
+
+// Address is the parsed address of a card.
+type Address = domain.Address
+
+// Location is where an address is on the map.
+type Location = domain.GeoLocation
+
+// ErrNotFound is returned by providers that can't place an address.
+var ErrNotFound = errors.New("address not found")
+
+// Provider finds where an address is. It returns ErrNotFound when it can't
+// place it; any other error is logged. Either way the province fallback is
+// used.
+type Provider interface {
+	Geocode(ctx context.Context, addr *Address) (*Location, error)
+}
+
+// ProviderFunc adapts a function to a Provider.
+type ProviderFunc func(ctx context.Context, addr *Address) (*Location, error)
+
+func (f ProviderFunc) Geocode(ctx context.Context, addr *Address) (*Location, error) {
+	return f(ctx, addr)
+}
+
+// Built-in providers of the card service.
+const (
+	// ProviderNominatim asks a Nominatim (OpenStreetMap) server at
+	// geocode.url
+	ProviderNominatim = "nominatim"
+)
+
+var builtin = []string{ProviderNominatim}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Provider)
+)
+
+// Register makes provider available to geocode.provider as name. It panics
+// if the name is empty or already taken, as registering happens at startup.
+func Register(name string, provider Provider) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if name == "" || provider == nil {
+		panic("geocode: Register needs a name and a provider")
+	}
+	if _, ok := registry[name]; ok || slices.Contains(builtin, name) {
+		panic(fmt.Sprintf("geocode: provider %q registered twice", name))
+	}
+	registry[name] = provider
+}
+
+// Lookup returns the registered provider called name. Built-in providers
+// aren't returned, as the card service builds them from its configuration.
+func Lookup(name string) (Provider, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	provider, ok := registry[name]
+	return provider, ok
+}
+
+// Names lists the built-in and registered provider names.
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return append(slices.Clone(builtin), slices.Sorted(maps.Keys(registry))...)
+}
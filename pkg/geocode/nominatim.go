@@ -0,0 +1,87 @@
+package geocode
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/version"
+)
+
+// Nominatim looks addresses up on a Nominatim server, such as OpenStreetMap's
+// public one. Its usage policy allows at most one request per second, which
+// suits the rate cards are read at.
+type Nominatim struct {
+	url    string
+	client *http.Client
+}
+
+// NewNominatim returns a provider asking the Nominatim server at baseURL,
+// e.g. https://nominatim.openstreetmap.org.
+func NewNominatim(baseURL string, client *http.Client) *Nominatim {
+	return &Nominatim{url: strings.TrimSuffix(baseURL, "/"), client: client}
+}
+
+// nominatimPlace is the part of a search result used; coordinates are
+// strings.
+type nominatimPlace struct {
+	Lat string `json:"lat"`
+	Lon string `json:"lon"`
+}
+
+func (n *Nominatim) Geocode(ctx context.Context, addr *Address) (*Location, error) {
+	query := url.Values{
+		"q":               {addr.FullAddress},
+		"format":          {"jsonv2"},
+		"limit":           {"1"},
+		"countrycodes":    {"th"},
+		"accept-language": {"th"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, n.url+"/search?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "go-thai-id-card-reader/"+version.Version)
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		// The URL holds the address, which mustn't reach the log
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("nominatim returned %d", resp.StatusCode)
+	}
+
+	var places []nominatimPlace
+	if err := json.NewDecoder(resp.Body).Decode(&places); err != nil {
+		return nil, fmt.Errorf("invalid nominatim response: %w", err)
+	}
+	if len(places) == 0 {
+		return nil, ErrNotFound
+	}
+	lat, err := strconv.ParseFloat(places[0].Lat, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid nominatim latitude %q", places[0].Lat)
+	}
+	lon, err := strconv.ParseFloat(places[0].Lon, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid nominatim longitude %q", places[0].Lon)
+	}
+	return &Location{
+		Latitude:  lat,
+		Longitude: lon,
+		Precision: domain.PrecisionAddress,
+		Source:    ProviderNominatim,
+	}, nil
+}
@@ -0,0 +1,120 @@
+package geocode
+
+import (
+	"strings"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+)
+
+// SourceProvince is the Source of locations from ProvinceCentre.
+const SourceProvince = "province"
+
+// provinceCentres are the seats of the 77 provinces, as latitude and
+// longitude, which serve as their approximate centres.
+var provinceCentres = map[string][2]float64{
+	"กรุงเทพมหานคร":   {13.7563, 100.5018},
+	"กระบี่":          {8.0863, 98.9063},
+	"กาญจนบุรี":       {14.0228, 99.5328},
+	"กาฬสินธุ์":       {16.4322, 103.5061},
+	"กำแพงเพชร":       {16.4828, 99.5227},
+	"ขอนแก่น":         {16.4322, 102.8236},
+	"จันทบุรี":        {12.6114, 102.1039},
+	"ฉะเชิงเทรา":      {13.6904, 101.0779},
+	"ชลบุรี":          {13.3611, 100.9847},
+	"ชัยนาท":          {15.1851, 100.1251},
+	"ชัยภูมิ":         {15.8068, 102.0315},
+	"ชุมพร":           {10.4930, 99.1800},
+	"เชียงราย":        {19.9105, 99.8406},
+	"เชียงใหม่":       {18.7883, 98.9853},
+	"ตรัง":            {7.5594, 99.6114},
+	"ตราด":            {12.2428, 102.5175},
+	"ตาก":             {16.8840, 99.1259},
+	"นครนายก":         {14.2069, 101.2131},
+	"นครปฐม":          {13.8199, 100.0622},
+	"นครพนม":          {17.3920, 104.7695},
+	"นครราชสีมา":      {14.9799, 102.0978},
+	"นครศรีธรรมราช":   {8.4304, 99.9631},
+	"นครสวรรค์":       {15.7047, 100.1372},
+	"นนทบุรี":         {13.8621, 100.5144},
+	"นราธิวาส":        {6.4255, 101.8253},
+	"น่าน":            {18.7756, 100.7730},
+	"บึงกาฬ":          {18.3609, 103.6466},
+	"บุรีรัมย์":       {14.9930, 103.1029},
+	"ปทุมธานี":        {14.0208, 100.5250},
+	"ประจวบคีรีขันธ์": {11.8126, 99.7957},
+	"ปราจีนบุรี":      {14.0509, 101.3717},
+	"ปัตตานี":         {6.8696, 101.2501},
+	"พระนครศรีอยุธยา": {14.3532, 100.5684},
+	"พะเยา":           {19.1664, 99.9019},
+	"พังงา":           {8.4501, 98.5255},
+	"พัทลุง":          {7.6167, 100.0740},
+	"พิจิตร":          {16.4429, 100.3487},
+	"พิษณุโลก":        {16.8211, 100.2659},
+	"เพชรบุรี":        {13.1119, 99.9391},
+	"เพชรบูรณ์":       {16.4190, 101.1606},
+	"แพร่":            {18.1446, 100.1403},
+	"ภูเก็ต":          {7.8804, 98.3923},
+	"มหาสารคาม":       {16.1851, 103.3029},
+	"มุกดาหาร":        {16.5436, 104.7235},
+	"แม่ฮ่องสอน":      {19.3020, 97.9654},
+	"ยโสธร":           {15.7944, 104.1451},
+	"ยะลา":            {6.5411, 101.2804},
+	"ร้อยเอ็ด":        {16.0538, 103.6520},
+	"ระนอง":           {9.9529, 98.6085},
+	"ระยอง":           {12.6814, 101.2816},
+	"ราชบุรี":         {13.5283, 99.8134},
+	"ลพบุรี":          {14.7995, 100.6534},
+	"ลำปาง":           {18.2888, 99.4909},
+	"ลำพูน":           {18.5745, 99.0087},
+	"เลย":             {17.4860, 101.7223},
+	"ศรีสะเกษ":        {15.1186, 104.3220},
+	"สกลนคร":          {17.1545, 104.1348},
+	"สงขลา":           {7.1898, 100.5954},
+	"สตูล":            {6.6238, 100.0674},
+	"สมุทรปราการ":     {13.5991, 100.5998},
+	"สมุทรสงคราม":     {13.4098, 100.0023},
+	"สมุทรสาคร":       {13.5475, 100.2744},
+	"สระแก้ว":         {13.8240, 102.0646},
+	"สระบุรี":         {14.5289, 100.9101},
+	"สิงห์บุรี":       {14.8936, 100.3967},
+	"สุโขทัย":         {17.0056, 99.8264},
+	"สุพรรณบุรี":      {14.4745, 100.1177},
+	"สุราษฎร์ธานี":    {9.1382, 99.3217},
+	"สุรินทร์":        {14.8818, 103.4936},
+	"หนองคาย":         {17.8783, 102.7413},
+	"หนองบัวลำภู":     {17.2218, 102.4260},
+	"อ่างทอง":         {14.5896, 100.4551},
+	"อำนาจเจริญ":      {15.8657, 104.6258},
+	"อุดรธานี":        {17.4138, 102.7872},
+	"อุตรดิตถ์":       {17.6200, 100.0993},
+	"อุทัยธานี":       {15.3835, 100.0246},
+	"อุบลราชธานี":     {15.2287, 104.8564},
+}
+
+// provinceAliases are other ways cards and people write province names.
+var provinceAliases = map[string]string{
+	"กรุงเทพฯ": "กรุงเทพมหานคร",
+	"กรุงเทพ":  "กรุงเทพมหานคร",
+	"กทม.":     "กรุงเทพมหานคร",
+	"อยุธยา":   "พระนครศรีอยุธยา",
+}
+
+// ProvinceCentre returns the approximate centre of the province named
+// province, with or without its จังหวัด prefix. It needs no network, so it
+// works as the fallback of every provider.
+func ProvinceCentre(province string) (*Location, bool) {
+	name := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(province), "จังหวัด"))
+	if alias, ok := provinceAliases[name]; ok {
+		name = alias
+	}
+	centre, ok := provinceCentres[name]
+	if !ok {
+		return nil, false
+	}
+	return &Location{
+		Latitude:  centre[0],
+		Longitude: centre[1],
+		Precision: domain.PrecisionProvince,
+		Source:    SourceProvince,
+	}, true
+}
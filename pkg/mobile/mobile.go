@@ -0,0 +1,128 @@
+// Package mobile exposes the Thai ID card reading core to Android and iOS
+// apps through gomobile:
+//
+//	gomobile bind -target=android ./pkg/mobile
+//	gomobile bind -target=ios ./pkg/mobile
+//
+// The app implements Transport over its own reader API, e.g. a USB-OTG CCID
+// reader through Android's UsbDeviceConnection or TKSmartCard on iOS, and
+// gets the same APDU flow and parsing as the card service. Only types
+// gomobile can bind are used in the API.
+package mobile
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/config"
+	"github.com/cortex-x/go-thai-id-card-reader/internal/thaiid"
+)
+
+// Transport sends APDUs to the card. Transmit returns the response APDU,
+// including the status word.
+type Transport interface {
+	Transmit(apdu []byte) ([]byte, error)
+}
+
+// Options control what is read and how dates are given.
+type Options struct {
+	// Photo reads the card photo, which takes most of the read time
+	Photo bool
+	// Transliterate romanizes the Thai name when the card's English name is
+	// blank or garbled
+	Transliterate bool
+	// Calendar of the ISO dates: "gregorian" or "buddhist"
+	Calendar string
+	// ThaiDates fills the Thai display dates in JSON, e.g. "1 มกราคม 2533"
+	ThaiDates bool
+}
+
+// NewOptions returns the defaults: photo read, Gregorian dates.
+func NewOptions() *Options {
+	return &Options{Photo: true, Calendar: "gregorian"}
+}
+
+// Card is the data read from a card. JSON holds every field, in the same
+// form as the card service's CARD_INSERTED payload.
+type Card struct {
+	CitizenID    string
+	PrefixTH     string
+	FirstNameTH  string
+	MiddleNameTH string
+	LastNameTH   string
+	PrefixEN     string
+	FirstNameEN  string
+	MiddleNameEN string
+	LastNameEN   string
+	DateOfBirth  string
+	// Gender is male, female or unspecified
+	Gender     string
+	IssueDate  string
+	ExpireDate string
+	Address    string
+	// Photo is the JPEG photo, empty when not read
+	Photo []byte
+	JSON  string
+}
+
+// ReadCard reads the card on t. A nil opts uses NewOptions.
+func ReadCard(t Transport, opts *Options) (*Card, error) {
+	if t == nil {
+		return nil, fmt.Errorf("no transport")
+	}
+	if opts == nil {
+		opts = NewOptions()
+	}
+	calendar := strings.ToLower(opts.Calendar)
+	if calendar == "" {
+		calendar = "gregorian"
+	}
+	if calendar != "gregorian" && calendar != "buddhist" {
+		return nil, fmt.Errorf("unknown calendar %q", opts.Calendar)
+	}
+
+	date := config.DateFormat{Calendar: calendar, Display: opts.ThaiDates}
+	reader := thaiid.NewReader(thaiid.Options{
+		Dates: config.DatesConfig{DateOfBirth: date, IssueDate: date, ExpireDate: date},
+		Gender: config.GenderConfig{
+			Labels:      map[string]string{"1": "male", "2": "female"},
+			Unspecified: "unspecified",
+		},
+		Transliterate: opts.Transliterate,
+		Photo:         opts.Photo,
+	})
+
+	data, err := reader.Read(context.Background(), "", t, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	card := &Card{
+		CitizenID:    data.CitizenID,
+		PrefixTH:     data.PrefixNameTH,
+		FirstNameTH:  data.FirstNameTH,
+		MiddleNameTH: data.MiddleNameTH,
+		LastNameTH:   data.LastNameTH,
+		PrefixEN:     data.PrefixNameEN,
+		FirstNameEN:  data.FirstNameEN,
+		MiddleNameEN: data.MiddleNameEN,
+		LastNameEN:   data.LastNameEN,
+		DateOfBirth:  data.DateOfBirth,
+		Gender:       data.Gender,
+		IssueDate:    data.IssueDate,
+		ExpireDate:   data.ExpireDate,
+	}
+	if data.Address != nil {
+		card.Address = data.Address.FullAddress
+	}
+	if data.PhotoBase64 != "" {
+		card.Photo, _ = base64.StdEncoding.DecodeString(data.PhotoBase64)
+	}
+	if encoded, err := json.Marshal(data); err == nil {
+		card.JSON = string(encoded)
+	}
+	return card, nil
+}
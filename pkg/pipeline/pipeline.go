@@ -0,0 +1,127 @@
+// Package pipeline runs card data through processing steps after each
+// successful read, before the card is stored and announced. The card
+// service runs the steps named in pipeline.steps, in that order: its
+// built-in steps and any a custom build registers.
+//
+// A build that embeds the service adds its own steps by registering them
+// before the configuration is loaded, usually from an init function:
+//
+//	func init() {
+//		pipeline.Register("badge", pipeline.StepFunc(func(ctx context.Context, card *pipeline.Card) error {
+//			card.Directory = map[string]string{"badge": lookupBadge(card.CitizenID)}
+//			return nil
+//		}))
+//	}
+//
+// and lists "badge" in pipeline.steps.
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/cortex-x/go-thai-id-card-reader/internal/domain"
+)
+
+// Card is the card data passed through the steps.
+type Card = domain.ThaiIdCard
+
+// Step processes a card. It may change the card in place; returning an error
+// rejects the card, which is then reported as error 1010 instead of being
+// announced.
+type Step interface {
+	Process(ctx context.Context, card *Card) error
+}
+
+// StepFunc adapts a function to a Step.
+type StepFunc func(ctx context.Context, card *Card) error
+
+func (f StepFunc) Process(ctx context.Context, card *Card) error {
+	return f(ctx, card)
+}
+
+// Built-in steps of the card service.
+const (
+	// StepValidate rejects cards whose citizen ID check digit is wrong
+	StepValidate = "validate"
+	// StepEnrich adds the holder's LDAP attributes when ldap.url is set
+	StepEnrich = "enrich"
+	// StepGeocode adds the location of the holder's address; see package
+	// geocode
+	StepGeocode = "geocode"
+)
+
+var builtin = []string{StepValidate, StepEnrich, StepGeocode}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Step)
+)
+
+// Register makes step available to pipeline.steps as name. It panics if the
+// name is empty or already taken, as registering happens at startup.
+func Register(name string, step Step) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if name == "" || step == nil {
+		panic("pipeline: Register needs a name and a step")
+	}
+	if _, ok := registry[name]; ok || slices.Contains(builtin, name) {
+		panic(fmt.Sprintf("pipeline: step %q registered twice", name))
+	}
+	registry[name] = step
+}
+
+// Lookup returns the registered step called name. Built-in steps aren't
+// returned, as the card service builds them from its configuration.
+func Lookup(name string) (Step, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	step, ok := registry[name]
+	return step, ok
+}
+
+// Names lists the built-in and registered step names.
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return append(slices.Clone(builtin), slices.Sorted(maps.Keys(registry))...)
+}
+
+// Pipeline is an ordered list of steps. The zero value and nil run no
+// steps.
+type Pipeline struct {
+	names []string
+	steps []Step
+}
+
+// Add appends step, called name in errors and logs.
+func (p *Pipeline) Add(name string, step Step) {
+	p.names = append(p.names, name)
+	p.steps = append(p.steps, step)
+}
+
+// Steps returns the names of the steps in the order they run.
+func (p *Pipeline) Steps() []string {
+	if p == nil {
+		return nil
+	}
+	return slices.Clone(p.names)
+}
+
+// Run passes card through each step in turn, stopping at the first that
+// rejects it. The error is a *domain.CardRejectedError naming that step.
+func (p *Pipeline) Run(ctx context.Context, card *Card) error {
+	if p == nil {
+		return nil
+	}
+	for i, step := range p.steps {
+		if err := step.Process(ctx, card); err != nil {
+			return &domain.CardRejectedError{Step: p.names[i], Err: err}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+// Package web holds the browser assets served by the card service. They are
+// compiled into the binary so a deployment is a single executable.
+package web
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed static
+var static embed.FS
+
+// Static returns the files under static/, e.g. index.html.
+func Static() fs.FS {
+	sub, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}